@@ -0,0 +1,188 @@
+/*
+Copyright © 2019 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/crashlog"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	buildRE     = regexp.MustCompile(`^\d{2}[A-Z]\d{1,5}[a-z]?$`)
+	dscSuffixRE = regexp.MustCompile(`^dyld_shared_cache_[a-z0-9_]+$`)
+)
+
+func init() {
+	rootCmd.AddCommand(crashCmd)
+}
+
+// crashCmd represents the crash command
+var crashCmd = &cobra.Command{
+	Use:   "crash",
+	Short: "Work with crash logs",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// findCachesByBuild returns the dyld_shared_caches in dir by the OS build in their path
+func findCachesByBuild(dir string) (map[string][]string, error) {
+	caches := make(map[string][]string)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !dscSuffixRE.MatchString(info.Name()) {
+			return nil // skip the sub-caches, .map and .symbols files
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+			build := strings.SplitN(part, "__", 2)[0]
+			if buildRE.MatchString(build) {
+				caches[build] = append(caches[build], path)
+				break
+			}
+		}
+		return nil
+	})
+
+	return caches, err
+}
+
+// pickCache returns the dyld_shared_cache matching the arch of the crashlog's images
+func pickCache(caches []string, c *crashlog.CrashLog) string {
+	for _, img := range c.Images {
+		for _, cache := range caches {
+			if strings.HasSuffix(cache, "_"+img.Arch) {
+				return cache
+			}
+		}
+	}
+	return caches[0]
+}
+
+// walkCrashLogs opens every crash log in the roots (files or directories), symbolicates its crashed thread
+// with the dyld_shared_cache for its OS build (and/or the binaries in binsDir) and passes it to fn.
+// It returns the number of files that weren't crash logs
+func walkCrashLogs(roots []string, cachesDir, binsDir string, fn func(path string, c *crashlog.CrashLog)) (int, error) {
+	// group the crash logs by OS build so each dyld_shared_cache is only opened once
+	byBuild := make(map[string][]string)
+	skipped := 0
+	for _, root := range roots {
+		if err := filepath.Walk(filepath.Clean(root), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			c, err := crashlog.Open(path)
+			if err != nil {
+				log.WithField("file", path).Debugf("skipping: %v", err)
+				skipped++
+				return nil
+			}
+			byBuild[c.OSBuild] = append(byBuild[c.OSBuild], path)
+			c.Close()
+			return nil
+		}); err != nil {
+			return skipped, errors.Wrapf(err, "failed to walk %s", root)
+		}
+	}
+
+	var caches map[string][]string
+	if len(cachesDir) > 0 {
+		var err error
+		caches, err = findCachesByBuild(cachesDir)
+		if err != nil {
+			return skipped, errors.Wrapf(err, "failed to find dyld_shared_caches in %s", cachesDir)
+		}
+	}
+
+	var bins *crashlog.BinaryIndex
+	if len(binsDir) > 0 {
+		var err error
+		bins, err = crashlog.IndexBinaries(binsDir)
+		if err != nil {
+			return skipped, err
+		}
+		defer bins.Close()
+	}
+
+	var builds []string
+	for build := range byBuild {
+		builds = append(builds, build)
+	}
+	sort.Strings(builds)
+
+	for _, build := range builds {
+		var f *dyld.File
+		parsed := make(map[string]bool)
+
+		for _, path := range byBuild[build] {
+			c, err := crashlog.Open(path)
+			if err != nil {
+				if f != nil {
+					f.Close()
+				}
+				return skipped, err
+			}
+			if f == nil && len(caches[build]) > 0 {
+				cache := pickCache(caches[build], c)
+				log.WithField("build", build).Infof("Symbolicating %d crash logs with %s", len(byBuild[build]), cache)
+				if f, err = openSymbolicateCache(cache); err != nil {
+					c.Close()
+					return skipped, err
+				}
+			}
+			if f != nil || bins != nil {
+				if _, err := symbolicateCrashLog(c, f, bins, parsed, true); err != nil {
+					log.WithField("file", path).Errorf("failed to symbolicate: %v", err)
+				}
+			}
+			fn(path, c)
+			c.Close()
+		}
+
+		if f != nil {
+			f.Close()
+		} else if len(cachesDir) > 0 {
+			log.WithField("build", build).Warn("no dyld_shared_cache found")
+		}
+	}
+
+	return skipped, nil
+}
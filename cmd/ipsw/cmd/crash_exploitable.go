@@ -0,0 +1,84 @@
+/*
+Copyright © 2019 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/crashlog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	crashCmd.AddCommand(crashExploitableCmd)
+
+	crashExploitableCmd.Flags().StringP("caches", "c", "", "Directory of dyld_shared_caches (i.e. extracted by 'ipsw extract --dyld' into <build>__<devices> folders)")
+	crashExploitableCmd.Flags().StringP("bins", "b", "", "Directory of Mach-Os/dSYMs to symbolicate non dyld_shared_cache images with (matched by UUID)")
+	crashExploitableCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
+	crashExploitableCmd.Flags().BoolP("json", "j", false, "Output the ratings as JSON")
+}
+
+type exploitableReport struct {
+	Path string `json:"path"`
+	*crashlog.Exploitability
+}
+
+// crashExploitableCmd represents the crash exploitable command
+var crashExploitableCmd = &cobra.Command{
+	Use:     "exploitable <crashlog|dir>...",
+	Aliases: []string{"analyze"},
+	Short:   "Rate how likely crashes are to be exploitable",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		cachesDir, _ := cmd.Flags().GetString("caches")
+		binsDir, _ := cmd.Flags().GetString("bins")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		var reports []exploitableReport
+		skipped, err := walkCrashLogs(args, cachesDir, binsDir, func(path string, c *crashlog.CrashLog) {
+			reports = append(reports, exploitableReport{Path: path, Exploitability: c.Exploitability()})
+		})
+		if err != nil {
+			return err
+		}
+		if skipped > 0 {
+			log.Warnf("Skipped %d files that aren't crash logs", skipped)
+		}
+
+		if asJSON {
+			return printJSON(reports)
+		}
+
+		for _, r := range reports {
+			fmt.Printf("%s: %s", r.Path, r.Exploitability)
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
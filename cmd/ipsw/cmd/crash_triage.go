@@ -0,0 +1,127 @@
+/*
+Copyright © 2019 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/crashlog"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	crashCmd.AddCommand(crashTriageCmd)
+
+	crashTriageCmd.Flags().StringP("caches", "c", "", "Directory of dyld_shared_caches (i.e. extracted by 'ipsw extract --dyld' into <build>__<devices> folders)")
+	crashTriageCmd.Flags().StringP("bins", "b", "", "Directory of Mach-Os/dSYMs to symbolicate non dyld_shared_cache images with (matched by UUID)")
+	crashTriageCmd.Flags().IntP("frames", "n", crashlog.DefaultSignatureFrames, "Number of crashing thread frames in the crash signature")
+	crashTriageCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
+	crashTriageCmd.Flags().BoolP("json", "j", false, "Output the buckets as JSON")
+	crashTriageCmd.Flags().String("sqlite", "", "Write the buckets to a SQLite database")
+}
+
+// crashTriageCmd represents the crash triage command
+var crashTriageCmd = &cobra.Command{
+	Use:   "triage <dir>",
+	Short: "Bucket a directory of crash logs by crash signature",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		cachesDir, _ := cmd.Flags().GetString("caches")
+		binsDir, _ := cmd.Flags().GetString("bins")
+		frames, _ := cmd.Flags().GetInt("frames")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		sqlitePath, _ := cmd.Flags().GetString("sqlite")
+
+		triage := crashlog.NewTriage(frames)
+
+		skipped, err := walkCrashLogs(args, cachesDir, binsDir, func(path string, c *crashlog.CrashLog) {
+			triage.Add(path, c)
+		})
+		if err != nil {
+			return err
+		}
+
+		buckets := triage.Buckets()
+
+		total := 0
+		for _, b := range buckets {
+			total += b.Count
+		}
+		log.Infof("Bucketed %d crash logs into %d buckets (skipped %d files)", total, len(buckets), skipped)
+
+		if len(sqlitePath) > 0 {
+			if err := crashlog.WriteSQLite(sqlitePath, buckets); err != nil {
+				return err
+			}
+			log.Infof("Created %s", sqlitePath)
+			return nil
+		}
+
+		if asJSON {
+			return printJSON(buckets)
+		}
+
+		var data [][]string
+		for _, b := range buckets {
+			var top string
+			if len(b.Frames) > 0 {
+				top = b.Frames[0]
+			}
+			data = append(data, []string{
+				b.ID,
+				strconv.Itoa(b.Count),
+				b.Exploitability.String(),
+				b.ExceptionType,
+				top,
+				strings.Join(b.Builds, ", "),
+				strings.Join(b.Devices, ", "),
+				b.Representative,
+			})
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Bucket", "Count", "Rating", "Exception", "Top Frame", "Builds", "Devices", "Representative"})
+		table.SetAutoWrapText(false)
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetCenterSeparator("|")
+		table.AppendBulk(data)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.Render()
+
+		fmt.Println()
+		for _, b := range buckets {
+			fmt.Printf("%s:\n    %s\n", b.ID, strings.ReplaceAll(b.Signature, "\n", "\n    "))
+		}
+
+		return nil
+	},
+}
@@ -50,6 +50,7 @@ func init() {
 
 	deviceTreeCmd.PersistentFlags().String("proxy", "", "HTTP/HTTPS proxy")
 	deviceTreeCmd.PersistentFlags().Bool("insecure", false, "do not verify ssl certs")
+	addRemoteCacheFlags(deviceTreeCmd.PersistentFlags())
 
 	deviceTreeCmd.Flags().BoolVarP(&jsonFlag, "json", "j", false, "Output to stdout as JSON")
 	deviceTreeCmd.Flags().BoolVarP(&remoteFlag, "remote", "r", false, "Extract from URL")
@@ -75,6 +76,7 @@ var deviceTreeCmd = &cobra.Command{
 			zr, err := download.NewRemoteZipReader(args[0], &download.RemoteConfig{
 				Proxy:    proxy,
 				Insecure: insecure,
+				Cache:    remoteCache(cmd),
 			})
 			if err != nil {
 				return errors.Wrap(err, "failed to create new remote zip reader")
@@ -32,6 +32,7 @@ import (
 	"github.com/apex/log"
 	"github.com/blacktop/go-arm64"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
 	"github.com/blacktop/ipsw/internal/demangle"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/pkg/errors"
@@ -54,6 +55,7 @@ func init() {
 	disCmd.PersistentFlags().Uint64P("instrs", "i", 0, "Number of instructions to disassemble")
 	disCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
 	disCmd.Flags().StringVarP(&symbolMapFile, "companion", "c", "", "Companion symbol map file")
+	disCmd.Flags().StringP("kdk", "k", "", "Kernel Debug Kit kernel to symbolicate a kernelcache with")
 	disCmd.MarkZshCompPositionalArgumentFile(1)
 }
 
@@ -387,6 +389,20 @@ var disCmd = &cobra.Command{
 			symbolMap = make(map[uint64]string)
 		}
 
+		kdkPath, _ := cmd.Flags().GetString("kdk")
+		// kernelcaches are symbolicated from their symbolsets and kext exports (and the KDK if supplied)
+		if m.FileTOC.FileHeader.Type == types.FileSet || m.Section("__PRELINK_INFO", "__info") != nil || len(kdkPath) > 0 {
+			ks, err := getKernelSymbolicator(m, kdkPath)
+			if err != nil {
+				return errors.Wrapf(err, "failed to symbolicate kernelcache")
+			}
+			for addr, name := range ks.Symbols {
+				if _, ok := symbolMap[addr]; !ok {
+					symbolMap[addr] = name
+				}
+			}
+		}
+
 		err = parseImports(m)
 		if err != nil {
 			return errors.Wrapf(err, "failed to parse imports")
@@ -10,8 +10,10 @@ import (
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/download"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -19,14 +21,15 @@ func init() {
 	rootCmd.AddCommand(downloadCmd)
 
 	// Persistent Flags which will work for this command and all subcommands
-	downloadCmd.PersistentFlags().String("proxy", "", "HTTP/HTTPS proxy")
-	downloadCmd.PersistentFlags().Bool("insecure", false, "do not verify ssl certs")
+	addDownloadManagerFlags(downloadCmd.PersistentFlags())
+	downloadCmd.PersistentFlags().String("mirror", viper.GetString("IPSW_MIRROR"), "Base URL of an 'ipsw mirror serve' mirror to use instead of ipsw.me/iTunes")
 	// Filters
 	downloadCmd.PersistentFlags().StringArrayP("black-list", "", []string{viper.GetString("IPSW_DEVICE_BLACKLIST")}, "iOS device black list")
 	downloadCmd.PersistentFlags().StringArrayP("white-list", "", []string{viper.GetString("IPSW_DEVICE_WHITELIST")}, "iOS device white list")
 	downloadCmd.PersistentFlags().BoolP("yes", "y", false, "do not prompt user")
 	downloadCmd.PersistentFlags().BoolP("skip-all", "s", false, "Always skip resumable IPSWs")
 	downloadCmd.PersistentFlags().BoolP("remove-commas", "_", false, "replace commas in IPSW filename with underscores")
+	addRemoteCacheFlags(downloadCmd.PersistentFlags())
 	downloadCmd.PersistentFlags().StringP("version", "v", viper.GetString("IPSW_VERSION"), "iOS Version (i.e. 12.3.1)")
 	downloadCmd.PersistentFlags().StringP("device", "d", viper.GetString("IPSW_DEVICE"), "iOS Device (i.e. iPhone11,2)")
 	downloadCmd.PersistentFlags().StringP("build", "b", viper.GetString("IPSW_BUILD"), "iOS BuildID (i.e. 16F203)")
@@ -56,6 +59,12 @@ func checkCanIJailbreak(version string) {
 	}
 }
 
+// newDownloadAPI creates the ipsw.me/iTunes API client (of the --mirror if one is given)
+func newDownloadAPI(cmd *cobra.Command) *download.API {
+	mirrorURL, _ := cmd.Flags().GetString("mirror")
+	return download.NewAPI(mirrorURL)
+}
+
 func filterIPSWs(cmd *cobra.Command) ([]download.IPSW, error) {
 
 	var err error
@@ -69,21 +78,23 @@ func filterIPSWs(cmd *cobra.Command) ([]download.IPSW, error) {
 	doNotDownload, _ := cmd.Flags().GetStringArray("black-list")
 	build, _ := cmd.Flags().GetString("build")
 
+	api := newDownloadAPI(cmd)
+
 	if len(version) > 0 && len(build) > 0 {
 		log.Fatal("you cannot supply a --version AND a --build (they are mutually exclusive)")
 	}
 
 	if len(version) > 0 {
-		ipsws, err = download.GetAllIPSW(version)
+		ipsws, err = api.GetAllIPSW(version)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to query ipsw.me api")
 		}
 	} else if len(build) > 0 {
-		version, err = download.GetVersion(build)
+		version, err = api.GetVersion(build)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to query ipsw.me api")
 		}
-		ipsws, err = download.GetAllIPSW(version)
+		ipsws, err = api.GetAllIPSW(version)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to query ipsw.me api")
 		}
@@ -129,6 +140,105 @@ func filterIPSWs(cmd *cobra.Command) ([]download.IPSW, error) {
 	return uniqueIPSWs, nil
 }
 
+// addDownloadManagerFlags adds the flags of the download manager
+func addDownloadManagerFlags(flags *pflag.FlagSet) {
+	flags.String("proxy", "", "HTTP/HTTPS proxy")
+	flags.Bool("insecure", false, "do not verify ssl certs")
+	flags.IntP("parallel", "P", 1, "Number of files to download at once")
+	flags.Int("segments", 4, "Number of parallel byte-range segments to split each file into")
+	flags.String("limit", "", "Global bandwidth limit per second (i.e. 10MB)")
+	flags.Int("retries", 5, "Number of times to retry a failed request")
+}
+
+// newDownloadManager creates a download manager from the download flags
+func newDownloadManager(cmd *cobra.Command) (*download.Manager, error) {
+	proxy, _ := cmd.Flags().GetString("proxy")
+	insecure, _ := cmd.Flags().GetBool("insecure")
+	skipAll, _ := cmd.Flags().GetBool("skip-all")
+	confirm, _ := cmd.Flags().GetBool("yes")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	segments, _ := cmd.Flags().GetInt("segments")
+	limit, _ := cmd.Flags().GetString("limit")
+	retries, _ := cmd.Flags().GetInt("retries")
+
+	m := download.NewManager(proxy, insecure)
+	m.Parallel = parallel
+	m.Segments = segments
+	m.Retries = retries
+	m.SkipResumable = skipAll
+	// only the (interactive) download commands have --yes
+	m.Prompt = cmd.Flags().Lookup("yes") != nil && !confirm
+
+	if len(limit) > 0 {
+		bps, err := humanize.ParseBytes(limit)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse --limit %s", limit)
+		}
+		m.SetRateLimit(int64(bps))
+	}
+
+	return m, nil
+}
+
+// addRemoteCacheFlags adds the flags of the remote zip block cache
+func addRemoteCacheFlags(flags *pflag.FlagSet) {
+	flags.String("cache-dir", viper.GetString("IPSW_CACHE_DIR"), "Remote zip block cache directory (default is the user cache dir)")
+	flags.String("cache-size", "1GB", "Max size of the remote zip block cache")
+	flags.Bool("no-cache", false, "Do not cache remote zip reads")
+}
+
+// remoteCache opens the remote zip block cache from the cache flags (returns nil if it is disabled or fails to open)
+func remoteCache(cmd *cobra.Command) *download.BlockCache {
+	cacheDir, _ := cmd.Flags().GetString("cache-dir")
+	cacheSize, _ := cmd.Flags().GetString("cache-size")
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+
+	if noCache {
+		return nil
+	}
+	if len(cacheDir) == 0 {
+		cacheDir = download.DefaultBlockCacheDir()
+	}
+
+	size := download.DefaultBlockCacheSize
+	if len(cacheSize) > 0 {
+		bytes, err := humanize.ParseBytes(cacheSize)
+		if err != nil {
+			log.WithError(err).Warnf("failed to parse --cache-size %s (using default)", cacheSize)
+		} else {
+			size = int64(bytes)
+		}
+	}
+
+	cache, err := download.OpenBlockCache(cacheDir, size)
+	if err != nil {
+		log.WithError(err).Warn("failed to open remote zip block cache (not caching)")
+		return nil
+	}
+
+	return cache
+}
+
+// appendChecksums appends the sha1 and filename of the downloaded jobs to the checksums file
+func appendChecksums(jobs []download.Job) error {
+	f, err := os.OpenFile("checksums.txt.sha1", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open checksums.txt.sha1")
+	}
+	defer f.Close()
+
+	for _, job := range jobs {
+		if _, err := os.Stat(job.DestName); err != nil || len(job.Sha1) == 0 {
+			continue // failed or skipped
+		}
+		if _, err = f.WriteString(job.Sha1 + "  " + job.DestName + "\n"); err != nil {
+			return errors.Wrap(err, "failed to write to checksums.txt.sha1")
+		}
+	}
+
+	return nil
+}
+
 func getDestName(url string, removeCommas bool) string {
 	var destName string
 	if removeCommas {
@@ -149,10 +259,7 @@ var downloadCmd = &cobra.Command{
 			log.SetLevel(log.DebugLevel)
 		}
 
-		proxy, _ := cmd.Flags().GetString("proxy")
-		insecure, _ := cmd.Flags().GetBool("insecure")
 		confirm, _ := cmd.Flags().GetBool("yes")
-		skipAll, _ := cmd.Flags().GetBool("skip-all")
 		removeCommas, _ := cmd.Flags().GetBool("remove-commas")
 
 		ipsws, err := filterIPSWs(cmd)
@@ -178,6 +285,11 @@ var downloadCmd = &cobra.Command{
 		}
 
 		if cont {
+			downloader, err := newDownloadManager(cmd)
+			if err != nil {
+				return err
+			}
+			var jobs []download.Job
 			for _, i := range ipsws {
 				destName := getDestName(i.URL, removeCommas)
 				if _, err := os.Stat(destName); os.IsNotExist(err) {
@@ -187,31 +299,22 @@ var downloadCmd = &cobra.Command{
 						"version": i.Version,
 						"signed":  i.Signed,
 					}).Info("Getting IPSW")
-
-					downloader := download.NewDownload(proxy, insecure, skipAll)
-					downloader.URL = i.URL
-					downloader.Sha1 = i.SHA1
-					downloader.DestName = destName
-
-					err = downloader.Do()
-					if err != nil {
-						return errors.Wrap(err, "failed to download file")
-					}
-
-					// append sha1 and filename to checksums file
-					f, err := os.OpenFile("checksums.txt.sha1", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
-					if err != nil {
-						return errors.Wrap(err, "failed to open checksums.txt.sha1")
-					}
-					defer f.Close()
-
-					if _, err = f.WriteString(i.SHA1 + "  " + destName + "\n"); err != nil {
-						return errors.Wrap(err, "failed to write to checksums.txt.sha1")
-					}
+					jobs = append(jobs, download.Job{
+						URL:      i.URL,
+						Sha1:     i.SHA1,
+						DestName: destName,
+					})
 				} else {
 					log.Warnf("ipsw already exists: %s", destName)
 				}
 			}
+			err = downloader.Do(jobs...)
+			if err := appendChecksums(jobs); err != nil {
+				return err
+			}
+			if err != nil {
+				return errors.Wrap(err, "failed to download file")
+			}
 		}
 		return nil
 	},
@@ -69,6 +69,7 @@ var downloadKernelCmd = &cobra.Command{
 			utils.Indent(log.Debug, 2)(i.URL)
 		}
 
+		cache := remoteCache(cmd)
 		g := new(errgroup.Group)
 
 		for _, i := range ipsws {
@@ -83,6 +84,7 @@ var downloadKernelCmd = &cobra.Command{
 				zr, err := download.NewRemoteZipReader(i.URL, &download.RemoteConfig{
 					Proxy:    proxy,
 					Insecure: insecure,
+					Cache:    cache,
 				})
 				if err != nil {
 					return errors.Wrap(err, "failed to create remote zip reader of ipsw")
@@ -53,10 +53,7 @@ var latestCmd = &cobra.Command{
 		var builds []download.Build
 		var filteredBuilds []download.Build
 
-		proxy, _ := cmd.Flags().GetString("proxy")
-		insecure, _ := cmd.Flags().GetBool("insecure")
 		confirm, _ := cmd.Flags().GetBool("yes")
-		skipAll, _ := cmd.Flags().GetBool("skip-all")
 		removeCommas, _ := cmd.Flags().GetBool("remove-commas")
 
 		// filters
@@ -66,7 +63,7 @@ var latestCmd = &cobra.Command{
 
 		iosInfo, _ := cmd.Flags().GetBool("info")
 
-		itunes, err := download.NewiTunesVersionMaster()
+		itunes, err := newDownloadAPI(cmd).NewiTunesVersionMaster()
 		if err != nil {
 			return errors.Wrap(err, "failed to create itunes API")
 		}
@@ -118,7 +115,11 @@ var latestCmd = &cobra.Command{
 		}
 
 		if cont {
-			downloader := download.NewDownload(proxy, insecure, skipAll)
+			downloader, err := newDownloadManager(cmd)
+			if err != nil {
+				return err
+			}
+			var jobs []download.Job
 			for _, build := range filteredBuilds {
 				destName := getDestName(build.FirmwareURL, removeCommas)
 				if _, err := os.Stat(destName); os.IsNotExist(err) {
@@ -127,27 +128,22 @@ var latestCmd = &cobra.Command{
 						"build":   build.BuildVersion,
 						"version": build.ProductVersion,
 					}).Info("Getting IPSW")
-					// download file
-					downloader.URL = build.FirmwareURL
-					downloader.Sha1 = build.FirmwareSHA1
-					downloader.DestName = destName
-					err = downloader.Do()
-					if err != nil {
-						return errors.Wrap(err, "failed to download file")
-					}
-					// append sha1 and filename to checksums file
-					f, err := os.OpenFile("checksums.txt.sha1", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
-					if err != nil {
-						return errors.Wrap(err, "failed to open checksums.txt.sha1")
-					}
-					defer f.Close()
-					if _, err = f.WriteString(build.FirmwareSHA1 + "  " + destName + "\n"); err != nil {
-						return errors.Wrap(err, "failed to write to checksums.txt.sha1")
-					}
+					jobs = append(jobs, download.Job{
+						URL:      build.FirmwareURL,
+						Sha1:     build.FirmwareSHA1,
+						DestName: destName,
+					})
 				} else {
 					log.Warnf("ipsw already exists: %s", destName)
 				}
 			}
+			err = downloader.Do(jobs...)
+			if err := appendChecksums(jobs); err != nil {
+				return err
+			}
+			if err != nil {
+				return errors.Wrap(err, "failed to download file")
+			}
 		}
 
 		return nil
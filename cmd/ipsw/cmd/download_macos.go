@@ -149,6 +149,7 @@ var macosCmd = &cobra.Command{
 
 		if cont {
 			if remoteKernel {
+				cache := remoteCache(cmd)
 				for _, build := range filteredBuilds {
 					log.WithFields(log.Fields{
 						"device":  build.Identifier,
@@ -158,6 +159,7 @@ var macosCmd = &cobra.Command{
 					zr, err := download.NewRemoteZipReader(build.FirmwareURL, &download.RemoteConfig{
 						Proxy:    proxy,
 						Insecure: insecure,
+						Cache:    cache,
 					})
 					if err != nil {
 						return errors.Wrap(err, "failed to open remote zip to OTA")
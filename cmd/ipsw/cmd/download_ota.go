@@ -62,7 +62,6 @@ var otaDLCmd = &cobra.Command{
 		proxy, _ := cmd.Flags().GetString("proxy")
 		insecure, _ := cmd.Flags().GetBool("insecure")
 		confirm, _ := cmd.Flags().GetBool("yes")
-		skipAll, _ := cmd.Flags().GetBool("skip-all")
 
 		// filters
 		device, _ := cmd.Flags().GetString("device")
@@ -120,6 +119,7 @@ var otaDLCmd = &cobra.Command{
 
 		if cont {
 			if remoteDyld || remoteKernel {
+				cache := remoteCache(cmd)
 				for _, o := range otas {
 					log.WithFields(log.Fields{
 						"device":  strings.Join(o.SupportedDevices, " "),
@@ -129,6 +129,7 @@ var otaDLCmd = &cobra.Command{
 					zr, err := download.NewRemoteZipReader(o.BaseURL+o.RelativePath, &download.RemoteConfig{
 						Proxy:    proxy,
 						Insecure: insecure,
+						Cache:    cache,
 					})
 					if err != nil {
 						return fmt.Errorf("failed to open remote zip to OTA: %v", err)
@@ -149,7 +150,11 @@ var otaDLCmd = &cobra.Command{
 					}
 				}
 			} else {
-				downloader := download.NewDownload(proxy, insecure, skipAll)
+				downloader, err := newDownloadManager(cmd)
+				if err != nil {
+					return err
+				}
+				var jobs []download.Job
 				for _, o := range otas {
 					url := o.BaseURL + o.RelativePath
 					destName := strings.Replace(path.Base(url), ",", "_", -1)
@@ -159,17 +164,20 @@ var otaDLCmd = &cobra.Command{
 							"build":   o.Build,
 							"version": o.DocumentationID,
 						}).Info("Getting OTA")
-						// download file
-						downloader.URL = url
-						downloader.DestName = destName
-						err = downloader.Do()
-						if err != nil {
-							return fmt.Errorf("failed to download file: %v", err)
-						}
+						sha1sum, sha256sum := o.Checksums()
+						jobs = append(jobs, download.Job{
+							URL:      url,
+							DestName: destName,
+							Sha1:     sha1sum,
+							Sha256:   sha256sum,
+						})
 					} else {
 						log.Warnf("ota already exists: %s", destName)
 					}
 				}
+				if err := downloader.Do(jobs...); err != nil {
+					return fmt.Errorf("failed to download file: %v", err)
+				}
 			}
 		}
 
@@ -66,6 +66,7 @@ var patternCmd = &cobra.Command{
 			utils.Indent(log.Debug, 2)(i.URL)
 		}
 
+		cache := remoteCache(cmd)
 		for _, i := range ipsws {
 
 			log.WithFields(log.Fields{
@@ -78,6 +79,7 @@ var patternCmd = &cobra.Command{
 			zr, err := download.NewRemoteZipReader(i.URL, &download.RemoteConfig{
 				Proxy:    proxy,
 				Insecure: insecure,
+				Cache:    cache,
 			})
 			if err != nil {
 				return errors.Wrap(err, "failed to download kernelcaches from remote ipsw")
@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/demangle"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/pkg/errors"
@@ -39,6 +40,7 @@ func init() {
 	a2sCmd.Flags().Uint64P("slide", "s", 0, "dyld_shared_cache slide to apply")
 	a2sCmd.Flags().BoolP("image", "i", false, "Only lookup address's dyld_shared_cache mapping")
 	a2sCmd.Flags().BoolP("mapping", "m", false, "Only lookup address's image segment/section")
+	a2sCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
 
 	a2sCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
@@ -234,12 +236,18 @@ var a2sCmd = &cobra.Command{
 		}
 
 		if symName, ok := f.AddressToSymbol[unslidAddr]; ok {
+			if demangleFlag {
+				symName = demangle.Do(symName, false, false)
+			}
 			fmt.Printf("\n%#x: %s\n", addr, symName)
 			return nil
 		}
 
 		if fn, err := m.GetFunctionForVMAddr(unslidAddr); err == nil {
 			if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+				if demangleFlag {
+					symName = demangle.Do(symName, false, false)
+				}
 				fmt.Printf("\n%#x: %s + %d\n", addr, symName, unslidAddr-fn.StartAddr)
 				return nil
 			}
@@ -0,0 +1,144 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldClosureCmd)
+
+	dyldClosureCmd.Flags().BoolP("dlopen", "l", false, "Lookup dlopen closure image instead of a launch closure")
+	dyldClosureCmd.Flags().BoolP("fixups", "f", false, "Dump rebase and bind fixups")
+	dyldClosureCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	dyldClosureCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+}
+
+// dyldClosureCmd represents the closure command
+var dyldClosureCmd = &cobra.Command{
+	Use:   "closure [options] <dyld_shared_cache> <path>",
+	Short: "Dump dyld3 launch/dlopen closure for a path",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		dlopen, _ := cmd.Flags().GetBool("dlopen")
+		showFixups, _ := cmd.Flags().GetBool("fixups")
+		outAsJSON, _ := cmd.Flags().GetBool("json")
+
+		dscPath, err := resolveDSCPath(args[0])
+		if err != nil {
+			return err
+		}
+
+		f, err := dyld.Open(dscPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var images []*dyld.ClosureImage
+		var closure *dyld.Closure
+
+		if dlopen {
+			img, err := f.GetDlopenImage(args[1])
+			if err != nil {
+				return err
+			}
+			images = append(images, img)
+		} else {
+			closure, err = f.GetLaunchClosure(args[1])
+			if err != nil {
+				return err
+			}
+			if closure.Images != nil {
+				images = closure.Images.Images
+			}
+		}
+
+		if outAsJSON {
+			var j []byte
+			if closure != nil {
+				j, err = json.MarshalIndent(closure, "", "    ")
+			} else {
+				j, err = json.MarshalIndent(images[0], "", "    ")
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
+		}
+
+		if closure != nil {
+			fmt.Println(closure)
+			if order := f.ClosureInitOrder(closure); len(order) > 0 {
+				fmt.Println("Initializer Order")
+				fmt.Println("=================")
+				for idx, path := range order {
+					fmt.Printf("%4d: %s\n", idx+1, path)
+				}
+				fmt.Println()
+			}
+		}
+
+		for _, img := range images {
+			fmt.Println(img)
+			if len(img.Dependents) > 0 {
+				fmt.Println("  dependent paths:")
+				for _, dep := range img.Dependents {
+					fmt.Printf("    %s (%s)\n", f.ClosureImagePath(closure, dep.ImageNum()), dep.Kind())
+				}
+			}
+			if showFixups {
+				if rebases := img.Rebases(); len(rebases) > 0 {
+					fmt.Println("  rebases:")
+					for _, off := range rebases {
+						fmt.Printf("    %#08x\n", off)
+					}
+				}
+				if binds := img.Binds(); len(binds) > 0 {
+					fmt.Println("  binds:")
+					for _, bind := range binds {
+						target := bind.Target.String()
+						if bind.Target.Kind() == dyld.ImageTarget {
+							target = fmt.Sprintf("%s+%#x", f.ClosureImagePath(closure, bind.Target.ImageNum()), bind.Target.Offset())
+						}
+						fmt.Printf("    %#08x -> %s\n", bind.Offset, target)
+					}
+				}
+			}
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldDiffCmd)
+
+	dyldDiffCmd.Flags().StringArrayP("image", "i", []string{}, "Only diff images matching this name (can be used multiple times)")
+	dyldDiffCmd.Flags().Bool("no-exports", false, "Do NOT diff exported symbols")
+	dyldDiffCmd.Flags().Bool("no-objc", false, "Do NOT diff ObjC classes, selectors and protocols")
+	dyldDiffCmd.Flags().Bool("no-funcs", false, "Do NOT diff function sizes")
+	dyldDiffCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	dyldDiffCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+	dyldDiffCmd.MarkZshCompPositionalArgumentFile(2, "dyld_shared_cache*")
+}
+
+// resolveDSCPath follows the dyld_shared_cache symlink found in extracted IPSWs
+func resolveDSCPath(path string) (string, error) {
+	dscPath := filepath.Clean(path)
+
+	if _, err := os.Lstat(dscPath); err != nil {
+		return "", fmt.Errorf("file %s does not exist", dscPath)
+	}
+
+	dscPath, err := filepath.EvalSymlinks(dscPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve symlink %s", path)
+	}
+
+	return dscPath, nil
+}
+
+// dyldDiffCmd represents the diff command
+var dyldDiffCmd = &cobra.Command{
+	Use:   "diff [options] <old_dyld_shared_cache> <new_dyld_shared_cache>",
+	Short: "Diff two dyld_shared_caches",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		images, _ := cmd.Flags().GetStringArray("image")
+		noExports, _ := cmd.Flags().GetBool("no-exports")
+		noObjC, _ := cmd.Flags().GetBool("no-objc")
+		noFuncs, _ := cmd.Flags().GetBool("no-funcs")
+		outAsJSON, _ := cmd.Flags().GetBool("json")
+
+		oldPath, err := resolveDSCPath(args[0])
+		if err != nil {
+			return err
+		}
+		newPath, err := resolveDSCPath(args[1])
+		if err != nil {
+			return err
+		}
+
+		oldDSC, err := dyld.Open(oldPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", oldPath)
+		}
+		defer oldDSC.Close()
+
+		newDSC, err := dyld.Open(newPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", newPath)
+		}
+		defer newDSC.Close()
+
+		log.Info("Diffing dyld_shared_caches...")
+		diff, err := dyld.Diff(oldDSC, newDSC, &dyld.DiffConfig{
+			Images:    images,
+			Exports:   !noExports,
+			ObjC:      !noObjC,
+			Functions: !noFuncs,
+		})
+		if err != nil {
+			return err
+		}
+
+		if outAsJSON {
+			j, err := json.MarshalIndent(diff, "", "    ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
+		}
+
+		fmt.Println(diff)
+
+		return nil
+	},
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/symscript"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldExportSymbolsCmd)
+
+	dyldExportSymbolsCmd.Flags().StringP("format", "f", "ida", fmt.Sprintf("Output format (%s)", strings.Join(symscript.Formats, ", ")))
+	dyldExportSymbolsCmd.Flags().StringP("output", "o", "", "Output file (default is stdout)")
+	dyldExportSymbolsCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+}
+
+// dyldExportSymbolsCmd represents the export-symbols command
+var dyldExportSymbolsCmd = &cobra.Command{
+	Use:   "export-symbols [options] <dyld_shared_cache> <image>",
+	Short: "Generate a disassembler script to name an image's symbols",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		dscPath, err := resolveDSCPath(args[0])
+		if err != nil {
+			return err
+		}
+
+		f, err := dyld.Open(dscPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		image := f.Image(args[1])
+		if image == nil {
+			return fmt.Errorf("image %s not in %s", args[1], dscPath)
+		}
+
+		log.WithField("image", image.Name).Info("Collecting symbols")
+		syms, err := f.GetImageSymbols(image)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if len(output) > 0 {
+			of, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer of.Close()
+			w = of
+		}
+
+		if err := symscript.Write(w, format, syms); err != nil {
+			return err
+		}
+
+		if len(output) > 0 {
+			log.WithFields(log.Fields{
+				"count": len(syms),
+				"file":  output,
+			}).Info("Wrote symbols")
+		}
+
+		return nil
+	},
+}
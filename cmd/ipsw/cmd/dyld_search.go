@@ -0,0 +1,146 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldSearchCmd)
+
+	dyldSearchCmd.Flags().BoolP("glob", "g", false, "Treat pattern as a glob instead of a regex")
+	dyldSearchCmd.Flags().StringArrayP("image", "i", []string{}, "Only search images matching this name (can be used multiple times)")
+	dyldSearchCmd.Flags().BoolP("reexports", "r", false, "Follow re-exported symbols to their implementation")
+	dyldSearchCmd.Flags().Bool("weak", false, "Only show weak definition exports")
+	dyldSearchCmd.Flags().Bool("tlv", false, "Only show thread local exports")
+	dyldSearchCmd.Flags().Bool("resolver", false, "Only show exports with a resolver function")
+	dyldSearchCmd.Flags().Bool("absolute", false, "Only show absolute exports")
+	dyldSearchCmd.Flags().Bool("no-exports", false, "Do NOT search exported symbols")
+	dyldSearchCmd.Flags().Bool("no-locals", false, "Do NOT search local symbols")
+	dyldSearchCmd.Flags().Bool("no-objc", false, "Do NOT search ObjC methods")
+	dyldSearchCmd.Flags().String("start", "", "Start of address range to search")
+	dyldSearchCmd.Flags().String("end", "", "End of address range to search")
+	dyldSearchCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
+	dyldSearchCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+}
+
+// dyldSearchCmd represents the search command
+var dyldSearchCmd = &cobra.Command{
+	Use:   "search [options] <dyld_shared_cache> [pattern]",
+	Short: "Search dyld_shared_cache symbols by name, flags or address range",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		glob, _ := cmd.Flags().GetBool("glob")
+		images, _ := cmd.Flags().GetStringArray("image")
+		followReExports, _ := cmd.Flags().GetBool("reexports")
+		weak, _ := cmd.Flags().GetBool("weak")
+		tlv, _ := cmd.Flags().GetBool("tlv")
+		resolver, _ := cmd.Flags().GetBool("resolver")
+		absolute, _ := cmd.Flags().GetBool("absolute")
+		noExports, _ := cmd.Flags().GetBool("no-exports")
+		noLocals, _ := cmd.Flags().GetBool("no-locals")
+		noObjC, _ := cmd.Flags().GetBool("no-objc")
+		startStr, _ := cmd.Flags().GetString("start")
+		endStr, _ := cmd.Flags().GetString("end")
+
+		query := &dyld.SearchQuery{
+			Glob:            glob,
+			Images:          images,
+			Weak:            weak,
+			ThreadLocal:     tlv,
+			Resolver:        resolver,
+			Absolute:        absolute,
+			FollowReExports: followReExports,
+			Exports:         !noExports,
+			Locals:          !noLocals,
+			ObjC:            !noObjC,
+		}
+
+		if len(args) > 1 {
+			query.Pattern = args[1]
+		}
+
+		if len(startStr) > 0 || len(endStr) > 0 {
+			if len(startStr) == 0 || len(endStr) == 0 {
+				return fmt.Errorf("you must supply both --start and --end")
+			}
+			start, err := utils.ConvertStrToInt(startStr)
+			if err != nil {
+				return err
+			}
+			end, err := utils.ConvertStrToInt(endStr)
+			if err != nil {
+				return err
+			}
+			query.StartAddr = start
+			query.EndAddr = end
+		}
+
+		if len(query.Pattern) == 0 && query.EndAddr == 0 && len(images) == 0 {
+			return fmt.Errorf("you must supply a pattern, an address range or an image to search")
+		}
+
+		dscPath, err := resolveDSCPath(args[0])
+		if err != nil {
+			return err
+		}
+
+		f, err := dyld.Open(dscPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		results, err := f.Search(query)
+		if err != nil {
+			return err
+		}
+
+		if demangleFlag {
+			for idx := range results {
+				results[idx].Name = demangle.Do(results[idx].Name, false, false)
+			}
+		}
+
+		j, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(j))
+
+		return nil
+	},
+}
@@ -28,6 +28,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/demangle"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/pkg/errors"
@@ -39,6 +40,7 @@ func init() {
 
 	symaddrCmd.Flags().BoolP("all", "a", false, "Find all symbol matches")
 	symaddrCmd.Flags().StringP("image", "i", "", "dylib image to search")
+	symaddrCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
 	// symaddrCmd.Flags().StringP("cache", "c", "", "path to addr to sym cache file")
 	symaddrCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
@@ -103,6 +105,9 @@ var symaddrCmd = &cobra.Command{
 							sym.Address = rexpSym.Address
 						}
 					}
+					if demangleFlag {
+						sym.Name = demangle.Do(sym.Name, false, false)
+					}
 					fmt.Println(sym)
 
 					if !allMatches {
@@ -112,6 +117,9 @@ var symaddrCmd = &cobra.Command{
 
 				if sym, _ := f.FindLocalSymbolInImage(args[1], imageName); sym != nil {
 					sym.Sections = m.Sections
+					if demangleFlag {
+						sym.Name = demangle.Do(sym.Name, false, false)
+					}
 					fmt.Println(sym)
 				}
 
@@ -123,6 +131,9 @@ var symaddrCmd = &cobra.Command{
 			 **********************************/
 			log.Warn("searching in local symbols...")
 			if lSym, _ := f.FindLocalSymbol(args[1]); lSym != nil {
+				if demangleFlag {
+					lSym.Name = demangle.Do(lSym.Name, false, false)
+				}
 				fmt.Println(lSym)
 			}
 			log.Warn("searching in exported symbols...")
@@ -146,6 +157,9 @@ var symaddrCmd = &cobra.Command{
 							sym.Address = rexpSym.Address
 						}
 					}
+					if demangleFlag {
+						sym.Name = demangle.Do(sym.Name, false, false)
+					}
 					fmt.Println(sym)
 
 					if !allMatches {
@@ -177,6 +191,9 @@ var symaddrCmd = &cobra.Command{
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
 			for _, sym := range f.Image(imageName).LocalSymbols {
 				sym.Sections = m.Sections
+				if demangleFlag {
+					sym.Name = demangle.Do(sym.Name, false, false)
+				}
 				fmt.Fprintf(w, "%s\n", sym)
 			}
 			w.Flush()
@@ -198,6 +215,9 @@ var symaddrCmd = &cobra.Command{
 					if sym.Sect > 0 && int(sym.Sect) <= len(m.Sections) {
 						sec = fmt.Sprintf("%s.%s", m.Sections[sym.Sect-1].Seg, m.Sections[sym.Sect-1].Name)
 					}
+					if demangleFlag {
+						sym.Name = demangle.Do(sym.Name, false, false)
+					}
 					fmt.Fprintf(w, "%#016x:\t(%s)\t%s\n", sym.Value, sym.Type.String(sec), sym.Name)
 				}
 				w.Flush()
@@ -229,6 +249,9 @@ var symaddrCmd = &cobra.Command{
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
 			for _, sym := range image.LocalSymbols {
 				sym.Sections = m.Sections
+				if demangleFlag {
+					sym.Name = demangle.Do(sym.Name, false, false)
+				}
 				fmt.Fprintf(w, "%s\n", sym)
 			}
 			w.Flush()
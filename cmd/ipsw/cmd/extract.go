@@ -50,6 +50,7 @@ func init() {
 	extractCmd.Flags().Bool("insecure", false, "do not verify ssl certs")
 
 	extractCmd.Flags().BoolP("remote", "r", false, "Extract from URL")
+	addRemoteCacheFlags(extractCmd.Flags())
 	extractCmd.Flags().BoolP("kernel", "k", false, "Extract kernelcache")
 	extractCmd.Flags().BoolP("dyld", "d", false, "Extract dyld_shared_cache")
 	extractCmd.Flags().BoolP("dtree", "t", false, "Extract DeviceTree")
@@ -109,6 +110,7 @@ var extractCmd = &cobra.Command{
 			zr, err := download.NewRemoteZipReader(args[0], &download.RemoteConfig{
 				Proxy:    proxy,
 				Insecure: insecure,
+				Cache:    remoteCache(cmd),
 			})
 			if err != nil {
 				return errors.Wrap(err, "failed to download kernelcaches from remote ipsw")
@@ -22,6 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/blacktop/go-macho"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -38,3 +45,29 @@ var kernelcacheCmd = &cobra.Command{
 		cmd.Help()
 	},
 }
+
+// openKernelcache opens the kernelcache MachO at path
+func openKernelcache(path string) (*macho.File, error) {
+	kcPath := filepath.Clean(path)
+
+	if _, err := os.Stat(kcPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("file %s does not exist", path)
+	}
+
+	m, err := macho.Open(kcPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", kcPath)
+	}
+
+	return m, nil
+}
+
+// printJSON prints v as indented JSON
+func printJSON(v interface{}) error {
+	j, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(j))
+	return nil
+}
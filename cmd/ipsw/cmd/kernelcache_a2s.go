@@ -0,0 +1,120 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	kernelcacheCmd.AddCommand(kernelA2sCmd)
+
+	kernelA2sCmd.Flags().StringP("kdk", "k", "", "Kernel Debug Kit kernel to carry symbols over from")
+	kernelA2sCmd.Flags().BoolP("demangle", "d", false, "Demangle symbol names")
+	kernelA2sCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// getKernelSymbolicator builds the symbolicator for a kernelcache and an optional KDK kernel
+func getKernelSymbolicator(m *macho.File, kdkPath string) (*kernelcache.Symbolicator, error) {
+	var kdk *macho.File
+	if len(kdkPath) > 0 {
+		var err error
+		kdk, err = macho.Open(kdkPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open KDK kernel %s", kdkPath)
+		}
+		defer kdk.Close()
+	}
+
+	log.Info("Symbolicating kernelcache...")
+	s, err := kernelcache.NewSymbolicator(m, kdk)
+	if err != nil {
+		return nil, err
+	}
+
+	for source, count := range s.Stats {
+		log.WithField("source", source).Debugf("%d symbols", count)
+	}
+
+	return s, nil
+}
+
+// kernelA2sCmd represents the kernel a2s command
+var kernelA2sCmd = &cobra.Command{
+	Use:   "a2s <kernelcache> <vaddr>",
+	Short: "Lookup the symbol (and kext) at a kernelcache address",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		kdkPath, _ := cmd.Flags().GetString("kdk")
+		doDemangle, _ := cmd.Flags().GetBool("demangle")
+
+		addr, err := strconv.ParseUint(args[1], 0, 64)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse address %s", args[1])
+		}
+
+		m, err := openKernelcache(args[0])
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		s, err := getKernelSymbolicator(m, kdkPath)
+		if err != nil {
+			return err
+		}
+
+		owner := s.Owner(addr)
+		if len(owner) == 0 {
+			return fmt.Errorf("address %#x not in any kext", addr)
+		}
+
+		name, off, ok := s.Lookup(addr)
+		if !ok {
+			fmt.Printf("%#x: ? (%s)\n", addr, owner)
+			return nil
+		}
+		if doDemangle {
+			name = demangle.Do(name, false, false)
+		}
+		if off > 0 {
+			fmt.Printf("%#x: %s + %d (%s)\n", addr, name, off, owner)
+		} else {
+			fmt.Printf("%#x: %s (%s)\n", addr, name, owner)
+		}
+
+		return nil
+	},
+}
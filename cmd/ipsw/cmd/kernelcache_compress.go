@@ -0,0 +1,115 @@
+/*
+Copyright © 2019 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	kernelcacheCmd.AddCommand(kernelCompressCmd)
+
+	kernelCompressCmd.Flags().Bool("lzss", false, "Compress with LZSS (comp/lzss header)")
+	kernelCompressCmd.Flags().Bool("lzfse", false, "Compress with LZFSE (default)")
+	kernelCompressCmd.Flags().Bool("im4p", false, "Wrap the compressed kernelcache in an IM4P")
+	kernelCompressCmd.Flags().String("version", "KernelCacheBuilder", "IM4P version string")
+	kernelCompressCmd.Flags().StringP("output", "o", "", "Output file")
+	kernelCompressCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// kernelCompressCmd represents the kernel compress command
+var kernelCompressCmd = &cobra.Command{
+	Use:   "compress <macho>",
+	Short: "Compress a (patched) kernelcache and optionally wrap it in an IM4P",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		useLZSS, _ := cmd.Flags().GetBool("lzss")
+		useLZFSE, _ := cmd.Flags().GetBool("lzfse")
+		wrapIm4p, _ := cmd.Flags().GetBool("im4p")
+		version, _ := cmd.Flags().GetString("version")
+		outPath, _ := cmd.Flags().GetString("output")
+
+		if useLZSS && useLZFSE {
+			return fmt.Errorf("you can only use one of --lzss OR --lzfse")
+		}
+
+		m, err := openKernelcache(args[0])
+		if err != nil {
+			return err
+		}
+		m.Close()
+
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", args[0])
+		}
+
+		var comp []byte
+		var ext string
+		if useLZSS {
+			log.Info("Compressing kernelcache with LZSS")
+			comp, err = kernelcache.CompressLZSS(data)
+			ext = ".lzss"
+		} else {
+			log.Info("Compressing kernelcache with LZFSE")
+			comp, err = kernelcache.CompressLZFSE(data)
+			ext = ".lzfse"
+		}
+		if err != nil {
+			return err
+		}
+
+		if wrapIm4p {
+			comp, err = kernelcache.CreateImg4Data(comp, version)
+			if err != nil {
+				return err
+			}
+			ext = ".im4p"
+		}
+
+		if len(outPath) == 0 {
+			outPath = args[0] + ext
+		}
+
+		if err := ioutil.WriteFile(outPath, comp, 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %s", outPath)
+		}
+
+		log.WithFields(log.Fields{
+			"size":       len(data),
+			"compressed": len(comp),
+		}).Info("Created " + outPath)
+
+		return nil
+	},
+}
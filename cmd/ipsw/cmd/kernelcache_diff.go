@@ -22,32 +22,89 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	kernelcacheCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringArrayP("kext", "k", []string{}, "Only diff kexts matching this bundle ID (can be used multiple times)")
+	diffCmd.Flags().Bool("no-symbols", false, "Do NOT diff kext symbols and function counts")
+	diffCmd.Flags().Bool("no-strings", false, "Do NOT diff assert/panic strings")
+	diffCmd.Flags().Bool("no-sysctls", false, "Do NOT diff sysctls")
+	diffCmd.Flags().Bool("no-syscalls", false, "Do NOT diff the syscall and mach trap tables")
+	diffCmd.Flags().Bool("no-sandbox", false, "Do NOT diff sandbox operations")
+	diffCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	diffCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+	diffCmd.MarkZshCompPositionalArgumentFile(2, "kernelcache*")
 }
 
 // diffCmd represents the diff command
 var diffCmd = &cobra.Command{
-	Use:   "diff",
-	Short: "🚧 diff kernelcache (using assert strings)",
-	// Long:   longDesc,
-	Args:   cobra.MinimumNArgs(1),
-	Hidden: true,
+	Use:   "diff [options] <old_kernelcache> <new_kernelcache>",
+	Short: "Diff two kernelcaches",
+	Args:  cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
+
 		if Verbose {
 			log.SetLevel(log.DebugLevel)
 		}
-		if _, err := os.Stat(args[0]); os.IsNotExist(err) {
-			return fmt.Errorf("file %s does not exist", args[0])
+
+		kexts, _ := cmd.Flags().GetStringArray("kext")
+		noSymbols, _ := cmd.Flags().GetBool("no-symbols")
+		noStrings, _ := cmd.Flags().GetBool("no-strings")
+		noSysctls, _ := cmd.Flags().GetBool("no-sysctls")
+		noSyscalls, _ := cmd.Flags().GetBool("no-syscalls")
+		noSandbox, _ := cmd.Flags().GetBool("no-sandbox")
+		outAsJSON, _ := cmd.Flags().GetBool("json")
+
+		var kcs []*macho.File
+		for _, arg := range args {
+			kcPath := filepath.Clean(arg)
+			if _, err := os.Stat(kcPath); os.IsNotExist(err) {
+				return fmt.Errorf("file %s does not exist", arg)
+			}
+			m, err := macho.Open(kcPath)
+			if err != nil {
+				return errors.Wrapf(err, "failed to open %s", kcPath)
+			}
+			defer m.Close()
+			kcs = append(kcs, m)
+		}
+
+		log.Info("Diffing kernelcaches...")
+		diff, err := kernelcache.Diff(kcs[0], kcs[1], &kernelcache.DiffConfig{
+			Kexts:    kexts,
+			Symbols:  !noSymbols,
+			Strings:  !noStrings,
+			Sysctls:  !noSysctls,
+			Syscalls: !noSyscalls,
+			Sandbox:  !noSandbox,
+		})
+		if err != nil {
+			return err
+		}
+
+		if outAsJSON {
+			j, err := json.MarshalIndent(diff, "", "    ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
 		}
-		return kernelcache.ParseMachO(args[0])
+
+		fmt.Println(diff)
+
+		return nil
 	},
 }
@@ -0,0 +1,125 @@
+/*
+Copyright © 2019 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	kernelcacheCmd.AddCommand(kernelInfoCmd)
+
+	kernelInfoCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelInfoCmd.Flags().StringP("ipsw", "i", "", "IPSW the kernelcache came from (to list the supported devices)")
+	kernelInfoCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// getKernelCacheDevices returns the devices of the IPSW's kernelcache that kcPath was extracted from
+func getKernelCacheDevices(ipswPath, kcPath string) ([]string, error) {
+	i, err := info.Parse(ipswPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse ipsw info")
+	}
+
+	base := strings.TrimSuffix(filepath.Base(kcPath), ".decompressed")
+	for _, kcaches := range i.Plists.BuildManifest.GetKernelCaches() {
+		for _, kc := range kcaches {
+			// extracted kernelcaches are renamed to <kernelcache>.<devices>
+			if base == kc || strings.HasPrefix(base, strings.TrimSuffix(kc, filepath.Ext(kc))+".") {
+				return i.GetDevicesForKernelCache(kc), nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("failed to find kernelcache %s in %s", base, ipswPath)
+}
+
+// kernelInfoCmd represents the kernel info command
+var kernelInfoCmd = &cobra.Command{
+	Use:   "info <kernelcache>",
+	Short: "Display kernelcache version, build and layout information",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		asJSON, _ := cmd.Flags().GetBool("json")
+		ipswPath, _ := cmd.Flags().GetString("ipsw")
+
+		kcPath := filepath.Clean(args[0])
+		if _, err := os.Stat(kcPath); os.IsNotExist(err) {
+			return fmt.Errorf("file %s does not exist", kcPath)
+		}
+
+		data, err := ioutil.ReadFile(kcPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", kcPath)
+		}
+
+		dec, packing, err := kernelcache.Unpack(data)
+		if err != nil {
+			return err
+		}
+
+		m, err := macho.NewFile(bytes.NewReader(dec))
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse kernelcache %s", kcPath)
+		}
+		defer m.Close()
+
+		kinfo, err := kernelcache.GetInfo(m)
+		if err != nil {
+			return err
+		}
+		kinfo.Compression = packing.Compression
+		kinfo.Im4p = packing.Im4p
+
+		if len(ipswPath) > 0 {
+			kinfo.Devices, err = getKernelCacheDevices(ipswPath, kcPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if asJSON {
+			return printJSON(kinfo)
+		}
+
+		fmt.Print(kinfo)
+
+		return nil
+	},
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/symscript"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	kernelcacheCmd.AddCommand(iokitCmd)
+
+	iokitCmd.Flags().BoolP("json", "j", false, "Output classes as JSON")
+	iokitCmd.Flags().BoolP("methods", "m", false, "Also print each class's virtual methods")
+	iokitCmd.Flags().StringP("format", "f", "", fmt.Sprintf("Output a disassembler script instead (%s)", strings.Join(symscript.Formats, ", ")))
+	iokitCmd.Flags().StringP("output", "o", "", "Output file (default is stdout)")
+	iokitCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+func printIOKitTree(w io.Writer, class *kernelcache.IOKitClass, children map[string][]*kernelcache.IOKitClass, depth int, methods bool) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%s%s\n", indent, class)
+	if methods {
+		for _, m := range class.Methods {
+			if !m.Inherited {
+				fmt.Fprintf(w, "%s    %4d: %#x %s\n", indent, m.Index, m.Addr, m.Demangled())
+			}
+		}
+	}
+	for _, child := range children[class.Name] {
+		printIOKitTree(w, child, children, depth+1, methods)
+	}
+}
+
+// iokitCmd represents the iokit command
+var iokitCmd = &cobra.Command{
+	Use:   "iokit <kernelcache>",
+	Short: "Dump the IOKit class hierarchy and vtables",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		outAsJSON, _ := cmd.Flags().GetBool("json")
+		showMethods, _ := cmd.Flags().GetBool("methods")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		m, err := openKernelcache(args[0])
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		log.Info("Recovering IOKit classes...")
+		classes, err := kernelcache.GetIOKitClasses(m)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if len(output) > 0 {
+			of, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer of.Close()
+			w = of
+		}
+
+		switch {
+		case len(format) > 0:
+			if err := symscript.Write(w, format, kernelcache.IOKitSymbols(classes)); err != nil {
+				return err
+			}
+		case outAsJSON:
+			j, err := json.MarshalIndent(classes, "", "    ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, string(j))
+		default:
+			children := make(map[string][]*kernelcache.IOKitClass)
+			known := make(map[string]bool)
+			for _, c := range classes {
+				known[c.Name] = true
+			}
+			var roots []*kernelcache.IOKitClass
+			for _, c := range classes {
+				if len(c.Super) == 0 || !known[c.Super] || c.Super == c.Name {
+					roots = append(roots, c)
+				} else {
+					children[c.Super] = append(children[c.Super], c)
+				}
+			}
+			sort.Slice(roots, func(i, j int) bool { return roots[i].Name < roots[j].Name })
+			for _, root := range roots {
+				printIOKitTree(w, root, children, 0, showMethods)
+			}
+		}
+
+		if len(output) > 0 {
+			log.WithFields(log.Fields{
+				"classes": len(classes),
+				"file":    output,
+			}).Info("Wrote IOKit classes")
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	kernelcacheCmd.AddCommand(kextCmd)
+	kextCmd.AddCommand(kextExtractCmd)
+
+	kextExtractCmd.Flags().BoolP("all", "a", false, "Extract all kexts")
+	kextExtractCmd.Flags().StringP("output", "o", "", "Directory to extract the kexts to")
+	kextExtractCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// kextCmd represents the kext command
+var kextCmd = &cobra.Command{
+	Use:   "kext",
+	Short: "Kernel extension commands",
+}
+
+// kextExtractCmd represents the kext extract command
+var kextExtractCmd = &cobra.Command{
+	Use:   "extract <kernelcache> [bundle-id]",
+	Short: "Extract kexts from a kernelcache as standalone MachOs",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		all, _ := cmd.Flags().GetBool("all")
+		output, _ := cmd.Flags().GetString("output")
+
+		if !all && len(args) < 2 {
+			return fmt.Errorf("you must supply a kext bundle ID or use --all")
+		} else if all && len(args) > 1 {
+			return fmt.Errorf("you cannot supply a kext bundle ID and use --all")
+		}
+
+		kcPath := filepath.Clean(args[0])
+
+		if _, err := os.Stat(kcPath); os.IsNotExist(err) {
+			return fmt.Errorf("file %s does not exist", args[0])
+		}
+
+		m, err := macho.Open(kcPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", kcPath)
+		}
+		defer m.Close()
+
+		kexts, err := kernelcache.GetKexts(m)
+		if err != nil {
+			return err
+		}
+
+		if len(output) == 0 {
+			output = filepath.Dir(kcPath)
+		}
+		if err := os.MkdirAll(output, 0755); err != nil {
+			return err
+		}
+
+		found := false
+		for _, k := range kexts {
+			if all && k.ID == kernelcache.KernelID {
+				continue // the kernel isn't a kext
+			}
+			if !all && !strings.EqualFold(k.ID, args[1]) {
+				continue
+			}
+			found = true
+			data, err := kernelcache.ExtractKext(m, k)
+			if err != nil {
+				if all {
+					log.Errorf("failed to extract %s: %v", k.ID, err)
+					continue
+				}
+				return err
+			}
+			fname := filepath.Join(output, k.ID)
+			if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+				return err
+			}
+			log.Infof("Created %s", fname)
+		}
+
+		if !found {
+			if all {
+				return fmt.Errorf("no kexts found in %s", kcPath)
+			}
+			return fmt.Errorf("kext %s not found in %s", args[1], kcPath)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,121 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	kernelcacheCmd.AddCommand(sbdiffCmd)
+
+	sbdiffCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	sbdiffCmd.Flags().StringP("output", "o", "", "Also write the JSON diff to this file")
+	sbdiffCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+	sbdiffCmd.MarkZshCompPositionalArgumentFile(2, "kernelcache*")
+}
+
+func getKernelSandboxes(path string) ([]*kernelcache.Sandbox, error) {
+	kcPath := filepath.Clean(path)
+
+	if _, err := os.Stat(kcPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("file %s does not exist", path)
+	}
+
+	m, err := macho.Open(kcPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", kcPath)
+	}
+	defer m.Close()
+
+	data, err := ioutil.ReadFile(kcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return kernelcache.GetSandboxes(m, bytes.NewReader(data))
+}
+
+// sbdiffCmd represents the sbdiff command
+var sbdiffCmd = &cobra.Command{
+	Use:   "sbdiff <old_kernelcache> <new_kernelcache>",
+	Short: "Diff the sandbox profiles of two kernelcaches",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		outAsJSON, _ := cmd.Flags().GetBool("json")
+		output, _ := cmd.Flags().GetString("output")
+
+		log.WithField("kernelcache", args[0]).Info("Parsing sandbox profiles")
+		oldSBs, err := getKernelSandboxes(args[0])
+		if err != nil {
+			return err
+		}
+		log.WithField("kernelcache", args[1]).Info("Parsing sandbox profiles")
+		newSBs, err := getKernelSandboxes(args[1])
+		if err != nil {
+			return err
+		}
+
+		log.Info("Diffing sandbox profiles...")
+		diff, err := kernelcache.DiffSandboxes(oldSBs, newSBs)
+		if err != nil {
+			return err
+		}
+
+		j, err := json.MarshalIndent(diff, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		if len(output) > 0 {
+			if err := ioutil.WriteFile(output, j, 0644); err != nil {
+				return err
+			}
+			log.Info("Created " + output)
+		}
+
+		if outAsJSON {
+			fmt.Println(string(j))
+			return nil
+		}
+
+		fmt.Print(diff)
+
+		return nil
+	},
+}
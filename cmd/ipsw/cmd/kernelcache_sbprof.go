@@ -30,6 +30,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/spf13/cobra"
 )
@@ -37,27 +38,38 @@ import (
 func init() {
 	kernelcacheCmd.AddCommand(sbprofCmd)
 
+	sbprofCmd.Flags().StringP("output", "o", "", "Output folder (default is a sandbox folder next to the kernelcache)")
+	sbprofCmd.Flags().StringP("profile", "p", "", "Only print the SBPL for this profile to stdout")
+	sbprofCmd.Flags().BoolP("raw", "r", false, "Also write out the raw sandbox profile and collection data")
+
 	sbprofCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
 }
 
 // sbprofCmd represents the sbprof command
 var sbprofCmd = &cobra.Command{
-	Use:    "sbprof",
-	Short:  "🚧 [WIP] Extract kernel sandbox profile data",
-	Args:   cobra.MinimumNArgs(1),
-	Hidden: true,
+	Use:   "sbprof <kernelcache>",
+	Short: "Decompile kernel sandbox profiles to SBPL",
+	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if Verbose {
 			log.SetLevel(log.DebugLevel)
 		}
 
+		outDir, _ := cmd.Flags().GetString("output")
+		profileName, _ := cmd.Flags().GetString("profile")
+		writeRaw, _ := cmd.Flags().GetBool("raw")
+
 		kcPath := filepath.Clean(args[0])
 
 		if _, err := os.Stat(kcPath); os.IsNotExist(err) {
 			return fmt.Errorf("file %s does not exist", args[0])
 		}
 
+		if len(outDir) == 0 {
+			outDir = filepath.Join(filepath.Dir(kcPath), "sandbox")
+		}
+
 		m, err := macho.Open(kcPath)
 		if err != nil {
 			return err
@@ -69,50 +81,78 @@ var sbprofCmd = &cobra.Command{
 			return err
 		}
 
-		the_real_platform_profile_data, err := kernelcache.GetSandboxProfiles(m, bytes.NewReader(data))
+		sbOpsList, err := kernelcache.GetSandboxOpts(m)
 		if err != nil {
 			return err
 		}
 
-		sbProfPath := filepath.Join(filepath.Dir(kcPath), "sandbox_profile.bin")
-		err = ioutil.WriteFile(sbProfPath, the_real_platform_profile_data, 0755)
+		the_real_platform_profile_data, err := kernelcache.GetSandboxProfiles(m, bytes.NewReader(data))
 		if err != nil {
 			return err
 		}
-		log.Info("Created " + sbProfPath)
+		platform, err := kernelcache.ParseSandboxProfile(the_real_platform_profile_data, sbOpsList)
+		if err != nil {
+			return fmt.Errorf("failed to parse platform profile: %v", err)
+		}
 
 		collection_data, err := kernelcache.GetSandboxCollections(m, bytes.NewReader(data))
 		if err != nil {
 			return err
 		}
-
-		sbColPath := filepath.Join(filepath.Dir(kcPath), "sandbox_collection.bin")
-		err = ioutil.WriteFile(sbColPath, collection_data, 0755)
+		collection, err := kernelcache.ParseSandboxCollection(collection_data, sbOpsList)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to parse profile collection: %v", err)
 		}
-		log.Info("Created " + sbColPath)
 
-		log.Info("Parsing " + sbColPath)
-		sbOpsList, err := kernelcache.GetSandboxOpts(m)
-		if err != nil {
-			return err
+		if len(profileName) > 0 {
+			for _, sb := range []*kernelcache.Sandbox{platform, collection} {
+				for _, prof := range sb.Profiles {
+					if prof.Name == profileName {
+						sbpl, err := sb.SBPL(prof)
+						if err != nil {
+							return err
+						}
+						fmt.Print(sbpl)
+						return nil
+					}
+				}
+			}
+			return fmt.Errorf("profile %s not found", profileName)
 		}
-		_, err = kernelcache.ParseSandboxCollection(collection_data, sbOpsList)
-		if err != nil {
+
+		if err := os.MkdirAll(outDir, 0755); err != nil {
 			return err
 		}
 
-		// regexFolder := filepath.Join(filepath.Dir(kcPath), "regex")
-		// os.MkdirAll(regexFolder, 0755)
+		if writeRaw {
+			sbProfPath := filepath.Join(outDir, "sandbox_profile.bin")
+			if err := ioutil.WriteFile(sbProfPath, the_real_platform_profile_data, 0644); err != nil {
+				return err
+			}
+			log.Info("Created " + sbProfPath)
+
+			sbColPath := filepath.Join(outDir, "sandbox_collection.bin")
+			if err := ioutil.WriteFile(sbColPath, collection_data, 0644); err != nil {
+				return err
+			}
+			log.Info("Created " + sbColPath)
+		}
 
-		// for off, data := range sb.Regexes {
-		// 	regexPath := filepath.Join(regexFolder, fmt.Sprintf("regex_%x", off))
-		// 	err = ioutil.WriteFile(regexPath, data, 0755)
-		// 	if err != nil {
-		// 		return err
-		// 	}
-		// }
+		log.Info("Decompiling profiles")
+		for _, sb := range []*kernelcache.Sandbox{platform, collection} {
+			for _, prof := range sb.Profiles {
+				sbpl, err := sb.SBPL(prof)
+				if err != nil {
+					log.Errorf("failed to decompile %s: %v", prof.Name, err)
+					continue
+				}
+				sbplPath := filepath.Join(outDir, prof.Name+".sb")
+				if err := ioutil.WriteFile(sbplPath, []byte(sbpl), 0644); err != nil {
+					return err
+				}
+				utils.Indent(log.Info, 2)("Created " + sbplPath)
+			}
+		}
 
 		return nil
 	},
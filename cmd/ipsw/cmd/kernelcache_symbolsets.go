@@ -22,15 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
-	"github.com/blacktop/go-macho/types"
-	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -40,22 +38,6 @@ func init() {
 	kextsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
 }
 
-type symbolsSets struct {
-	SymbolsSetsDictionary []cFBundle `plist:"SymbolsSets,omitempty"`
-}
-
-type cFBundle struct {
-	ID                string   `plist:"CFBundleIdentifier,omitempty"`
-	CompatibleVersion string   `plist:"OSBundleCompatibleVersion,omitempty"`
-	Version           string   `plist:"CFBundleVersion,omitempty"`
-	Symbols           []symbol `plist:"Symbols,omitempty"`
-}
-
-type symbol struct {
-	Name   string `plist:"SymbolName,omitempty"`
-	Prefix string `plist:"SymbolPrefix,omitempty"`
-}
-
 // symbolsetsCmd represents the symbolsets command
 var symbolsetsCmd = &cobra.Command{
 	Use:   "symbolsets <kernelcache>",
@@ -76,34 +58,17 @@ var symbolsetsCmd = &cobra.Command{
 			return errors.Wrapf(err, "%s appears to not be a valid MachO", args[0])
 		}
 
-		if m.FileTOC.FileHeader.Type == types.FileSet {
-			m, err = m.GetFileSetFileByName("com.apple.kernel")
-			if err != nil {
-				return fmt.Errorf("failed to parse entry com.apple.kernel; %v", err)
-			}
-		}
-
-		symbolsets := m.Section("__LINKINFO", "__symbolsets")
-		if symbolsets == nil {
-			log.Error("kernelcache does NOT contain __LINKINFO.__symbolsets")
+		sets, err := kernelcache.GetSymbolSets(m)
+		if err == kernelcache.ErrNoSymbolSets {
+			log.Error(err.Error())
 			return nil
-		}
-
-		dat := make([]byte, symbolsets.Size)
-		m.ReadAt(dat, int64(symbolsets.Offset))
-
-		var blist symbolsSets
-
-		dec := plist.NewDecoder(bytes.NewReader(dat))
-
-		err = dec.Decode(&blist)
-		if err != nil {
-			return errors.Wrapf(err, "failed to parse __symbolsets bplist data")
+		} else if err != nil {
+			return err
 		}
 
 		fmt.Println("Symbol Sets")
 		fmt.Println("===========")
-		for _, sset := range blist.SymbolsSetsDictionary {
+		for _, sset := range sets {
 			head := fmt.Sprintf("%s: (%s)", sset.ID, sset.Version)
 			fmt.Printf("\n%s\n", head)
 			fmt.Println(strings.Repeat("-", len(head)))
@@ -0,0 +1,171 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	kernelcacheCmd.AddCommand(syscallsCmd)
+	kernelcacheCmd.AddCommand(machTrapsCmd)
+	kernelcacheCmd.AddCommand(migCmd)
+
+	syscallsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	syscallsCmd.Flags().BoolP("all", "a", false, "Also show unimplemented syscalls")
+	syscallsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+
+	machTrapsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	machTrapsCmd.Flags().BoolP("all", "a", false, "Also show unimplemented mach traps")
+	machTrapsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+
+	migCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	migCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// syscallsCmd represents the syscalls command
+var syscallsCmd = &cobra.Command{
+	Use:   "syscalls <kernelcache>",
+	Short: "Dump the BSD syscall table",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		outAsJSON, _ := cmd.Flags().GetBool("json")
+		showAll, _ := cmd.Flags().GetBool("all")
+
+		m, err := openKernelcache(args[0])
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		syscalls, err := kernelcache.GetSyscallTable(m)
+		if err != nil {
+			return err
+		}
+
+		var out []kernelcache.Sysent
+		for _, s := range syscalls {
+			if showAll || s.Implemented {
+				out = append(out, s)
+			}
+		}
+
+		if outAsJSON {
+			return printJSON(out)
+		}
+
+		for _, s := range out {
+			fmt.Println(s)
+		}
+
+		return nil
+	},
+}
+
+// machTrapsCmd represents the mach-traps command
+var machTrapsCmd = &cobra.Command{
+	Use:   "mach-traps <kernelcache>",
+	Short: "Dump the mach trap table",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		outAsJSON, _ := cmd.Flags().GetBool("json")
+		showAll, _ := cmd.Flags().GetBool("all")
+
+		m, err := openKernelcache(args[0])
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		traps, err := kernelcache.GetMachTrapTable(m)
+		if err != nil {
+			return err
+		}
+
+		var out []kernelcache.MachTrap
+		for _, t := range traps {
+			if showAll || t.Implemented {
+				out = append(out, t)
+			}
+		}
+
+		if outAsJSON {
+			return printJSON(out)
+		}
+
+		for _, t := range out {
+			fmt.Println(t)
+		}
+
+		return nil
+	},
+}
+
+// migCmd represents the mig command
+var migCmd = &cobra.Command{
+	Use:   "mig <kernelcache>",
+	Short: "Dump the kernel's MIG subsystems",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		outAsJSON, _ := cmd.Flags().GetBool("json")
+
+		m, err := openKernelcache(args[0])
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		subsystems, err := kernelcache.GetMigSubsystems(m)
+		if err != nil {
+			return err
+		}
+
+		if outAsJSON {
+			return printJSON(subsystems)
+		}
+
+		for _, s := range subsystems {
+			fmt.Print(s)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2019 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/mirror"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	mirrorCmd.AddCommand(mirrorServeCmd)
+
+	mirrorServeCmd.Flags().StringP("dir", "o", viper.GetString("IPSW_MIRROR_DIR"), "Mirror directory")
+	mirrorServeCmd.Flags().StringP("addr", "a", ":3993", "Address to listen on")
+	mirrorServeCmd.Flags().StringP("url", "u", "", "Base URL of the mirror used in the served download URLs (defaults to the request's host)")
+}
+
+// mirrorServeCmd represents the mirror serve command
+var mirrorServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a local mirror with an ipsw.me/iTunes compatible API (use with 'ipsw download --mirror')",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		dir, _ := cmd.Flags().GetString("dir")
+		addr, _ := cmd.Flags().GetString("addr")
+		baseURL, _ := cmd.Flags().GetString("url")
+
+		if len(dir) == 0 {
+			dir = "mirror"
+		}
+
+		m, err := mirror.Open(dir)
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"addr":    addr,
+			"dir":     dir,
+			"entries": len(m.Entries()),
+		}).Info("Serving mirror")
+
+		return http.ListenAndServe(addr, mirror.NewServer(m, baseURL))
+	},
+}
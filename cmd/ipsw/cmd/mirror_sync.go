@@ -0,0 +1,181 @@
+/*
+Copyright © 2019 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/mirror"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	mirrorCmd.AddCommand(mirrorSyncCmd)
+
+	mirrorSyncCmd.Flags().StringP("dir", "o", viper.GetString("IPSW_MIRROR_DIR"), "Mirror directory")
+	mirrorSyncCmd.Flags().StringSliceP("devices", "d", []string{}, "iOS Devices to mirror (i.e. iPhone11,2,iPhone12,3)")
+	mirrorSyncCmd.Flags().StringSliceP("versions", "v", []string{}, "iOS Versions to mirror (i.e. 14.2,14.2.1)")
+	mirrorSyncCmd.Flags().StringSliceP("builds", "b", []string{}, "iOS BuildIDs to mirror (i.e. 18B92)")
+	mirrorSyncCmd.Flags().Bool("ota", false, "Mirror OTAs from the OTA feed instead of IPSWs")
+	mirrorSyncCmd.Flags().BoolP("release", "r", false, "Mirror Release (non-beta) OTAs")
+	addDownloadManagerFlags(mirrorSyncCmd.Flags())
+}
+
+// mirrorSyncCmd represents the mirror sync command
+var mirrorSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Download IPSWs/OTAs into a local mirror (by device, version and build)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		dir, _ := cmd.Flags().GetString("dir")
+		devices, _ := cmd.Flags().GetStringSlice("devices")
+		versions, _ := cmd.Flags().GetStringSlice("versions")
+		builds, _ := cmd.Flags().GetStringSlice("builds")
+		ota, _ := cmd.Flags().GetBool("ota")
+		release, _ := cmd.Flags().GetBool("release")
+		proxy, _ := cmd.Flags().GetString("proxy")
+		insecure, _ := cmd.Flags().GetBool("insecure")
+
+		if len(dir) == 0 {
+			dir = "mirror"
+		}
+		if len(versions) == 0 && len(builds) == 0 && !ota {
+			return fmt.Errorf("you must supply --versions and/or --builds (or --ota)")
+		}
+
+		m, err := mirror.Open(dir)
+		if err != nil {
+			return err
+		}
+
+		dl, err := newDownloadManager(cmd)
+		if err != nil {
+			return err
+		}
+
+		matchDevice := func(device string) bool {
+			if len(devices) == 0 {
+				return true
+			}
+			for _, d := range devices {
+				if strings.EqualFold(d, device) {
+					return true
+				}
+			}
+			return false
+		}
+
+		var sources []mirror.Source
+		identifiers := make(map[string]bool)
+
+		if ota {
+			o, err := download.NewOTA(proxy, insecure, release, false)
+			if err != nil {
+				return errors.Wrap(err, "failed to parse remote OTA XML")
+			}
+			for _, asset := range o.GetOTAs("", devices, []string{}) {
+				src := mirror.FromOTA(asset)
+				if len(versions) > 0 && !utils.StrSliceContains(versions, src.Version) {
+					continue
+				}
+				if len(builds) > 0 && !utils.StrSliceContains(builds, src.Build) {
+					continue
+				}
+				var devs []string
+				for _, d := range src.Devices {
+					if matchDevice(d) {
+						devs = append(devs, d)
+						identifiers[d] = true
+					}
+				}
+				if len(devs) == 0 {
+					continue
+				}
+				src.Devices = devs
+				sources = append(sources, src)
+			}
+		} else {
+			for _, build := range builds {
+				version, err := download.GetVersion(build)
+				if err != nil {
+					return errors.Wrapf(err, "failed to get the version of build %s", build)
+				}
+				ipsws, err := download.GetAllIPSW(version)
+				if err != nil {
+					return errors.Wrap(err, "failed to query ipsw.me api")
+				}
+				for _, i := range ipsws {
+					if i.BuildID == build && matchDevice(i.Identifier) {
+						sources = append(sources, mirror.FromIPSW(i))
+						identifiers[i.Identifier] = true
+					}
+				}
+			}
+
+			for _, version := range versions {
+				ipsws, err := download.GetAllIPSW(version)
+				if err != nil {
+					return errors.Wrap(err, "failed to query ipsw.me api")
+				}
+				for _, i := range ipsws {
+					if matchDevice(i.Identifier) {
+						sources = append(sources, mirror.FromIPSW(i))
+						identifiers[i.Identifier] = true
+					}
+				}
+			}
+		}
+
+		if len(sources) == 0 {
+			return fmt.Errorf("filter flags matched 0 IPSWs/OTAs")
+		}
+
+		// store the device info so the mirror can serve it to 'ipsw download'
+		for id := range identifiers {
+			if _, ok := m.Devices()[id]; ok {
+				continue
+			}
+			dev, err := download.GetDevice(id)
+			if err != nil {
+				log.WithError(err).Warnf("failed to get device info for %s", id)
+				continue
+			}
+			m.SetDevice(dev)
+		}
+
+		added, err := m.Sync(dl, sources)
+		log.WithFields(log.Fields{"added": added, "dir": dir}).Info("Mirror synced")
+
+		return err
+	},
+}
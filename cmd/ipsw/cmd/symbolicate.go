@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"text/tabwriter"
 
@@ -33,6 +34,7 @@ import (
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/crashlog"
 	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -42,14 +44,340 @@ func init() {
 
 	symbolicateCmd.Flags().BoolP("unslide", "u", false, "Unslide the crashlog for easier static analysis")
 	symbolicateCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
+	symbolicateCmd.Flags().BoolP("kernel", "k", false, "Symbolicate a kernel panic log against a kernelcache")
+	symbolicateCmd.Flags().String("kdk", "", "Kernel Debug Kit kernel to carry symbols over from (with --kernel)")
+	symbolicateCmd.Flags().BoolP("spindump", "s", false, "Symbolicate a spindump or stackshot (hang report) against a dyld_shared_cache")
+	symbolicateCmd.Flags().BoolP("json", "j", false, "Output the symbolicated kernel panic or spindump as JSON")
+	symbolicateCmd.Flags().StringP("output", "o", "", "Write the symbolicated crashlog to a file")
+	symbolicateCmd.Flags().StringP("format", "f", "text", "Output format (text, ips or folded for spindumps)")
+	symbolicateCmd.Flags().StringP("bins", "b", "", "Directory of Mach-Os/dSYMs to symbolicate non dyld_shared_cache images with (matched by UUID)")
 	symbolicateCmd.MarkZshCompPositionalArgumentFile(2, "dyld_shared_cache*")
 }
 
-// TODO: handle all edge cases from `/Applications/Xcode.app/Contents/SharedFrameworks/DVTFoundation.framework/Versions/A/Resources/symbolicatecrash` and handle spindumps etc
+// kernelPanicSymbolicator demangles the kernelcache symbols (if requested)
+type kernelPanicSymbolicator struct {
+	*kernelcache.Symbolicator
+}
+
+func (s kernelPanicSymbolicator) Symbolicate(addr uint64) string {
+	name, off, ok := s.Lookup(addr)
+	if !ok {
+		return ""
+	}
+	if demangleFlag {
+		name = demangle.Do(name, false, false)
+	}
+	if off == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s + %d", name, off)
+}
+
+func symbolicateKernelPanic(cmd *cobra.Command, args []string) error {
+	kdkPath, _ := cmd.Flags().GetString("kdk")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	if len(args) < 2 {
+		return fmt.Errorf("please supply a kernel panic log AND a kernelcache")
+	}
+
+	panicLog, err := crashlog.OpenKernelPanic(args[0])
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse kernel panic %s", args[0])
+	}
+
+	m, err := openKernelcache(args[1])
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if len(panicLog.KernelCacheUUID) > 0 {
+		if uuid := m.UUID(); uuid != nil && !strings.EqualFold(uuid.String(), panicLog.KernelCacheUUID) {
+			log.Warnf("kernelcache UUID %s does NOT match the panic's KernelCache UUID %s", uuid, panicLog.KernelCacheUUID)
+		}
+	}
+
+	s, err := getKernelSymbolicator(m, kdkPath)
+	if err != nil {
+		return err
+	}
+
+	panicLog.Symbolicate(kernelPanicSymbolicator{s})
+
+	if asJSON {
+		return printJSON(panicLog)
+	}
+
+	fmt.Println(panicLog)
+
+	return nil
+}
+
+// lookupCacheSymbol returns the symbol containing the (unslid) address in a dyld_shared_cache image and
+// the offset into it, loading the image's symbols the first time it is needed
+func lookupCacheSymbol(f *dyld.File, image *dyld.CacheImage, unslidAddr uint64, parsed map[string]bool) (string, uint64, bool, error) {
+	m, err := image.GetMacho()
+	if err != nil {
+		return "", 0, false, err
+	}
+	defer m.Close()
+
+	lookup := func() (string, uint64, bool) {
+		// check if symbol is cached
+		if symName, ok := f.AddressToSymbol[unslidAddr]; ok {
+			return symName, 0, true
+		}
+		if fn, err := m.GetFunctionForVMAddr(unslidAddr); err == nil {
+			if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+				return symName, unslidAddr - fn.StartAddr, true
+			}
+		}
+		return "", 0, false
+	}
+
+	if symName, off, ok := lookup(); ok || parsed[image.Name] {
+		return symName, off, ok, nil
+	}
+	parsed[image.Name] = true
+
+	if m.HasObjC() {
+		if err := f.CFStringsForImage(image.Name); err != nil {
+			return "", 0, false, errors.Wrapf(err, "failed to parse objc cfstrings")
+		}
+		if err := f.MethodsForImage(image.Name); err != nil {
+			return "", 0, false, errors.Wrapf(err, "failed to parse objc methods")
+		}
+		if strings.Contains(image.Name, "libobjc.A.dylib") {
+			_, err = f.GetAllSelectors(false)
+		} else {
+			err = f.SelectorsForImage(image.Name)
+		}
+		if err != nil {
+			return "", 0, false, errors.Wrapf(err, "failed to parse objc selectors")
+		}
+		if err := f.ClassesForImage(image.Name); err != nil {
+			return "", 0, false, errors.Wrapf(err, "failed to parse objc classes")
+		}
+	}
+
+	for _, patch := range image.PatchableExports {
+		addr, err := f.GetVMAddress(uint64(patch.OffsetOfImpl))
+		if err != nil {
+			return "", 0, false, err
+		}
+		f.AddressToSymbol[addr] = patch.Name
+	}
+
+	// Load all symbol
+	if err := f.GetAllExportedSymbolsForImage(image, false); err != nil {
+		log.Error("failed to parse exported symbols")
+	}
+
+	if err := f.GetLocalSymbolsForImage(image); err != nil {
+		if errors.Is(err, dyld.ErrNoLocals) {
+			utils.Indent(log.Warn, 2)(err.Error())
+		} else if err != nil {
+			return "", 0, false, err
+		}
+	}
+
+	// if err := f.AnalyzeImage(image); err != nil {
+	// 	return fmt.Errorf("failed to analyze image %s; %v", image.Name, err)
+	// }
+
+	symName, off, ok := lookup()
+	return symName, off, ok, nil
+}
+
+// openSymbolicateCache opens the dyld_shared_cache to symbolicate against (following symlinks)
+func openSymbolicateCache(path string) (*dyld.File, error) {
+	dscPath, err := resolveDSCPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return dyld.Open(dscPath)
+}
+
+func symbolicateSpindump(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	format, _ := cmd.Flags().GetString("format")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	if format != "text" && format != "folded" {
+		return fmt.Errorf("unsupported spindump output format %s (must be text or folded)", format)
+	}
+
+	spin, err := crashlog.OpenSpindump(args[0])
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse spindump %s", args[0])
+	}
+
+	if len(args) > 1 {
+		f, err := openSymbolicateCache(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		parsed := make(map[string]bool)
+		for _, proc := range spin.Processes {
+			var walkErr error
+			proc.Walk(func(_ *crashlog.SampleThread, frame *crashlog.SampleFrame) {
+				if walkErr != nil || frame.Kernel || len(frame.Symbol) > 0 || frame.Image == nil {
+					return
+				}
+				var image *dyld.CacheImage
+				var unslidAddr uint64
+				if frame.Image.Name == crashlog.SharedCacheImage { // stackshot frames are offsets into the cache
+					unslidAddr = f.SharedRegionStart + frame.ImageOffset
+					if image, err = f.GetImageContainingTextAddr(unslidAddr); err != nil {
+						return
+					}
+					frame.ImageName = filepath.Base(image.Name)
+					frame.ImageOffset = unslidAddr - image.CacheImageTextInfo.LoadAddress
+				} else {
+					if image = f.Image(frame.Image.Path); image == nil {
+						if image = f.Image(frame.ImageName); image == nil {
+							return
+						}
+					}
+					unslidAddr = image.CacheImageTextInfo.LoadAddress + frame.ImageOffset
+				}
+				symName, off, ok, err := lookupCacheSymbol(f, image, unslidAddr, parsed)
+				if err != nil {
+					walkErr = err
+					return
+				}
+				if ok {
+					if demangleFlag {
+						symName = demangle.Do(symName, false, false)
+					}
+					frame.Symbol = symName
+					frame.SymbolOffset = off
+				}
+			})
+			if walkErr != nil {
+				return walkErr
+			}
+		}
+	}
+
+	if len(output) > 0 {
+		out, err := os.Create(output)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create %s", output)
+		}
+		defer out.Close()
+		if format == "folded" {
+			err = spin.WriteFolded(out)
+		} else {
+			_, err = out.WriteString(spin.String())
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to write symbolicated spindump")
+		}
+		log.Infof("Created %s", output)
+		return nil
+	}
+
+	if asJSON {
+		return printJSON(spin)
+	}
+
+	if format == "folded" {
+		return spin.WriteFolded(os.Stdout)
+	}
+
+	fmt.Println(spin)
+
+	return nil
+}
+
+// symbolicateCrashLog symbolicates the threads (or just the crashed thread) of a crashlog against a
+// dyld_shared_cache and/or a directory of binaries and returns the images that could not be found
+func symbolicateCrashLog(crashLog *crashlog.CrashLog, f *dyld.File, bins *crashlog.BinaryIndex, parsed map[string]bool, crashedOnly bool) (map[string]string, error) {
+	missing := make(map[string]string) // images that could not be found (name -> UUID)
+
+	// Symbolicate all the threads' backtraces
+	for tidx := range crashLog.Threads {
+		if crashedOnly && tidx != crashLog.CrashedThread {
+			continue
+		}
+		for idx := range crashLog.Threads[tidx].BackTrace {
+			bt := &crashLog.Threads[tidx].BackTrace[idx]
+
+			var symName string
+			var symOff uint64
+			var found, resolved bool
+
+			if f != nil {
+				image := f.Image(bt.Image.Path)
+				if image == nil {
+					image = f.Image(bt.Image.Name)
+				}
+				if image != nil {
+					found = true
+					// calculate slide
+					bt.Image.Slide = bt.Image.Start - image.CacheImageTextInfo.LoadAddress
+					var err error
+					symName, symOff, resolved, err = lookupCacheSymbol(f, image, bt.Address-bt.Image.Slide, parsed)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			if !found && bins != nil {
+				bin, err := bins.Open(bt.Image.UUID)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to open binary for %s", bt.Image.Name)
+				}
+				if bin != nil {
+					found = true
+					bt.Image.Slide = bt.Image.Start - bin.TextAddr
+					symName, symOff, resolved = bin.Lookup(bt.Address - bt.Image.Start)
+					// return addresses point after the call so look up the source line of the call itself
+					pcOffset := bt.Address - bt.Image.Start
+					if bt.FrameNum > 0 && pcOffset > 0 {
+						pcOffset--
+					}
+					if lines := bin.SourceLines(pcOffset, demangleFlag); len(lines) > 0 {
+						for i := range lines {
+							if demangleFlag {
+								lines[i].Function = demangle.Do(lines[i].Function, false, false)
+							}
+						}
+						bt.Source = &lines[len(lines)-1]
+						bt.Inlined = lines[:len(lines)-1]
+						if !resolved && len(bt.Source.Function) > 0 {
+							bt.Symbol = bt.Source.Function
+						}
+					}
+				}
+			}
+
+			if !found {
+				missing[bt.Image.Name] = bt.Image.UUID
+			}
+			if resolved {
+				if demangleFlag {
+					symName = demangle.Do(symName, false, false)
+				}
+				bt.Symbol = symName
+				bt.SymbolOffset = symOff
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// TODO: handle all edge cases from `/Applications/Xcode.app/Contents/SharedFrameworks/DVTFoundation.framework/Versions/A/Resources/symbolicatecrash`
 
 // symbolicateCmd represents the symbolicate command
 var symbolicateCmd = &cobra.Command{
-	Use:   "symbolicate [options] <crashlog> <dyld_shared_cache>",
+	Use:   "symbolicate [options] <crashlog> [dyld_shared_cache]",
 	Short: "Symbolicate ARM 64-bit crash logs (similar to Apple's symbolicatecrash)",
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -59,6 +387,20 @@ var symbolicateCmd = &cobra.Command{
 		}
 
 		unslide, _ := cmd.Flags().GetBool("unslide")
+		output, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+		binsDir, _ := cmd.Flags().GetString("bins")
+
+		if kernel, _ := cmd.Flags().GetBool("kernel"); kernel {
+			return symbolicateKernelPanic(cmd, args)
+		}
+		if spindump, _ := cmd.Flags().GetBool("spindump"); spindump {
+			return symbolicateSpindump(cmd, args)
+		}
+
+		if format != "text" && format != "ips" {
+			return fmt.Errorf("unsupported output format %s (must be text or ips)", format)
+		}
 
 		crashLog, err := crashlog.Open(args[0])
 		if err != nil {
@@ -66,28 +408,13 @@ var symbolicateCmd = &cobra.Command{
 		}
 		defer crashLog.Close()
 
-		if len(args) > 1 {
-			dscPath := filepath.Clean(args[1])
-
-			fileInfo, err := os.Lstat(dscPath)
-			if err != nil {
-				return fmt.Errorf("file %s does not exist", dscPath)
-			}
-
-			// Check if file is a symlink
-			if fileInfo.Mode()&os.ModeSymlink != 0 {
-				symlinkPath, err := os.Readlink(dscPath)
-				if err != nil {
-					return errors.Wrapf(err, "failed to read symlink %s", dscPath)
-				}
-				// TODO: this seems like it would break
-				linkParent := filepath.Dir(dscPath)
-				linkRoot := filepath.Dir(linkParent)
-
-				dscPath = filepath.Join(linkRoot, symlinkPath)
-			}
+		if format == "ips" && !crashLog.IsIPS() {
+			return fmt.Errorf("--format ips requires an .ips crashlog")
+		}
 
-			f, err := dyld.Open(dscPath)
+		var f *dyld.File
+		if len(args) > 1 {
+			f, err = openSymbolicateCache(args[1])
 			if err != nil {
 				return err
 			}
@@ -148,135 +475,94 @@ var symbolicateCmd = &cobra.Command{
 			// 	a2sFile.Close()
 			// }
 
-			// Symbolicate the crashing thread's backtrace
-			for idx, bt := range crashLog.Threads[crashLog.CrashedThread].BackTrace {
-				// calculate slide
-				image := f.Image(bt.Image.Name)
-				bt.Image.Slide = bt.Image.Start - image.CacheImageTextInfo.LoadAddress
-				unslidAddr := bt.Address - bt.Image.Slide
-				m, err := image.GetMacho()
-				if err != nil {
-					return err
-				}
-				defer m.Close()
-
-				// check if symbol is cached
-				if symName, ok := f.AddressToSymbol[unslidAddr]; ok {
-					if demangleFlag {
-						symName = demangle.Do(symName, false, false)
-					}
-					crashLog.Threads[crashLog.CrashedThread].BackTrace[idx].Symbol = symName
-					continue
-				}
-
-				if fn, err := m.GetFunctionForVMAddr(unslidAddr); err == nil {
-					if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
-						if demangleFlag {
-							symName = demangle.Do(symName, false, false)
-						}
-						crashLog.Threads[crashLog.CrashedThread].BackTrace[idx].Symbol = fmt.Sprintf("%s + %d", symName, unslidAddr-fn.StartAddr)
-						continue
-					}
-				}
+		}
 
-				if m.HasObjC() {
-					err = f.CFStringsForImage(image.Name)
-					if err != nil {
-						return errors.Wrapf(err, "failed to parse objc cfstrings")
-					}
-					err = f.MethodsForImage(image.Name)
-					if err != nil {
-						return errors.Wrapf(err, "failed to parse objc methods")
-					}
-					if strings.Contains(image.Name, "libobjc.A.dylib") {
-						_, err = f.GetAllSelectors(false)
-					} else {
-						err = f.SelectorsForImage(image.Name)
-					}
-					if err != nil {
-						return errors.Wrapf(err, "failed to parse objc selectors")
-					}
-					err = f.ClassesForImage(image.Name)
-					if err != nil {
-						return errors.Wrapf(err, "failed to parse objc classes")
-					}
-				}
+		var bins *crashlog.BinaryIndex
+		if len(binsDir) > 0 || runtime.GOOS == "darwin" { // dSYMs can also be found with Spotlight on macOS
+			bins, err = crashlog.IndexBinaries(binsDir)
+			if err != nil {
+				return err
+			}
+			defer bins.Close()
+		}
 
-				for _, patch := range image.PatchableExports {
-					addr, err := f.GetVMAddress(uint64(patch.OffsetOfImpl))
-					if err != nil {
-						return err
-					}
-					f.AddressToSymbol[addr] = patch.Name
-				}
+		if f == nil && bins == nil {
+			log.Errorf("please supply a dyld_shared_cache for %s running %s (%s)", crashLog.HardwareModel, crashLog.OSVersion, crashLog.OSBuild)
+			return nil
+		}
 
-				// Load all symbol
-				if err := f.GetAllExportedSymbolsForImage(image, false); err != nil {
-					log.Error("failed to parse exported symbols")
-				}
+		missing, err := symbolicateCrashLog(crashLog, f, bins, make(map[string]bool), false)
+		if err != nil {
+			return err
+		}
 
-				if err := f.GetLocalSymbolsForImage(image); err != nil {
-					if errors.Is(err, dyld.ErrNoLocals) {
-						utils.Indent(log.Warn, 2)(err.Error())
-					} else if err != nil {
-						return err
-					}
-				}
+		for name, uuid := range missing {
+			log.WithField("uuid", uuid).Warnf("no binary found for %s", name)
+		}
 
-				// if err := f.AnalyzeImage(image); err != nil {
-				// 	return fmt.Errorf("failed to analyze image %s; %v", image.Name, err)
-				// }
+		fmt.Println(crashLog)
 
-				if symName, ok := f.AddressToSymbol[unslidAddr]; ok {
-					if demangleFlag {
-						symName = demangle.Do(symName, false, false)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		for _, t := range crashLog.Threads {
+			if len(t.Name) > 0 {
+				fmt.Fprintf(w, "Thread %d name: %s\n", t.Number, t.Name)
+			}
+			if t.Number == crashLog.CrashedThread {
+				fmt.Fprintf(w, "Thread %d Crashed:\n", t.Number)
+			} else {
+				fmt.Fprintf(w, "Thread %d:\n", t.Number)
+			}
+			for _, bt := range t.BackTrace {
+				for _, inl := range bt.Inlined {
+					if unslide {
+						fmt.Fprintf(w, "\t%2d: %s\t%#x\t%s [inlined]\n", bt.FrameNum, bt.Image.Name, bt.Address-bt.Image.Slide, inl)
+					} else {
+						fmt.Fprintf(w, "\t%2d: %s\t(slide=%#x)\t%#x\t%s [inlined]\n", bt.FrameNum, bt.Image.Name, bt.Image.Slide, bt.Address, inl)
 					}
-					crashLog.Threads[crashLog.CrashedThread].BackTrace[idx].Symbol = symName
-					continue
 				}
-
-				if fn, err := m.GetFunctionForVMAddr(unslidAddr); err == nil {
-					if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
-						if demangleFlag {
-							symName = demangle.Do(symName, false, false)
-						}
-						crashLog.Threads[crashLog.CrashedThread].BackTrace[idx].Symbol = fmt.Sprintf("%s + %d", symName, unslidAddr-fn.StartAddr)
-					}
+				symbol := bt.SymbolString()
+				if len(symbol) == 0 {
+					symbol = "??? (unresolved)"
 				}
-
-			}
-
-			fmt.Println(crashLog)
-
-			fmt.Printf("Thread %d name: %s\n",
-				crashLog.CrashedThread,
-				crashLog.Threads[crashLog.CrashedThread].Name)
-			fmt.Printf("Thread %d Crashed:\n", crashLog.CrashedThread)
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
-			for _, bt := range crashLog.Threads[crashLog.CrashedThread].BackTrace {
 				if unslide {
-					fmt.Fprintf(w, "\t%2d: %s\t%#x\t%s\n", bt.FrameNum, bt.Image.Name, bt.Address-bt.Image.Slide, bt.Symbol)
+					fmt.Fprintf(w, "\t%2d: %s\t%#x\t%s\n", bt.FrameNum, bt.Image.Name, bt.Address-bt.Image.Slide, symbol)
 				} else {
-					fmt.Fprintf(w, "\t%2d: %s\t(slide=%#x)\t%#x\t%s\n", bt.FrameNum, bt.Image.Name, bt.Image.Slide, bt.Address, bt.Symbol)
+					fmt.Fprintf(w, "\t%2d: %s\t(slide=%#x)\t%#x\t%s\n", bt.FrameNum, bt.Image.Name, bt.Image.Slide, bt.Address, symbol)
 				}
 			}
-			w.Flush()
-			var note string
-			if unslide {
-				note = " (may contain slid addresses)"
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+		var note string
+		if unslide {
+			note = " (may contain slid addresses)"
+		}
+		fmt.Printf("Thread %d State:%s\n%s\n", crashLog.CrashedThread, note, crashLog.Threads[crashLog.CrashedThread].State)
+		// slide := crashLog.Threads[crashLog.CrashedThread].BackTrace[0].Image.Slide
+		// for key, val := range crashLog.Threads[crashLog.CrashedThread].State {
+		// 	unslid := val - slide
+		// 	if sym, ok := f.AddressToSymbol[unslid]; ok {
+		// 		fmt.Printf("%4v: %#016x %s\n", key, val, sym)
+		// 	} else {
+		// 		fmt.Printf("%4v: %#016x\n", key, val)
+		// 	}
+		// }
+
+		if len(output) > 0 {
+			out, err := os.Create(output)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create %s", output)
 			}
-			fmt.Printf("\nThread %d State:%s\n%s\n", crashLog.CrashedThread, note, crashLog.Threads[crashLog.CrashedThread].State)
-			// slide := crashLog.Threads[crashLog.CrashedThread].BackTrace[0].Image.Slide
-			// for key, val := range crashLog.Threads[crashLog.CrashedThread].State {
-			// 	unslid := val - slide
-			// 	if sym, ok := f.AddressToSymbol[unslid]; ok {
-			// 		fmt.Printf("%4v: %#016x %s\n", key, val, sym)
-			// 	} else {
-			// 		fmt.Printf("%4v: %#016x\n", key, val)
-			// 	}
-			// }
-		} else {
-			log.Errorf("please supply a dyld_shared_cache for %s running %s (%s)", crashLog.HardwareModel, crashLog.OSVersion, crashLog.OSBuild)
+			defer out.Close()
+			if format == "ips" {
+				err = crashLog.WriteIPS(out)
+			} else {
+				err = crashLog.WriteText(out)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to write symbolicated crashlog")
+			}
+			log.Infof("Created %s", output)
 		}
 
 		return nil
@@ -0,0 +1,173 @@
+/*
+Copyright © 2019 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/watch"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().DurationP("interval", "i", time.Hour, "How often to poll the feeds")
+	watchCmd.Flags().Bool("once", false, "Poll the feeds once and exit")
+	watchCmd.Flags().StringSliceP("feeds", "f", []string{"itunes", "ota", "beta"}, "Feeds to watch (itunes, ota, beta)")
+	watchCmd.Flags().String("itunes-url", "", "iTunes version plist URL (i.e. of an 'ipsw mirror serve' mirror)")
+	watchCmd.Flags().String("ota-url", "", "OTA asset feed URL")
+	watchCmd.Flags().String("wiki-url", "", "iPhone Wiki URL to scrape for betas")
+	watchCmd.Flags().StringP("output", "o", "watch", "Folder to process new builds into")
+	watchCmd.Flags().String("state", "", "State file of the seen builds (default is <output>/state.json)")
+	watchCmd.Flags().Bool("all", false, "Process the builds already in a feed the first time it is polled (instead of only new ones)")
+	// pipeline
+	watchCmd.Flags().StringSliceP("devices", "d", []string{}, "Only process the files of these devices (i.e. iPhone12,3)")
+	watchCmd.Flags().Bool("download", false, "Download new builds")
+	watchCmd.Flags().BoolP("kernel", "k", false, "Extract the kernelcaches of new builds")
+	watchCmd.Flags().Bool("dyld", false, "Extract the dyld_shared_cache of new builds (IPSWs must be downloaded)")
+	watchCmd.Flags().Bool("diff", false, "Diff the extracted kernelcaches against the previous build's")
+	watchCmd.Flags().String("hook", "", "Shell command to run for new builds (gets the event JSON on stdin)")
+	addDownloadManagerFlags(watchCmd.Flags())
+	addRemoteCacheFlags(watchCmd.Flags())
+}
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch the IPSW/OTA/beta feeds and process new builds",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		interval, _ := cmd.Flags().GetDuration("interval")
+		once, _ := cmd.Flags().GetBool("once")
+		feedNames, _ := cmd.Flags().GetStringSlice("feeds")
+		itunesURL, _ := cmd.Flags().GetString("itunes-url")
+		otaURL, _ := cmd.Flags().GetString("ota-url")
+		wikiURL, _ := cmd.Flags().GetString("wiki-url")
+		output, _ := cmd.Flags().GetString("output")
+		statePath, _ := cmd.Flags().GetString("state")
+		processAll, _ := cmd.Flags().GetBool("all")
+		devices, _ := cmd.Flags().GetStringSlice("devices")
+		doDownload, _ := cmd.Flags().GetBool("download")
+		kernel, _ := cmd.Flags().GetBool("kernel")
+		dyld, _ := cmd.Flags().GetBool("dyld")
+		diff, _ := cmd.Flags().GetBool("diff")
+		hook, _ := cmd.Flags().GetString("hook")
+		proxy, _ := cmd.Flags().GetString("proxy")
+		insecure, _ := cmd.Flags().GetBool("insecure")
+
+		if interval <= 0 {
+			return fmt.Errorf("--interval must be greater than 0")
+		}
+		if diff {
+			kernel = true
+		}
+
+		var feeds []watch.Feed
+		for _, name := range feedNames {
+			switch strings.ToLower(name) {
+			case "itunes":
+				feeds = append(feeds, &watch.ITunesFeed{URL: itunesURL})
+			case "ota":
+				feeds = append(feeds, &watch.OTAFeed{URL: otaURL, Proxy: proxy, Insecure: insecure})
+			case "beta":
+				feeds = append(feeds, &watch.BetaFeed{URL: wikiURL})
+			default:
+				return fmt.Errorf("unknown feed %s (must be itunes, ota or beta)", name)
+			}
+		}
+
+		if len(statePath) == 0 {
+			statePath = filepath.Join(output, "state.json")
+		}
+		state, err := watch.LoadState(statePath)
+		if err != nil {
+			return err
+		}
+
+		dl, err := newDownloadManager(cmd)
+		if err != nil {
+			return err
+		}
+
+		w := &watch.Watcher{
+			Feeds:           feeds,
+			State:           state,
+			Interval:        interval,
+			Events:          os.Stdout,
+			ProcessExisting: processAll,
+			Handler: &watch.Pipeline{
+				Output:   output,
+				Devices:  devices,
+				Download: doDownload,
+				Kernel:   kernel,
+				Dyld:     dyld,
+				Diff:     diff,
+				Hook:     hook,
+				Manager:  dl,
+				Remote: download.RemoteConfig{
+					Proxy:    proxy,
+					Insecure: insecure,
+					Cache:    remoteCache(cmd),
+				},
+				State: state,
+			},
+		}
+
+		if once {
+			_, err := w.Poll()
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		go func() {
+			<-sig
+			log.Info("Stopping")
+			cancel()
+		}()
+
+		log.WithFields(log.Fields{"feeds": strings.Join(feedNames, ", "), "interval": interval}).Info("Watching")
+
+		if err := w.Run(ctx); err != context.Canceled {
+			return err
+		}
+
+		return nil
+	},
+}
@@ -44,6 +44,7 @@ const (
 )
 
 // Do demangle a string just as the GNU c++filt program does.
+// Swift symbols are detected by their mangling prefix and handed to the Swift demangler.
 func Do(name string, verbose, llvmStyle bool) string {
 	var deStr string
 	var options []Option
@@ -60,6 +61,10 @@ func Do(name string, verbose, llvmStyle bool) string {
 		return name
 	}
 
+	if IsSwiftSymbol(name) {
+		return SwiftFilter(name)
+	}
+
 	skip := 0
 	if name[0] == '.' || name[0] == '$' {
 		skip++
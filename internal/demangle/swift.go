@@ -0,0 +1,2386 @@
+package demangle
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file implements a demangler for Swift symbol names. It follows the
+// grammar in swift/docs/ABI/Mangling.rst and the structure of the reference
+// implementation in swift/lib/Demangling/Demangler.cpp: the mangled name is
+// read as a sequence of postfix operators which push nodes onto a stack.
+
+// ErrNotSwiftMangledName is returned by SwiftToString if the string does
+// not appear to be a Swift symbol name.
+var ErrNotSwiftMangledName = errors.New("not a Swift mangled name")
+
+// swiftPrefixes are the known Swift mangling prefixes (Swift 4, 4.2 and 5+)
+var swiftPrefixes = []string{"_T0", "$S", "_$S", "$s", "_$s", "$e", "_$e", "@__swiftmacro_"}
+
+const (
+	swiftMaxNumWords    = 26
+	swiftMaxRepeatCount = 2048
+	swiftMaxNodeDepth   = 1024
+)
+
+// IsSwiftSymbol returns true if name looks like a mangled Swift symbol.
+func IsSwiftSymbol(name string) bool {
+	return swiftPrefixLength(name) > 0 || strings.HasPrefix(name, "_Tt") || strings.HasPrefix(name, "__Tt")
+}
+
+func swiftPrefixLength(name string) int {
+	for _, prefix := range swiftPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return len(prefix)
+		}
+	}
+	// Mach-O symbols carry an extra leading underscore
+	if strings.HasPrefix(name, "_") {
+		for _, prefix := range swiftPrefixes {
+			if strings.HasPrefix(name[1:], prefix) {
+				return len(prefix) + 1
+			}
+		}
+	}
+	return 0
+}
+
+// SwiftFilter demangles a Swift symbol name, returning the human-readable name.
+// If any error occurs during demangling, the input string is returned.
+func SwiftFilter(name string) string {
+	ret, err := SwiftToString(name)
+	if err != nil {
+		return name
+	}
+	return ret
+}
+
+// SwiftToString demangles a Swift symbol name, returning a human-readable
+// name or an error.
+// If the name does not appear to be a Swift symbol name at all, the
+// error will be ErrNotSwiftMangledName.
+func SwiftToString(name string) (string, error) {
+	root, err := swiftDemangle(name)
+	if err != nil {
+		return "", err
+	}
+	p := swiftPrinter{}
+	p.print(root)
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.buf.String(), nil
+}
+
+var errSwiftDemangle = errors.New("failed to demangle Swift symbol")
+
+func swiftDemangle(name string) (*swiftNode, error) {
+	d := swiftDemangler{}
+	if strings.HasPrefix(name, "__Tt") {
+		name = name[1:]
+	}
+	if strings.HasPrefix(name, "_Tt") {
+		d.text = name
+		d.pos = 3
+		if n := d.demangleObjCTypeName(); n != nil {
+			return n, nil
+		}
+		return nil, errSwiftDemangle
+	}
+	prefixLen := swiftPrefixLength(name)
+	if prefixLen == 0 {
+		return nil, ErrNotSwiftMangledName
+	}
+	d.text = name
+	d.pos = prefixLen
+	d.oldFunctionTypeMangling = strings.HasPrefix(strings.TrimPrefix(name, "_"), "_T")
+
+	for d.pos < len(d.text) {
+		n := d.demangleOperator()
+		if n == nil {
+			return nil, errSwiftDemangle
+		}
+		d.push(n)
+	}
+
+	top := &swiftNode{kind: skGlobal}
+	parent := top
+	for {
+		attr := d.popIf(isSwiftFunctionAttr)
+		if attr == nil {
+			break
+		}
+		parent.add(attr)
+		if attr.kind == skPartialApplyForwarder || attr.kind == skPartialApplyObjCForwarder {
+			parent = attr
+		}
+	}
+	for _, n := range d.stack {
+		if n.kind == skType {
+			parent.add(n.child(0))
+		} else {
+			parent.add(n)
+		}
+	}
+	if len(top.children) == 0 {
+		return nil, errSwiftDemangle
+	}
+	return top, nil
+}
+
+type swiftDemangler struct {
+	text  string
+	pos   int
+	stack []*swiftNode
+	subst []*swiftNode
+	words []string
+
+	oldFunctionTypeMangling bool
+}
+
+/********************
+ * character helpers *
+ ********************/
+
+func (d *swiftDemangler) peek() byte {
+	if d.pos >= len(d.text) {
+		return 0
+	}
+	return d.text[d.pos]
+}
+
+func (d *swiftDemangler) next() byte {
+	if d.pos >= len(d.text) {
+		return 0
+	}
+	c := d.text[d.pos]
+	d.pos++
+	return c
+}
+
+func (d *swiftDemangler) nextIf(c byte) bool {
+	if d.peek() != c || d.pos >= len(d.text) {
+		return false
+	}
+	d.pos++
+	return true
+}
+
+func (d *swiftDemangler) pushBack() {
+	if d.pos > 0 {
+		d.pos--
+	}
+}
+
+func (d *swiftDemangler) natural() int {
+	if !isDigit(d.peek()) {
+		return -1000
+	}
+	num := 0
+	for isDigit(d.peek()) {
+		num = num*10 + int(d.next()-'0')
+		if num > 1<<30 {
+			return -1000
+		}
+	}
+	return num
+}
+
+func (d *swiftDemangler) demangleIndex() int {
+	if d.nextIf('_') {
+		return 0
+	}
+	if isDigit(d.peek()) {
+		num := d.natural()
+		if num >= 0 && d.nextIf('_') {
+			return num + 1
+		}
+	}
+	return -1000
+}
+
+/****************
+ * node helpers *
+ ****************/
+
+func (d *swiftDemangler) push(n *swiftNode) {
+	d.stack = append(d.stack, n)
+}
+
+func (d *swiftDemangler) pop() *swiftNode {
+	if len(d.stack) == 0 {
+		return nil
+	}
+	n := d.stack[len(d.stack)-1]
+	d.stack = d.stack[:len(d.stack)-1]
+	return n
+}
+
+func (d *swiftDemangler) popIf(pred func(swiftKind) bool) *swiftNode {
+	if len(d.stack) == 0 || !pred(d.stack[len(d.stack)-1].kind) {
+		return nil
+	}
+	return d.pop()
+}
+
+func (d *swiftDemangler) popKind(kinds ...swiftKind) *swiftNode {
+	if len(d.stack) == 0 {
+		return nil
+	}
+	top := d.stack[len(d.stack)-1].kind
+	for _, k := range kinds {
+		if top == k {
+			return d.pop()
+		}
+	}
+	return nil
+}
+
+func (d *swiftDemangler) addSubstitution(n *swiftNode) {
+	if n != nil {
+		d.subst = append(d.subst, n)
+	}
+}
+
+func newSwiftNode(kind swiftKind, text string) *swiftNode {
+	return &swiftNode{kind: kind, text: text}
+}
+
+func newSwiftIndexNode(kind swiftKind, index int) *swiftNode {
+	return &swiftNode{kind: kind, index: index}
+}
+
+// createWith returns a new node with the given children, or nil if any child is nil.
+func createWith(kind swiftKind, children ...*swiftNode) *swiftNode {
+	for _, c := range children {
+		if c == nil {
+			return nil
+		}
+	}
+	return &swiftNode{kind: kind, children: children}
+}
+
+// addChild adds child to parent, returning nil if either is nil.
+func addChild(parent, child *swiftNode) *swiftNode {
+	if parent == nil || child == nil {
+		return nil
+	}
+	parent.children = append(parent.children, child)
+	return parent
+}
+
+func createType(child *swiftNode) *swiftNode {
+	return createWith(skType, child)
+}
+
+func swiftType(kind swiftKind, name string) *swiftNode {
+	return createType(createWith(kind, newSwiftNode(skModule, "Swift"), newSwiftNode(skIdentifier, name)))
+}
+
+func changeKind(n *swiftNode, kind swiftKind) *swiftNode {
+	if n == nil {
+		return nil
+	}
+	c := *n
+	c.kind = kind
+	c.children = append([]*swiftNode(nil), n.children...)
+	return &c
+}
+
+func (d *swiftDemangler) popTypeAndGetChild() *swiftNode {
+	ty := d.popKind(skType)
+	if ty == nil || len(ty.children) != 1 {
+		return nil
+	}
+	return ty.child(0)
+}
+
+func (d *swiftDemangler) popTypeAndGetAnyGeneric() *swiftNode {
+	child := d.popTypeAndGetChild()
+	if child != nil && isSwiftAnyGeneric(child.kind) {
+		return child
+	}
+	return nil
+}
+
+func (d *swiftDemangler) popModule() *swiftNode {
+	if ident := d.popKind(skIdentifier); ident != nil {
+		return changeKind(ident, skModule)
+	}
+	return d.popKind(skModule)
+}
+
+func (d *swiftDemangler) popContext() *swiftNode {
+	if mod := d.popModule(); mod != nil {
+		return mod
+	}
+	if ty := d.popKind(skType); ty != nil {
+		if len(ty.children) != 1 || !isSwiftContext(ty.child(0).kind) {
+			return nil
+		}
+		return ty.child(0)
+	}
+	return d.popIf(isSwiftContext)
+}
+
+func (d *swiftDemangler) popProtocol() *swiftNode {
+	if ty := d.popKind(skType); ty != nil {
+		if len(ty.children) < 1 || !isSwiftExistential(ty) {
+			return nil
+		}
+		return ty
+	}
+	name := d.popIf(isSwiftDeclName)
+	ctx := d.popContext()
+	return createType(createWith(skProtocol, ctx, name))
+}
+
+/*************
+ * operators *
+ *************/
+
+func (d *swiftDemangler) demangleOperator() *swiftNode {
+	c := d.next()
+	switch c {
+	case 'A':
+		return d.demangleMultiSubstitutions()
+	case 'B':
+		return d.demangleBuiltinType()
+	case 'C':
+		return d.demangleAnyGenericType(skClass)
+	case 'D':
+		return createWith(skTypeMangling, d.popKind(skType))
+	case 'E':
+		return d.demangleExtensionContext()
+	case 'F':
+		return d.demanglePlainFunction()
+	case 'G':
+		return d.demangleBoundGenericType()
+	case 'I':
+		return d.demangleImplFunctionType()
+	case 'K':
+		return newSwiftNode(skThrowsAnnotation, "")
+	case 'L':
+		return d.demangleLocalIdentifier()
+	case 'M':
+		return d.demangleMetatype()
+	case 'N':
+		return createWith(skTypeMetadata, d.popKind(skType))
+	case 'O':
+		return d.demangleAnyGenericType(skEnum)
+	case 'P':
+		return d.demangleAnyGenericType(skProtocol)
+	case 'Q':
+		return d.demangleArchetype()
+	case 'R':
+		return d.demangleGenericRequirement()
+	case 'S':
+		return d.demangleStandardSubstitution()
+	case 'T':
+		return d.demangleThunkOrSpecialization()
+	case 'V':
+		return d.demangleAnyGenericType(skStructure)
+	case 'W':
+		return d.demangleWitness()
+	case 'X':
+		return d.demangleSpecialType()
+	case 'Y':
+		return d.demangleTypeAnnotation()
+	case 'Z':
+		return createWith(skStatic, d.popIf(isSwiftEntity))
+	case 'a':
+		return d.demangleAnyGenericType(skTypeAlias)
+	case 'c':
+		return d.popFunctionType(skFunctionType)
+	case 'd':
+		return newSwiftNode(skVariadicMarker, "")
+	case 'f':
+		return d.demangleFunctionEntity()
+	case 'h':
+		return createType(createWith(skShared, d.popTypeAndGetChild()))
+	case 'i':
+		return d.demangleSubscript()
+	case 'l':
+		return d.demangleGenericSignature(false)
+	case 'm':
+		return createType(createWith(skMetatype, d.popKind(skType)))
+	case 'n':
+		return createType(createWith(skOwned, d.popTypeAndGetChild()))
+	case 'o':
+		return d.demangleOperatorIdentifier()
+	case 'p':
+		return createType(d.demangleProtocolList())
+	case 'q':
+		return createType(d.demangleGenericParamIndex())
+	case 'r':
+		return d.demangleGenericSignature(true)
+	case 's':
+		return newSwiftNode(skModule, "Swift")
+	case 't':
+		return d.popTuple()
+	case 'u':
+		return d.demangleGenericType()
+	case 'v':
+		return d.demangleAccessor(d.demangleEntity(skVariable))
+	case 'w':
+		return d.demangleValueWitness()
+	case 'x':
+		return createType(dependentGenericParamType(0, 0))
+	case 'y':
+		return newSwiftNode(skEmptyList, "")
+	case 'z':
+		return createType(createWith(skInOut, d.popTypeAndGetChild()))
+	case '_':
+		return newSwiftNode(skFirstElementMarker, "")
+	case '.':
+		d.pushBack()
+		suffix := newSwiftNode(skSuffix, d.text[d.pos:])
+		d.pos = len(d.text)
+		return suffix
+	default:
+		d.pushBack()
+		return d.demangleIdentifier()
+	}
+}
+
+func isWordStart(c byte) bool {
+	return !isDigit(c) && c != '_' && c != 0
+}
+
+func isWordEnd(c, prev byte) bool {
+	return c == '_' || c == 0 || (!isUpper(prev) && isUpper(c))
+}
+
+func (d *swiftDemangler) demangleIdentifier() *swiftNode {
+	hasWordSubsts := false
+	isPunycoded := false
+	if !isDigit(d.peek()) {
+		return nil
+	}
+	if d.nextIf('0') {
+		if d.nextIf('0') {
+			isPunycoded = true
+		} else {
+			hasWordSubsts = true
+		}
+	}
+	var ident strings.Builder
+	for {
+		for hasWordSubsts && (isLower(d.peek()) || isUpper(d.peek())) {
+			c := d.next()
+			var idx int
+			if isLower(c) {
+				idx = int(c - 'a')
+			} else {
+				idx = int(c - 'A')
+				hasWordSubsts = false
+			}
+			if idx >= len(d.words) {
+				return nil
+			}
+			ident.WriteString(d.words[idx])
+		}
+		if d.nextIf('0') {
+			break
+		}
+		numChars := d.natural()
+		if numChars <= 0 {
+			return nil
+		}
+		if isPunycoded {
+			d.nextIf('_')
+		}
+		if d.pos+numChars > len(d.text) {
+			return nil
+		}
+		slice := d.text[d.pos : d.pos+numChars]
+		if isPunycoded {
+			decoded, ok := decodeSwiftPunycode(slice)
+			if !ok {
+				return nil
+			}
+			ident.WriteString(decoded)
+		} else {
+			ident.WriteString(slice)
+			wordStart := -1
+			for i := 0; i <= len(slice); i++ {
+				var c byte
+				if i < len(slice) {
+					c = slice[i]
+				}
+				if wordStart >= 0 && isWordEnd(c, slice[i-1]) {
+					if i-wordStart >= 2 && len(d.words) < swiftMaxNumWords {
+						d.words = append(d.words, slice[wordStart:i])
+					}
+					wordStart = -1
+				}
+				if wordStart < 0 && isWordStart(c) {
+					wordStart = i
+				}
+			}
+		}
+		d.pos += numChars
+		if !hasWordSubsts {
+			break
+		}
+	}
+	if ident.Len() == 0 {
+		return nil
+	}
+	n := newSwiftNode(skIdentifier, ident.String())
+	d.addSubstitution(n)
+	return n
+}
+
+// decodeSwiftPunycode decodes Swift's variant of punycode which uses
+// [a-zA-J] as digits and '_' as the delimiter.
+func decodeSwiftPunycode(input string) (string, bool) {
+	const (
+		base        = 36
+		tmin        = 1
+		tmax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+	)
+	digit := func(c byte) int {
+		switch {
+		case c >= 'a' && c <= 'z':
+			return int(c - 'a')
+		case c >= 'A' && c <= 'J':
+			return int(c-'A') + 26
+		}
+		return -1
+	}
+	adapt := func(delta, numPoints int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / numPoints
+		k := 0
+		for delta > ((base-tmin)*tmax)/2 {
+			delta /= base - tmin
+			k += base
+		}
+		return k + (((base - tmin + 1) * delta) / (delta + skew))
+	}
+
+	var output []rune
+	n := initialN
+	i := 0
+	bias := initialBias
+	if lastDelim := strings.LastIndexByte(input, '_'); lastDelim >= 0 {
+		for j := 0; j < lastDelim; j++ {
+			if input[j] >= 0x80 {
+				return "", false
+			}
+			output = append(output, rune(input[j]))
+		}
+		input = input[lastDelim+1:]
+	}
+	for pos := 0; pos < len(input); {
+		oldi := i
+		w := 1
+		for k := base; ; k += base {
+			if pos >= len(input) {
+				return "", false
+			}
+			dg := digit(input[pos])
+			pos++
+			if dg < 0 {
+				return "", false
+			}
+			i += dg * w
+			t := k - bias
+			if k <= bias {
+				t = tmin
+			} else if k >= bias+tmax {
+				t = tmax
+			}
+			if dg < t {
+				break
+			}
+			w *= base - t
+		}
+		bias = adapt(i-oldi, len(output)+1, oldi == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n < 0x80 || !utf8.ValidRune(rune(n)) {
+			return "", false
+		}
+		output = append(output[:i], append([]rune{rune(n)}, output[i:]...)...)
+		i++
+	}
+	return string(output), true
+}
+
+func (d *swiftDemangler) pushMultiSubstitutions(repeatCount, idx int) *swiftNode {
+	if idx >= len(d.subst) || repeatCount > swiftMaxRepeatCount {
+		return nil
+	}
+	n := d.subst[idx]
+	for repeatCount > 1 {
+		d.push(n)
+		repeatCount--
+	}
+	return n
+}
+
+func (d *swiftDemangler) demangleMultiSubstitutions() *swiftNode {
+	repeatCount := -1
+	for {
+		c := d.next()
+		switch {
+		case c == 0:
+			return nil
+		case isLower(c):
+			n := d.pushMultiSubstitutions(repeatCount, int(c-'a'))
+			if n == nil {
+				return nil
+			}
+			d.push(n)
+			repeatCount = -1
+		case isUpper(c):
+			return d.pushMultiSubstitutions(repeatCount, int(c-'A'))
+		case c == '_':
+			idx := repeatCount + 27
+			if idx >= len(d.subst) {
+				return nil
+			}
+			return d.subst[idx]
+		default:
+			d.pushBack()
+			repeatCount = d.natural()
+			if repeatCount < 0 {
+				return nil
+			}
+		}
+	}
+}
+
+type swiftStdType struct {
+	kind swiftKind
+	name string
+}
+
+var swiftStandardTypes = map[byte]swiftStdType{
+	'A': {skStructure, "AutoreleasingUnsafeMutablePointer"},
+	'a': {skStructure, "Array"},
+	'B': {skProtocol, "BinaryFloatingPoint"},
+	'b': {skStructure, "Bool"},
+	'c': {skStructure, "UnicodeScalar"},
+	'D': {skStructure, "Dictionary"},
+	'd': {skStructure, "Double"},
+	'E': {skProtocol, "Encodable"},
+	'e': {skProtocol, "Decodable"},
+	'F': {skProtocol, "FloatingPoint"},
+	'f': {skStructure, "Float"},
+	'G': {skProtocol, "RandomNumberGenerator"},
+	'H': {skProtocol, "Hashable"},
+	'h': {skStructure, "Set"},
+	'I': {skStructure, "DefaultIndices"},
+	'i': {skStructure, "Int"},
+	'J': {skStructure, "Character"},
+	'j': {skProtocol, "Numeric"},
+	'K': {skProtocol, "BidirectionalCollection"},
+	'k': {skProtocol, "RandomAccessCollection"},
+	'L': {skProtocol, "Comparable"},
+	'l': {skProtocol, "Collection"},
+	'M': {skProtocol, "MutableCollection"},
+	'm': {skProtocol, "RangeReplaceableCollection"},
+	'N': {skStructure, "ClosedRange"},
+	'n': {skStructure, "Range"},
+	'O': {skStructure, "ObjectIdentifier"},
+	'P': {skStructure, "UnsafePointer"},
+	'p': {skStructure, "UnsafeMutablePointer"},
+	'Q': {skProtocol, "Equatable"},
+	'q': {skEnum, "Optional"},
+	'R': {skStructure, "UnsafeBufferPointer"},
+	'r': {skStructure, "UnsafeRawBufferPointer"},
+	'S': {skStructure, "String"},
+	's': {skStructure, "Substring"},
+	'T': {skProtocol, "Sequence"},
+	't': {skProtocol, "IteratorProtocol"},
+	'U': {skProtocol, "UnsignedInteger"},
+	'u': {skStructure, "UInt"},
+	'V': {skStructure, "UnsafeRawPointer"},
+	'v': {skStructure, "UnsafeMutableRawPointer"},
+	'W': {skStructure, "UnsafeMutableBufferPointer"},
+	'w': {skStructure, "UnsafeMutableRawBufferPointer"},
+	'X': {skProtocol, "RangeExpression"},
+	'x': {skProtocol, "Strideable"},
+	'Y': {skProtocol, "RawRepresentable"},
+	'y': {skProtocol, "StringProtocol"},
+	'Z': {skProtocol, "SignedInteger"},
+	'z': {skProtocol, "BinaryInteger"},
+}
+
+// swiftConcurrencyTypes are the second level ('Sc') standard substitutions
+var swiftConcurrencyTypes = map[byte]swiftStdType{
+	'A': {skProtocol, "Actor"},
+	'C': {skStructure, "CheckedContinuation"},
+	'c': {skStructure, "UnsafeContinuation"},
+	'E': {skStructure, "CancellationError"},
+	'e': {skStructure, "UnownedSerialExecutor"},
+	'F': {skProtocol, "Executor"},
+	'f': {skProtocol, "SerialExecutor"},
+	'G': {skStructure, "TaskGroup"},
+	'g': {skStructure, "ThrowingTaskGroup"},
+	'h': {skProtocol, "TaskExecutor"},
+	'I': {skProtocol, "AsyncIteratorProtocol"},
+	'i': {skProtocol, "AsyncSequence"},
+	'J': {skStructure, "UnownedJob"},
+	'M': {skClass, "MainActor"},
+	'P': {skStructure, "TaskPriority"},
+	'S': {skStructure, "AsyncStream"},
+	's': {skStructure, "AsyncThrowingStream"},
+	'T': {skStructure, "Task"},
+	't': {skStructure, "UnsafeCurrentTask"},
+}
+
+func (d *swiftDemangler) demangleStandardSubstitution() *swiftNode {
+	switch c := d.next(); c {
+	case 'o':
+		return newSwiftNode(skModule, "__C")
+	case 'C':
+		return newSwiftNode(skModule, "__C_Synthesized")
+	case 'g':
+		opt := createType(createWith(skBoundGenericEnum, swiftType(skEnum, "Optional"), createWith(skTypeList, d.popKind(skType))))
+		d.addSubstitution(opt)
+		return opt
+	default:
+		d.pushBack()
+		repeatCount := d.natural()
+		if repeatCount > swiftMaxRepeatCount {
+			return nil
+		}
+		table := swiftStandardTypes
+		if d.nextIf('c') {
+			table = swiftConcurrencyTypes
+		}
+		std, ok := table[d.next()]
+		if !ok {
+			return nil
+		}
+		n := swiftType(std.kind, std.name)
+		for ; repeatCount > 1; repeatCount-- {
+			d.push(n)
+		}
+		return n
+	}
+}
+
+func (d *swiftDemangler) demangleBuiltinType() *swiftNode {
+	var name string
+	switch d.next() {
+	case 'b':
+		name = "Builtin.BridgeObject"
+	case 'B':
+		name = "Builtin.UnsafeValueBuffer"
+	case 'c':
+		name = "Builtin.RawUnsafeContinuation"
+	case 'D':
+		name = "Builtin.DefaultActorStorage"
+	case 'd':
+		name = "Builtin.NonDefaultDistributedActorStorage"
+	case 'e':
+		name = "Builtin.Executor"
+	case 'f':
+		size := d.natural()
+		if size <= 0 || !d.nextIf('_') {
+			return nil
+		}
+		name = "Builtin.FPIEEE" + itoa(size)
+	case 'i':
+		size := d.natural()
+		if size <= 0 || !d.nextIf('_') {
+			return nil
+		}
+		name = "Builtin.Int" + itoa(size)
+	case 'I':
+		name = "Builtin.IntLiteral"
+	case 'j':
+		name = "Builtin.Job"
+	case 'O':
+		name = "Builtin.UnknownObject"
+	case 'o':
+		name = "Builtin.NativeObject"
+	case 'p':
+		name = "Builtin.RawPointer"
+	case 't':
+		name = "Builtin.SILToken"
+	case 'v':
+		elts := d.natural()
+		if elts <= 0 || !d.nextIf('_') {
+			return nil
+		}
+		elt := d.popTypeAndGetChild()
+		if elt == nil || elt.kind != skBuiltinTypeName || !strings.HasPrefix(elt.text, "Builtin.") {
+			return nil
+		}
+		name = "Builtin.Vec" + itoa(elts) + "x" + strings.TrimPrefix(elt.text, "Builtin.")
+	case 'w':
+		name = "Builtin.Word"
+	default:
+		return nil
+	}
+	return createType(newSwiftNode(skBuiltinTypeName, name))
+}
+
+func itoa(i int) string {
+	if i == 0 {
+		return "0"
+	}
+	var b []byte
+	neg := i < 0
+	if neg {
+		i = -i
+	}
+	for i > 0 {
+		b = append([]byte{byte('0' + i%10)}, b...)
+		i /= 10
+	}
+	if neg {
+		return "-" + string(b)
+	}
+	return string(b)
+}
+
+func (d *swiftDemangler) demangleAnyGenericType(kind swiftKind) *swiftNode {
+	name := d.popIf(isSwiftDeclName)
+	ctx := d.popContext()
+	ty := createType(createWith(kind, ctx, name))
+	d.addSubstitution(ty)
+	return ty
+}
+
+func (d *swiftDemangler) demangleExtensionContext() *swiftNode {
+	sig := d.popKind(skDependentGenericSignature)
+	mod := d.popModule()
+	ty := d.popTypeAndGetAnyGeneric()
+	ext := createWith(skExtension, mod, ty)
+	if sig != nil {
+		ext = addChild(ext, sig)
+	}
+	return ext
+}
+
+func (d *swiftDemangler) demangleLocalIdentifier() *swiftNode {
+	if d.nextIf('L') {
+		discriminator := d.popKind(skIdentifier)
+		name := d.popIf(isSwiftDeclName)
+		return createWith(skPrivateDeclName, discriminator, name)
+	}
+	if d.nextIf('l') {
+		return createWith(skPrivateDeclName, d.popKind(skIdentifier))
+	}
+	if c := d.peek(); (c >= 'a' && c <= 'j') || (c >= 'A' && c <= 'J') {
+		// related entity declarations (e.g. imported C error codes)
+		d.next()
+		return createWith(skPrivateDeclName, d.popKind(skIdentifier), d.popIf(isSwiftDeclName))
+	}
+	idx := d.demangleIndex()
+	if idx < 0 {
+		return nil
+	}
+	name := d.popIf(isSwiftDeclName)
+	return createWith(skLocalDeclName, newSwiftIndexNode(skNumber, idx), name)
+}
+
+func (d *swiftDemangler) demangleOperatorIdentifier() *swiftNode {
+	ident := d.popKind(skIdentifier)
+	if ident == nil {
+		return nil
+	}
+	const opCharTable = "& @/= >    <*!|+?%-~   ^ ."
+	op := []byte(ident.text)
+	for i, c := range op {
+		if c >= 0x80 {
+			continue
+		}
+		if !isLower(c) {
+			return nil
+		}
+		if o := opCharTable[c-'a']; o != ' ' {
+			op[i] = o
+		} else {
+			return nil
+		}
+	}
+	switch d.next() {
+	case 'i':
+		return newSwiftNode(skInfixOperator, string(op))
+	case 'p':
+		return newSwiftNode(skPrefixOperator, string(op))
+	case 'P':
+		return newSwiftNode(skPostfixOperator, string(op))
+	}
+	return nil
+}
+
+/************************
+ * tuples and functions *
+ ************************/
+
+func (d *swiftDemangler) popTuple() *swiftNode {
+	root := newSwiftNode(skTuple, "")
+	if d.popKind(skEmptyList) == nil {
+		for {
+			first := d.popKind(skFirstElementMarker) != nil
+			elem := newSwiftNode(skTupleElement, "")
+			elem.add(d.popKind(skVariadicMarker))
+			if ident := d.popKind(skIdentifier); ident != nil {
+				elem.add(newSwiftNode(skTupleElementName, ident.text))
+			}
+			ty := d.popKind(skType)
+			if ty == nil {
+				return nil
+			}
+			elem.add(ty)
+			root.add(elem)
+			if first {
+				break
+			}
+		}
+		root.reverseChildren(0)
+	}
+	return createType(root)
+}
+
+func (d *swiftDemangler) popTypeList() *swiftNode {
+	root := newSwiftNode(skTypeList, "")
+	if d.popKind(skEmptyList) == nil {
+		for {
+			first := d.popKind(skFirstElementMarker) != nil
+			ty := d.popKind(skType)
+			if ty == nil {
+				return nil
+			}
+			root.add(ty)
+			if first {
+				break
+			}
+		}
+		root.reverseChildren(0)
+	}
+	return root
+}
+
+func (d *swiftDemangler) popFunctionType(kind swiftKind) *swiftNode {
+	fn := newSwiftNode(kind, "")
+	fn.add(d.popKind(skGlobalActorFunctionType))
+	fn.add(d.popKind(skThrowsAnnotation, skTypedThrowsAnnotation))
+	fn.add(d.popKind(skConcurrentFunctionType))
+	fn.add(d.popKind(skAsyncAnnotation))
+	fn = addChild(fn, d.popFunctionParams(skArgumentTuple))
+	fn = addChild(fn, d.popFunctionParams(skReturnType))
+	return createType(fn)
+}
+
+func (d *swiftDemangler) popFunctionParams(kind swiftKind) *swiftNode {
+	var params *swiftNode
+	if d.popKind(skEmptyList) != nil {
+		params = createType(newSwiftNode(skTuple, ""))
+	} else {
+		params = d.popKind(skType)
+	}
+	return createWith(kind, params)
+}
+
+func (d *swiftDemangler) popFunctionParamLabels(ty *swiftNode) *swiftNode {
+	if !d.oldFunctionTypeMangling && d.popKind(skEmptyList) != nil {
+		return newSwiftNode(skLabelList, "")
+	}
+	if ty == nil || ty.kind != skType {
+		return nil
+	}
+	fn := ty.child(0)
+	if fn != nil && fn.kind == skDependentGenericType {
+		fn = fn.child(1).child(0)
+	}
+	if fn == nil || (fn.kind != skFunctionType && fn.kind != skNoEscapeFunctionType) {
+		return nil
+	}
+	args := fn.firstChildOf(skArgumentTuple)
+	if args == nil {
+		return nil
+	}
+	params := args.child(0).child(0)
+	if params == nil {
+		return nil
+	}
+	numParams := 1
+	if params.kind == skTuple {
+		numParams = len(params.children)
+	}
+	if numParams == 0 {
+		return nil
+	}
+
+	labels := newSwiftNode(skLabelList, "")
+	if d.oldFunctionTypeMangling {
+		// old style function type mangling has labels as part of the argument tuple
+		if params.kind != skTuple {
+			return labels
+		}
+		hasLabels := false
+		for _, param := range params.children {
+			var label *swiftNode
+			for i, c := range param.children {
+				if c.kind == skTupleElementName {
+					label = newSwiftNode(skIdentifier, c.text)
+					param.children = append(param.children[:i], param.children[i+1:]...)
+					hasLabels = true
+					break
+				}
+			}
+			if label == nil {
+				label = newSwiftNode(skFirstElementMarker, "")
+			}
+			labels.add(label)
+		}
+		if !hasLabels {
+			return newSwiftNode(skLabelList, "")
+		}
+		return labels
+	}
+
+	hasLabels := false
+	for i := 0; i < numParams; i++ {
+		label := d.popKind(skIdentifier, skFirstElementMarker)
+		if label == nil {
+			return nil
+		}
+		labels.add(label)
+		hasLabels = hasLabels || label.kind == skIdentifier
+	}
+	if !hasLabels {
+		return newSwiftNode(skLabelList, "")
+	}
+	labels.reverseChildren(0)
+	return labels
+}
+
+func (d *swiftDemangler) demanglePlainFunction() *swiftNode {
+	sig := d.popKind(skDependentGenericSignature)
+	ty := d.popFunctionType(skFunctionType)
+	labels := d.popFunctionParamLabels(ty)
+	if sig != nil {
+		ty = createType(createWith(skDependentGenericType, sig, ty))
+	}
+	name := d.popIf(isSwiftDeclName)
+	ctx := d.popContext()
+	if labels != nil {
+		return createWith(skFunction, ctx, name, labels, ty)
+	}
+	return createWith(skFunction, ctx, name, ty)
+}
+
+func (d *swiftDemangler) demangleEntity(kind swiftKind) *swiftNode {
+	ty := d.popKind(skType)
+	labels := d.popFunctionParamLabels(ty)
+	name := d.popIf(isSwiftDeclName)
+	ctx := d.popContext()
+	if labels != nil {
+		return createWith(kind, ctx, name, labels, ty)
+	}
+	return createWith(kind, ctx, name, ty)
+}
+
+func (d *swiftDemangler) demangleAccessor(child *swiftNode) *swiftNode {
+	var kind swiftKind
+	switch d.next() {
+	case 'm':
+		kind = skMaterializeForSet
+	case 's':
+		kind = skSetter
+	case 'g':
+		kind = skGetter
+	case 'G':
+		kind = skGlobalGetter
+	case 'w':
+		kind = skWillSet
+	case 'W':
+		kind = skDidSet
+	case 'r':
+		kind = skReadAccessor
+	case 'M':
+		kind = skModifyAccessor
+	case 'i':
+		kind = skInitAccessor
+	case 'a':
+		switch d.next() {
+		case 'O':
+			kind = skOwningMutableAddressor
+		case 'o':
+			kind = skNativeOwningMutableAddressor
+		case 'P':
+			kind = skNativePinningMutableAddressor
+		case 'u':
+			kind = skUnsafeMutableAddressor
+		default:
+			return nil
+		}
+	case 'l':
+		switch d.next() {
+		case 'O':
+			kind = skOwningAddressor
+		case 'o':
+			kind = skNativeOwningAddressor
+		case 'p':
+			kind = skNativePinningAddressor
+		case 'u':
+			kind = skUnsafeAddressor
+		default:
+			return nil
+		}
+	case 'p':
+		// pseudo-accessor referring to the variable/subscript itself
+		return child
+	default:
+		return nil
+	}
+	return createWith(kind, child)
+}
+
+func (d *swiftDemangler) demangleSubscript() *swiftNode {
+	privateName := d.popKind(skPrivateDeclName)
+	ty := d.popKind(skType)
+	labels := d.popFunctionParamLabels(ty)
+	ctx := d.popContext()
+	sub := createWith(skSubscript, ctx)
+	sub.add(labels)
+	sub = addChild(sub, ty)
+	sub.add(privateName)
+	return d.demangleAccessor(sub)
+}
+
+func (d *swiftDemangler) demangleFunctionEntity() *swiftNode {
+	const (
+		argsNone = iota
+		argsTypeAndMaybePrivateName
+		argsTypeAndIndex
+		argsIndex
+	)
+	args := argsNone
+	var kind swiftKind
+	switch d.next() {
+	case 'D':
+		kind = skDeallocator
+	case 'd':
+		kind = skDestructor
+	case 'E':
+		kind = skIVarDestroyer
+	case 'e':
+		kind = skIVarInitializer
+	case 'i':
+		kind = skInitializer
+	case 'C':
+		kind, args = skAllocator, argsTypeAndMaybePrivateName
+	case 'c':
+		kind, args = skConstructor, argsTypeAndMaybePrivateName
+	case 'U':
+		kind, args = skExplicitClosure, argsTypeAndIndex
+	case 'u':
+		kind, args = skImplicitClosure, argsTypeAndIndex
+	case 'A':
+		kind, args = skDefaultArgumentInitializer, argsIndex
+	default:
+		return nil
+	}
+
+	var nameOrIndex, paramType, labels *swiftNode
+	switch args {
+	case argsTypeAndMaybePrivateName:
+		nameOrIndex = d.popKind(skPrivateDeclName)
+		paramType = d.popKind(skType)
+		labels = d.popFunctionParamLabels(paramType)
+	case argsTypeAndIndex:
+		idx := d.demangleIndex()
+		if idx < 0 {
+			return nil
+		}
+		nameOrIndex = newSwiftIndexNode(skNumber, idx)
+		paramType = d.popKind(skType)
+	case argsIndex:
+		idx := d.demangleIndex()
+		if idx < 0 {
+			return nil
+		}
+		nameOrIndex = newSwiftIndexNode(skNumber, idx)
+	}
+
+	entity := createWith(kind, d.popContext())
+	switch args {
+	case argsIndex:
+		entity = addChild(entity, nameOrIndex)
+	case argsTypeAndMaybePrivateName:
+		entity.add(labels)
+		entity = addChild(entity, paramType)
+		entity.add(nameOrIndex)
+	case argsTypeAndIndex:
+		entity = addChild(entity, nameOrIndex)
+		entity.add(paramType)
+	}
+	return entity
+}
+
+/*******************
+ * generic support *
+ *******************/
+
+func dependentGenericParamType(depth, index int) *swiftNode {
+	if depth < 0 || index < 0 {
+		return nil
+	}
+	return &swiftNode{
+		kind:     skDependentGenericParamType,
+		text:     genericParameterName(depth, index),
+		children: []*swiftNode{newSwiftIndexNode(skNumber, depth), newSwiftIndexNode(skNumber, index)},
+	}
+}
+
+func (d *swiftDemangler) demangleGenericParamIndex() *swiftNode {
+	if d.nextIf('d') {
+		depth := d.demangleIndex() + 1
+		index := d.demangleIndex()
+		return dependentGenericParamType(depth, index)
+	}
+	if d.nextIf('z') {
+		return dependentGenericParamType(0, 0)
+	}
+	if d.nextIf('s') {
+		return newSwiftNode(skDependentGenericParamType, "Self")
+	}
+	return dependentGenericParamType(0, d.demangleIndex()+1)
+}
+
+func (d *swiftDemangler) demangleBoundGenerics() ([]*swiftNode, bool) {
+	var lists []*swiftNode
+	for {
+		list := newSwiftNode(skTypeList, "")
+		lists = append(lists, list)
+		for {
+			ty := d.popKind(skType)
+			if ty == nil {
+				break
+			}
+			list.add(ty)
+		}
+		list.reverseChildren(0)
+		if d.popKind(skEmptyList) != nil {
+			break
+		}
+		if d.popKind(skFirstElementMarker) == nil {
+			return nil, false
+		}
+	}
+	return lists, true
+}
+
+func (d *swiftDemangler) demangleBoundGenericType() *swiftNode {
+	lists, ok := d.demangleBoundGenerics()
+	if !ok {
+		return nil
+	}
+	nominal := d.popTypeAndGetAnyGeneric()
+	bound := d.demangleBoundGenericArgs(nominal, lists, 0)
+	ty := createType(bound)
+	d.addSubstitution(ty)
+	return ty
+}
+
+func (d *swiftDemangler) demangleBoundGenericArgs(nominal *swiftNode, lists []*swiftNode, idx int) *swiftNode {
+	if nominal == nil || idx >= len(lists) {
+		return nil
+	}
+	args := lists[idx]
+	idx++
+	if idx < len(lists) {
+		ctx := nominal.child(0)
+		var parent *swiftNode
+		if ctx != nil && ctx.kind == skExtension {
+			parent = createWith(skExtension, ctx.child(0), d.demangleBoundGenericArgs(ctx.child(1), lists, idx))
+			if parent != nil && len(ctx.children) == 3 {
+				parent.add(ctx.child(2))
+			}
+		} else {
+			parent = d.demangleBoundGenericArgs(ctx, lists, idx)
+		}
+		if parent == nil {
+			return nil
+		}
+		rebuilt := createWith(nominal.kind, parent)
+		rebuilt.children = append(rebuilt.children, nominal.children[1:]...)
+		nominal = rebuilt
+	}
+	if len(args.children) == 0 {
+		return nominal
+	}
+	var kind swiftKind
+	switch nominal.kind {
+	case skClass:
+		kind = skBoundGenericClass
+	case skStructure:
+		kind = skBoundGenericStructure
+	case skEnum:
+		kind = skBoundGenericEnum
+	case skProtocol:
+		kind = skBoundGenericProtocol
+	case skTypeAlias:
+		kind = skBoundGenericTypeAlias
+	case skOtherNominalType:
+		kind = skBoundGenericOtherNominalType
+	case skFunction, skConstructor:
+		return createWith(skBoundGenericFunction, nominal, args)
+	default:
+		return nil
+	}
+	return createWith(kind, createType(nominal), args)
+}
+
+func (d *swiftDemangler) demangleGenericType() *swiftNode {
+	sig := d.popKind(skDependentGenericSignature)
+	ty := d.popKind(skType)
+	return createType(createWith(skDependentGenericType, sig, ty))
+}
+
+func (d *swiftDemangler) demangleGenericSignature(hasParamCounts bool) *swiftNode {
+	sig := newSwiftNode(skDependentGenericSignature, "")
+	if hasParamCounts {
+		for !d.nextIf('l') {
+			count := 0
+			if !d.nextIf('z') {
+				count = d.demangleIndex() + 1
+			}
+			if count < 0 || d.pos >= len(d.text) {
+				return nil
+			}
+			sig.add(newSwiftIndexNode(skDependentGenericParamCount, count))
+		}
+	} else {
+		sig.add(newSwiftIndexNode(skDependentGenericParamCount, 1))
+	}
+	numCounts := len(sig.children)
+	for {
+		req := d.popIf(isSwiftRequirement)
+		if req == nil {
+			break
+		}
+		sig.add(req)
+	}
+	sig.reverseChildren(numCounts)
+	return sig
+}
+
+func (d *swiftDemangler) popAssocTypeName() *swiftNode {
+	proto := d.popKind(skType)
+	if proto != nil && !isSwiftExistential(proto) {
+		return nil
+	}
+	id := d.popKind(skIdentifier)
+	ref := changeKind(id, skDependentAssociatedTypeRef)
+	if ref != nil {
+		ref.add(proto)
+	}
+	return ref
+}
+
+func (d *swiftDemangler) demangleAssociatedTypeSimple(base *swiftNode) *swiftNode {
+	name := d.popAssocTypeName()
+	var baseTy *swiftNode
+	if base != nil {
+		baseTy = createType(base)
+	} else {
+		baseTy = d.popKind(skType)
+	}
+	return createType(createWith(skDependentMemberType, baseTy, name))
+}
+
+func (d *swiftDemangler) demangleAssociatedTypeCompound(base *swiftNode) *swiftNode {
+	var names []*swiftNode
+	for {
+		first := d.popKind(skFirstElementMarker) != nil
+		name := d.popAssocTypeName()
+		if name == nil {
+			return nil
+		}
+		names = append(names, name)
+		if first {
+			break
+		}
+	}
+	var baseTy *swiftNode
+	if base != nil {
+		baseTy = createType(base)
+	} else {
+		baseTy = d.popKind(skType)
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		baseTy = createType(createWith(skDependentMemberType, baseTy, names[i]))
+	}
+	return baseTy
+}
+
+func (d *swiftDemangler) demangleGenericRequirement() *swiftNode {
+	const (
+		typeGeneric = iota
+		typeAssoc
+		typeCompoundAssoc
+		typeSubstitution
+	)
+	const (
+		constraintProtocol = iota
+		constraintBaseClass
+		constraintSameType
+		constraintLayout
+	)
+	var typeKind, constraintKind int
+	switch d.next() {
+	case 'c':
+		constraintKind, typeKind = constraintBaseClass, typeAssoc
+	case 'C':
+		constraintKind, typeKind = constraintBaseClass, typeCompoundAssoc
+	case 'b':
+		constraintKind, typeKind = constraintBaseClass, typeGeneric
+	case 'B':
+		constraintKind, typeKind = constraintBaseClass, typeSubstitution
+	case 't':
+		constraintKind, typeKind = constraintSameType, typeAssoc
+	case 'T':
+		constraintKind, typeKind = constraintSameType, typeCompoundAssoc
+	case 's':
+		constraintKind, typeKind = constraintSameType, typeGeneric
+	case 'S':
+		constraintKind, typeKind = constraintSameType, typeSubstitution
+	case 'm':
+		constraintKind, typeKind = constraintLayout, typeAssoc
+	case 'M':
+		constraintKind, typeKind = constraintLayout, typeCompoundAssoc
+	case 'l':
+		constraintKind, typeKind = constraintLayout, typeGeneric
+	case 'L':
+		constraintKind, typeKind = constraintLayout, typeSubstitution
+	case 'p':
+		constraintKind, typeKind = constraintProtocol, typeAssoc
+	case 'P':
+		constraintKind, typeKind = constraintProtocol, typeCompoundAssoc
+	case 'Q':
+		constraintKind, typeKind = constraintProtocol, typeSubstitution
+	default:
+		constraintKind, typeKind = constraintProtocol, typeGeneric
+		d.pushBack()
+	}
+
+	var constrTy *swiftNode
+	switch typeKind {
+	case typeGeneric:
+		constrTy = createType(d.demangleGenericParamIndex())
+	case typeAssoc:
+		constrTy = d.demangleAssociatedTypeSimple(d.demangleGenericParamIndex())
+		d.addSubstitution(constrTy)
+	case typeCompoundAssoc:
+		constrTy = d.demangleAssociatedTypeCompound(d.demangleGenericParamIndex())
+		d.addSubstitution(constrTy)
+	case typeSubstitution:
+		constrTy = d.popKind(skType)
+	}
+
+	switch constraintKind {
+	case constraintProtocol:
+		return createWith(skDependentGenericConformanceRequirement, constrTy, d.popProtocol())
+	case constraintBaseClass:
+		return createWith(skDependentGenericConformanceRequirement, constrTy, d.popKind(skType))
+	case constraintSameType:
+		return createWith(skDependentGenericSameTypeRequirement, constrTy, d.popKind(skType))
+	}
+
+	var layout string
+	switch c := d.next(); c {
+	case 'U':
+		layout = "_UnknownLayout"
+	case 'R':
+		layout = "_RefCountedObject"
+	case 'N':
+		layout = "_NativeRefCountedObject"
+	case 'C':
+		layout = "AnyObject"
+	case 'D':
+		layout = "_NativeClass"
+	case 'T':
+		layout = "_Trivial"
+	case 'E', 'e', 'M', 'm':
+		size := d.demangleIndex() - 1
+		if size < 0 {
+			return nil
+		}
+		if c == 'E' || c == 'e' {
+			layout = "_Trivial(" + itoa(size)
+		} else {
+			layout = "_TrivialAtMost(" + itoa(size)
+		}
+		if c == 'e' || c == 'm' {
+			align := d.demangleIndex() - 1
+			if align < 0 {
+				return nil
+			}
+			layout += ", " + itoa(align)
+		}
+		layout += ")"
+	default:
+		return nil
+	}
+	req := createWith(skDependentGenericLayoutRequirement, constrTy)
+	if req != nil {
+		req.text = layout
+	}
+	return req
+}
+
+func (d *swiftDemangler) demangleArchetype() *swiftNode {
+	switch d.next() {
+	case 'a':
+		ident := d.popKind(skIdentifier)
+		archeTy := d.popTypeAndGetChild()
+		ty := createType(createWith(skAssociatedTypeRef, archeTy, ident))
+		d.addSubstitution(ty)
+		return ty
+	case 'O':
+		return createWith(skOpaqueReturnTypeOf, d.popContext())
+	case 'o':
+		idx := d.demangleIndex()
+		if idx < 0 {
+			return nil
+		}
+		lists, ok := d.demangleBoundGenerics()
+		if !ok {
+			return nil
+		}
+		name := d.pop()
+		args := newSwiftNode(skTypeList, "")
+		for i := len(lists) - 1; i >= 0; i-- {
+			args.children = append(args.children, lists[i].children...)
+		}
+		opaque := createWith(skOpaqueType, name, newSwiftIndexNode(skNumber, idx), args)
+		ty := createType(opaque)
+		d.addSubstitution(ty)
+		return ty
+	case 'r':
+		return createType(newSwiftNode(skOpaqueReturnType, ""))
+	case 'R':
+		idx := d.demangleIndex()
+		if idx < 0 {
+			return nil
+		}
+		return createType(newSwiftIndexNode(skOpaqueReturnType, idx))
+	case 'x':
+		ty := d.demangleAssociatedTypeSimple(nil)
+		d.addSubstitution(ty)
+		return ty
+	case 'X':
+		ty := d.demangleAssociatedTypeCompound(nil)
+		d.addSubstitution(ty)
+		return ty
+	case 'y':
+		ty := d.demangleAssociatedTypeSimple(d.demangleGenericParamIndex())
+		d.addSubstitution(ty)
+		return ty
+	case 'Y':
+		ty := d.demangleAssociatedTypeCompound(d.demangleGenericParamIndex())
+		d.addSubstitution(ty)
+		return ty
+	case 'z':
+		ty := d.demangleAssociatedTypeSimple(dependentGenericParamType(0, 0))
+		d.addSubstitution(ty)
+		return ty
+	case 'Z':
+		ty := d.demangleAssociatedTypeCompound(dependentGenericParamType(0, 0))
+		d.addSubstitution(ty)
+		return ty
+	}
+	return nil
+}
+
+func (d *swiftDemangler) demangleProtocolList() *swiftNode {
+	types := newSwiftNode(skTypeList, "")
+	list := createWith(skProtocolList, types)
+	if d.popKind(skEmptyList) == nil {
+		for {
+			first := d.popKind(skFirstElementMarker) != nil
+			proto := d.popProtocol()
+			if proto == nil {
+				return nil
+			}
+			types.add(proto)
+			if first {
+				break
+			}
+		}
+		types.reverseChildren(0)
+	}
+	return list
+}
+
+/*****************
+ * special types *
+ *****************/
+
+func (d *swiftDemangler) demangleSpecialType() *swiftNode {
+	switch d.next() {
+	case 'E':
+		return d.popFunctionType(skNoEscapeFunctionType)
+	case 'A':
+		return d.popFunctionType(skEscapingAutoClosureType)
+	case 'f':
+		return d.popFunctionType(skThinFunctionType)
+	case 'K':
+		return d.popFunctionType(skAutoClosureType)
+	case 'U':
+		return d.popFunctionType(skUncurriedFunctionType)
+	case 'L':
+		return d.popFunctionType(skEscapingObjCBlock)
+	case 'B':
+		return d.popFunctionType(skObjCBlock)
+	case 'C':
+		return d.popFunctionType(skCFunctionPointer)
+	case 'o':
+		return createType(createWith(skUnowned, d.popKind(skType)))
+	case 'u':
+		return createType(createWith(skUnmanaged, d.popKind(skType)))
+	case 'w':
+		return createType(createWith(skWeak, d.popKind(skType)))
+	case 'b':
+		return createType(createWith(skSILBoxType, d.popKind(skType)))
+	case 'D':
+		return createType(createWith(skDynamicSelf, d.popKind(skType)))
+	case 'M':
+		repr := d.demangleMetatypeRepresentation()
+		return createType(createWith(skMetatype, repr, d.popKind(skType)))
+	case 'm':
+		repr := d.demangleMetatypeRepresentation()
+		return createType(createWith(skExistentialMetatype, repr, d.popKind(skType)))
+	case 'p':
+		return createType(createWith(skExistentialMetatype, d.popKind(skType)))
+	case 'c':
+		superclass := d.popKind(skType)
+		list := d.demangleProtocolList()
+		return createType(createWith(skProtocolListWithClass, list, superclass))
+	case 'l':
+		return createType(createWith(skProtocolListWithAnyObject, d.demangleProtocolList()))
+	case 'S':
+		switch d.next() {
+		case 'q':
+			return createType(createWith(skSugaredOptional, d.popKind(skType)))
+		case 'a':
+			return createType(createWith(skSugaredArray, d.popKind(skType)))
+		case 'D':
+			value := d.popKind(skType)
+			key := d.popKind(skType)
+			return createType(createWith(skSugaredDictionary, key, value))
+		case 'p':
+			return createType(createWith(skSugaredParen, d.popKind(skType)))
+		}
+	}
+	return nil
+}
+
+func (d *swiftDemangler) demangleMetatypeRepresentation() *swiftNode {
+	switch d.next() {
+	case 't':
+		return newSwiftNode(skMetatypeRepresentation, "@thin")
+	case 'T':
+		return newSwiftNode(skMetatypeRepresentation, "@thick")
+	case 'o':
+		return newSwiftNode(skMetatypeRepresentation, "@objc_metatype")
+	}
+	return nil
+}
+
+func (d *swiftDemangler) demangleTypeAnnotation() *swiftNode {
+	switch d.next() {
+	case 'a':
+		return newSwiftNode(skAsyncAnnotation, "")
+	case 'b':
+		return newSwiftNode(skConcurrentFunctionType, "")
+	case 'c':
+		return createWith(skGlobalActorFunctionType, d.popKind(skType))
+	case 'K':
+		return createWith(skTypedThrowsAnnotation, d.popKind(skType))
+	}
+	return nil
+}
+
+func (d *swiftDemangler) demangleImplParamConvention(kind swiftKind) *swiftNode {
+	var attr string
+	switch d.next() {
+	case 'i':
+		attr = "@in"
+	case 'c':
+		attr = "@in_constant"
+	case 'l':
+		attr = "@inout"
+	case 'b':
+		attr = "@inout_aliasable"
+	case 'n':
+		attr = "@in_guaranteed"
+	case 'X':
+		attr = "@in_cxx"
+	case 'x':
+		attr = "@owned"
+	case 'g':
+		attr = "@guaranteed"
+	case 'e':
+		attr = "@deallocating"
+	case 'y':
+		attr = "@unowned"
+	default:
+		d.pushBack()
+		return nil
+	}
+	return newSwiftNode(kind, attr)
+}
+
+func (d *swiftDemangler) demangleImplResultConvention(kind swiftKind) *swiftNode {
+	var attr string
+	switch d.next() {
+	case 'r':
+		attr = "@out"
+	case 'o':
+		attr = "@owned"
+	case 'd':
+		attr = "@unowned"
+	case 'u':
+		attr = "@unowned_inner_pointer"
+	case 'a':
+		attr = "@autoreleased"
+	case 'k':
+		attr = "@pack_out"
+	default:
+		d.pushBack()
+		return nil
+	}
+	return newSwiftNode(kind, attr)
+}
+
+func (d *swiftDemangler) demangleImplFunctionType() *swiftNode {
+	ty := newSwiftNode(skImplFunctionType, "")
+	sig := d.popKind(skDependentGenericSignature)
+	if sig != nil && d.nextIf('P') {
+		// pseudo-generic signatures print the same way
+	}
+	if d.nextIf('e') {
+		ty.add(newSwiftNode(skImplEscaping, ""))
+	}
+	var calleeConv string
+	switch d.next() {
+	case 'y':
+		calleeConv = "@callee_unowned"
+	case 'g':
+		calleeConv = "@callee_guaranteed"
+	case 'x':
+		calleeConv = "@callee_owned"
+	case 't':
+		calleeConv = "@convention(thin)"
+	default:
+		return nil
+	}
+	ty.add(newSwiftNode(skImplConvention, calleeConv))
+	var funcAttr string
+	switch d.next() {
+	case 'B':
+		funcAttr = "@convention(block)"
+	case 'C':
+		funcAttr = "@convention(c)"
+	case 'M':
+		funcAttr = "@convention(method)"
+	case 'O':
+		funcAttr = "@convention(objc_method)"
+	case 'K':
+		funcAttr = "@convention(closure)"
+	case 'W':
+		funcAttr = "@convention(witness_method)"
+	default:
+		d.pushBack()
+	}
+	if len(funcAttr) > 0 {
+		ty.add(newSwiftNode(skImplFunctionAttribute, funcAttr))
+	}
+	if d.nextIf('A') {
+		ty.add(newSwiftNode(skImplFunctionAttribute, "@yield_once"))
+	} else if d.nextIf('G') {
+		ty.add(newSwiftNode(skImplFunctionAttribute, "@yield_many"))
+	}
+	if d.nextIf('h') {
+		ty.add(newSwiftNode(skImplFunctionAttribute, "@Sendable"))
+	}
+	if d.nextIf('H') {
+		ty.add(newSwiftNode(skImplFunctionAttribute, "@async"))
+	}
+	ty.add(sig)
+
+	numTypes := 0
+	for {
+		param := d.demangleImplParamConvention(skImplParameter)
+		if param == nil {
+			break
+		}
+		ty.add(param)
+		numTypes++
+	}
+	for {
+		result := d.demangleImplResultConvention(skImplResult)
+		if result == nil {
+			break
+		}
+		ty.add(result)
+		numTypes++
+	}
+	for d.nextIf('Y') {
+		yield := d.demangleImplParamConvention(skImplYield)
+		if yield == nil {
+			return nil
+		}
+		ty.add(yield)
+		numTypes++
+	}
+	if d.nextIf('z') {
+		errResult := d.demangleImplResultConvention(skImplErrorResult)
+		if errResult == nil {
+			return nil
+		}
+		ty.add(errResult)
+		numTypes++
+	}
+	if !d.nextIf('_') {
+		return nil
+	}
+	for i := 0; i < numTypes; i++ {
+		convTy := d.popKind(skType)
+		if convTy == nil {
+			return nil
+		}
+		ty.children[len(ty.children)-i-1].add(convTy)
+	}
+	return createType(ty)
+}
+
+/******************************
+ * metadata, witnesses, thunks *
+ ******************************/
+
+func (d *swiftDemangler) popProtocolConformance() *swiftNode {
+	sig := d.popKind(skDependentGenericSignature)
+	mod := d.popModule()
+	proto := d.popProtocol()
+	ty := d.popKind(skType)
+	if ty == nil {
+		return nil
+	}
+	if sig != nil {
+		ty = createType(createWith(skDependentGenericType, sig, ty))
+	}
+	conf := createWith(skProtocolConformance, ty, proto)
+	conf.add(mod)
+	return conf
+}
+
+func (d *swiftDemangler) demangleMetatype() *swiftNode {
+	switch d.next() {
+	case 'a':
+		return createWith(skTypeMetadataAccessFunction, d.popKind(skType))
+	case 'A':
+		return createWith(skReflectionMetadataAssocTypeDescriptor, d.popProtocolConformance())
+	case 'B':
+		return createWith(skReflectionMetadataBuiltinDescriptor, d.popKind(skType))
+	case 'c':
+		return createWith(skProtocolConformanceDescriptor, d.popProtocolConformance())
+	case 'C':
+		ty := d.popKind(skType)
+		if ty == nil || !isSwiftAnyGeneric(ty.child(0).kind) {
+			return nil
+		}
+		return createWith(skReflectionMetadataSuperclassDescriptor, ty.child(0))
+	case 'f':
+		return createWith(skFullTypeMetadata, d.popKind(skType))
+	case 'F':
+		return createWith(skReflectionMetadataFieldDescriptor, d.popKind(skType))
+	case 'i':
+		return createWith(skTypeMetadataInstantiationFunction, d.popKind(skType))
+	case 'I':
+		return createWith(skTypeMetadataInstantiationCache, d.popKind(skType))
+	case 'l':
+		return createWith(skTypeMetadataSingletonInitializationCache, d.popKind(skType))
+	case 'L':
+		return createWith(skTypeMetadataLazyCache, d.popKind(skType))
+	case 'm':
+		return createWith(skMetaclass, d.popKind(skType))
+	case 'n':
+		return createWith(skNominalTypeDescriptor, d.popKind(skType))
+	case 'o':
+		return createWith(skClassMetadataBaseOffset, d.popKind(skType))
+	case 'p':
+		return createWith(skProtocolDescriptor, d.popProtocol())
+	case 'P':
+		return createWith(skGenericTypeMetadataPattern, d.popKind(skType))
+	case 'r':
+		return createWith(skTypeMetadataCompletionFunction, d.popKind(skType))
+	case 's':
+		return createWith(skObjCResilientClassStub, d.popKind(skType))
+	case 'S':
+		return createWith(skProtocolSelfConformanceDescriptor, d.popProtocol())
+	case 't':
+		return createWith(skFullObjCResilientClassStub, d.popKind(skType))
+	case 'u':
+		return createWith(skMethodLookupFunction, d.popKind(skType))
+	case 'U':
+		return createWith(skObjCMetadataUpdateFunction, d.popKind(skType))
+	case 'V':
+		return createWith(skPropertyDescriptor, d.popIf(isSwiftEntity))
+	case 'X':
+		switch d.next() {
+		case 'M':
+			return createWith(skModuleDescriptor, d.popModule())
+		case 'E':
+			return createWith(skExtensionDescriptor, d.popContext())
+		case 'X':
+			return createWith(skAnonymousDescriptor, d.popContext())
+		case 'Y':
+			d.popKind(skIdentifier)
+			return createWith(skAnonymousDescriptor, d.popContext())
+		}
+	}
+	return nil
+}
+
+func (d *swiftDemangler) demangleWitness() *swiftNode {
+	switch d.next() {
+	case 'V':
+		return createWith(skValueWitnessTable, d.popKind(skType))
+	case 'v':
+		var directness string
+		switch d.next() {
+		case 'd':
+			directness = "direct"
+		case 'i':
+			directness = "indirect"
+		default:
+			return nil
+		}
+		return createWith(skFieldOffset, newSwiftNode(skDirectness, directness), d.popIf(isSwiftEntity))
+	case 'S':
+		return createWith(skProtocolSelfConformanceWitnessTable, d.popProtocol())
+	case 'P':
+		return createWith(skProtocolWitnessTable, d.popProtocolConformance())
+	case 'p':
+		return createWith(skProtocolWitnessTablePattern, d.popProtocolConformance())
+	case 'G':
+		return createWith(skGenericProtocolWitnessTable, d.popProtocolConformance())
+	case 'I':
+		return createWith(skGenericProtocolWitnessTableInstantiationFunction, d.popProtocolConformance())
+	case 'r':
+		return createWith(skResilientProtocolWitnessTable, d.popProtocolConformance())
+	case 'l':
+		conf := d.popProtocolConformance()
+		ty := d.popKind(skType)
+		return createWith(skLazyProtocolWitnessTableAccessor, ty, conf)
+	case 'L':
+		conf := d.popProtocolConformance()
+		ty := d.popKind(skType)
+		return createWith(skLazyProtocolWitnessTableCacheVariable, ty, conf)
+	case 'a':
+		return createWith(skProtocolWitnessTableAccessor, d.popProtocolConformance())
+	case 't':
+		name := d.popIf(isSwiftDeclName)
+		conf := d.popProtocolConformance()
+		return createWith(skAssociatedTypeMetadataAccessor, conf, name)
+	case 'T':
+		proto := d.popProtocol()
+		assocTy := d.popKind(skType)
+		conf := d.popProtocolConformance()
+		return createWith(skAssociatedTypeWitnessTableAccessor, conf, assocTy, proto)
+	case 'O':
+		var kind swiftKind
+		switch d.next() {
+		case 'y':
+			kind = skOutlinedCopy
+		case 'e':
+			kind = skOutlinedConsume
+		case 'r':
+			kind = skOutlinedRetain
+		case 's':
+			kind = skOutlinedRelease
+		case 'b':
+			kind = skOutlinedInitializeWithTake
+		case 'c':
+			kind = skOutlinedInitializeWithCopy
+		case 'd':
+			kind = skOutlinedAssignWithTake
+		case 'f':
+			kind = skOutlinedAssignWithCopy
+		case 'h':
+			kind = skOutlinedDestroy
+		default:
+			return nil
+		}
+		sig := d.popKind(skDependentGenericSignature)
+		n := createWith(kind, d.popKind(skType))
+		if n != nil {
+			n.add(sig)
+		}
+		return n
+	}
+	return nil
+}
+
+var swiftValueWitnessNames = map[string]string{
+	"al": "allocateBuffer",
+	"ca": "assignWithCopy",
+	"ta": "assignWithTake",
+	"de": "deallocateBuffer",
+	"xx": "destroy",
+	"XX": "destroyBuffer",
+	"Xx": "destroyArray",
+	"CP": "initializeBufferWithCopyOfBuffer",
+	"Cp": "initializeBufferWithCopy",
+	"cp": "initializeWithCopy",
+	"Tk": "initializeBufferWithTake",
+	"tk": "initializeWithTake",
+	"pr": "projectBuffer",
+	"TK": "initializeBufferWithTakeOfBuffer",
+	"Cc": "initializeArrayWithCopy",
+	"Tt": "initializeArrayWithTakeFrontToBack",
+	"tT": "initializeArrayWithTakeBackToFront",
+	"xs": "storeExtraInhabitant",
+	"xg": "getExtraInhabitantIndex",
+	"ug": "getEnumTag",
+	"up": "destructiveProjectEnumData",
+	"ui": "destructiveInjectEnumTag",
+	"et": "getEnumTagSinglePayload",
+	"st": "storeEnumTagSinglePayload",
+}
+
+func (d *swiftDemangler) demangleValueWitness() *swiftNode {
+	code := string([]byte{d.next(), d.next()})
+	name, ok := swiftValueWitnessNames[code]
+	if !ok {
+		return nil
+	}
+	n := createWith(skValueWitness, d.popKind(skType))
+	if n != nil {
+		n.text = name
+	}
+	return n
+}
+
+func (d *swiftDemangler) demangleThunkOrSpecialization() *swiftNode {
+	switch c := d.next(); c {
+	case 'c':
+		return createWith(skCurryThunk, d.popIf(isSwiftEntity))
+	case 'j':
+		return createWith(skDispatchThunk, d.popIf(isSwiftEntity))
+	case 'q':
+		return createWith(skMethodDescriptor, d.popIf(isSwiftEntity))
+	case 'o':
+		return newSwiftNode(skObjCAttribute, "")
+	case 'O':
+		return newSwiftNode(skNonObjCAttribute, "")
+	case 'D':
+		return newSwiftNode(skDynamicAttribute, "")
+	case 'd':
+		return newSwiftNode(skDirectMethodReferenceAttribute, "")
+	case 'a':
+		return newSwiftNode(skPartialApplyObjCForwarder, "")
+	case 'A':
+		return newSwiftNode(skPartialApplyForwarder, "")
+	case 'm':
+		return newSwiftNode(skMergedFunction, "")
+	case 'X':
+		return newSwiftNode(skDynamicallyReplaceableFunctionVar, "")
+	case 'x':
+		return newSwiftNode(skDynamicallyReplaceableFunctionKey, "")
+	case 'I':
+		return newSwiftNode(skDynamicallyReplaceableFunctionImpl, "")
+	case 'u':
+		return newSwiftNode(skAsyncFunctionPointer, "")
+	case 'W':
+		entity := d.popIf(isSwiftEntity)
+		conf := d.popProtocolConformance()
+		return createWith(skProtocolWitness, conf, entity)
+	case 'L':
+		return createWith(skProtocolRequirementsBaseDescriptor, d.popProtocol())
+	case 'l':
+		return createWith(skAssociatedTypeDescriptor, d.popAssocTypeName())
+	case 'R', 'r', 'y':
+		kind := skReabstractionThunk
+		switch c {
+		case 'R':
+			kind = skReabstractionThunkHelper
+		case 'y':
+			kind = skReabstractionThunkHelperWithSelf
+		}
+		thunk := newSwiftNode(kind, "")
+		thunk.add(d.popKind(skDependentGenericSignature))
+		if kind == skReabstractionThunkHelperWithSelf {
+			thunk = addChild(thunk, d.popKind(skType))
+		}
+		thunk = addChild(thunk, d.popKind(skType))
+		return addChild(thunk, d.popKind(skType))
+	case 'K', 'k':
+		kind := skKeyPathGetterThunkHelper
+		if c == 'k' {
+			kind = skKeyPathSetterThunkHelper
+		}
+		serialized := d.nextIf('q')
+		var types []*swiftNode
+		n := d.pop()
+		if n == nil || n.kind != skType {
+			return nil
+		}
+		for n != nil && n.kind == skType {
+			types = append(types, n)
+			n = d.pop()
+		}
+		if n == nil {
+			return nil
+		}
+		var result *swiftNode
+		if n.kind == skDependentGenericSignature {
+			result = createWith(kind, d.pop(), n)
+		} else {
+			result = createWith(kind, n)
+		}
+		if result == nil {
+			return nil
+		}
+		for i := len(types) - 1; i >= 0; i-- {
+			result.add(types[i])
+		}
+		if serialized {
+			result.add(newSwiftNode(skIsSerialized, ""))
+		}
+		return result
+	case 'g':
+		return d.demangleGenericSpecialization(skGenericSpecialization)
+	case 'G':
+		return d.demangleGenericSpecialization(skGenericSpecializationNotReAbstracted)
+	case 'B':
+		return d.demangleGenericSpecialization(skGenericSpecializationInResilienceDomain)
+	case 's':
+		return d.demangleGenericSpecialization(skGenericSpecializationPrespecialized)
+	case 'i':
+		return d.demangleGenericSpecialization(skInlinedGenericFunction)
+	case 'f':
+		return d.demangleFunctionSpecialization()
+	}
+	return nil
+}
+
+func (d *swiftDemangler) demangleSpecAttributes(kind swiftKind) *swiftNode {
+	d.nextIf('m') // metatype params removed
+	serialized := d.nextIf('q')
+	d.nextIf('a') // async removed
+	passID := int(d.next()) - '0'
+	if passID < 0 || passID > 9 {
+		return nil
+	}
+	spec := newSwiftNode(kind, "")
+	if serialized {
+		spec.add(newSwiftNode(skIsSerialized, ""))
+	}
+	spec.add(newSwiftIndexNode(skSpecializationPassID, passID))
+	return spec
+}
+
+func (d *swiftDemangler) demangleGenericSpecialization(kind swiftKind) *swiftNode {
+	spec := d.demangleSpecAttributes(kind)
+	list := d.popTypeList()
+	if spec == nil || list == nil {
+		return nil
+	}
+	for _, ty := range list.children {
+		spec.add(createWith(skGenericSpecializationParam, ty))
+	}
+	return spec
+}
+
+func (d *swiftDemangler) demangleFunctionSpecialization() *swiftNode {
+	spec := d.demangleSpecAttributes(skFunctionSignatureSpecialization)
+	for spec != nil && !d.nextIf('_') {
+		if d.pos >= len(d.text) {
+			return nil
+		}
+		spec = addChild(spec, d.demangleFuncSpecParam(skFunctionSignatureSpecializationParam))
+	}
+	if spec != nil && !d.nextIf('n') {
+		spec = addChild(spec, d.demangleFuncSpecParam(skFunctionSignatureSpecializationReturn))
+	}
+	if spec == nil {
+		return nil
+	}
+	// add the required parameters in reverse order
+	for i := len(spec.children) - 1; i >= 0; i-- {
+		param := spec.children[i]
+		if param.kind != skFunctionSignatureSpecializationParam || len(param.children) == 0 {
+			continue
+		}
+		switch kind := param.child(0).index; kind {
+		case fsConstantPropFunction, fsConstantPropGlobal, fsConstantPropString, fsConstantPropKeyPath, fsClosureProp:
+			fixed := len(param.children)
+			for {
+				ty := d.popKind(skType)
+				if ty == nil {
+					break
+				}
+				if kind != fsClosureProp {
+					return nil
+				}
+				param.add(ty)
+			}
+			name := d.popKind(skIdentifier)
+			if name == nil {
+				return nil
+			}
+			text := name.text
+			if kind == fsConstantPropString && strings.HasPrefix(text, "_") {
+				text = text[1:]
+			}
+			param.add(newSwiftNode(skFunctionSignatureSpecializationParamPayload, text))
+			param.reverseChildren(fixed)
+		}
+	}
+	return spec
+}
+
+func (d *swiftDemangler) demangleFuncSpecParam(kind swiftKind) *swiftNode {
+	param := newSwiftNode(kind, "")
+	paramKind := func(k int) *swiftNode {
+		param.add(newSwiftIndexNode(skFunctionSignatureSpecializationParamKind, k))
+		return param
+	}
+	optionSet := func(k int, flags string) *swiftNode {
+		for _, f := range flags {
+			if d.nextIf(byte(f)) {
+				switch f {
+				case 'D':
+					k |= fsDead
+				case 'G':
+					k |= fsOwnedToGuaranteed
+				case 'O':
+					k |= fsGuaranteedToOwned
+				case 'X':
+					k |= fsSROA
+				}
+			}
+		}
+		return paramKind(k)
+	}
+	switch d.next() {
+	case 'n':
+		return param
+	case 'c':
+		return paramKind(fsClosureProp)
+	case 'p':
+		switch d.next() {
+		case 'f':
+			return paramKind(fsConstantPropFunction)
+		case 'g':
+			return paramKind(fsConstantPropGlobal)
+		case 'k':
+			return paramKind(fsConstantPropKeyPath)
+		case 'i', 'd':
+			k := fsConstantPropInteger
+			if d.text[d.pos-1] == 'd' {
+				k = fsConstantPropFloat
+			}
+			start := d.pos
+			d.nextIf('-')
+			for isDigit(d.peek()) {
+				d.next()
+			}
+			if !d.nextIf('_') {
+				return nil
+			}
+			paramKind(k)
+			param.add(newSwiftNode(skFunctionSignatureSpecializationParamPayload, d.text[start:d.pos-1]))
+			return param
+		case 's':
+			var encoding string
+			switch d.next() {
+			case 'b':
+				encoding = "u8"
+			case 'w':
+				encoding = "u16"
+			case 'c':
+				encoding = "objc"
+			default:
+				return nil
+			}
+			paramKind(fsConstantPropString)
+			param.add(newSwiftNode(skFunctionSignatureSpecializationParamPayload, encoding))
+			return param
+		}
+		return nil
+	case 'e':
+		return optionSet(fsExistentialToGeneric, "DGOX")
+	case 'd':
+		return optionSet(fsDead, "GOX")
+	case 'g':
+		return optionSet(fsOwnedToGuaranteed, "X")
+	case 'o':
+		return optionSet(fsGuaranteedToOwned, "X")
+	case 'x':
+		return paramKind(fsSROA)
+	case 'i':
+		return paramKind(fsBoxToValue)
+	case 's':
+		return paramKind(fsBoxToStack)
+	case 'r':
+		return paramKind(fsInOutToOut)
+	}
+	return nil
+}
+
+// demangleObjCTypeName demangles the old-style class and protocol names
+// which are still used in the ObjC metadata (e.g. _TtC4main3Foo)
+func (d *swiftDemangler) demangleObjCTypeName() *swiftNode {
+	ty := newSwiftNode(skType, "")
+	global := createWith(skGlobal, createWith(skTypeMangling, ty))
+	var nominal *swiftNode
+	isProto := false
+	switch {
+	case d.nextIf('C'):
+		nominal = newSwiftNode(skClass, "")
+		ty.add(nominal)
+	case d.nextIf('P'):
+		isProto = true
+		nominal = newSwiftNode(skProtocol, "")
+		ty.add(createWith(skProtocolList, createWith(skTypeList, createType(nominal))))
+	default:
+		return nil
+	}
+	if d.nextIf('s') {
+		nominal.add(newSwiftNode(skModule, "Swift"))
+	} else {
+		mod := d.demangleIdentifier()
+		if mod == nil {
+			return nil
+		}
+		nominal.add(changeKind(mod, skModule))
+	}
+	ident := d.demangleIdentifier()
+	if ident == nil {
+		return nil
+	}
+	nominal.add(ident)
+	if isProto && !d.nextIf('_') {
+		return nil
+	}
+	if d.pos < len(d.text) {
+		return nil
+	}
+	return global
+}
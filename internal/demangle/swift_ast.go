@@ -0,0 +1,1297 @@
+package demangle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// swiftKind is the kind of a node in a demangled Swift symbol tree.
+type swiftKind int
+
+const (
+	skGlobal swiftKind = iota
+	skSuffix
+
+	// names and contexts
+	skModule
+	skIdentifier
+	skLocalDeclName
+	skPrivateDeclName
+	skInfixOperator
+	skPrefixOperator
+	skPostfixOperator
+	skNumber
+	skExtension
+	skClass
+	skStructure
+	skEnum
+	skProtocol
+	skTypeAlias
+	skOtherNominalType
+
+	// entities
+	skFunction
+	skVariable
+	skSubscript
+	skConstructor
+	skAllocator
+	skDestructor
+	skDeallocator
+	skIVarInitializer
+	skIVarDestroyer
+	skInitializer
+	skDefaultArgumentInitializer
+	skExplicitClosure
+	skImplicitClosure
+	skStatic
+	skGetter
+	skSetter
+	skGlobalGetter
+	skModifyAccessor
+	skReadAccessor
+	skWillSet
+	skDidSet
+	skInitAccessor
+	skMaterializeForSet
+	skUnsafeAddressor
+	skUnsafeMutableAddressor
+	skOwningAddressor
+	skOwningMutableAddressor
+	skNativeOwningAddressor
+	skNativeOwningMutableAddressor
+	skNativePinningAddressor
+	skNativePinningMutableAddressor
+
+	// types
+	skType
+	skTypeList
+	skBuiltinTypeName
+	skTuple
+	skTupleElement
+	skTupleElementName
+	skVariadicMarker
+	skFunctionType
+	skNoEscapeFunctionType
+	skAutoClosureType
+	skEscapingAutoClosureType
+	skThinFunctionType
+	skCFunctionPointer
+	skObjCBlock
+	skEscapingObjCBlock
+	skUncurriedFunctionType
+	skArgumentTuple
+	skReturnType
+	skLabelList
+	skThrowsAnnotation
+	skTypedThrowsAnnotation
+	skAsyncAnnotation
+	skConcurrentFunctionType
+	skGlobalActorFunctionType
+	skInOut
+	skShared
+	skOwned
+	skWeak
+	skUnowned
+	skUnmanaged
+	skMetatype
+	skExistentialMetatype
+	skMetatypeRepresentation
+	skDynamicSelf
+	skProtocolList
+	skProtocolListWithClass
+	skProtocolListWithAnyObject
+	skBoundGenericClass
+	skBoundGenericStructure
+	skBoundGenericEnum
+	skBoundGenericProtocol
+	skBoundGenericTypeAlias
+	skBoundGenericOtherNominalType
+	skBoundGenericFunction
+	skSugaredOptional
+	skSugaredArray
+	skSugaredDictionary
+	skSugaredParen
+	skDependentGenericParamType
+	skDependentGenericType
+	skDependentGenericSignature
+	skDependentGenericParamCount
+	skDependentGenericConformanceRequirement
+	skDependentGenericSameTypeRequirement
+	skDependentGenericLayoutRequirement
+	skDependentMemberType
+	skDependentAssociatedTypeRef
+	skAssociatedTypeRef
+	skOpaqueReturnType
+	skOpaqueReturnTypeOf
+	skOpaqueType
+	skSILBoxType
+	skImplFunctionType
+	skImplEscaping
+	skImplConvention
+	skImplFunctionAttribute
+	skImplParameter
+	skImplResult
+	skImplErrorResult
+	skImplYield
+
+	// markers used while parsing
+	skEmptyList
+	skFirstElementMarker
+	skTypeMangling
+
+	// metadata, witnesses and thunks
+	skTypeMetadata
+	skFullTypeMetadata
+	skTypeMetadataAccessFunction
+	skTypeMetadataLazyCache
+	skTypeMetadataInstantiationCache
+	skTypeMetadataInstantiationFunction
+	skTypeMetadataSingletonInitializationCache
+	skTypeMetadataCompletionFunction
+	skGenericTypeMetadataPattern
+	skMetaclass
+	skNominalTypeDescriptor
+	skClassMetadataBaseOffset
+	skProtocolDescriptor
+	skProtocolSelfConformanceDescriptor
+	skProtocolConformanceDescriptor
+	skProtocolConformance
+	skMethodLookupFunction
+	skObjCMetadataUpdateFunction
+	skObjCResilientClassStub
+	skFullObjCResilientClassStub
+	skPropertyDescriptor
+	skReflectionMetadataFieldDescriptor
+	skReflectionMetadataBuiltinDescriptor
+	skReflectionMetadataAssocTypeDescriptor
+	skReflectionMetadataSuperclassDescriptor
+	skModuleDescriptor
+	skExtensionDescriptor
+	skAnonymousDescriptor
+	skMethodDescriptor
+	skDispatchThunk
+	skCurryThunk
+	skProtocolWitness
+	skProtocolWitnessTable
+	skProtocolWitnessTablePattern
+	skProtocolWitnessTableAccessor
+	skProtocolSelfConformanceWitnessTable
+	skGenericProtocolWitnessTable
+	skGenericProtocolWitnessTableInstantiationFunction
+	skResilientProtocolWitnessTable
+	skLazyProtocolWitnessTableAccessor
+	skLazyProtocolWitnessTableCacheVariable
+	skAssociatedTypeMetadataAccessor
+	skAssociatedTypeWitnessTableAccessor
+	skAssociatedTypeDescriptor
+	skProtocolRequirementsBaseDescriptor
+	skValueWitness
+	skValueWitnessTable
+	skFieldOffset
+	skDirectness
+	skOutlinedCopy
+	skOutlinedConsume
+	skOutlinedRetain
+	skOutlinedRelease
+	skOutlinedInitializeWithTake
+	skOutlinedInitializeWithCopy
+	skOutlinedAssignWithTake
+	skOutlinedAssignWithCopy
+	skOutlinedDestroy
+	skReabstractionThunk
+	skReabstractionThunkHelper
+	skReabstractionThunkHelperWithSelf
+	skKeyPathGetterThunkHelper
+	skKeyPathSetterThunkHelper
+	skAsyncFunctionPointer
+
+	// function attributes
+	skObjCAttribute
+	skNonObjCAttribute
+	skDynamicAttribute
+	skDirectMethodReferenceAttribute
+	skMergedFunction
+	skPartialApplyForwarder
+	skPartialApplyObjCForwarder
+	skDynamicallyReplaceableFunctionVar
+	skDynamicallyReplaceableFunctionKey
+	skDynamicallyReplaceableFunctionImpl
+	skGenericSpecialization
+	skGenericSpecializationNotReAbstracted
+	skGenericSpecializationInResilienceDomain
+	skGenericSpecializationPrespecialized
+	skInlinedGenericFunction
+	skGenericSpecializationParam
+	skFunctionSignatureSpecialization
+	skFunctionSignatureSpecializationParam
+	skFunctionSignatureSpecializationReturn
+	skFunctionSignatureSpecializationParamKind
+	skFunctionSignatureSpecializationParamPayload
+	skSpecializationPassID
+	skIsSerialized
+)
+
+// swiftNode is a node in a demangled Swift symbol tree.
+type swiftNode struct {
+	kind     swiftKind
+	text     string
+	index    int
+	children []*swiftNode
+}
+
+func (n *swiftNode) add(c *swiftNode) {
+	if n != nil && c != nil {
+		n.children = append(n.children, c)
+	}
+}
+
+func (n *swiftNode) child(i int) *swiftNode {
+	if n == nil || i < 0 || i >= len(n.children) {
+		return nil
+	}
+	return n.children[i]
+}
+
+func (n *swiftNode) firstChildOf(kinds ...swiftKind) *swiftNode {
+	for _, c := range n.children {
+		for _, k := range kinds {
+			if c.kind == k {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func (n *swiftNode) reverseChildren(from int) {
+	for i, j := from, len(n.children)-1; i < j; i, j = i+1, j-1 {
+		n.children[i], n.children[j] = n.children[j], n.children[i]
+	}
+}
+
+func isSwiftContext(k swiftKind) bool {
+	switch k {
+	case skModule, skExtension, skClass, skStructure, skEnum, skProtocol, skTypeAlias, skOtherNominalType,
+		skFunction, skVariable, skSubscript, skConstructor, skAllocator, skDestructor, skDeallocator,
+		skIVarInitializer, skIVarDestroyer, skInitializer, skDefaultArgumentInitializer,
+		skExplicitClosure, skImplicitClosure, skStatic, skOpaqueReturnTypeOf:
+		return true
+	}
+	return isSwiftAccessor(k)
+}
+
+func isSwiftAccessor(k swiftKind) bool {
+	switch k {
+	case skGetter, skSetter, skGlobalGetter, skModifyAccessor, skReadAccessor, skWillSet, skDidSet,
+		skInitAccessor, skMaterializeForSet, skUnsafeAddressor, skUnsafeMutableAddressor,
+		skOwningAddressor, skOwningMutableAddressor, skNativeOwningAddressor,
+		skNativeOwningMutableAddressor, skNativePinningAddressor, skNativePinningMutableAddressor:
+		return true
+	}
+	return false
+}
+
+func isSwiftEntity(k swiftKind) bool {
+	return k == skType || isSwiftContext(k)
+}
+
+func isSwiftDeclName(k swiftKind) bool {
+	switch k {
+	case skIdentifier, skLocalDeclName, skPrivateDeclName, skInfixOperator, skPrefixOperator, skPostfixOperator:
+		return true
+	}
+	return false
+}
+
+func isSwiftAnyGeneric(k swiftKind) bool {
+	switch k {
+	case skClass, skStructure, skEnum, skProtocol, skTypeAlias, skOtherNominalType:
+		return true
+	}
+	return false
+}
+
+func isSwiftRequirement(k swiftKind) bool {
+	switch k {
+	case skDependentGenericConformanceRequirement, skDependentGenericSameTypeRequirement, skDependentGenericLayoutRequirement:
+		return true
+	}
+	return false
+}
+
+func isSwiftFunctionAttr(k swiftKind) bool {
+	switch k {
+	case skObjCAttribute, skNonObjCAttribute, skDynamicAttribute, skDirectMethodReferenceAttribute,
+		skMergedFunction, skPartialApplyForwarder, skPartialApplyObjCForwarder,
+		skDynamicallyReplaceableFunctionVar, skDynamicallyReplaceableFunctionKey, skDynamicallyReplaceableFunctionImpl,
+		skGenericSpecialization, skGenericSpecializationNotReAbstracted, skGenericSpecializationInResilienceDomain,
+		skGenericSpecializationPrespecialized, skInlinedGenericFunction, skFunctionSignatureSpecialization,
+		skAsyncFunctionPointer:
+		return true
+	}
+	return false
+}
+
+func isSwiftFunctionType(k swiftKind) bool {
+	switch k {
+	case skFunctionType, skNoEscapeFunctionType, skAutoClosureType, skEscapingAutoClosureType,
+		skThinFunctionType, skCFunctionPointer, skObjCBlock, skEscapingObjCBlock, skUncurriedFunctionType:
+		return true
+	}
+	return false
+}
+
+// swiftSimplePrefixes are the printed prefixes of nodes that just
+// describe their (only) child.
+var swiftSimplePrefixes = map[swiftKind]string{
+	skTypeMetadata:                                     "type metadata for ",
+	skFullTypeMetadata:                                 "full type metadata for ",
+	skTypeMetadataAccessFunction:                       "type metadata accessor for ",
+	skTypeMetadataLazyCache:                            "lazy cache variable for type metadata for ",
+	skTypeMetadataInstantiationCache:                   "type metadata instantiation cache for ",
+	skTypeMetadataInstantiationFunction:                "type metadata instantiation function for ",
+	skTypeMetadataSingletonInitializationCache:         "type metadata singleton initialization cache for ",
+	skTypeMetadataCompletionFunction:                   "type metadata completion function for ",
+	skGenericTypeMetadataPattern:                       "generic type metadata pattern for ",
+	skMetaclass:                                        "metaclass for ",
+	skNominalTypeDescriptor:                            "nominal type descriptor for ",
+	skClassMetadataBaseOffset:                          "class metadata base offset for ",
+	skProtocolDescriptor:                               "protocol descriptor for ",
+	skProtocolSelfConformanceDescriptor:                "protocol self-conformance descriptor for ",
+	skProtocolConformanceDescriptor:                    "protocol conformance descriptor for ",
+	skMethodLookupFunction:                             "method lookup function for ",
+	skObjCMetadataUpdateFunction:                       "ObjC metadata update function for ",
+	skObjCResilientClassStub:                           "ObjC resilient class stub for ",
+	skFullObjCResilientClassStub:                       "full ObjC resilient class stub for ",
+	skPropertyDescriptor:                               "property descriptor for ",
+	skReflectionMetadataFieldDescriptor:                "reflection metadata field descriptor ",
+	skReflectionMetadataBuiltinDescriptor:              "reflection metadata builtin descriptor ",
+	skReflectionMetadataAssocTypeDescriptor:            "reflection metadata associated type descriptor ",
+	skReflectionMetadataSuperclassDescriptor:           "reflection metadata superclass descriptor ",
+	skModuleDescriptor:                                 "module descriptor ",
+	skExtensionDescriptor:                              "extension descriptor ",
+	skAnonymousDescriptor:                              "anonymous descriptor ",
+	skMethodDescriptor:                                 "method descriptor for ",
+	skDispatchThunk:                                    "dispatch thunk of ",
+	skCurryThunk:                                       "curry thunk of ",
+	skProtocolWitnessTable:                             "protocol witness table for ",
+	skProtocolWitnessTablePattern:                      "protocol witness table pattern for ",
+	skProtocolWitnessTableAccessor:                     "protocol witness table accessor for ",
+	skProtocolSelfConformanceWitnessTable:              "protocol self-conformance witness table for ",
+	skGenericProtocolWitnessTable:                      "generic protocol witness table for ",
+	skResilientProtocolWitnessTable:                    "resilient protocol witness table for ",
+	skAssociatedTypeDescriptor:                         "associated type descriptor for ",
+	skProtocolRequirementsBaseDescriptor:               "protocol requirements base descriptor for ",
+	skValueWitnessTable:                                "value witness table for ",
+	skOutlinedCopy:                                     "outlined copy of ",
+	skOutlinedConsume:                                  "outlined consume of ",
+	skOutlinedRetain:                                   "outlined retain of ",
+	skOutlinedRelease:                                  "outlined release of ",
+	skOutlinedInitializeWithTake:                       "outlined init with take of ",
+	skOutlinedInitializeWithCopy:                       "outlined init with copy of ",
+	skOutlinedAssignWithTake:                           "outlined assign with take of ",
+	skOutlinedAssignWithCopy:                           "outlined assign with copy of ",
+	skOutlinedDestroy:                                  "outlined destroy of ",
+	skAsyncFunctionPointer:                             "async function pointer to ",
+	skObjCAttribute:                                    "@objc ",
+	skNonObjCAttribute:                                 "@nonobjc ",
+	skDynamicAttribute:                                 "dynamic ",
+	skDirectMethodReferenceAttribute:                   "super ",
+	skMergedFunction:                                   "merged ",
+	skDynamicallyReplaceableFunctionVar:                "dynamically replaceable variable for ",
+	skDynamicallyReplaceableFunctionKey:                "dynamically replaceable key for ",
+	skDynamicallyReplaceableFunctionImpl:               "dynamically replaceable thunk for ",
+	skStatic:                                           "static ",
+	skInOut:                                            "inout ",
+	skShared:                                           "__shared ",
+	skOwned:                                            "__owned ",
+	skWeak:                                             "weak ",
+	skUnowned:                                          "unowned ",
+	skUnmanaged:                                        "unowned(unsafe) ",
+	skSILBoxType:                                       "@box ",
+	skGenericProtocolWitnessTableInstantiationFunction: "instantiation function for generic protocol witness table for ",
+}
+
+var swiftAccessorNames = map[swiftKind]string{
+	skGetter:                        "getter",
+	skSetter:                        "setter",
+	skGlobalGetter:                  "getter",
+	skModifyAccessor:                "modify",
+	skReadAccessor:                  "read",
+	skWillSet:                       "willset",
+	skDidSet:                        "didset",
+	skInitAccessor:                  "init",
+	skMaterializeForSet:             "materializeForSet",
+	skUnsafeAddressor:               "unsafeAddressor",
+	skUnsafeMutableAddressor:        "unsafeMutableAddressor",
+	skOwningAddressor:               "owningAddressor",
+	skOwningMutableAddressor:        "owningMutableAddressor",
+	skNativeOwningAddressor:         "nativeOwningAddressor",
+	skNativeOwningMutableAddressor:  "nativeOwningMutableAddressor",
+	skNativePinningAddressor:        "nativePinningAddressor",
+	skNativePinningMutableAddressor: "nativePinningMutableAddressor",
+}
+
+// FunctionSignatureSpecialization parameter kinds (see swift/Demangling/Demangle.h)
+const (
+	fsConstantPropFunction = iota
+	fsConstantPropGlobal
+	fsConstantPropInteger
+	fsConstantPropFloat
+	fsConstantPropString
+	fsClosureProp
+	fsBoxToValue
+	fsBoxToStack
+	fsInOutToOut
+	fsConstantPropKeyPath
+
+	fsDead                 = 1 << 6
+	fsOwnedToGuaranteed    = 1 << 7
+	fsSROA                 = 1 << 8
+	fsGuaranteedToOwned    = 1 << 9
+	fsExistentialToGeneric = 1 << 10
+)
+
+// maxSwiftPrintDepth limits recursion while printing malformed trees.
+const maxSwiftPrintDepth = 768
+
+// swiftPrinter converts a demangled Swift node tree to a string.
+type swiftPrinter struct {
+	buf   strings.Builder
+	depth int
+	err   error
+}
+
+func (p *swiftPrinter) unsupported(n *swiftNode) {
+	if p.err == nil {
+		p.err = fmt.Errorf("unsupported swift node kind %d", n.kind)
+	}
+}
+
+func (p *swiftPrinter) printChildren(n *swiftNode, sep string) {
+	for i, c := range n.children {
+		if i > 0 {
+			p.buf.WriteString(sep)
+		}
+		p.print(c)
+	}
+}
+
+// str prints a node into a new string without touching the current buffer.
+func (p *swiftPrinter) str(n *swiftNode) string {
+	sub := swiftPrinter{depth: p.depth}
+	sub.print(n)
+	if sub.err != nil && p.err == nil {
+		p.err = sub.err
+	}
+	return sub.buf.String()
+}
+
+func genericParameterName(depth, index int) string {
+	var name []byte
+	for {
+		name = append(name, byte('A'+index%26))
+		index /= 26
+		if index == 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		return fmt.Sprintf("%s%d", name, depth)
+	}
+	return string(name)
+}
+
+func (p *swiftPrinter) print(n *swiftNode) {
+	if n == nil {
+		if p.err == nil {
+			p.err = fmt.Errorf("missing swift node")
+		}
+		return
+	}
+	if p.depth > maxSwiftPrintDepth {
+		if p.err == nil {
+			p.err = fmt.Errorf("swift node tree is too deep")
+		}
+		return
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if prefix, ok := swiftSimplePrefixes[n.kind]; ok {
+		p.buf.WriteString(prefix)
+		p.printChildren(n, "")
+		return
+	}
+
+	switch n.kind {
+	case skGlobal:
+		p.printChildren(n, "")
+	case skSuffix:
+		fmt.Fprintf(&p.buf, " with unmangled suffix %q", n.text)
+	case skType, skTypeMangling, skGenericSpecializationParam:
+		p.printChildren(n, "")
+	case skModule, skIdentifier, skBuiltinTypeName, skDependentGenericParamType, skImplConvention,
+		skImplFunctionAttribute, skMetatypeRepresentation:
+		p.buf.WriteString(n.text)
+	case skDependentAssociatedTypeRef:
+		p.buf.WriteString(n.text)
+	case skInfixOperator:
+		p.buf.WriteString(n.text + " infix")
+	case skPrefixOperator:
+		p.buf.WriteString(n.text + " prefix")
+	case skPostfixOperator:
+		p.buf.WriteString(n.text + " postfix")
+	case skNumber:
+		fmt.Fprintf(&p.buf, "%d", n.index)
+	case skLocalDeclName:
+		p.print(n.child(1))
+		fmt.Fprintf(&p.buf, " #%d", n.child(0).index+1)
+	case skPrivateDeclName:
+		if len(n.children) == 2 {
+			p.buf.WriteString("(")
+			p.print(n.child(1))
+			p.buf.WriteString(" in ")
+			p.print(n.child(0))
+			p.buf.WriteString(")")
+		} else {
+			p.buf.WriteString("(in ")
+			p.print(n.child(0))
+			p.buf.WriteString(")")
+		}
+	case skClass, skStructure, skEnum, skProtocol, skTypeAlias, skOtherNominalType:
+		p.printContextPrefix(n.child(0))
+		p.print(n.child(1))
+	case skExtension:
+		p.buf.WriteString("(extension in ")
+		p.print(n.child(0))
+		p.buf.WriteString("):")
+		p.print(n.child(1))
+		if len(n.children) == 3 {
+			p.print(n.child(2))
+		}
+	case skFunction, skVariable, skSubscript, skConstructor, skAllocator, skDestructor, skDeallocator,
+		skIVarInitializer, skIVarDestroyer, skInitializer, skDefaultArgumentInitializer,
+		skExplicitClosure, skImplicitClosure:
+		p.printEntity(n, "")
+	case skGetter, skSetter, skGlobalGetter, skModifyAccessor, skReadAccessor, skWillSet, skDidSet,
+		skInitAccessor, skMaterializeForSet, skUnsafeAddressor, skUnsafeMutableAddressor,
+		skOwningAddressor, skOwningMutableAddressor, skNativeOwningAddressor,
+		skNativeOwningMutableAddressor, skNativePinningAddressor, skNativePinningMutableAddressor:
+		p.printEntity(n.child(0), swiftAccessorNames[n.kind])
+	case skTypeList:
+		p.printChildren(n, ", ")
+	case skTuple:
+		p.buf.WriteString("(")
+		p.printChildren(n, ", ")
+		p.buf.WriteString(")")
+	case skTupleElement:
+		if name := n.firstChildOf(skTupleElementName); name != nil {
+			p.buf.WriteString(name.text + ": ")
+		}
+		p.print(n.firstChildOf(skType))
+		if n.firstChildOf(skVariadicMarker) != nil {
+			p.buf.WriteString("...")
+		}
+	case skFunctionType, skNoEscapeFunctionType, skUncurriedFunctionType:
+		p.printFunctionType(n, nil)
+	case skAutoClosureType:
+		p.buf.WriteString("@autoclosure ")
+		p.printFunctionType(n, nil)
+	case skEscapingAutoClosureType:
+		p.buf.WriteString("@autoclosure @escaping ")
+		p.printFunctionType(n, nil)
+	case skThinFunctionType:
+		p.buf.WriteString("@convention(thin) ")
+		p.printFunctionType(n, nil)
+	case skCFunctionPointer:
+		p.buf.WriteString("@convention(c) ")
+		p.printFunctionType(n, nil)
+	case skObjCBlock:
+		p.buf.WriteString("@convention(block) ")
+		p.printFunctionType(n, nil)
+	case skEscapingObjCBlock:
+		p.buf.WriteString("@escaping @convention(block) ")
+		p.printFunctionType(n, nil)
+	case skArgumentTuple:
+		p.printFunctionParameters(nil, n)
+	case skReturnType:
+		p.buf.WriteString(" -> ")
+		p.printChildren(n, "")
+	case skMetatype:
+		ty := n.children[len(n.children)-1]
+		if len(n.children) == 2 {
+			p.print(n.child(0))
+			p.buf.WriteString(" ")
+		}
+		p.printWithParens(ty)
+		if isSwiftExistential(ty) {
+			p.buf.WriteString(".Protocol")
+		} else {
+			p.buf.WriteString(".Type")
+		}
+	case skExistentialMetatype:
+		ty := n.children[len(n.children)-1]
+		if len(n.children) == 2 {
+			p.print(n.child(0))
+			p.buf.WriteString(" ")
+		}
+		p.printWithParens(ty)
+		p.buf.WriteString(".Type")
+	case skDynamicSelf:
+		p.buf.WriteString("Self")
+	case skProtocolList:
+		list := n.child(0)
+		if list == nil || len(list.children) == 0 {
+			p.buf.WriteString("Any")
+			return
+		}
+		p.printChildren(list, " & ")
+	case skProtocolListWithClass:
+		p.print(n.child(0))
+		p.buf.WriteString(" & ")
+		p.print(n.child(1))
+	case skProtocolListWithAnyObject:
+		list := n.child(0).child(0)
+		if list != nil && len(list.children) > 0 {
+			p.print(n.child(0))
+			p.buf.WriteString(" & ")
+		}
+		p.buf.WriteString("Swift.AnyObject")
+	case skBoundGenericClass, skBoundGenericStructure, skBoundGenericEnum, skBoundGenericProtocol,
+		skBoundGenericTypeAlias, skBoundGenericOtherNominalType, skBoundGenericFunction:
+		p.printBoundGeneric(n)
+	case skSugaredOptional:
+		p.printWithParens(n.child(0))
+		p.buf.WriteString("?")
+	case skSugaredArray:
+		p.buf.WriteString("[")
+		p.print(n.child(0))
+		p.buf.WriteString("]")
+	case skSugaredDictionary:
+		p.buf.WriteString("[")
+		p.print(n.child(0))
+		p.buf.WriteString(" : ")
+		p.print(n.child(1))
+		p.buf.WriteString("]")
+	case skSugaredParen:
+		p.buf.WriteString("(")
+		p.print(n.child(0))
+		p.buf.WriteString(")")
+	case skDependentGenericType:
+		p.print(n.child(0))
+		p.buf.WriteString(" ")
+		p.print(n.child(1))
+	case skDependentGenericSignature:
+		p.printGenericSignature(n)
+	case skDependentGenericConformanceRequirement:
+		p.print(n.child(0))
+		p.buf.WriteString(": ")
+		p.print(n.child(1))
+	case skDependentGenericSameTypeRequirement:
+		p.print(n.child(0))
+		p.buf.WriteString(" == ")
+		p.print(n.child(1))
+	case skDependentGenericLayoutRequirement:
+		p.print(n.child(0))
+		p.buf.WriteString(": " + n.text)
+	case skDependentMemberType, skAssociatedTypeRef:
+		p.print(n.child(0))
+		p.buf.WriteString(".")
+		p.print(n.child(1))
+	case skOpaqueReturnType:
+		p.buf.WriteString("some")
+	case skOpaqueReturnTypeOf:
+		p.buf.WriteString("<<opaque return type of ")
+		p.printChildren(n, "")
+		p.buf.WriteString(">>")
+	case skOpaqueType:
+		p.print(n.child(0))
+		p.buf.WriteString(".")
+		p.print(n.child(1))
+		if args := n.child(2); args != nil && len(args.children) > 0 {
+			p.buf.WriteString("<")
+			p.print(args)
+			p.buf.WriteString(">")
+		}
+	case skThrowsAnnotation:
+		p.buf.WriteString(" throws")
+	case skTypedThrowsAnnotation:
+		p.buf.WriteString(" throws(")
+		p.print(n.child(0))
+		p.buf.WriteString(")")
+	case skAsyncAnnotation:
+		p.buf.WriteString(" async")
+	case skConcurrentFunctionType:
+		p.buf.WriteString("@Sendable ")
+	case skGlobalActorFunctionType:
+		p.buf.WriteString("@")
+		p.print(n.child(0))
+		p.buf.WriteString(" ")
+	case skImplFunctionType:
+		p.printImplFunctionType(n)
+	case skImplEscaping:
+		p.buf.WriteString("@escaping")
+	case skImplParameter, skImplResult, skImplYield:
+		if n.kind == skImplYield {
+			p.buf.WriteString("@yields ")
+		}
+		p.buf.WriteString(n.text + " ")
+		p.printChildren(n, "")
+	case skImplErrorResult:
+		p.buf.WriteString("@error " + n.text + " ")
+		p.printChildren(n, "")
+	case skProtocolConformance:
+		p.print(n.child(0))
+		p.buf.WriteString(" : ")
+		p.print(n.child(1))
+		if mod := n.child(2); mod != nil {
+			p.buf.WriteString(" in ")
+			p.print(mod)
+		}
+	case skProtocolWitness:
+		p.buf.WriteString("protocol witness for ")
+		p.print(n.child(1))
+		p.buf.WriteString(" in conformance ")
+		p.print(n.child(0))
+	case skLazyProtocolWitnessTableAccessor, skLazyProtocolWitnessTableCacheVariable:
+		if n.kind == skLazyProtocolWitnessTableAccessor {
+			p.buf.WriteString("lazy protocol witness table accessor for type ")
+		} else {
+			p.buf.WriteString("lazy protocol witness table cache variable for type ")
+		}
+		p.print(n.child(0))
+		p.buf.WriteString(" and conformance ")
+		p.print(n.child(1))
+	case skAssociatedTypeMetadataAccessor:
+		p.buf.WriteString("associated type metadata accessor for ")
+		p.print(n.child(1))
+		p.buf.WriteString(" in ")
+		p.print(n.child(0))
+	case skAssociatedTypeWitnessTableAccessor:
+		p.buf.WriteString("associated type witness table accessor for ")
+		p.print(n.child(1))
+		p.buf.WriteString(" : ")
+		p.print(n.child(2))
+		p.buf.WriteString(" in ")
+		p.print(n.child(0))
+	case skValueWitness:
+		p.buf.WriteString(n.text + " value witness for ")
+		p.printChildren(n, "")
+	case skFieldOffset:
+		p.print(n.child(0))
+		p.buf.WriteString("field offset for ")
+		p.print(n.child(1))
+	case skDirectness:
+		p.buf.WriteString(n.text + " ")
+	case skReabstractionThunk, skReabstractionThunkHelper, skReabstractionThunkHelperWithSelf:
+		p.buf.WriteString("reabstraction thunk ")
+		if n.kind != skReabstractionThunk {
+			p.buf.WriteString("helper ")
+		}
+		idx := 0
+		if n.child(0) != nil && n.child(0).kind == skDependentGenericSignature {
+			p.print(n.child(0))
+			p.buf.WriteString(" ")
+			idx = 1
+		}
+		if n.kind == skReabstractionThunkHelperWithSelf {
+			p.buf.WriteString("with self ")
+			p.print(n.child(idx))
+			p.buf.WriteString(" ")
+			idx++
+		}
+		p.buf.WriteString("from ")
+		p.print(n.child(idx + 1))
+		p.buf.WriteString(" to ")
+		p.print(n.child(idx))
+	case skKeyPathGetterThunkHelper, skKeyPathSetterThunkHelper:
+		if n.kind == skKeyPathGetterThunkHelper {
+			p.buf.WriteString("key path getter for ")
+		} else {
+			p.buf.WriteString("key path setter for ")
+		}
+		p.print(n.child(0))
+		p.buf.WriteString(" : ")
+		var types []*swiftNode
+		for _, c := range n.children[1:] {
+			if c.kind == skType {
+				types = append(types, c)
+			}
+		}
+		for i, c := range types {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.print(c)
+		}
+	case skPartialApplyForwarder, skPartialApplyObjCForwarder:
+		if n.kind == skPartialApplyForwarder {
+			p.buf.WriteString("partial apply forwarder")
+		} else {
+			p.buf.WriteString("partial apply ObjC forwarder")
+		}
+		if len(n.children) > 0 {
+			p.buf.WriteString(" for ")
+			p.printChildren(n, "")
+		}
+	case skGenericSpecialization, skGenericSpecializationNotReAbstracted, skGenericSpecializationInResilienceDomain:
+		p.printSpecializationPrefix(n, "generic specialization")
+	case skGenericSpecializationPrespecialized:
+		p.printSpecializationPrefix(n, "generic pre-specialization")
+	case skInlinedGenericFunction:
+		p.printSpecializationPrefix(n, "inlined generic function")
+	case skFunctionSignatureSpecialization:
+		p.printSpecializationPrefix(n, "function signature specialization")
+	case skIsSerialized:
+		p.buf.WriteString("serialized")
+	default:
+		p.unsupported(n)
+	}
+}
+
+func isSwiftExistential(n *swiftNode) bool {
+	if n != nil && n.kind == skType {
+		n = n.child(0)
+	}
+	if n == nil {
+		return false
+	}
+	switch n.kind {
+	case skProtocol, skProtocolList, skProtocolListWithClass, skProtocolListWithAnyObject:
+		return true
+	}
+	return false
+}
+
+func (p *swiftPrinter) printWithParens(ty *swiftNode) {
+	inner := ty
+	if inner != nil && inner.kind == skType {
+		inner = inner.child(0)
+	}
+	needParens := inner != nil && (isSwiftFunctionType(inner.kind) || inner.kind == skProtocolListWithClass ||
+		(inner.kind == skProtocolList && inner.child(0) != nil && len(inner.child(0).children) > 1))
+	if needParens {
+		p.buf.WriteString("(")
+	}
+	p.print(ty)
+	if needParens {
+		p.buf.WriteString(")")
+	}
+}
+
+// printContextPrefix prints ctx followed by a '.' unless ctx is empty.
+func (p *swiftPrinter) printContextPrefix(ctx *swiftNode) {
+	if ctx == nil {
+		return
+	}
+	before := p.buf.Len()
+	p.print(ctx)
+	if p.buf.Len() != before {
+		p.buf.WriteString(".")
+	}
+}
+
+// isPrefixContext reports whether a context prints as a prefix ("Module.Type.")
+// instead of a postfix (" in func()").
+func isPrefixContext(ctx *swiftNode) bool {
+	switch ctx.kind {
+	case skModule, skExtension, skClass, skStructure, skEnum, skProtocol, skTypeAlias, skOtherNominalType,
+		skBoundGenericClass, skBoundGenericStructure, skBoundGenericEnum, skBoundGenericProtocol,
+		skBoundGenericTypeAlias, skBoundGenericOtherNominalType, skType:
+		return true
+	}
+	return false
+}
+
+func swiftEntityType(n *swiftNode) *swiftNode {
+	for i := len(n.children) - 1; i > 0; i-- {
+		if n.children[i].kind == skType {
+			return n.children[i]
+		}
+	}
+	return nil
+}
+
+func (p *swiftPrinter) printEntity(n *swiftNode, accessor string) {
+	if n == nil {
+		p.print(n)
+		return
+	}
+	ctx := n.child(0)
+	ty := swiftEntityType(n)
+
+	switch n.kind {
+	case skExplicitClosure, skImplicitClosure:
+		if n.kind == skImplicitClosure {
+			p.buf.WriteString("implicit ")
+		}
+		fmt.Fprintf(&p.buf, "closure #%d", n.child(1).index+1)
+		if ty != nil {
+			p.buf.WriteString(" ")
+			p.print(ty)
+		}
+		p.buf.WriteString(" in ")
+		p.print(ctx)
+		return
+	case skDefaultArgumentInitializer:
+		fmt.Fprintf(&p.buf, "default argument %d of ", n.child(1).index)
+		p.print(ctx)
+		return
+	case skInitializer:
+		p.buf.WriteString("variable initialization expression of ")
+		p.print(ctx)
+		return
+	}
+
+	var postfix *swiftNode
+	if ctx != nil {
+		if isPrefixContext(ctx) {
+			p.printContextPrefix(ctx)
+		} else {
+			postfix = ctx
+		}
+	}
+
+	switch n.kind {
+	case skFunction, skVariable:
+		p.print(n.child(1))
+	case skSubscript:
+		p.buf.WriteString("subscript")
+		if priv := n.firstChildOf(skPrivateDeclName); priv != nil {
+			p.buf.WriteString(" ")
+			p.print(priv)
+		}
+	case skConstructor:
+		p.buf.WriteString("init")
+	case skAllocator:
+		p.buf.WriteString("__allocating_init")
+	case skDestructor:
+		p.buf.WriteString("deinit")
+	case skDeallocator:
+		p.buf.WriteString("__deallocating_deinit")
+	case skIVarInitializer:
+		p.buf.WriteString("__ivar_initializer")
+	case skIVarDestroyer:
+		p.buf.WriteString("__ivar_destroyer")
+	default:
+		p.unsupported(n)
+	}
+
+	if len(accessor) > 0 {
+		p.buf.WriteString("." + accessor)
+	}
+
+	if ty != nil {
+		labels := n.firstChildOf(skLabelList)
+		inner := ty.child(0)
+		var sig *swiftNode
+		if inner != nil && inner.kind == skDependentGenericType {
+			sig = inner.child(0)
+			inner = inner.child(1).child(0)
+		}
+		if len(accessor) == 0 && n.kind != skVariable && inner != nil && isSwiftFunctionType(inner.kind) {
+			if sig != nil {
+				p.print(sig)
+			}
+			p.printFunctionType(inner, labels)
+		} else {
+			p.buf.WriteString(" : ")
+			p.print(ty)
+		}
+	}
+
+	if postfix != nil {
+		p.buf.WriteString(" in ")
+		p.print(postfix)
+	}
+}
+
+func (p *swiftPrinter) printFunctionType(n *swiftNode, labels *swiftNode) {
+	var args, ret *swiftNode
+	var async, throws, sendable, actor *swiftNode
+	for _, c := range n.children {
+		switch c.kind {
+		case skArgumentTuple:
+			args = c
+		case skReturnType:
+			ret = c
+		case skAsyncAnnotation:
+			async = c
+		case skThrowsAnnotation, skTypedThrowsAnnotation:
+			throws = c
+		case skConcurrentFunctionType:
+			sendable = c
+		case skGlobalActorFunctionType:
+			actor = c
+		}
+	}
+	if actor != nil {
+		p.print(actor)
+	}
+	if sendable != nil {
+		p.print(sendable)
+	}
+	p.printFunctionParameters(labels, args)
+	if async != nil {
+		p.print(async)
+	}
+	if throws != nil {
+		p.print(throws)
+	}
+	p.print(ret)
+}
+
+func (p *swiftPrinter) printFunctionParameters(labels, args *swiftNode) {
+	if args == nil {
+		p.print(args)
+		return
+	}
+	params := args.child(0).child(0)
+	if params == nil {
+		p.buf.WriteString("()")
+		return
+	}
+	hasLabels := labels != nil && len(labels.children) > 0
+	label := func(i int) string {
+		if l := labels.child(i); l != nil && l.kind == skIdentifier {
+			return l.text + ": "
+		}
+		return "_: "
+	}
+	if params.kind != skTuple {
+		p.buf.WriteString("(")
+		if hasLabels {
+			p.buf.WriteString(label(0))
+		}
+		p.print(params)
+		p.buf.WriteString(")")
+		return
+	}
+	p.buf.WriteString("(")
+	for i, param := range params.children {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		if hasLabels {
+			p.buf.WriteString(label(i))
+		}
+		p.print(param)
+	}
+	p.buf.WriteString(")")
+}
+
+var swiftSugarNames = map[string]string{
+	"Optional":                    "?",
+	"ImplicitlyUnwrappedOptional": "!",
+	"Array":                       "[]",
+	"Dictionary":                  "[:]",
+}
+
+func (p *swiftPrinter) printBoundGeneric(n *swiftNode) {
+	nominal := n.child(0)
+	args := n.child(1)
+	if nominal != nil && nominal.kind == skType {
+		nominal = nominal.child(0)
+	}
+	if nominal != nil && args != nil && isSwiftAnyGeneric(nominal.kind) &&
+		nominal.child(0) != nil && nominal.child(0).kind == skModule && nominal.child(0).text == "Swift" &&
+		nominal.child(1) != nil && nominal.child(1).kind == skIdentifier {
+		switch swiftSugarNames[nominal.child(1).text] {
+		case "?", "!":
+			if len(args.children) == 1 {
+				p.printWithParens(args.child(0))
+				p.buf.WriteString(swiftSugarNames[nominal.child(1).text])
+				return
+			}
+		case "[]":
+			if len(args.children) == 1 {
+				p.buf.WriteString("[")
+				p.print(args.child(0))
+				p.buf.WriteString("]")
+				return
+			}
+		case "[:]":
+			if len(args.children) == 2 {
+				p.buf.WriteString("[")
+				p.print(args.child(0))
+				p.buf.WriteString(" : ")
+				p.print(args.child(1))
+				p.buf.WriteString("]")
+				return
+			}
+		}
+	}
+	p.print(n.child(0))
+	p.buf.WriteString("<")
+	p.print(args)
+	p.buf.WriteString(">")
+}
+
+func (p *swiftPrinter) printGenericSignature(n *swiftNode) {
+	p.buf.WriteString("<")
+	numCounts := 0
+	for _, c := range n.children {
+		if c.kind != skDependentGenericParamCount {
+			break
+		}
+		if numCounts > 0 {
+			p.buf.WriteString("><")
+		}
+		for i := 0; i < c.index; i++ {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.buf.WriteString(genericParameterName(numCounts, i))
+		}
+		numCounts++
+	}
+	if numCounts < len(n.children) {
+		p.buf.WriteString(" where ")
+		for i, c := range n.children[numCounts:] {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.print(c)
+		}
+	}
+	p.buf.WriteString(">")
+}
+
+func (p *swiftPrinter) printImplFunctionType(n *swiftNode) {
+	const (
+		stateAttrs = iota
+		stateInputs
+		stateResults
+	)
+	state := stateAttrs
+	transition := func(to int) {
+		for ; state < to; state++ {
+			switch state {
+			case stateAttrs:
+				p.buf.WriteString("(")
+			case stateInputs:
+				p.buf.WriteString(") -> (")
+			}
+		}
+	}
+	for _, c := range n.children {
+		switch c.kind {
+		case skImplParameter:
+			if state == stateInputs {
+				p.buf.WriteString(", ")
+			}
+			transition(stateInputs)
+			p.print(c)
+		case skImplResult, skImplYield, skImplErrorResult:
+			if state == stateResults {
+				p.buf.WriteString(", ")
+			}
+			transition(stateResults)
+			p.print(c)
+		default:
+			p.print(c)
+			p.buf.WriteString(" ")
+		}
+	}
+	transition(stateResults)
+	p.buf.WriteString(")")
+}
+
+func (p *swiftPrinter) printSpecializationPrefix(n *swiftNode, description string) {
+	p.buf.WriteString(description + " <")
+	sep := ""
+	argNum := 0
+	for _, c := range n.children {
+		switch c.kind {
+		case skSpecializationPassID:
+		case skIsSerialized:
+			p.buf.WriteString(sep)
+			sep = ", "
+			p.print(c)
+		default:
+			if len(c.children) > 0 {
+				p.buf.WriteString(sep)
+				sep = ", "
+				switch c.kind {
+				case skFunctionSignatureSpecializationParam:
+					fmt.Fprintf(&p.buf, "Arg[%d] = ", argNum)
+					p.printFuncSigSpecializationParam(c)
+				case skFunctionSignatureSpecializationReturn:
+					p.buf.WriteString("Return = ")
+					p.printFuncSigSpecializationParam(c)
+				default:
+					p.print(c)
+				}
+			}
+			argNum++
+		}
+	}
+	p.buf.WriteString("> of ")
+}
+
+func (p *swiftPrinter) printFuncSigSpecializationParam(n *swiftNode) {
+	kind := n.child(0).index
+	payload := func(i int) string {
+		if c := n.child(i); c != nil {
+			return c.text
+		}
+		return ""
+	}
+	switch kind {
+	case fsConstantPropFunction, fsConstantPropGlobal:
+		if kind == fsConstantPropFunction {
+			p.buf.WriteString("Constant Propagated Function : ")
+		} else {
+			p.buf.WriteString("Constant Propagated Global : ")
+		}
+		p.buf.WriteString(SwiftFilter(payload(1)))
+	case fsConstantPropInteger, fsConstantPropFloat:
+		if kind == fsConstantPropInteger {
+			p.buf.WriteString("Constant Propagated Integer : ")
+		} else {
+			p.buf.WriteString("Constant Propagated Float : ")
+		}
+		p.buf.WriteString(payload(1))
+	case fsConstantPropString:
+		fmt.Fprintf(&p.buf, "Constant Propagated String : %s'%s'", payload(1), payload(2))
+	case fsConstantPropKeyPath:
+		p.buf.WriteString("Constant Propagated KeyPath : ")
+		p.buf.WriteString(SwiftFilter(payload(1)))
+	case fsClosureProp:
+		p.buf.WriteString("Closure Propagated : ")
+		p.buf.WriteString(SwiftFilter(payload(1)))
+		p.buf.WriteString(", Argument Types : [")
+		for i, c := range n.children[2:] {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.print(c)
+		}
+		p.buf.WriteString("]")
+	case fsBoxToValue:
+		p.buf.WriteString("Value Promoted from Box")
+	case fsBoxToStack:
+		p.buf.WriteString("Stack Promoted from Box")
+	case fsInOutToOut:
+		p.buf.WriteString("InOut Converted to Out")
+	default:
+		var opts []string
+		if kind&fsExistentialToGeneric != 0 {
+			opts = append(opts, "Existential To Protocol Constrained Generic")
+		}
+		if kind&fsDead != 0 {
+			opts = append(opts, "Dead")
+		}
+		if kind&fsOwnedToGuaranteed != 0 {
+			opts = append(opts, "Owned To Guaranteed")
+		}
+		if kind&fsGuaranteedToOwned != 0 {
+			opts = append(opts, "Guaranteed To Owned")
+		}
+		if kind&fsSROA != 0 {
+			opts = append(opts, "Exploded")
+		}
+		p.buf.WriteString(strings.Join(opts, " and "))
+	}
+}
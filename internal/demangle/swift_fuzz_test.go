@@ -0,0 +1,15 @@
+// +build go1.18
+
+package demangle
+
+import "testing"
+
+func FuzzSwift(f *testing.F) {
+	for _, tt := range swiftTests {
+		f.Add(tt.mangled)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		// the demangler must reject malformed names, not panic on them
+		SwiftToString(name)
+	})
+}
@@ -0,0 +1,140 @@
+package demangle
+
+import "testing"
+
+// swiftTests are mangled names and their demangling as printed by swift-demangle
+// (in the style of swift/test/Demangle/Inputs/manglings.txt)
+var swiftTests = []struct {
+	mangled   string
+	demangled string
+}{
+	// functions
+	{"$s4test3fooyyF", "test.foo() -> ()"},
+	{"$s4main3fooyySS_SitF", "main.foo(Swift.String, Swift.Int) -> ()"},
+	{"$s4main3foo1xySi_tF", "main.foo(x: Swift.Int) -> ()"},
+	{"$s4main3FooC3bar1xS2i_tF", "main.Foo.bar(x: Swift.Int) -> Swift.Int"},
+	{"$s4main3FooC3bar_3bazS2i_SStF", "main.Foo.bar(_: Swift.Int, baz: Swift.String) -> Swift.Int"},
+	{"$s4main3FooC3bazyySiKF", "main.Foo.baz(Swift.Int) throws -> ()"},
+	{"$s4main3FooC3quxyyYaF", "main.Foo.qux() async -> ()"},
+	{"$s4main3fooSiSgyF", "main.foo() -> Swift.Int?"},
+	{"$s4main3fooyySiz_tF", "main.foo(inout Swift.Int) -> ()"},
+	{"$s4main3fooyyyyXEF", "main.foo(() -> ()) -> ()"},
+	{"$s4main3FooC3baryySaySiGF", "main.Foo.bar([Swift.Int]) -> ()"},
+	{"$sSi1poiyS2i_SitFZ", "static Swift.Int.+ infix(Swift.Int, Swift.Int) -> Swift.Int"},
+	{"$s4main3BarO1ayA2CmF", "main.Bar.a(main.Bar.Type) -> main.Bar"},
+	{"$s4main4testyyFyycfU_", "closure #1 () -> () in main.test() -> ()"},
+	{"$sSS7cStringSSSPys4Int8VG_tcfC", "Swift.String.__allocating_init(cString: Swift.UnsafePointer<Swift.Int8>) -> Swift.String"},
+
+	// generics
+	{"$s4main3fooyyxlF", "main.foo<A>(A) -> ()"},
+	{"$s4main3fooyyx_q_tr0_lF", "main.foo<A, B>(A, B) -> ()"},
+	{"$s4main3fooyyxAA1PRzlF", "main.foo<A where A: main.P>(A) -> ()"},
+
+	// constructors, destructors and accessors
+	{"$s4main3FooCACycfC", "main.Foo.__allocating_init() -> main.Foo"},
+	{"$s4main3FooCACycfc", "main.Foo.init() -> main.Foo"},
+	{"$s4main3FooCfD", "main.Foo.__deallocating_deinit"},
+	{"$s4main3FooCfd", "main.Foo.deinit"},
+	{"$s4main3FooCfE", "main.Foo.__ivar_destroyer"},
+	{"$s4main3FooV3barSivg", "main.Foo.bar.getter : Swift.Int"},
+	{"$s4main3FooV3barSivs", "main.Foo.bar.setter : Swift.Int"},
+	{"$s4main3FooC1xSivM", "main.Foo.x.modify : Swift.Int"},
+	{"$s4main3FooC4nameSSvW", "main.Foo.name.didset : Swift.String"},
+	{"$s4main3FooV1xSivau", "main.Foo.x.unsafeMutableAddressor : Swift.Int"},
+	{"$s4main3FooV1xSivpZ", "static main.Foo.x : Swift.Int"},
+	{"$s4main3FooC1xSivpfi", "variable initialization expression of main.Foo.x : Swift.Int"},
+
+	// metadata and descriptors
+	{"$s4main3FooVN", "type metadata for main.Foo"},
+	{"$sSiN", "type metadata for Swift.Int"},
+	{"$s4main3FooVMa", "type metadata accessor for main.Foo"},
+	{"$s4main3FooVMf", "full type metadata for main.Foo"},
+	{"$s4main3FooVMn", "nominal type descriptor for main.Foo"},
+	{"$s4main3FooCMm", "metaclass for main.Foo"},
+	{"$s4main3FooCMo", "class metadata base offset for main.Foo"},
+	{"$s4main1PMp", "protocol descriptor for main.P"},
+	{"$s4main3FooC1xSivpMV", "property descriptor for main.Foo.x : Swift.Int"},
+	{"$s4main3FooVWV", "value witness table for main.Foo"},
+	{"$s4main3FooVwCP", "initializeBufferWithCopyOfBuffer value witness for main.Foo"},
+	{"$sSo6CGRectVMn", "nominal type descriptor for __C.CGRect"},
+	{"$sSo8NSObjectCMa", "type metadata accessor for __C.NSObject"},
+
+	// conformances
+	{"$s4main3FooVAA1PAAMc", "protocol conformance descriptor for main.Foo : main.P in main"},
+	{"$s4main3FooVAA1PAAWP", "protocol witness table for main.Foo : main.P in main"},
+	{"$s4main3FooVSHAAMc", "protocol conformance descriptor for main.Foo : Swift.Hashable in main"},
+	{"$s4main3FooCAA1PA2aDP3baryyFTW", "protocol witness for main.P.bar() -> () in conformance main.Foo : main.P in main"},
+
+	// thunks
+	{"$s4main3FooC3baryyFTq", "method descriptor for main.Foo.bar() -> ()"},
+	{"$s4main3FooC3baryyFTj", "dispatch thunk of main.Foo.bar() -> ()"},
+	{"$s4main3FooC3baryyFTo", "@objc main.Foo.bar() -> ()"},
+	{"$s4main3FooC1xSivgTo", "@objc main.Foo.x.getter : Swift.Int"},
+	{"$s4main3FooC3baryyFTA", "partial apply forwarder for main.Foo.bar() -> ()"},
+
+	// types
+	{"$sSaySiGD", "[Swift.Int]"},
+	{"$sSDySSSiGD", "[Swift.String : Swift.Int]"},
+	{"$sSiSgD", "Swift.Int?"},
+	{"$s4main3FooVySiGD", "main.Foo<Swift.Int>"},
+	{"$s4main5Outer33_0123456789ABCDEF0123456789ABCDEFLLV", "main.(Outer in _0123456789ABCDEF0123456789ABCDEF)"},
+
+	// prefixes
+	{"_$s4main3FooVMn", "nominal type descriptor for main.Foo"},
+	{"$S4main3FooVN", "type metadata for main.Foo"},
+	{"_T04main3FooVN", "type metadata for main.Foo"},
+	{"_T0SiD", "Swift.Int"},
+	{"_TtC4main3Foo", "main.Foo"},
+	{"_TtCs12_SwiftObject", "Swift._SwiftObject"},
+	{"_TtP3foo3bar_", "foo.bar"},
+}
+
+func TestSwift(t *testing.T) {
+	for _, tt := range swiftTests {
+		got, err := SwiftToString(tt.mangled)
+		if err != nil {
+			t.Errorf("SwiftToString(%s) error = %v", tt.mangled, err)
+		} else if got != tt.demangled {
+			t.Errorf("SwiftToString(%s) = %q, want %q", tt.mangled, got, tt.demangled)
+		}
+	}
+}
+
+func TestSwiftErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+	}{
+		{"_ZN3foo3barEv", ErrNotSwiftMangledName},
+		{"main", ErrNotSwiftMangledName},
+		{"$s", errSwiftDemangle},
+		{"$s4mainyyF", errSwiftDemangle},
+		{"$s4main3FooVAA1PAAMcMK", errSwiftDemangle},
+	} {
+		if _, err := SwiftToString(tt.name); err != tt.err {
+			t.Errorf("SwiftToString(%s) error = %v, want %v", tt.name, err, tt.err)
+		}
+		if got := SwiftFilter(tt.name); got != tt.name {
+			t.Errorf("SwiftFilter(%s) = %s, want the name unchanged", tt.name, got)
+		}
+	}
+}
+
+func TestIsSwiftSymbol(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want bool
+	}{
+		{"$s4main3FooVN", true},
+		{"_$s4main3FooVN", true},
+		{"_T04main3FooVN", true},
+		{"_TtC4main3Foo", true},
+		{"__TtC4main3Foo", true},
+		{"_ZN3foo3barEv", false},
+		{"_main", false},
+	} {
+		if got := IsSwiftSymbol(tt.name); got != tt.want {
+			t.Errorf("IsSwiftSymbol(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package download
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ranger"
+	"github.com/pkg/errors"
+)
+
+// DefaultBlockCacheSize is the default max size of the remote block cache
+const DefaultBlockCacheSize int64 = 1 << 30
+
+// DefaultBlockCacheDir returns the default remote block cache directory
+func DefaultBlockCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "ipsw", "remote")
+}
+
+type cacheEntry struct {
+	size int64
+	used time.Time
+}
+
+// BlockCache is a persistent on-disk LRU cache of the byte ranges read from remote zips.
+// Blocks are keyed by URL, validator (ETag or Last-Modified) and range so a changed
+// remote file never hits stale blocks, and the cache can be shared between commands
+type BlockCache struct {
+	Dir     string
+	MaxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+}
+
+// OpenBlockCache opens (or creates) the block cache in dir
+func OpenBlockCache(dir string, maxSize int64) (*BlockCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create block cache %s", dir)
+	}
+
+	c := &BlockCache{
+		Dir:     dir,
+		MaxSize: maxSize,
+		entries: make(map[string]*cacheEntry),
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(path, ".tmp") {
+			os.Remove(path) // left over from an interrupted write
+			return nil
+		}
+		c.entries[filepath.Base(path)] = &cacheEntry{size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read block cache %s", dir)
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// Size returns the number of bytes and blocks in the cache
+func (c *BlockCache) Size() (int64, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size, len(c.entries)
+}
+
+// Purge removes all the blocks from the cache
+func (c *BlockCache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		os.Remove(c.path(key))
+	}
+	c.entries = make(map[string]*cacheEntry)
+	c.size = 0
+	return nil
+}
+
+// Key returns the cache key of a range of a remote file
+func (c *BlockCache) Key(url, validator string, start, end int64) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d-%d", url, validator, start, end))))
+}
+
+func (c *BlockCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// Get returns a cached block
+func (c *BlockCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil || int64(len(data)) != e.size { // evicted by another process
+		c.mu.Lock()
+		c.remove(key)
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	e.used = now
+	c.mu.Unlock()
+	os.Chtimes(c.path(key), now, now) // persist the LRU order
+
+	return data, true
+}
+
+// Put adds a block to the cache, evicting the least recently used blocks if the cache is full
+func (c *BlockCache) Put(key string, data []byte) error {
+	if int64(len(data)) > c.MaxSize {
+		return nil
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "failed to write cache block")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+	c.entries[key] = &cacheEntry{size: int64(len(data)), used: time.Now()}
+	c.size += int64(len(data))
+	c.evict()
+
+	return nil
+}
+
+// remove drops a block from the index (caller must hold the lock)
+func (c *BlockCache) remove(key string) {
+	if e, ok := c.entries[key]; ok {
+		c.size -= e.size
+		delete(c.entries, key)
+	}
+}
+
+// evict removes the least recently used blocks until the cache fits (caller must hold the lock)
+func (c *BlockCache) evict() {
+	if c.size <= c.MaxSize {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].used.Before(c.entries[keys[j]].used)
+	})
+
+	for _, key := range keys {
+		if c.size <= c.MaxSize {
+			break
+		}
+		os.Remove(c.path(key))
+		c.remove(key)
+	}
+}
+
+// validatorClient records the validator of the ranger's HEAD request so blocks can be keyed by it
+type validatorClient struct {
+	*http.Client
+	validator string
+}
+
+func (v *validatorClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := v.Client.Do(req)
+	if err == nil && len(v.validator) == 0 {
+		if etag := resp.Header.Get("ETag"); len(etag) > 0 {
+			v.validator = etag
+		} else {
+			v.validator = resp.Header.Get("Last-Modified")
+		}
+	}
+	return resp, err
+}
+
+// cachedFetcher is a ranger.RangeFetcher that serves the blocks it can from a BlockCache
+type cachedFetcher struct {
+	url    string
+	ranger *ranger.HTTPRanger
+	client *validatorClient
+	cache  *BlockCache
+}
+
+func (f *cachedFetcher) ExpectedLength() (int64, error) {
+	return f.ranger.ExpectedLength()
+}
+
+func (f *cachedFetcher) FetchRanges(ranges []ranger.ByteRange) ([]ranger.Block, error) {
+	length, err := f.ranger.ExpectedLength()
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]ranger.Block, len(ranges))
+	keys := make([]string, len(ranges))
+
+	var missing []ranger.ByteRange
+	var missingIdx []int
+	for i, br := range ranges {
+		keys[i] = f.cache.Key(f.url, f.client.validator, br.Start, br.End)
+		if data, ok := f.cache.Get(keys[i]); ok {
+			blocks[i] = ranger.Block{Length: br.End - br.Start + 1, Data: data}
+			continue
+		}
+		missing = append(missing, br)
+		missingIdx = append(missingIdx, i)
+	}
+
+	log.WithFields(log.Fields{
+		"cached":  len(ranges) - len(missing),
+		"fetched": len(missing),
+	}).Debug("Remote block cache")
+
+	if len(missing) == 0 {
+		return blocks, nil
+	}
+
+	fetched, err := f.ranger.FetchRanges(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, block := range fetched {
+		idx := missingIdx[j]
+		blocks[idx] = block
+		// only cache complete blocks (the last block of the file is short)
+		br := ranges[idx]
+		end := br.End
+		if end > length-1 {
+			end = length - 1
+		}
+		if int64(len(block.Data)) != end-br.Start+1 {
+			continue
+		}
+		if err := f.cache.Put(keys[idx], block.Data); err != nil {
+			log.WithError(err).Debug("failed to cache remote block")
+		}
+	}
+
+	return blocks, nil
+}
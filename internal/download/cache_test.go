@@ -0,0 +1,246 @@
+package download
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ranger"
+)
+
+func TestBlockCacheKey(t *testing.T) {
+	c := &BlockCache{}
+	key := c.Key("https://example.com/a.ipsw", `"v1"`, 0, 511)
+	if key != c.Key("https://example.com/a.ipsw", `"v1"`, 0, 511) {
+		t.Error("Key() isn't stable")
+	}
+	for _, other := range []string{
+		c.Key("https://example.com/b.ipsw", `"v1"`, 0, 511),
+		c.Key("https://example.com/a.ipsw", `"v2"`, 0, 511),
+		c.Key("https://example.com/a.ipsw", `"v1"`, 512, 1023),
+		c.Key("https://example.com/a.ipsw", `"v1"`, 0, 1023),
+		// the fields are separated so they can't run together
+		c.Key("https://example.com/a.ipsw\x00", `"v1"`, 0, 511),
+	} {
+		if other == key {
+			t.Errorf("Key() collides for a different url, validator or range")
+		}
+	}
+}
+
+func TestBlockCacheEviction(t *testing.T) {
+	c, err := OpenBlockCache(t.TempDir(), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := func(b byte) []byte { return bytes.Repeat([]byte{b}, 10) }
+	keys := []string{
+		c.Key("u", "", 0, 9),
+		c.Key("u", "", 10, 19),
+		c.Key("u", "", 20, 29),
+		c.Key("u", "", 30, 39),
+	}
+	for i, key := range keys[:3] {
+		if err := c.Put(key, block(byte(i))); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	if size, n := c.Size(); size != 30 || n != 3 {
+		t.Fatalf("Size() = %d, %d; want 30, 3", size, n)
+	}
+
+	// touch the oldest block so the second one is the least recently used
+	if data, ok := c.Get(keys[0]); !ok || !bytes.Equal(data, block(0)) {
+		t.Fatalf("Get() = %v, %v", data, ok)
+	}
+	if err := c.Put(keys[3], block(3)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if size, n := c.Size(); size != 30 || n != 3 {
+		t.Errorf("Size() = %d, %d; want 30, 3", size, n)
+	}
+	if _, ok := c.Get(keys[1]); ok {
+		t.Error("least recently used block wasn't evicted")
+	}
+	if _, err := os.Stat(c.path(keys[1])); !os.IsNotExist(err) {
+		t.Error("evicted block wasn't removed from disk")
+	}
+	for _, i := range []int{0, 2, 3} {
+		if data, ok := c.Get(keys[i]); !ok || !bytes.Equal(data, block(byte(i))) {
+			t.Errorf("block %d = %v, %v", i, data, ok)
+		}
+	}
+
+	// blocks bigger than the cache aren't cached
+	if err := c.Put(c.Key("u", "", 0, 99), make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, n := c.Size(); n != 3 {
+		t.Errorf("cache has %d blocks after putting an oversized block, want 3", n)
+	}
+
+	// a block removed by another process is a miss
+	os.Remove(c.path(keys[3]))
+	if _, ok := c.Get(keys[3]); ok {
+		t.Error("Get() of a block removed from disk hit")
+	}
+	if size, n := c.Size(); size != 20 || n != 2 {
+		t.Errorf("Size() = %d, %d; want 20, 2", size, n)
+	}
+}
+
+func TestOpenBlockCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenBlockCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, recent := c.Key("u", "", 0, 39), c.Key("u", "", 40, 79)
+	if err := c.Put(old, make([]byte, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(recent, make([]byte, 40)); err != nil {
+		t.Fatal(err)
+	}
+	// the LRU order is persisted in the blocks' mtimes
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(c.path(old), past, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "interrupted.tmp"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenBlockCache(dir, 50)
+	if err != nil {
+		t.Fatalf("OpenBlockCache() error = %v", err)
+	}
+	if size, n := reopened.Size(); size != 40 || n != 1 {
+		t.Errorf("Size() = %d, %d; want 40, 1", size, n)
+	}
+	if _, ok := reopened.Get(recent); !ok {
+		t.Error("most recently used block was evicted on open")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "interrupted.tmp")); !os.IsNotExist(err) {
+		t.Error("interrupted write wasn't cleaned up")
+	}
+
+	if err := reopened.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if size, n := reopened.Size(); size != 0 || n != 0 {
+		t.Errorf("Size() after Purge() = %d, %d", size, n)
+	}
+}
+
+// etagServer serves data with an ETag and counts the range requests
+type etagServer struct {
+	mu     sync.Mutex
+	data   []byte
+	etag   string
+	ranges int
+}
+
+func (s *etagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if len(r.Header.Get("Range")) > 0 {
+		s.ranges++
+	}
+	etag := s.etag
+	s.mu.Unlock()
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "test.zip", time.Time{}, bytes.NewReader(s.data))
+}
+
+func (s *etagServer) rangeRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ranges
+}
+
+func TestCachedFetcher(t *testing.T) {
+	data := testFile(4000) // the last 512 byte block is short
+	srv := &etagServer{data: data, etag: `"v1"`}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := OpenBlockCache(t.TempDir(), DefaultBlockCacheSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newReader := func() *ranger.Reader {
+		vc := &validatorClient{Client: &http.Client{}}
+		return &ranger.Reader{
+			Fetcher: &cachedFetcher{
+				url:    ts.URL,
+				ranger: &ranger.HTTPRanger{URL: u, Client: vc},
+				client: vc,
+				cache:  cache,
+			},
+			BlockSize: 512,
+		}
+	}
+	read := func(r *ranger.Reader, off int64, n int) {
+		t.Helper()
+		buf := make([]byte, n)
+		if got, err := r.ReadAt(buf, off); got != n || err != nil && err != io.EOF { // reads to the end are an io.EOF
+			t.Fatalf("ReadAt(%d) = %d, %v", off, got, err)
+		}
+		if !bytes.Equal(buf, data[off:off+int64(n)]) {
+			t.Fatalf("ReadAt(%d) doesn't match the served data", off)
+		}
+	}
+
+	// a read spanning blocks 0-2
+	read(newReader(), 300, 1000)
+	fetched := srv.rangeRequests()
+	if fetched == 0 {
+		t.Fatal("nothing was fetched")
+	}
+	if _, n := cache.Size(); n != 3 {
+		t.Fatalf("cache has %d blocks, want 3", n)
+	}
+
+	// the same blocks are served from the cache by a new reader
+	read(newReader(), 512, 1024)
+	if got := srv.rangeRequests(); got != fetched {
+		t.Errorf("cached read made %d range requests", got-fetched)
+	}
+
+	// the short last block of the file is cached too
+	read(newReader(), 3600, 400)
+	if _, n := cache.Size(); n != 4 {
+		t.Errorf("cache has %d blocks after reading the last block, want 4", n)
+	}
+	fetched = srv.rangeRequests()
+	read(newReader(), 3584, 416)
+	if got := srv.rangeRequests(); got != fetched {
+		t.Errorf("cached read of the last block made %d range requests", got-fetched)
+	}
+
+	// a changed remote file misses
+	fetched = srv.rangeRequests()
+	srv.mu.Lock()
+	srv.etag = `"v2"`
+	srv.mu.Unlock()
+	read(newReader(), 300, 1000)
+	if srv.rangeRequests() == fetched {
+		t.Error("read of a changed remote file was served from the cache")
+	}
+	if _, n := cache.Size(); n != 7 {
+		t.Errorf("cache has %d blocks, want 7 (the changed file's 3 blocks are cached separately)", n)
+	}
+}
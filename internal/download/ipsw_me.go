@@ -5,10 +5,38 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 )
 
-const ipswMeAPI = "https://api.ipsw.me/v4/"
+const (
+	// IpswMeAPIPath is the path of the ipsw.me API (and of an 'ipsw mirror serve' mirror's copy of it)
+	IpswMeAPIPath = "/v4/"
+	ipswMeURL     = "https://api.ipsw.me"
+)
+
+// API requests the ipsw.me API and the iTunes version plist (or an 'ipsw mirror serve' mirror's copies of them)
+type API struct {
+	ipswMeAPI        string
+	iTunesVersionURL string
+}
+
+// NewAPI returns an API client for the mirror at baseURL (or for ipsw.me and iTunes if baseURL is empty)
+func NewAPI(baseURL string) *API {
+	if len(baseURL) == 0 {
+		return &API{
+			ipswMeAPI:        ipswMeURL + IpswMeAPIPath,
+			iTunesVersionURL: iTunesURL + ITunesVersionPath,
+		}
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &API{
+		ipswMeAPI:        baseURL + IpswMeAPIPath,
+		iTunesVersionURL: baseURL + ITunesVersionPath,
+	}
+}
+
+var defaultAPI = NewAPI("")
 
 // Device struct
 type Device struct {
@@ -35,11 +63,16 @@ type IPSW struct {
 	Signed      bool      `json:"signed,omitempty"`
 }
 
-// GetAllDevices returns a list of all devices
+// GetAllDevices returns a list of all devices from ipsw.me
 func GetAllDevices() ([]Device, error) {
+	return defaultAPI.GetAllDevices()
+}
+
+// GetAllDevices returns a list of all devices
+func (a *API) GetAllDevices() ([]Device, error) {
 	devices := []Device{}
 
-	res, err := http.Get(ipswMeAPI + "devices")
+	res, err := http.Get(a.ipswMeAPI + "devices")
 	if err != nil {
 		return devices, err
 	}
@@ -61,11 +94,16 @@ func GetAllDevices() ([]Device, error) {
 	return devices, nil
 }
 
-// GetDevice returns a device from it's identifier
+// GetDevice returns a device from it's identifier from ipsw.me
 func GetDevice(identifier string) (Device, error) {
+	return defaultAPI.GetDevice(identifier)
+}
+
+// GetDevice returns a device from it's identifier
+func (a *API) GetDevice(identifier string) (Device, error) {
 	d := Device{}
 
-	res, err := http.Get(ipswMeAPI + "device" + "/" + identifier)
+	res, err := http.Get(a.ipswMeAPI + "device" + "/" + identifier)
 	if err != nil {
 		return d, err
 	}
@@ -87,11 +125,16 @@ func GetDevice(identifier string) (Device, error) {
 	return d, nil
 }
 
-// GetAllIPSW finds all IPSW files for a given iOS version
+// GetAllIPSW finds all IPSW files for a given iOS version from ipsw.me
 func GetAllIPSW(version string) ([]IPSW, error) {
+	return defaultAPI.GetAllIPSW(version)
+}
+
+// GetAllIPSW finds all IPSW files for a given iOS version
+func (a *API) GetAllIPSW(version string) ([]IPSW, error) {
 	ipsws := []IPSW{}
 
-	res, err := http.Get(ipswMeAPI + "ipsw/" + version)
+	res, err := http.Get(a.ipswMeAPI + "ipsw/" + version)
 	if err != nil {
 		return ipsws, err
 	}
@@ -113,11 +156,16 @@ func GetAllIPSW(version string) ([]IPSW, error) {
 	return ipsws, nil
 }
 
-// GetIPSW will get an IPSW when supplied an identifier and build ID
+// GetIPSW will get an IPSW when supplied an identifier and build ID from ipsw.me
 func GetIPSW(identifier, buildID string) (IPSW, error) {
+	return defaultAPI.GetIPSW(identifier, buildID)
+}
+
+// GetIPSW will get an IPSW when supplied an identifier and build ID
+func (a *API) GetIPSW(identifier, buildID string) (IPSW, error) {
 	i := IPSW{}
 
-	res, err := http.Get(ipswMeAPI + "ipsw/" + identifier + "/" + buildID)
+	res, err := http.Get(a.ipswMeAPI + "ipsw/" + identifier + "/" + buildID)
 	if err != nil {
 		return i, err
 	}
@@ -140,17 +188,22 @@ func GetIPSW(identifier, buildID string) (IPSW, error) {
 	return i, nil
 }
 
-// GetVersion returns the iOS version for a given build ID
+// GetVersion returns the iOS version for a given build ID from ipsw.me
 func GetVersion(buildID string) (string, error) {
+	return defaultAPI.GetVersion(buildID)
+}
+
+// GetVersion returns the iOS version for a given build ID
+func (a *API) GetVersion(buildID string) (string, error) {
 
-	devices, err := GetAllDevices()
+	devices, err := a.GetAllDevices()
 	if err != nil {
 		return "", fmt.Errorf("failed to get all devices from ipsw.me API: %v", err)
 	}
 
 	for i := len(devices) - 1; i >= 0; i-- {
 		var dev Device
-		res, err := http.Get(ipswMeAPI + "device/" + devices[i].Identifier)
+		res, err := http.Get(a.ipswMeAPI + "device/" + devices[i].Identifier)
 		if err != nil {
 			return "", err
 		}
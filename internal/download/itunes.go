@@ -16,8 +16,10 @@ import (
 )
 
 const (
-	iTunesVersionURL = "https://itunes.apple.com/WebObjects/MZStore.woa/wa/com.apple.jingle.appserver.client.MZITunesClientCheck/version/"
-	macOSIpswURL     = "https://mesu.apple.com/assets/macos/com_apple_macOSIPSW/com_apple_macOSIPSW.xml"
+	// ITunesVersionPath is the path of the iTunes version plist (and of an 'ipsw mirror serve' mirror's copy of it)
+	ITunesVersionPath = "/WebObjects/MZStore.woa/wa/com.apple.jingle.appserver.client.MZITunesClientCheck/version/"
+	iTunesURL         = "https://itunes.apple.com"
+	macOSIpswURL      = "https://mesu.apple.com/assets/macos/com_apple_macOSIPSW/com_apple_macOSIPSW.xml"
 )
 
 // Identifier object
@@ -305,12 +307,27 @@ func (vm *ITunesVersionMaster) GetSoftwareURLsForBuildID(buildID string) ([]stri
 	return utils.Unique(urls), nil
 }
 
-// NewiTunesVersionMaster downloads and parses the itumes plist
+// NewiTunesVersionMaster downloads and parses the itumes plist from iTunes
 func NewiTunesVersionMaster() (*ITunesVersionMaster, error) {
-	resp, err := http.Get(iTunesVersionURL)
+	return defaultAPI.NewiTunesVersionMaster()
+}
+
+// NewiTunesVersionMaster downloads and parses the API's itunes plist
+func (a *API) NewiTunesVersionMaster() (*ITunesVersionMaster, error) {
+	return NewiTunesVersionMasterFromURL(a.iTunesVersionURL)
+}
+
+// NewiTunesVersionMasterFromURL downloads and parses an itunes version plist from a URL
+func NewiTunesVersionMasterFromURL(plistURL string) (*ITunesVersionMaster, error) {
+	resp, err := http.Get(plistURL)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create http client")
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get %s: %s", plistURL, resp.Status)
+	}
 
 	document, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -320,7 +337,9 @@ func NewiTunesVersionMaster() (*ITunesVersionMaster, error) {
 	vm := ITunesVersionMaster{}
 
 	dec := plist.NewDecoder(bytes.NewReader(document))
-	dec.Decode(&vm)
+	if err := dec.Decode(&vm); err != nil {
+		return nil, errors.Wrap(err, "failed to decode plist")
+	}
 
 	return &vm, nil
 }
@@ -0,0 +1,655 @@
+package download
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/pkg/errors"
+	"github.com/vbauerster/mpb/v5"
+	"github.com/vbauerster/mpb/v5/decor"
+)
+
+const (
+	defaultSegments       = 4
+	defaultMinSegmentSize = 8 * 1024 * 1024
+	defaultRetries        = 5
+	defaultBackoff        = time.Second
+	maxBackoff            = time.Minute
+	stateSaveInterval     = time.Second
+	copyBufferSize        = 32 * 1024
+)
+
+// Job is a file for the Manager to download
+type Job struct {
+	URL      string
+	DestName string
+	// Sha1 and/or Sha256 are the expected checksums (SHA-256 is verified if both are known)
+	Sha1   string
+	Sha256 string
+}
+
+// Manager downloads files as parallel byte-range segments. It persists each file's progress
+// to a state file so interrupted downloads can be resumed, verifies checksums,
+// retries failed segments with backoff and downloads several files at once under a global bandwidth limit
+type Manager struct {
+	// Parallel is the number of files downloaded at once
+	Parallel int
+	// Segments is the max number of byte-range segments a file is split into
+	Segments int
+	// MinSegmentSize is the smallest size a file is split into segments by
+	MinSegmentSize int64
+	// Retries is the number of times a failed segment is retried
+	Retries int
+	// Backoff is the delay before the first retry (it doubles on each retry)
+	Backoff time.Duration
+	// SkipResumable skips files with a partial download (i.e. being downloaded by another instance)
+	SkipResumable bool
+	// Prompt asks the user whether to resume, restart or skip a partial download (otherwise it is resumed)
+	Prompt bool
+	// Quiet hides the progress bars
+	Quiet bool
+
+	limiter  *rateLimiter
+	client   *http.Client
+	promptMu sync.Mutex
+}
+
+// NewManager creates a new download manager
+func NewManager(proxy string, insecure bool) *Manager {
+	return &Manager{
+		Parallel:       1,
+		Segments:       defaultSegments,
+		MinSegmentSize: defaultMinSegmentSize,
+		Retries:        defaultRetries,
+		Backoff:        defaultBackoff,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           GetProxy(proxy),
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+			},
+		},
+	}
+}
+
+// SetRateLimit limits the bandwidth of all the manager's downloads combined to bytesPerSec (0 is unlimited)
+func (m *Manager) SetRateLimit(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		m.limiter = nil
+		return
+	}
+	m.limiter = newRateLimiter(bytesPerSec)
+}
+
+// Do downloads the jobs (Parallel at a time) and returns an error if any of them failed
+func (m *Manager) Do(jobs ...Job) error {
+	parallel := m.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	opts := []mpb.ContainerOption{
+		mpb.WithWidth(60),
+		mpb.WithRefreshRate(180 * time.Millisecond),
+	}
+	if m.Quiet {
+		opts = append(opts, mpb.WithOutput(ioutil.Discard))
+	}
+	p := mpb.New(opts...)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+
+	sem := make(chan struct{}, parallel)
+	for _, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(job Job) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := m.download(job, p); err != nil {
+				log.WithError(err).WithField("file", job.DestName).Error("Download failed")
+				mu.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %v", job.DestName, err))
+				mu.Unlock()
+			}
+		}(job)
+	}
+	wg.Wait()
+	p.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d downloads failed:\n\t%s", len(failed), len(jobs), strings.Join(failed, "\n\t"))
+	}
+
+	return nil
+}
+
+// segment is a byte range of a file (End is inclusive)
+type segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+func (s *segment) remaining() int64 {
+	return s.End - s.Start + 1 - s.Done
+}
+
+// downloadState is a partial download's progress persisted next to it as <dest>.download.json
+type downloadState struct {
+	URL          string     `json:"url"`
+	Size         int64      `json:"size"`
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"last_modified,omitempty"`
+	Ranges       bool       `json:"ranges"`
+	Segments     []*segment `json:"segments"`
+}
+
+func (s *downloadState) done() int64 {
+	var done int64
+	for _, seg := range s.Segments {
+		done += seg.Done
+	}
+	return done
+}
+
+// matches returns true if a saved state is for the same remote file
+func (s *downloadState) matches(o *downloadState) bool {
+	if s.URL != o.URL || s.Size != o.Size || s.Ranges != o.Ranges || !s.Ranges {
+		return false
+	}
+	if len(s.ETag) > 0 && len(o.ETag) > 0 && s.ETag != o.ETag {
+		return false
+	}
+	if len(s.LastModified) > 0 && len(o.LastModified) > 0 && s.LastModified != o.LastModified {
+		return false
+	}
+	return true
+}
+
+// statusError is a non 2XX server response
+type statusError struct {
+	Status string
+	Code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server return status: %s", e.Status)
+}
+
+// retryable returns true if a request that failed with err might succeed if retried
+func retryable(err error) bool {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return serr.Code >= 500 || serr.Code == http.StatusRequestTimeout || serr.Code == http.StatusTooManyRequests
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errShortRead)
+}
+
+var errShortRead = fmt.Errorf("server closed the connection before sending the whole range")
+
+// fileDownload is a Job being downloaded
+type fileDownload struct {
+	Job
+
+	m     *Manager
+	state *downloadState
+	dest  *os.File
+	bar   *mpb.Bar
+	mu    sync.Mutex
+}
+
+func (d *fileDownload) partName() string {
+	return d.DestName + ".download"
+}
+
+func (d *fileDownload) stateName() string {
+	return d.DestName + ".download.json"
+}
+
+// probe gets the remote file's size and whether the server supports range requests
+func (m *Manager) probe(url string) (*downloadState, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create http request")
+	}
+	req.Header.Add("User-Agent", utils.RandomAgent())
+	req.Header.Add("Range", "bytes=0-0")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	state := &downloadState{
+		URL:          url,
+		Size:         resp.ContentLength,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-0/12345
+		cr := resp.Header.Get("Content-Range")
+		state.Size = -1
+		if idx := strings.LastIndex(cr, "/"); idx >= 0 {
+			if size, err := strconv.ParseInt(cr[idx+1:], 10, 64); err == nil {
+				state.Size = size
+				state.Ranges = true
+			}
+		}
+	case http.StatusOK:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// an empty file has no byte 0 (Content-Range: bytes */0)
+		if cr := resp.Header.Get("Content-Range"); cr != "bytes */0" {
+			return nil, &statusError{Status: resp.Status, Code: resp.StatusCode}
+		}
+		state.Size = 0
+	default:
+		return nil, &statusError{Status: resp.Status, Code: resp.StatusCode}
+	}
+
+	return state, nil
+}
+
+// split divides the file into segments
+func (m *Manager) split(state *downloadState) {
+	if !state.Ranges || state.Size <= 0 {
+		state.Segments = []*segment{{Start: 0, End: state.Size - 1}}
+		return
+	}
+	count := int64(m.Segments)
+	if count <= 0 {
+		count = 1
+	}
+	if m.MinSegmentSize > 0 && state.Size/m.MinSegmentSize < count {
+		count = state.Size / m.MinSegmentSize
+	}
+	if count < 1 {
+		count = 1
+	}
+	size := state.Size / count
+	for i := int64(0); i < count; i++ {
+		seg := &segment{Start: i * size, End: (i+1)*size - 1}
+		if i == count-1 {
+			seg.End = state.Size - 1
+		}
+		state.Segments = append(state.Segments, seg)
+	}
+}
+
+func (m *Manager) download(job Job, p *mpb.Progress) error {
+	d := &fileDownload{Job: job, m: m}
+
+	var remote *downloadState
+	err := m.retry(log.Fields{"url": job.URL}, func() (err error) {
+		remote, err = m.probe(job.URL)
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to query %s", job.URL)
+	}
+
+	// resume a previous download of the same remote file
+	resumed := false
+	if data, err := ioutil.ReadFile(d.stateName()); err == nil {
+		var saved downloadState
+		if err := json.Unmarshal(data, &saved); err == nil && saved.matches(remote) {
+			if _, err := os.Stat(d.partName()); err == nil {
+				switch m.askResume(d.DestName) {
+				case "skip":
+					log.WithField("file", d.partName()).Warn("Skipping partial download")
+					return nil
+				case "restart":
+					log.WithField("file", d.partName()).Info("Restarting download")
+				default:
+					d.state = &saved
+					resumed = true
+				}
+			}
+		}
+	}
+
+	if resumed {
+		log.WithField("file", d.DestName).Warn("Resuming a previous download")
+		if d.dest, err = os.OpenFile(d.partName(), os.O_WRONLY, 0644); err != nil {
+			return errors.Wrapf(err, "cannot open %s", d.partName())
+		}
+	} else {
+		d.state = remote
+		m.split(d.state)
+		if d.dest, err = os.Create(d.partName()); err != nil {
+			return errors.Wrapf(err, "cannot create %s", d.partName())
+		}
+		if d.state.Size > 0 {
+			if err := d.dest.Truncate(d.state.Size); err != nil {
+				d.dest.Close()
+				return errors.Wrapf(err, "cannot allocate %s", d.partName())
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"file":     d.DestName,
+		"segments": len(d.state.Segments),
+	}).Debug("Downloading")
+
+	d.bar = p.AddBar(d.state.Size, mpb.BarStyle("[=>-|"),
+		mpb.PrependDecorators(
+			decor.Name(filepath.Base(d.DestName)+" ", decor.WCSyncSpaceR),
+			decor.CountersKibiByte("\t% 6.1f / % 6.1f"),
+		),
+		mpb.AppendDecorators(
+			decor.OnComplete(decor.AverageETA(decor.ET_STYLE_GO), "✅ "),
+			decor.Name(" ] "),
+			decor.AverageSpeed(decor.UnitKiB, "% .2f", decor.WCSyncSpace),
+		),
+	)
+	if done := d.state.done(); done > 0 {
+		d.bar.SetRefill(done)
+		d.bar.IncrInt64(done)
+	}
+
+	err = d.run()
+	d.dest.Close()
+	if err != nil {
+		d.bar.Abort(false)
+		return err
+	}
+	if d.state.Size <= 0 { // the size wasn't known up front
+		d.bar.SetTotal(d.state.done(), true)
+	}
+
+	if err := verifyChecksum(d.partName(), d.Sha1, d.Sha256); err != nil {
+		os.Remove(d.partName())
+		os.Remove(d.stateName())
+		return err
+	}
+
+	if err := os.Rename(d.partName(), d.DestName); err != nil {
+		return errors.Wrap(err, "failed to remove .download from completed download")
+	}
+	os.Remove(d.stateName())
+
+	return nil
+}
+
+// askResume returns whether to "resume", "restart" or "skip" a partial download (prompting the user if Prompt is set)
+func (m *Manager) askResume(name string) string {
+	// one prompt at a time (and "skip all" applies to the downloads waiting on it)
+	m.promptMu.Lock()
+	defer m.promptMu.Unlock()
+
+	if m.SkipResumable {
+		return "skip"
+	}
+	if !m.Prompt {
+		return "resume"
+	}
+
+	choice := "resume"
+	prompt := &survey.Select{
+		Message: fmt.Sprintf("Previous download of %s can be resumed:", name),
+		Options: []string{"resume", "skip", "skip all", "restart"},
+		Default: "resume",
+	}
+	survey.AskOne(prompt, &choice)
+
+	if choice == "skip all" {
+		log.Info("Skipping ALL active downloads (you are performing a distributed download)")
+		m.SkipResumable = true
+		return "skip"
+	}
+
+	return choice
+}
+
+// run downloads the remaining segments in parallel, saving the state periodically so they can be resumed
+func (d *fileDownload) run() error {
+	if err := d.save(); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		ticker := time.NewTicker(stateSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := d.save(); err != nil {
+					log.WithError(err).Debug("failed to save download state")
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(d.state.Segments))
+	for _, seg := range d.state.Segments {
+		if seg.remaining() == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(seg *segment) {
+			defer wg.Done()
+			if err := d.m.retry(log.Fields{"file": d.DestName, "segment": seg.Start}, func() error {
+				return d.fetch(seg)
+			}); err != nil {
+				errs <- err
+			}
+		}(seg)
+	}
+	wg.Wait()
+	close(stop)
+	<-saved
+	close(errs)
+
+	if err := d.save(); err != nil {
+		return err
+	}
+
+	return <-errs
+}
+
+// save atomically writes the download state
+func (d *fileDownload) save() error {
+	d.mu.Lock()
+	data, err := json.Marshal(d.state)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := d.stateName() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s", tmp)
+	}
+	return os.Rename(tmp, d.stateName())
+}
+
+// retry calls fn until it succeeds, fails with an error that isn't retryable or runs out of retries
+func (m *Manager) retry(fields log.Fields, fn func() error) error {
+	backoff := m.Backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= m.Retries || !retryable(err) {
+			return err
+		}
+		fields["retry"] = fmt.Sprintf("%d/%d", attempt+1, m.Retries)
+		fields["in"] = backoff
+		log.WithFields(fields).Debug(err.Error())
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// fetch downloads the rest of a segment
+func (d *fileDownload) fetch(seg *segment) error {
+	req, err := http.NewRequest("GET", d.URL, nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot create http request")
+	}
+	req.Header.Add("User-Agent", utils.RandomAgent())
+
+	if d.state.Ranges {
+		req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", seg.Start+seg.Done, seg.End))
+	} else if seg.Done > 0 {
+		// without range support a retry has to start over
+		d.mu.Lock()
+		seg.Done = 0
+		d.mu.Unlock()
+		d.bar.SetCurrent(0)
+	}
+
+	resp, err := d.m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if d.state.Ranges && resp.StatusCode != http.StatusPartialContent ||
+		!d.state.Ranges && resp.StatusCode != http.StatusOK {
+		return &statusError{Status: resp.Status, Code: resp.StatusCode}
+	}
+
+	buf := make([]byte, copyBufferSize)
+	for {
+		if d.state.Ranges && seg.remaining() == 0 {
+			return nil
+		}
+		want := len(buf)
+		if d.state.Ranges && seg.remaining() < int64(want) {
+			want = int(seg.remaining())
+		}
+		d.m.limiter.wait(want)
+		n, rerr := resp.Body.Read(buf[:want])
+		if n > 0 {
+			if _, err := d.dest.WriteAt(buf[:n], seg.Start+seg.Done); err != nil {
+				return errors.Wrapf(err, "failed to write %s", d.partName())
+			}
+			d.mu.Lock()
+			seg.Done += int64(n)
+			d.mu.Unlock()
+			d.bar.IncrBy(n)
+		}
+		if rerr == io.EOF {
+			if d.state.Ranges && seg.remaining() > 0 {
+				return errShortRead
+			}
+			if !d.state.Ranges {
+				d.mu.Lock()
+				seg.End = seg.Done - 1
+				d.state.Size = seg.Done
+				d.mu.Unlock()
+			}
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// verifyChecksum checks a file's SHA-256 (or SHA-1 if that's the only one known)
+func verifyChecksum(name, sha1sum, sha256sum string) error {
+	var h hash.Hash
+	var expected, algo string
+	switch {
+	case len(sha256sum) > 0:
+		h, expected, algo = sha256.New(), sha256sum, "sha256"
+	case len(sha1sum) > 0:
+		h, expected, algo = sha1.New(), sha1sum, "sha1"
+	default:
+		return nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log.Debug(fmt.Sprintf("verifying %ssum...", algo))
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if actual := fmt.Sprintf("%x", h.Sum(nil)); !strings.EqualFold(expected, actual) {
+		log.WithFields(log.Fields{
+			"expected": expected,
+			"actual":   actual,
+		}).Error("❌ BAD CHECKSUM")
+		return fmt.Errorf("bad download: %s %s hash is incorrect", name, algo)
+	}
+
+	return nil
+}
+
+// rateLimiter is a token bucket shared by all of a manager's downloads
+type rateLimiter struct {
+	mu    sync.Mutex
+	rate  float64
+	avail float64
+	last  time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{
+		rate: float64(bytesPerSec),
+		last: time.Now(),
+	}
+}
+
+// wait blocks until n bytes can be transferred without exceeding the rate
+func (r *rateLimiter) wait(n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	r.avail += now.Sub(r.last).Seconds() * r.rate
+	if r.avail > r.rate { // allow bursts of up to a second
+		r.avail = r.rate
+	}
+	r.last = now
+	// reserve the bytes now (going into debt) so concurrent callers queue up behind each other
+	r.avail -= float64(n)
+	var delay time.Duration
+	if r.avail < 0 {
+		delay = time.Duration(-r.avail / r.rate * float64(time.Second))
+	}
+	r.mu.Unlock()
+	time.Sleep(delay)
+}
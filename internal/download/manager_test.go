@@ -0,0 +1,303 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFile returns size bytes of non-repeating content
+func testFile(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
+
+// rangeServer serves data with range support and records the Range header of every request
+type rangeServer struct {
+	data []byte
+	// short is the number of 206 responses that are cut off half way
+	short int
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	cut := s.short > 0 && r.Header.Get("Range") != "bytes=0-0"
+	if cut {
+		s.short--
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", `"test"`)
+	if len(s.data) == 0 && len(r.Header.Get("Range")) > 0 { // like S3 (and Apple's CDN)
+		w.Header().Set("Content-Range", "bytes */0")
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if cut {
+		var start, end int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(s.data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(s.data[start : start+(end-start+1)/2])
+		return
+	}
+	http.ServeContent(w, r, "test.ipsw", time.Time{}, bytes.NewReader(s.data))
+}
+
+// requests returns the ranges requested (without the size probe)
+func (s *rangeServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ranges []string
+	for _, r := range s.ranges {
+		if r != "bytes=0-0" {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+func testManager() *Manager {
+	m := NewManager("", false)
+	m.Segments = 4
+	m.MinSegmentSize = 1024
+	m.Backoff = time.Millisecond
+	m.Quiet = true
+	return m
+}
+
+func checkDownload(t *testing.T, dest string, want []byte) {
+	t.Helper()
+	got, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes that don't match the %d bytes served", len(got), len(want))
+	}
+	for _, name := range []string{dest + ".download", dest + ".download.json"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", filepath.Base(name))
+		}
+	}
+}
+
+func TestManagerSegments(t *testing.T) {
+	data := testFile(64 * 1024)
+	srv := &rangeServer{data: data}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+	m := testManager()
+	if err := m.Do(Job{URL: ts.URL, DestName: dest, Sha256: fmt.Sprintf("%x", sha256.Sum256(data))}); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dest, data)
+
+	ranges := srv.requests()
+	if len(ranges) != 4 {
+		t.Fatalf("requested %d ranges, want 4: %v", len(ranges), ranges)
+	}
+	for i, want := range []string{"bytes=0-16383", "bytes=16384-32767", "bytes=32768-49151", "bytes=49152-65535"} {
+		found := false
+		for _, r := range ranges {
+			found = found || r == want
+		}
+		if !found {
+			t.Errorf("segment %d (%s) was not requested: %v", i, want, ranges)
+		}
+	}
+}
+
+func TestManagerResume(t *testing.T) {
+	data := testFile(64 * 1024)
+	srv := &rangeServer{data: data}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+
+	// a previous download that got the first half of each of its 2 segments
+	part := make([]byte, len(data))
+	copy(part[:16384], data[:16384])
+	copy(part[32768:49152], data[32768:49152])
+	if err := ioutil.WriteFile(dest+".download", part, 0644); err != nil {
+		t.Fatal(err)
+	}
+	state, _ := json.Marshal(&downloadState{
+		URL:    ts.URL,
+		Size:   int64(len(data)),
+		ETag:   `"test"`,
+		Ranges: true,
+		Segments: []*segment{
+			{Start: 0, End: 32767, Done: 16384},
+			{Start: 32768, End: 65535, Done: 16384},
+		},
+	})
+	if err := ioutil.WriteFile(dest+".download.json", state, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := testManager()
+	if err := m.Do(Job{URL: ts.URL, DestName: dest}); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dest, data)
+
+	ranges := srv.requests()
+	if len(ranges) != 2 {
+		t.Fatalf("requested %d ranges, want the 2 unfinished halves: %v", len(ranges), ranges)
+	}
+	for _, r := range ranges {
+		if r != "bytes=16384-32767" && r != "bytes=49152-65535" {
+			t.Errorf("requested %s which was already downloaded", r)
+		}
+	}
+}
+
+func TestManagerSkipResumable(t *testing.T) {
+	data := testFile(4096)
+	srv := &rangeServer{data: data}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+	ioutil.WriteFile(dest+".download", make([]byte, len(data)), 0644)
+	state, _ := json.Marshal(&downloadState{
+		URL:      ts.URL,
+		Size:     int64(len(data)),
+		ETag:     `"test"`,
+		Ranges:   true,
+		Segments: []*segment{{Start: 0, End: int64(len(data)) - 1}},
+	})
+	ioutil.WriteFile(dest+".download.json", state, 0644)
+
+	m := testManager()
+	m.SkipResumable = true
+	if err := m.Do(Job{URL: ts.URL, DestName: dest}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("the partial download was not skipped")
+	}
+	if ranges := srv.requests(); len(ranges) != 0 {
+		t.Errorf("requested %v", ranges)
+	}
+}
+
+func TestManagerShortRead(t *testing.T) {
+	data := testFile(64 * 1024)
+	srv := &rangeServer{data: data, short: 2}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+	m := testManager()
+	m.Segments = 1
+	if err := m.Do(Job{URL: ts.URL, DestName: dest}); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dest, data)
+
+	want := []string{"bytes=0-65535", "bytes=32768-65535", "bytes=49152-65535"}
+	if got := srv.requests(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("requested %v, want %v", got, want)
+	}
+}
+
+func TestManagerShortReadRetries(t *testing.T) {
+	data := testFile(4096)
+	srv := &rangeServer{data: data, short: 10}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+	m := testManager()
+	m.Segments = 1
+	m.Retries = 2
+	if err := m.Do(Job{URL: ts.URL, DestName: dest}); err == nil {
+		t.Fatal("expected the download to fail after running out of retries")
+	}
+	if got := len(srv.requests()); got != 3 {
+		t.Errorf("made %d range requests, want 3", got)
+	}
+	if _, err := os.Stat(dest + ".download.json"); err != nil {
+		t.Error("the state of the failed download was not kept for resuming")
+	}
+}
+
+func TestManagerChecksumMismatch(t *testing.T) {
+	data := testFile(8192)
+	ts := httptest.NewServer(&rangeServer{data: data})
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+	m := testManager()
+	err := m.Do(Job{URL: ts.URL, DestName: dest, Sha1: strings.Repeat("0", 40)})
+	if err == nil {
+		t.Fatal("expected a checksum error")
+	}
+	if !strings.Contains(err.Error(), "sha1 hash is incorrect") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, name := range []string{dest, dest + ".download", dest + ".download.json"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s was kept after a bad checksum", filepath.Base(name))
+		}
+	}
+}
+
+func TestManagerEmptyFile(t *testing.T) {
+	ts := httptest.NewServer(&rangeServer{})
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "empty.ipsw")
+	m := testManager()
+	if err := m.Do(Job{URL: ts.URL, DestName: dest, Sha1: "da39a3ee5e6b4b0d3255bfef95601890afd80709"}); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dest, []byte{})
+}
+
+func TestManagerRateLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping rate limited download in short mode")
+	}
+
+	data := testFile(192 * 1024)
+	ts := httptest.NewServer(&rangeServer{data: data})
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "test.ipsw")
+	m := testManager()
+	m.SetRateLimit(128 * 1024)
+
+	start := time.Now()
+	if err := m.Do(Job{URL: ts.URL, DestName: dest}); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, dest, data)
+
+	// 192KiB at 128KiB/s (the limiter starts empty) takes 1.5s
+	if elapsed := time.Since(start); elapsed < 1200*time.Millisecond {
+		t.Errorf("downloaded 192KiB in %s with a 128KiB/s limit", elapsed)
+	}
+}
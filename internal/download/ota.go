@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -78,6 +79,20 @@ type OtaAsset struct {
 	RelativePath          string   `plist:"__RelativePath" json:"__RelativePath"`
 }
 
+// Checksums returns the hex encoded SHA-1 or SHA-256 of the OTA zip (whichever its measurement is)
+func (o OtaAsset) Checksums() (sha1sum, sha256sum string) {
+	if len(o.Hash) == 0 {
+		return "", ""
+	}
+	switch strings.ToUpper(strings.Replace(o.HashAlgorithm, "-", "", 1)) {
+	case "SHA1":
+		sha1sum = hex.EncodeToString(o.Hash)
+	case "SHA256":
+		sha256sum = hex.EncodeToString(o.Hash)
+	}
+	return sha1sum, sha256sum
+}
+
 type transformation struct {
 	Measurement string `json:"_Measurement"`
 	SEPDigest   string
@@ -115,8 +130,13 @@ type Ota struct {
 
 // NewOTA downloads and parses the itumes plist for iOS14 release/developer beta OTAs
 func NewOTA(proxy string, insecure, release, macos bool) (*Ota, error) {
+	return NewOTAFromURL(otaPublicURL, proxy, insecure, release, macos)
+}
+
+// NewOTAFromURL downloads and parses an OTA asset feed plist from a URL
+func NewOTAFromURL(feedURL, proxy string, insecure, release, macos bool) (*Ota, error) {
 
-	req, err := http.NewRequest("GET", otaPublicURL, nil)
+	req, err := http.NewRequest("GET", feedURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create http request: %v", err)
 	}
@@ -15,6 +15,8 @@ import (
 type RemoteConfig struct {
 	Proxy    string
 	Insecure bool
+	// Cache is an optional on-disk cache of the remote zip's blocks
+	Cache *BlockCache
 }
 
 // NewRemoteZipReader returns a new remote zip file reader
@@ -25,16 +27,35 @@ func NewRemoteZipReader(zipURL string, config *RemoteConfig) (*zip.Reader, error
 		return nil, errors.Wrap(err, "failed to parse url")
 	}
 
-	reader, err := ranger.NewReader(&ranger.HTTPRanger{
-		URL:       url,
-		UserAgent: utils.RandomAgent(),
-		Client: &http.Client{
-			Transport: &http.Transport{
-				Proxy:           GetProxy(config.Proxy),
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Insecure},
-			},
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           GetProxy(config.Proxy),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Insecure},
 		},
-	})
+	}
+
+	var fetcher ranger.RangeFetcher
+	if config.Cache != nil {
+		vc := &validatorClient{Client: client}
+		fetcher = &cachedFetcher{
+			url: zipURL,
+			ranger: &ranger.HTTPRanger{
+				URL:       url,
+				UserAgent: utils.RandomAgent(),
+				Client:    vc,
+			},
+			client: vc,
+			cache:  config.Cache,
+		}
+	} else {
+		fetcher = &ranger.HTTPRanger{
+			URL:       url,
+			UserAgent: utils.RandomAgent(),
+			Client:    client,
+		}
+	}
+
+	reader, err := ranger.NewReader(fetcher)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create ranger reader")
 	}
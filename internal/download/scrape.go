@@ -2,9 +2,11 @@ package download
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gocolly/colly/v2"
@@ -12,7 +14,8 @@ import (
 )
 
 const (
-	iphoneWikiURL    = "https://www.theiphonewiki.com"
+	// IPhoneWikiURL is the URL of The iPhone Wiki
+	IPhoneWikiURL    = "https://www.theiphonewiki.com"
 	firmwarePath     = "/wiki/Firmware"
 	betaFirmwarePath = "/wiki/Beta_Firmware"
 )
@@ -49,14 +52,42 @@ func appendIfMissing(slice []string, i string) []string {
 	return append(slice, i)
 }
 
+var betaIpswRE = regexp.MustCompile(`\/(?P<device>i.+)_(?P<version>.+)_(?P<build>\w+)_Restore.ipsw$`)
+
 // ScrapeURLs will scrape the iPhone Wiki for beta firmwares
 func ScrapeURLs(build string) (map[string]BetaIPSW, error) {
+	betas, err := ScrapeBetas(IPhoneWikiURL)
+	if err != nil {
+		return nil, err
+	}
+
 	ipsws := map[string]BetaIPSW{}
+	for link, ipsw := range betas {
+		if m := betaIpswRE.FindStringSubmatch(link); m != nil && strings.EqualFold(m[3], build) {
+			ipsws[link] = ipsw
+		}
+	}
+
+	if len(ipsws) == 0 {
+		return nil, fmt.Errorf("no ipsws found for build %s", build)
+	}
+
+	return ipsws, nil
+}
+
+// ScrapeBetas will scrape all the beta firmwares (by URL) from the Beta_Firmware pages of an iPhone Wiki (i.e. https://www.theiphonewiki.com)
+func ScrapeBetas(wikiURL string) (map[string]BetaIPSW, error) {
+	ipsws := map[string]BetaIPSW{}
+
+	u, err := url.Parse(wikiURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse wiki url")
+	}
 
 	c := colly.NewCollector(
-		colly.AllowedDomains("www.theiphonewiki.com"),
+		colly.AllowedDomains(u.Hostname()),
 		colly.URLFilters(
-			regexp.MustCompile("https://www.theiphonewiki.com/wiki/Beta_Firmware/(.+)$"),
+			regexp.MustCompile(regexp.QuoteMeta(wikiURL+betaFirmwarePath+"/")+"(.+)$"),
 		),
 		colly.Async(true),
 		colly.MaxDepth(1),
@@ -67,6 +98,8 @@ func ScrapeURLs(build string) (map[string]BetaIPSW, error) {
 		c.Visit(e.Request.AbsoluteURL(e.Attr("href")))
 	})
 
+	var mu sync.Mutex
+
 	c.OnHTML("body", func(e *colly.HTMLElement) {
 		e.ForEach("table.wikitable", func(_ int, ta *colly.HTMLElement) {
 			var cols []string
@@ -77,6 +110,9 @@ func ScrapeURLs(build string) (map[string]BetaIPSW, error) {
 					cols = append(cols, trimQuotes(strings.TrimSpace(el.Text)))
 				})
 				row.ForEach("td", func(_ int, el *colly.HTMLElement) {
+					if el.Index >= len(cols) {
+						return
+					}
 					switch cols[el.Index] {
 					case "Version":
 						possibleIPSW.Version = strings.TrimSpace(el.Text)
@@ -91,29 +127,19 @@ func ScrapeURLs(build string) (map[string]BetaIPSW, error) {
 					if el.ChildAttr("a", "class") == "external text" {
 						link := el.ChildAttr("a", "href")
 
-						if strings.Contains(link, "apple.com") {
-							r := regexp.MustCompile(`\/(?P<device>i.+)_(?P<version>.+)_(?P<build>\w+)_Restore.ipsw$`)
-							names := r.SubexpNames()
-
-							result := r.FindAllStringSubmatch(link, -1)
-							if result != nil {
-								m := map[string]string{}
-								for i, n := range result[0] {
-									m[names[i]] = n
-								}
-								if strings.EqualFold(m["build"], build) {
-									if _, ok := ipsws[link]; ok {
-										oldIPSW := ipsws[link]
-										for _, dev := range possibleIPSW.Devices {
-											oldIPSW.Devices = appendIfMissing(oldIPSW.Devices, dev)
-										}
-										sort.Strings(oldIPSW.Devices)
-										ipsws[link] = oldIPSW
-									} else {
-										ipsws[link] = possibleIPSW
-									}
+						if strings.Contains(link, "apple.com") && betaIpswRE.MatchString(link) {
+							mu.Lock()
+							if _, ok := ipsws[link]; ok {
+								oldIPSW := ipsws[link]
+								for _, dev := range possibleIPSW.Devices {
+									oldIPSW.Devices = appendIfMissing(oldIPSW.Devices, dev)
 								}
+								sort.Strings(oldIPSW.Devices)
+								ipsws[link] = oldIPSW
+							} else {
+								ipsws[link] = possibleIPSW
 							}
+							mu.Unlock()
 						}
 					}
 				})
@@ -122,18 +148,14 @@ func ScrapeURLs(build string) (map[string]BetaIPSW, error) {
 	})
 
 	for _, device := range devices {
-		err := c.Visit("https://www.theiphonewiki.com/wiki/Beta_Firmware/" + device)
+		err := c.Visit(wikiURL + betaFirmwarePath + "/" + device)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to scrape "+iphoneWikiURL)
+			return nil, errors.Wrap(err, "failed to scrape "+wikiURL)
 		}
 	}
 
 	c.Wait()
 
-	if len(ipsws) == 0 {
-		return nil, fmt.Errorf("no ipsws found for build %s", build)
-	}
-
 	return ipsws, nil
 }
 
@@ -0,0 +1,252 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/pkg/errors"
+)
+
+const (
+	// IndexName is the name of the mirror's JSON index
+	IndexName  = "index.json"
+	objectsDir = "objects"
+	// TypeIPSW is an IPSW entry
+	TypeIPSW = "ipsw"
+	// TypeOTA is an OTA entry
+	TypeOTA = "ota"
+)
+
+// Entry is a file in the mirror. Its data is stored once by SHA-1 under objects/ and is
+// linked into the device/version/build layout for each device it applies to
+type Entry struct {
+	Type        string    `json:"type"`
+	Device      string    `json:"device"`
+	Version     string    `json:"version"`
+	Build       string    `json:"build"`
+	Name        string    `json:"name"`
+	SHA1        string    `json:"sha1"`
+	Size        int64     `json:"size"`
+	Path        string    `json:"path"`
+	Object      string    `json:"object"`
+	URL         string    `json:"url,omitempty"`
+	ReleaseDate time.Time `json:"releasedate,omitempty"`
+	Signed      bool      `json:"signed,omitempty"`
+	Added       time.Time `json:"added"`
+}
+
+// Index is the mirror's JSON index
+type Index struct {
+	Updated time.Time                  `json:"updated"`
+	Devices map[string]download.Device `json:"devices"`
+	Entries []Entry                    `json:"entries"`
+}
+
+// Mirror is a local repository of IPSWs/OTAs laid out by device, version and build
+type Mirror struct {
+	Root string
+
+	index   *Index
+	modTime time.Time
+	mu      sync.RWMutex
+}
+
+// Open opens (or creates) the mirror in root
+func Open(root string) (*Mirror, error) {
+	if err := os.MkdirAll(filepath.Join(root, objectsDir), 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create mirror in %s", root)
+	}
+	m := &Mirror{
+		Root: root,
+		index: &Index{
+			Devices: make(map[string]download.Device),
+		},
+	}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload re-reads the index if it changed on disk (i.e. a sync ran while serving)
+func (m *Mirror) Reload() error {
+	fi, err := os.Stat(filepath.Join(m.Root, IndexName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	unchanged := fi.ModTime().Equal(m.modTime)
+	m.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(m.Root, IndexName))
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", IndexName)
+	}
+	index := &Index{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return errors.Wrapf(err, "failed to parse %s", IndexName)
+	}
+	if index.Devices == nil {
+		index.Devices = make(map[string]download.Device)
+	}
+
+	m.mu.Lock()
+	m.index = index
+	m.modTime = fi.ModTime()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Save atomically writes the index
+func (m *Mirror) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.index.Updated = time.Now().UTC()
+	sort.Slice(m.index.Entries, func(i, j int) bool {
+		return m.index.Entries[i].Path < m.index.Entries[j].Path
+	})
+
+	data, err := json.MarshalIndent(m.index, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(m.Root, IndexName+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s", tmp)
+	}
+	if err := os.Rename(tmp, filepath.Join(m.Root, IndexName)); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(filepath.Join(m.Root, IndexName)); err == nil {
+		m.modTime = fi.ModTime()
+	}
+
+	return nil
+}
+
+// Entries returns a copy of the index entries
+func (m *Mirror) Entries() []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Entry(nil), m.index.Entries...)
+}
+
+// Devices returns a copy of the devices in the index
+func (m *Mirror) Devices() map[string]download.Device {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	devices := make(map[string]download.Device, len(m.index.Devices))
+	for id, dev := range m.index.Devices {
+		devices[id] = dev
+	}
+	return devices
+}
+
+// SetDevice adds (or updates) a device's info in the index
+func (m *Mirror) SetDevice(dev download.Device) {
+	dev.Firmwares = nil
+	m.mu.Lock()
+	m.index.Devices[dev.Identifier] = dev
+	m.mu.Unlock()
+}
+
+// Lookup returns the entry of a type for a device and build
+func (m *Mirror) Lookup(typ, device, build string) (Entry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range m.index.Entries {
+		if e.Type == typ && strings.EqualFold(e.Device, device) && e.Build == build {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// LookupPath returns the entry at a layout path
+func (m *Mirror) LookupPath(path string) (Entry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range m.index.Entries {
+		if e.Path == path {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// ObjectPath returns the relative path of the object with a SHA-1
+func ObjectPath(sha1sum string) string {
+	sha1sum = strings.ToLower(sha1sum)
+	return filepath.ToSlash(filepath.Join(objectsDir, sha1sum[:2], sha1sum))
+}
+
+// HasObject returns true if the mirror has the object with a SHA-1
+func (m *Mirror) HasObject(sha1sum string) bool {
+	_, err := os.Stat(filepath.Join(m.Root, ObjectPath(sha1sum)))
+	return err == nil
+}
+
+// Add links the entry's object into the device/version/build layout and adds the entry to the index
+// (replacing any entry at the same path). The index isn't saved until Save is called
+func (m *Mirror) Add(e Entry) error {
+	if len(e.SHA1) < 2 {
+		return fmt.Errorf("entry %s has no sha1", e.Name)
+	}
+	e.SHA1 = strings.ToLower(e.SHA1)
+	e.Object = ObjectPath(e.SHA1)
+	e.Path = filepath.ToSlash(filepath.Join(e.Device, e.Version, e.Build, e.Name))
+	if e.Added.IsZero() {
+		e.Added = time.Now().UTC()
+	}
+
+	object := filepath.Join(m.Root, e.Object)
+	fi, err := os.Stat(object)
+	if err != nil {
+		return errors.Wrapf(err, "missing object for %s", e.Path)
+	}
+	e.Size = fi.Size()
+
+	dest := filepath.Join(m.Root, filepath.FromSlash(e.Path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	os.Remove(dest)
+	if err := os.Link(object, dest); err != nil {
+		// fallback to a relative symlink on filesystems without hard links
+		rel, err := filepath.Rel(filepath.Dir(dest), object)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(rel, dest); err != nil {
+			return errors.Wrapf(err, "failed to link %s", e.Path)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, old := range m.index.Entries {
+		if old.Path == e.Path {
+			m.index.Entries[idx] = e
+			return nil
+		}
+	}
+	m.index.Entries = append(m.index.Entries, e)
+
+	return nil
+}
@@ -0,0 +1,283 @@
+package mirror
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+// fileServer serves in-memory files (with range support) and counts the downloads of each
+// (not the download manager's 'bytes=0-0' size probes)
+type fileServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	gets  map[string]int
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.files[r.URL.Path]
+	if r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-0" {
+		s.gets[r.URL.Path]++
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, filepath.Base(r.URL.Path), time.Time{}, bytes.NewReader(data))
+}
+
+func sha1sum(data []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(data))
+}
+
+func testManager() *download.Manager {
+	m := download.NewManager("", false)
+	m.Segments = 1
+	m.Backoff = time.Millisecond
+	m.Quiet = true
+	return m
+}
+
+func TestSyncDedupe(t *testing.T) {
+	shared := bytes.Repeat([]byte("shared ipsw "), 1000)
+	other := bytes.Repeat([]byte("other ota "), 1000)
+	srv := &fileServer{
+		files: map[string][]byte{
+			"/iPhone_Restore.ipsw": shared,
+			"/ota.zip":             other,
+		},
+		gets: make(map[string]int),
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	m, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := []Source{
+		{Type: TypeIPSW, Devices: []string{"iPhone12,1"}, Version: "14.7", Build: "18G69", URL: ts.URL + "/iPhone_Restore.ipsw", SHA1: sha1sum(shared)},
+		{Type: TypeIPSW, Devices: []string{"iPhone12,3"}, Version: "14.7", Build: "18G69", URL: ts.URL + "/iPhone_Restore.ipsw", SHA1: sha1sum(shared)},
+		// the OTA's hash isn't known until it is downloaded
+		{Type: TypeOTA, Devices: []string{"iPhone12,1", "iPhone12,3"}, Version: "14.7", Build: "18G69", URL: ts.URL + "/ota.zip"},
+	}
+
+	added, err := m.Sync(testManager(), sources)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if added != 4 {
+		t.Errorf("Sync() added %d entries, want 4", added)
+	}
+	for name, gets := range srv.gets {
+		if gets != 1 {
+			t.Errorf("%s was downloaded %d times, want once", name, gets)
+		}
+	}
+
+	for _, tt := range []struct {
+		typ, device string
+		data        []byte
+	}{
+		{TypeIPSW, "iPhone12,1", shared},
+		{TypeIPSW, "iPhone12,3", shared},
+		{TypeOTA, "iPhone12,1", other},
+		{TypeOTA, "iPhone12,3", other},
+	} {
+		e, ok := m.Lookup(tt.typ, tt.device, "18G69")
+		if !ok {
+			t.Fatalf("%s %s not in the index", tt.typ, tt.device)
+		}
+		if e.SHA1 != sha1sum(tt.data) || e.Object != ObjectPath(sha1sum(tt.data)) || e.Size != int64(len(tt.data)) {
+			t.Errorf("entry = %+v", e)
+		}
+		if want := filepath.ToSlash(filepath.Join(tt.device, "14.7", "18G69", filepath.Base(e.URL))); e.Path != want {
+			t.Errorf("entry path = %s, want %s", e.Path, want)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(m.Root, filepath.FromSlash(e.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("%s doesn't have the downloaded data", e.Path)
+		}
+	}
+
+	objects, err := filepath.Glob(filepath.Join(m.Root, objectsDir, "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Errorf("mirror has %d objects, want 2", len(objects))
+	}
+
+	// a second sync has nothing to do
+	if added, err := m.Sync(testManager(), sources); err != nil || added != 0 {
+		t.Errorf("second Sync() = %d, %v; want 0, nil", added, err)
+	}
+	for name, gets := range srv.gets {
+		if gets != 1 {
+			t.Errorf("%s was downloaded again", name)
+		}
+	}
+}
+
+// addTestEntry writes an object to the mirror and adds an entry for it
+func addTestEntry(t *testing.T, m *Mirror, e Entry, data []byte) Entry {
+	t.Helper()
+	e.SHA1 = sha1sum(data)
+	object := filepath.Join(m.Root, filepath.FromSlash(ObjectPath(e.SHA1)))
+	if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(object, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(e); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	got, _ := m.LookupPath(filepath.ToSlash(filepath.Join(e.Device, e.Version, e.Build, e.Name)))
+	return got
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	m, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := time.Date(2021, 7, 26, 0, 0, 0, 0, time.UTC)
+	addTestEntry(t, m, Entry{Type: TypeIPSW, Device: "iPhone12,1", Version: "14.7", Build: "18G69", Name: "a.ipsw", ReleaseDate: release, Signed: true}, []byte("a"))
+	addTestEntry(t, m, Entry{Type: TypeOTA, Device: "iPhone12,1", Version: "14.7", Build: "18G69", Name: "b.zip"}, []byte("b"))
+	// re-adding an entry at the same path replaces it
+	addTestEntry(t, m, Entry{Type: TypeIPSW, Device: "iPhone12,1", Version: "14.7", Build: "18G69", Name: "a.ipsw", ReleaseDate: release, Signed: true}, []byte("a2"))
+	m.SetDevice(download.Device{Name: "iPhone 11", Identifier: "iPhone12,1", BoardConfig: "N104AP", Firmwares: []download.IPSW{{BuildID: "18G69"}}})
+
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reopened, err := Open(root)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	want, got := m.Entries(), reopened.Entries()
+	if len(got) != 2 {
+		t.Fatalf("index has %d entries, want 2", len(got))
+	}
+	for i := range want {
+		if !want[i].Added.Equal(got[i].Added) || !want[i].ReleaseDate.Equal(got[i].ReleaseDate) {
+			t.Errorf("entry %d times = %v %v, want %v %v", i, got[i].Added, got[i].ReleaseDate, want[i].Added, want[i].ReleaseDate)
+		}
+		got[i].Added, got[i].ReleaseDate = want[i].Added, want[i].ReleaseDate
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened entries = %+v, want %+v", got, want)
+	}
+	if got[0].SHA1 != sha1sum([]byte("a2")) {
+		t.Errorf("replaced entry has sha1 %s", got[0].SHA1)
+	}
+	devices := reopened.Devices()
+	if dev := devices["iPhone12,1"]; dev.BoardConfig != "N104AP" || len(dev.Firmwares) != 0 {
+		t.Errorf("reopened device = %+v", dev)
+	}
+}
+
+func TestServerAPI(t *testing.T) {
+	m, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipsw := []byte("iphone 11 ipsw")
+	addTestEntry(t, m, Entry{Type: TypeIPSW, Device: "iPhone12,1", Version: "14.7", Build: "18G69", Name: "iPhone12,1_14.7_18G69_Restore.ipsw"}, ipsw)
+	addTestEntry(t, m, Entry{Type: TypeIPSW, Device: "iPhone12,1", Version: "14.6", Build: "18F72", Name: "iPhone12,1_14.6_18F72_Restore.ipsw"}, []byte("older"))
+	addTestEntry(t, m, Entry{Type: TypeIPSW, Device: "iPhone12,3", Version: "14.7", Build: "18G69", Name: "iPhone12,3_14.7_18G69_Restore.ipsw"}, []byte("pro"))
+	addTestEntry(t, m, Entry{Type: TypeOTA, Device: "iPhone12,1", Version: "14.7", Build: "18G69", Name: "ota.zip"}, []byte("ota"))
+	m.SetDevice(download.Device{Name: "iPhone 11", Identifier: "iPhone12,1"})
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(NewServer(m, ""))
+	defer ts.Close()
+	api := download.NewAPI(ts.URL + "/")
+
+	devices, err := api.GetAllDevices()
+	if err != nil {
+		t.Fatalf("GetAllDevices() error = %v", err)
+	}
+	if len(devices) != 2 || devices[0].Name != "iPhone 11" || devices[1].Identifier != "iPhone12,3" {
+		t.Errorf("GetAllDevices() = %+v", devices)
+	}
+
+	dev, err := api.GetDevice("iPhone12,1")
+	if err != nil {
+		t.Fatalf("GetDevice() error = %v", err)
+	}
+	if len(dev.Firmwares) != 2 || dev.Firmwares[0].BuildID != "18G69" || dev.Firmwares[1].BuildID != "18F72" {
+		t.Errorf("GetDevice() firmwares = %+v (want the IPSWs newest first)", dev.Firmwares)
+	}
+	if _, err := api.GetDevice("iPad8,1"); err == nil {
+		t.Error("GetDevice() of a device not in the mirror should fail")
+	}
+
+	ipsws, err := api.GetAllIPSW("14.7")
+	if err != nil {
+		t.Fatalf("GetAllIPSW() error = %v", err)
+	}
+	if len(ipsws) != 2 {
+		t.Errorf("GetAllIPSW() = %+v", ipsws)
+	}
+
+	version, err := api.GetVersion("18F72")
+	if err != nil || version != "14.6" {
+		t.Errorf("GetVersion() = %s, %v; want 14.6", version, err)
+	}
+
+	i, err := api.GetIPSW("iPhone12,1", "18G69")
+	if err != nil {
+		t.Fatalf("GetIPSW() error = %v", err)
+	}
+	if i.SHA1 != sha1sum(ipsw) || i.FileSize != len(ipsw) || i.URL != ts.URL+"/iPhone12,1/14.7/18G69/iPhone12,1_14.7_18G69_Restore.ipsw" {
+		t.Errorf("GetIPSW() = %+v", i)
+	}
+	res, err := http.Get(i.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, ipsw) || res.Header.Get("ETag") != fmt.Sprintf("%q", i.SHA1) {
+		t.Errorf("GET %s = %q (etag %s)", i.URL, data, res.Header.Get("ETag"))
+	}
+
+	vm, err := api.NewiTunesVersionMaster()
+	if err != nil {
+		t.Fatalf("NewiTunesVersionMaster() error = %v", err)
+	}
+	urls, err := vm.GetSoftwareURLsForBuildID("18G69")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 2 {
+		t.Errorf("iTunes version plist 18G69 URLs = %v (want the 2 IPSWs and no OTA)", urls)
+	}
+}
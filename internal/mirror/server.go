@@ -0,0 +1,208 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+// Server serves a mirror over HTTP with the subset of the ipsw.me API and the
+// iTunes version plist that 'ipsw download' uses, so it can be pointed at the mirror
+type Server struct {
+	m *Mirror
+	// BaseURL is the URL that file URLs are rewritten to (defaults to the request's host)
+	BaseURL string
+}
+
+// NewServer creates a mirror server
+func NewServer(m *Mirror, baseURL string) *Server {
+	return &Server{
+		m:       m,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.m.Reload(); err != nil {
+		log.WithError(err).Error("failed to reload mirror index")
+	}
+
+	log.WithFields(log.Fields{"method": r.Method, "path": r.URL.Path, "range": r.Header.Get("Range")}).Debug("Request")
+
+	p := path.Clean("/" + r.URL.Path)
+	switch {
+	case p == "/"+IndexName:
+		http.ServeFile(w, r, filepath.Join(s.m.Root, IndexName))
+	case p+"/" == download.ITunesVersionPath || p == download.ITunesVersionPath:
+		s.versionPlist(w, r)
+	case strings.HasPrefix(p+"/", download.IpswMeAPIPath):
+		s.api(w, r, strings.Split(strings.TrimPrefix(p, download.IpswMeAPIPath), "/"))
+	default:
+		s.file(w, r, strings.TrimPrefix(p, "/"))
+	}
+}
+
+func (s *Server) baseURL(r *http.Request) string {
+	if len(s.BaseURL) > 0 {
+		return s.BaseURL
+	}
+	return "http://" + r.Host
+}
+
+func (s *Server) ipsw(r *http.Request, e Entry) download.IPSW {
+	return download.IPSW{
+		Identifier:  e.Device,
+		Version:     e.Version,
+		BuildID:     e.Build,
+		SHA1:        e.SHA1,
+		FileSize:    int(e.Size),
+		URL:         s.baseURL(r) + "/" + e.Path,
+		ReleaseDate: e.ReleaseDate,
+		UploadDate:  e.Added,
+		Signed:      e.Signed,
+	}
+}
+
+// ipsws returns the mirrored IPSWs matching a filter (newest first like ipsw.me)
+func (s *Server) ipsws(r *http.Request, match func(e Entry) bool) []download.IPSW {
+	var entries []Entry
+	for _, e := range s.m.Entries() {
+		if e.Type == TypeIPSW && match(e) {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Device != entries[j].Device {
+			return entries[i].Device < entries[j].Device
+		}
+		return entries[i].Build > entries[j].Build
+	})
+	ipsws := []download.IPSW{}
+	for _, e := range entries {
+		ipsws = append(ipsws, s.ipsw(r, e))
+	}
+	return ipsws
+}
+
+// device returns the device info (falls back to just the identifier for devices without info)
+func (s *Server) device(id string) (download.Device, bool) {
+	for ident, dev := range s.m.Devices() {
+		if strings.EqualFold(ident, id) {
+			return dev, true
+		}
+	}
+	for _, e := range s.m.Entries() {
+		if strings.EqualFold(e.Device, id) {
+			return download.Device{Name: e.Device, Identifier: e.Device}, true
+		}
+	}
+	return download.Device{}, false
+}
+
+func (s *Server) api(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 1 && parts[0] == "devices":
+		seen := make(map[string]bool)
+		devices := []download.Device{}
+		for _, e := range s.m.Entries() {
+			if seen[e.Device] {
+				continue
+			}
+			seen[e.Device] = true
+			dev, _ := s.device(e.Device)
+			devices = append(devices, dev)
+		}
+		sort.Slice(devices, func(i, j int) bool {
+			return devices[i].Identifier < devices[j].Identifier
+		})
+		writeJSON(w, devices)
+	case len(parts) == 2 && parts[0] == "device":
+		dev, ok := s.device(parts[1])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		dev.Firmwares = s.ipsws(r, func(e Entry) bool {
+			return strings.EqualFold(e.Device, dev.Identifier)
+		})
+		writeJSON(w, dev)
+	case len(parts) == 2 && parts[0] == "ipsw":
+		writeJSON(w, s.ipsws(r, func(e Entry) bool {
+			return e.Version == parts[1]
+		}))
+	case len(parts) == 3 && parts[0] == "ipsw":
+		e, ok := s.m.Lookup(TypeIPSW, parts[1], parts[2])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, s.ipsw(r, e))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// versionPlist serves the mirrored IPSWs as an iTunes version plist
+func (s *Server) versionPlist(w http.ResponseWriter, r *http.Request) {
+	// plain maps as the encoder writes nil struct pointers (i.e. BuildInformation.Update) as keys without values
+	versions := make(map[string]map[string]interface{})
+	for _, i := range s.ipsws(r, func(e Entry) bool { return true }) {
+		if versions[i.Identifier] == nil {
+			versions[i.Identifier] = make(map[string]interface{})
+		}
+		versions[i.Identifier][i.BuildID] = map[string]interface{}{
+			"Restore": map[string]string{
+				"BuildVersion":   i.BuildID,
+				"FirmwareURL":    i.URL,
+				"FirmwareSHA1":   i.SHA1,
+				"ProductVersion": i.Version,
+			},
+		}
+	}
+
+	vm := map[string]interface{}{
+		"MobileDeviceSoftwareVersionsByVersion": map[string]interface{}{
+			"1": map[string]interface{}{
+				"MobileDeviceSoftwareVersions": versions,
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	enc := plist.NewEncoderForFormat(w, plist.XMLFormat)
+	enc.Indent("\t")
+	if err := enc.Encode(vm); err != nil {
+		log.WithError(err).Error("failed to encode version plist")
+	}
+}
+
+// file serves a mirrored file by its layout path
+func (s *Server) file(w http.ResponseWriter, r *http.Request, p string) {
+	e, ok := s.m.LookupPath(p)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf("%q", e.SHA1))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeFile(w, r, filepath.Join(s.m.Root, filepath.FromSlash(e.Object)))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("failed to encode response")
+	}
+}
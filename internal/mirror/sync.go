@@ -0,0 +1,210 @@
+package mirror
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/pkg/errors"
+)
+
+const incomingDir = "incoming"
+
+// Source is a remote file to mirror for one or more devices
+type Source struct {
+	Type        string
+	Devices     []string
+	Version     string
+	Build       string
+	URL         string
+	SHA1        string
+	SHA256      string
+	ReleaseDate time.Time
+	Signed      bool
+}
+
+// Name returns the source's file name
+func (s Source) Name() string {
+	if u, err := url.Parse(s.URL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(s.URL)
+}
+
+// FromIPSW returns the source of an ipsw.me IPSW
+func FromIPSW(i download.IPSW) Source {
+	return Source{
+		Type:        TypeIPSW,
+		Devices:     []string{i.Identifier},
+		Version:     i.Version,
+		Build:       i.BuildID,
+		URL:         i.URL,
+		SHA1:        i.SHA1,
+		ReleaseDate: i.ReleaseDate,
+		Signed:      i.Signed,
+	}
+}
+
+// FromBuild returns the source of an iTunes version plist build
+func FromBuild(b download.Build) Source {
+	return Source{
+		Type:    TypeIPSW,
+		Devices: []string{b.Identifier},
+		Version: b.ProductVersion,
+		Build:   b.BuildVersion,
+		URL:     b.FirmwareURL,
+		SHA1:    b.FirmwareSHA1,
+	}
+}
+
+// FromOTA returns the source of an OTA asset
+func FromOTA(o download.OtaAsset) Source {
+	sha1sum, sha256sum := o.Checksums()
+	return Source{
+		Type:    TypeOTA,
+		Devices: o.SupportedDevices,
+		Version: strings.TrimPrefix(o.OSVersion, "9.9."),
+		Build:   o.Build,
+		URL:     o.BaseURL + o.RelativePath,
+		SHA1:    sha1sum,
+		SHA256:  sha256sum,
+	}
+}
+
+// Sync downloads the sources that aren't in the mirror yet (each unique file only once) and adds them to the index.
+// It returns the number of entries added
+func (m *Mirror) Sync(dl *download.Manager, sources []Source) (int, error) {
+	type pending struct {
+		Source
+		missing []string
+	}
+
+	var todo []*pending
+	for _, src := range sources {
+		p := &pending{Source: src}
+		for _, dev := range src.Devices {
+			if e, ok := m.Lookup(src.Type, dev, src.Build); ok && m.HasObject(e.SHA1) {
+				continue
+			}
+			p.missing = append(p.missing, dev)
+		}
+		if len(p.missing) == 0 {
+			log.WithFields(log.Fields{"build": src.Build, "name": src.Name()}).Debug("Already mirrored")
+			continue
+		}
+		todo = append(todo, p)
+	}
+
+	// dedupe the downloads by hash (or by URL if the hash isn't known up front)
+	queued := make(map[string]bool)
+	var jobs []download.Job
+	for _, p := range todo {
+		key := strings.ToLower(p.SHA1)
+		if len(key) == 0 {
+			key = p.URL
+		}
+		if queued[key] || len(p.SHA1) > 0 && m.HasObject(p.SHA1) {
+			continue
+		}
+		queued[key] = true
+
+		dest := filepath.Join(m.Root, incomingDir, p.Name())
+		if len(p.SHA1) > 0 {
+			dest = filepath.Join(m.Root, filepath.FromSlash(ObjectPath(p.SHA1)))
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return 0, err
+		}
+		log.WithFields(log.Fields{
+			"type":    p.Type,
+			"devices": strings.Join(p.missing, " "),
+			"build":   p.Build,
+			"version": p.Version,
+		}).Info("Mirroring")
+		jobs = append(jobs, download.Job{
+			URL:      p.URL,
+			DestName: dest,
+			Sha1:     p.SHA1,
+			Sha256:   p.SHA256,
+		})
+	}
+
+	dlErr := dl.Do(jobs...)
+
+	added := 0
+	for _, p := range todo {
+		if len(p.SHA1) == 0 {
+			sum, err := m.ingest(filepath.Join(m.Root, incomingDir, p.Name()))
+			if err != nil {
+				log.WithError(err).WithField("url", p.URL).Debug("not downloaded")
+				continue
+			}
+			p.SHA1 = sum
+			// other sources of the same URL are now in the objects too
+			for _, o := range todo {
+				if o.URL == p.URL {
+					o.SHA1 = sum
+				}
+			}
+		}
+		if !m.HasObject(p.SHA1) {
+			continue // failed download
+		}
+		for _, dev := range p.missing {
+			if err := m.Add(Entry{
+				Type:        p.Type,
+				Device:      dev,
+				Version:     p.Version,
+				Build:       p.Build,
+				Name:        p.Name(),
+				SHA1:        p.SHA1,
+				URL:         p.URL,
+				ReleaseDate: p.ReleaseDate,
+				Signed:      p.Signed,
+			}); err != nil {
+				return added, err
+			}
+			utils.Indent(log.WithField("path", filepath.Join(dev, p.Version, p.Build, p.Name())).Debug, 2)("Added")
+			added++
+		}
+	}
+
+	if err := m.Save(); err != nil {
+		return added, err
+	}
+
+	return added, dlErr
+}
+
+// ingest moves a downloaded file with an unknown hash into the objects and returns its SHA-1
+func (m *Mirror) ingest(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to hash %s", name)
+	}
+	sum := fmt.Sprintf("%x", h.Sum(nil))
+
+	if m.HasObject(sum) { // already mirrored under another name
+		return sum, os.Remove(name)
+	}
+	object := filepath.Join(m.Root, filepath.FromSlash(ObjectPath(sum)))
+	if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+		return "", err
+	}
+	return sum, os.Rename(name, object)
+}
@@ -0,0 +1,162 @@
+// Package symscript writes disassembler scripts that apply symbol names to addresses
+package symscript
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Kind is the kind of thing a symbol names
+type Kind string
+
+const (
+	Function   Kind = "function"
+	Stub       Kind = "stub"
+	SelRef     Kind = "selref"
+	CFString   Kind = "cfstring"
+	ObjCMethod Kind = "objc_method"
+	Data       Kind = "data"
+)
+
+// IsCode returns true if the symbol names code (and the disassembler should create a function)
+func (k Kind) IsCode() bool {
+	return k == Function || k == Stub || k == ObjCMethod
+}
+
+// Symbol is a named address
+type Symbol struct {
+	Address uint64 `json:"address"`
+	Name    string `json:"name"`
+	Kind    Kind   `json:"kind"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Formats are the supported output formats
+var Formats = []string{"ida", "ghidra", "binja", "json"}
+
+// Write writes a script in the given format that applies the symbols
+func Write(w io.Writer, format string, syms []Symbol) error {
+	sort.Slice(syms, func(i, j int) bool { return syms[i].Address < syms[j].Address })
+
+	switch strings.ToLower(format) {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return enc.Encode(syms)
+	case "ida":
+		return writeScript(w, idaTemplate, syms)
+	case "ghidra":
+		return writeScript(w, ghidraTemplate, syms)
+	case "binja", "binaryninja":
+		return writeScript(w, binjaTemplate, syms)
+	}
+	return fmt.Errorf("unsupported format %s (must be one of %s)", format, strings.Join(Formats, ", "))
+}
+
+// quote returns name as a python string literal (JSON strings are valid python strings)
+func quote(s string) string {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// sanitize replaces the characters disassemblers don't allow in names
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\t', '\n', '\r', '"', '\'', '`':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// label sanitizes a name for Ghidra which also doesn't allow spaces in labels (e.g. -[Class_sel])
+func label(s string) string {
+	return strings.Replace(sanitize(s), " ", "_", -1)
+}
+
+func writeScript(w io.Writer, tmpl string, syms []Symbol) error {
+	t := template.Must(template.New("script").Funcs(template.FuncMap{
+		"quote":    quote,
+		"sanitize": sanitize,
+		"label":    label,
+	}).Parse(tmpl))
+	return t.Execute(w, syms)
+}
+
+const idaTemplate = `# IDA Python script generated by ipsw
+import idc
+import ida_funcs
+
+symbols = [
+{{- range . }}
+    ({{ printf "%#x" .Address }}, {{ quote (sanitize .Name) }}, {{ if .Kind.IsCode }}True{{ else }}False{{ end }}, {{ quote .Comment }}),
+{{- end }}
+]
+
+for addr, name, is_code, comment in symbols:
+    if is_code:
+        ida_funcs.add_func(addr)
+    idc.set_name(addr, name, idc.SN_NOWARN | idc.SN_NOCHECK | idc.SN_FORCE)
+    if comment:
+        idc.set_cmt(addr, comment, 0)
+
+print("[ipsw] applied %d symbols" % len(symbols))
+`
+
+const ghidraTemplate = `# -*- coding: utf-8 -*-
+# Ghidra Python script generated by ipsw
+# @category ipsw
+from ghidra.program.model.symbol import SourceType
+from ghidra.program.model.listing import CodeUnit
+
+symbols = [
+{{- range . }}
+    ({{ printf "%#x" .Address }}, {{ quote (label .Name) }}, {{ if .Kind.IsCode }}True{{ else }}False{{ end }}, {{ quote .Comment }}),
+{{- end }}
+]
+
+listing = currentProgram.getListing()
+for addr, name, is_code, comment in symbols:
+    a = toAddr(addr)
+    try:
+        if is_code and getFunctionAt(a) is None:
+            createFunction(a, None)
+        createLabel(a, name, True, SourceType.USER_DEFINED)
+        if comment:
+            listing.setComment(a, CodeUnit.EOL_COMMENT, comment)
+    except Exception as e:
+        print("[ipsw] failed to apply %s @ %#x: %s" % (name, addr, e))
+
+print("[ipsw] applied %d symbols" % len(symbols))
+`
+
+const binjaTemplate = `# Binary Ninja Python script generated by ipsw
+from binaryninja import Symbol, SymbolType
+
+symbols = [
+{{- range . }}
+    ({{ printf "%#x" .Address }}, {{ quote (sanitize .Name) }}, {{ if .Kind.IsCode }}True{{ else }}False{{ end }}, {{ quote .Comment }}),
+{{- end }}
+]
+
+bv.begin_undo_actions()
+for addr, name, is_code, comment in symbols:
+    if is_code:
+        bv.add_function(addr)
+        bv.define_user_symbol(Symbol(SymbolType.FunctionSymbol, addr, name))
+    else:
+        bv.define_user_symbol(Symbol(SymbolType.DataSymbol, addr, name))
+    if comment:
+        bv.set_comment_at(addr, comment)
+bv.commit_undo_actions()
+
+print("[ipsw] applied %d symbols" % len(symbols))
+`
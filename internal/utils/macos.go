@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/blacktop/go-plist"
 )
@@ -323,3 +324,27 @@ func Unmount(mountPoint string, force bool) error {
 
 	return nil
 }
+
+// FindDSYMs returns the paths of the dSYM bundles with the given UUID using Spotlight
+func FindDSYMs(uuid string) ([]string, error) {
+	if runtime.GOOS == "darwin" {
+		if len(uuid) == 32 {
+			uuid = fmt.Sprintf("%s-%s-%s-%s-%s", uuid[:8], uuid[8:12], uuid[12:16], uuid[16:20], uuid[20:])
+		}
+		cmd := exec.Command("/usr/bin/mdfind", fmt.Sprintf("com_apple_xcode_dsym_uuids == %s", strings.ToUpper(uuid)))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %s", err, out)
+		}
+
+		var dsyms []string
+		for _, line := range strings.Split(string(out), "\n") {
+			if line = strings.TrimSpace(line); len(line) > 0 {
+				dsyms = append(dsyms, line)
+			}
+		}
+
+		return dsyms, nil
+	}
+	return nil, fmt.Errorf("only supported on macOS")
+}
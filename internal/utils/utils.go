@@ -13,6 +13,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -139,6 +140,23 @@ func Unique(s []string) []string {
 	return us
 }
 
+// DiffSets returns the sorted keys added to and removed from old in new
+func DiffSets(old, new map[string]bool) (added []string, removed []string) {
+	for k := range new {
+		if !old[k] {
+			added = append(added, k)
+		}
+	}
+	for k := range old {
+		if !new[k] {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
 // ReverseBytes reverse byte array order
 func ReverseBytes(a []byte) []byte {
 	for i := len(a)/2 - 1; i >= 0; i-- {
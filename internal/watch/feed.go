@@ -0,0 +1,205 @@
+package watch
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+const (
+	// TypeIPSW is a release IPSW build
+	TypeIPSW = "ipsw"
+	// TypeOTA is an OTA build
+	TypeOTA = "ota"
+	// TypeBeta is a beta IPSW build
+	TypeBeta = "beta"
+)
+
+// File is a downloadable file of a build
+type File struct {
+	Devices      []string `json:"devices"`
+	URL          string   `json:"url"`
+	SHA1         string   `json:"sha1,omitempty"`
+	SHA256       string   `json:"sha256,omitempty"`
+	Prerequisite string   `json:"prerequisite,omitempty"` // the build a delta OTA applies to
+}
+
+// Build is a firmware build found in a feed
+type Build struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+	Build   string `json:"build"`
+	Files   []File `json:"files"`
+}
+
+// Devices returns all the devices of the build
+func (b Build) Devices() []string {
+	var devices []string
+	for _, f := range b.Files {
+		devices = append(devices, f.Devices...)
+	}
+	devices = utils.Unique(devices)
+	sort.Strings(devices)
+	return devices
+}
+
+// Feed is a source of firmware builds
+type Feed interface {
+	Name() string
+	Poll() ([]Build, error)
+}
+
+// builds groups files by build (keeping the feed's order)
+type builds struct {
+	order []string
+	byID  map[string]*Build
+}
+
+func (bs *builds) add(typ, version, build string, f File) {
+	if bs.byID == nil {
+		bs.byID = make(map[string]*Build)
+	}
+	b, ok := bs.byID[build]
+	if !ok {
+		b = &Build{Type: typ, Version: version, Build: build}
+		bs.byID[build] = b
+		bs.order = append(bs.order, build)
+	}
+	for idx := range b.Files {
+		if b.Files[idx].URL == f.URL {
+			b.Files[idx].Devices = utils.Unique(append(b.Files[idx].Devices, f.Devices...))
+			return
+		}
+	}
+	b.Files = append(b.Files, f)
+}
+
+func (bs *builds) list() []Build {
+	var out []Build
+	for _, id := range bs.order {
+		out = append(out, *bs.byID[id])
+	}
+	return out
+}
+
+// ITunesFeed is the iTunes version plist of release IPSWs
+type ITunesFeed struct {
+	URL string // defaults to the iTunes (or mirror) version plist
+}
+
+// Name returns the feed's name
+func (f *ITunesFeed) Name() string { return "itunes" }
+
+// Poll returns the builds in the feed
+func (f *ITunesFeed) Poll() ([]Build, error) {
+	var vm *download.ITunesVersionMaster
+	var err error
+	if len(f.URL) > 0 {
+		vm, err = download.NewiTunesVersionMasterFromURL(f.URL)
+	} else {
+		vm, err = download.NewiTunesVersionMaster()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bs builds
+	for _, b := range vm.GetBuilds() {
+		bs.add(TypeIPSW, b.ProductVersion, b.BuildVersion, File{
+			Devices: []string{b.Identifier},
+			URL:     b.FirmwareURL,
+			SHA1:    b.FirmwareSHA1,
+		})
+	}
+
+	return bs.list(), nil
+}
+
+// OTAFeed is an OTA asset feed
+type OTAFeed struct {
+	URL      string // defaults to the public OTA feed
+	Proxy    string
+	Insecure bool
+}
+
+// Name returns the feed's name
+func (f *OTAFeed) Name() string { return "ota" }
+
+// Poll returns the builds in the feed
+func (f *OTAFeed) Poll() ([]Build, error) {
+	var o *download.Ota
+	var err error
+	if len(f.URL) > 0 {
+		o, err = download.NewOTAFromURL(f.URL, f.Proxy, f.Insecure, false, false)
+	} else {
+		o, err = download.NewOTA(f.Proxy, f.Insecure, false, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bs builds
+	for _, asset := range o.Assets {
+		if len(asset.Build) == 0 || len(asset.BaseURL+asset.RelativePath) == 0 {
+			continue
+		}
+		sha1sum, sha256sum := asset.Checksums()
+		bs.add(TypeOTA, strings.TrimPrefix(asset.OSVersion, "9.9."), asset.Build, File{
+			Devices:      asset.SupportedDevices,
+			URL:          asset.BaseURL + asset.RelativePath,
+			SHA1:         sha1sum,
+			SHA256:       sha256sum,
+			Prerequisite: asset.PrerequisiteBuild,
+		})
+	}
+
+	return bs.list(), nil
+}
+
+var betaBuildRE = regexp.MustCompile(`_(\w+)_Restore\.ipsw$`)
+
+// BetaFeed is the beta firmware pages of The iPhone Wiki
+type BetaFeed struct {
+	URL string // defaults to The iPhone Wiki
+}
+
+// Name returns the feed's name
+func (f *BetaFeed) Name() string { return "beta" }
+
+// Poll returns the builds in the feed
+func (f *BetaFeed) Poll() ([]Build, error) {
+	wikiURL := f.URL
+	if len(wikiURL) == 0 {
+		wikiURL = download.IPhoneWikiURL
+	}
+
+	betas, err := download.ScrapeBetas(strings.TrimSuffix(wikiURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	// the scraped betas are in a map
+	links := make([]string, 0, len(betas))
+	for link := range betas {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+
+	var bs builds
+	for _, link := range links {
+		beta := betas[link]
+		build := beta.BuildID
+		if m := betaBuildRE.FindStringSubmatch(link); m != nil {
+			build = m[1]
+		}
+		bs.add(TypeBeta, beta.Version, build, File{
+			Devices: append([]string{}, beta.Devices...),
+			URL:     link,
+		})
+	}
+
+	return bs.list(), nil
+}
@@ -0,0 +1,285 @@
+package watch
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/blacktop/ipsw/pkg/ota"
+	"github.com/pkg/errors"
+)
+
+// Pipeline is the configurable processing of a new build. Each build is processed into <Output>/<build>
+type Pipeline struct {
+	Output string
+	// Devices limits the files processed to these devices (all if empty)
+	Devices []string
+	// Download downloads the build's files
+	Download bool
+	// Kernel extracts the kernelcaches (remotely unless the file was downloaded)
+	Kernel bool
+	// Dyld extracts the dyld_shared_cache (remotely from OTAs, IPSWs must be downloaded)
+	Dyld bool
+	// Diff diffs the extracted kernelcaches against the ones extracted from the previous build
+	Diff bool
+	// Hook is a shell command run with the event JSON on stdin (and IPSW_WATCH_* env vars)
+	Hook string
+
+	Manager *download.Manager
+	Remote  download.RemoteConfig
+	State   *State
+}
+
+// files returns the build's files to process
+func (p *Pipeline) files(b Build) []File {
+	var files []File
+	for _, f := range b.Files {
+		if b.Type == TypeOTA && len(f.Prerequisite) > 0 {
+			continue // delta OTAs only contain the changes from another build
+		}
+		if len(p.Devices) == 0 {
+			files = append(files, f)
+			continue
+		}
+	devices:
+		for _, dev := range f.Devices {
+			for _, want := range p.Devices {
+				if strings.EqualFold(dev, want) {
+					files = append(files, f)
+					break devices
+				}
+			}
+		}
+	}
+	return files
+}
+
+func fileName(u string) string {
+	if pu, err := url.Parse(u); err == nil {
+		return path.Base(pu.Path)
+	}
+	return path.Base(u)
+}
+
+// Process runs the pipeline on the event's build (failed steps don't stop the following steps)
+func (p *Pipeline) Process(ev *Event) error {
+	dir := filepath.Join(p.Output, ev.Build.Build)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	files := p.files(ev.Build)
+	if len(files) == 0 && (p.Download || p.Kernel || p.Dyld) {
+		log.WithField("build", ev.Build.Build).Warn("No files matched the pipeline devices")
+	}
+
+	var errs []string
+	fail := func(err error) {
+		log.WithError(err).WithField("build", ev.Build.Build).Error("Pipeline step failed")
+		errs = append(errs, err.Error())
+	}
+
+	// local paths of the downloaded files
+	local := make(map[string]string)
+
+	if p.Download {
+		var jobs []download.Job
+		for _, f := range files {
+			jobs = append(jobs, download.Job{
+				URL:      f.URL,
+				DestName: filepath.Join(dir, fileName(f.URL)),
+				Sha1:     f.SHA1,
+				Sha256:   f.SHA256,
+			})
+		}
+		if err := p.Manager.Do(jobs...); err != nil {
+			fail(errors.Wrap(err, "download failed"))
+		}
+		for _, job := range jobs {
+			if _, err := os.Stat(job.DestName); err == nil {
+				local[job.URL] = job.DestName
+				ev.Outputs = append(ev.Outputs, job.DestName)
+			}
+		}
+	}
+
+	if p.Kernel || p.Dyld {
+		for _, f := range files {
+			zr, closer, err := p.open(f, local)
+			if err != nil {
+				fail(err)
+				continue
+			}
+			if p.Kernel {
+				if err := kernelcache.RemoteParse(zr, dir); err != nil {
+					fail(errors.Wrapf(err, "failed to extract kernelcache from %s", fileName(f.URL)))
+				}
+			}
+			if p.Dyld {
+				if err := p.extractDyld(ev.Build, f, zr, local, dir); err != nil {
+					fail(errors.Wrapf(err, "failed to extract dyld_shared_cache from %s", fileName(f.URL)))
+				}
+			}
+			if closer != nil {
+				closer.Close()
+			}
+		}
+		ev.Outputs = append(ev.Outputs, p.extracted(dir)...)
+	}
+
+	if p.Diff {
+		outputs, err := p.diffKernels(dir)
+		if err != nil {
+			fail(err)
+		}
+		ev.Outputs = append(ev.Outputs, outputs...)
+	}
+
+	if len(p.Hook) > 0 {
+		if err := p.runHook(ev, dir); err != nil {
+			fail(errors.Wrap(err, "hook failed"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// open opens the downloaded file or else the remote zip
+func (p *Pipeline) open(f File, local map[string]string) (*zip.Reader, *zip.ReadCloser, error) {
+	if name, ok := local[f.URL]; ok {
+		rc, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to open %s", name)
+		}
+		return &rc.Reader, rc, nil
+	}
+	zr, err := download.NewRemoteZipReader(f.URL, &p.Remote)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to open remote zip %s", f.URL)
+	}
+	return zr, nil, nil
+}
+
+func (p *Pipeline) extractDyld(b Build, f File, zr *zip.Reader, local map[string]string, dir string) error {
+	if b.Type == TypeOTA {
+		return ota.RemoteExtractTo(zr, "dyld_shared_cache_arm", dir)
+	}
+	name, ok := local[f.URL]
+	if !ok {
+		return fmt.Errorf("extracting the dyld_shared_cache from an IPSW requires it to be downloaded")
+	}
+	return dyld.Extract(name, dir)
+}
+
+// extracted returns the kernelcaches and dyld_shared_caches extracted into dir
+func (p *Pipeline) extracted(dir string) []string {
+	var outputs []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), "kernelcache") || strings.HasPrefix(info.Name(), "dyld_shared_cache") {
+			outputs = append(outputs, path)
+		}
+		return nil
+	})
+	return outputs
+}
+
+// diffKernels diffs the kernelcaches extracted into dir against the last ones with the same names
+func (p *Pipeline) diffKernels(dir string) ([]string, error) {
+	var outputs []string
+	var errs []string
+
+	for _, kc := range p.extracted(dir) {
+		name := filepath.Base(kc)
+		if !strings.HasPrefix(name, "kernelcache") || strings.HasSuffix(name, ".diff.json") {
+			continue
+		}
+		prev, ok := p.State.Kernel(name)
+		p.State.SetKernel(name, kc)
+		if !ok || prev == kc {
+			continue
+		}
+		if _, err := os.Stat(prev); err != nil {
+			continue
+		}
+
+		out := kc + ".diff.json"
+		if err := diffKernel(prev, kc, out); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to diff %s", name).Error())
+			continue
+		}
+		log.WithFields(log.Fields{"old": prev, "new": kc}).Info("Diffed kernelcaches")
+		outputs = append(outputs, out)
+	}
+
+	if len(errs) > 0 {
+		return outputs, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return outputs, nil
+}
+
+func diffKernel(oldPath, newPath, out string) error {
+	old, err := macho.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	new, err := macho.Open(newPath)
+	if err != nil {
+		return err
+	}
+	defer new.Close()
+
+	diff, err := kernelcache.Diff(old, new, nil)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(diff, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(out, data, 0644)
+}
+
+// runHook runs the hook command with the event JSON on stdin
+func (p *Pipeline) runHook(ev *Event, dir string) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("sh", "-c", p.Hook)
+	cmd.Stdin = strings.NewReader(string(data))
+	// stdout is for the JSON events
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"IPSW_WATCH_FEED="+ev.Feed,
+		"IPSW_WATCH_TYPE="+ev.Build.Type,
+		"IPSW_WATCH_VERSION="+ev.Build.Version,
+		"IPSW_WATCH_BUILD="+ev.Build.Build,
+		"IPSW_WATCH_DIR="+dir,
+	)
+
+	return cmd.Run()
+}
@@ -0,0 +1,171 @@
+package watch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FeedState is what has been seen in a feed
+type FeedState struct {
+	LastPoll  time.Time            `json:"last_poll"`
+	LastError string               `json:"last_error,omitempty"`
+	Seen      map[string]time.Time `json:"seen"`
+	// Failed maps the builds that failed to process (and aren't seen yet) to their last error
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// State is what the watcher has already seen (and the pipeline's last outputs) persisted as JSON
+type State struct {
+	Feeds map[string]*FeedState `json:"feeds"`
+	// Kernels maps a kernelcache name to the path it was last extracted to (to diff against)
+	Kernels map[string]string `json:"kernels,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// LoadState loads the state from path (an empty path keeps the state in memory only)
+func LoadState(path string) (*State, error) {
+	s := &State{
+		Feeds:   make(map[string]*FeedState),
+		Kernels: make(map[string]string),
+		path:    path,
+	}
+	if len(path) == 0 {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read state %s", path)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse state %s", path)
+	}
+	if s.Feeds == nil {
+		s.Feeds = make(map[string]*FeedState)
+	}
+	if s.Kernels == nil {
+		s.Kernels = make(map[string]string)
+	}
+
+	return s, nil
+}
+
+// Save atomically writes the state
+func (s *State) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.path); len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write state %s", tmp)
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func (s *State) feed(name string) *FeedState {
+	fs, ok := s.Feeds[name]
+	if !ok {
+		fs = &FeedState{Seen: make(map[string]time.Time)}
+		s.Feeds[name] = fs
+	}
+	if fs.Seen == nil {
+		fs.Seen = make(map[string]time.Time)
+	}
+	return fs
+}
+
+// Known returns true if the feed has been successfully polled before
+func (s *State) Known(feed string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs, ok := s.Feeds[feed]
+	return ok && !fs.LastPoll.IsZero()
+}
+
+// Seen returns true if the build has been seen in the feed
+func (s *State) Seen(feed, build string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.feed(feed).Seen[build]
+	return ok
+}
+
+// MarkSeen records the build as seen in the feed
+func (s *State) MarkSeen(feed, build string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs := s.feed(feed)
+	fs.Seen[build] = t
+	delete(fs.Failed, build)
+}
+
+// MarkFailed records that the build failed to process (it isn't seen so the next poll retries it)
+func (s *State) MarkFailed(feed, build, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs := s.feed(feed)
+	if fs.Failed == nil {
+		fs.Failed = make(map[string]string)
+	}
+	fs.Failed[build] = reason
+}
+
+// Failed returns the error of a build that failed to process
+func (s *State) Failed(feed, build string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reason, ok := s.feed(feed).Failed[build]
+	return reason, ok
+}
+
+// Polled records the result of polling the feed
+func (s *State) Polled(feed string, t time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs := s.feed(feed)
+	if err != nil {
+		fs.LastError = err.Error()
+		return
+	}
+	fs.LastPoll = t
+	fs.LastError = ""
+}
+
+// Kernel returns the path a kernelcache was last extracted to
+func (s *State) Kernel(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, ok := s.Kernels[name]
+	return path, ok
+}
+
+// SetKernel records the path a kernelcache was extracted to
+func (s *State) SetKernel(name, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Kernels[name] = path
+}
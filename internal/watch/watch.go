@@ -0,0 +1,146 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// Event is emitted for every new build
+type Event struct {
+	Time    time.Time `json:"time"`
+	Feed    string    `json:"feed"`
+	Build   Build     `json:"build"`
+	Outputs []string  `json:"outputs,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Handler processes new builds (i.e. a Pipeline)
+type Handler interface {
+	Process(e *Event) error
+}
+
+// Watcher polls feeds on a schedule and processes the builds it hasn't seen yet
+// (a build whose processing fails is retried on the next poll)
+type Watcher struct {
+	Feeds    []Feed
+	State    *State
+	Interval time.Duration
+	// Handler processes each new build (optional)
+	Handler Handler
+	// Events is where the JSON events are written to, one per line (optional)
+	Events io.Writer
+	// ProcessExisting processes all the builds of a feed the first time it is polled
+	// (instead of only recording them as seen)
+	ProcessExisting bool
+}
+
+// Poll polls every feed once, processes the new builds and returns their events
+func (w *Watcher) Poll() ([]*Event, error) {
+	var events []*Event
+	var failed []string
+
+	for _, feed := range w.Feeds {
+		name := feed.Name()
+		builds, err := feed.Poll()
+		if err != nil {
+			log.WithError(err).WithField("feed", name).Error("Failed to poll feed")
+			w.State.Polled(name, time.Now().UTC(), err)
+			failed = append(failed, name)
+			continue
+		}
+
+		baseline := !w.State.Known(name) && !w.ProcessExisting
+		if baseline {
+			log.WithFields(log.Fields{"feed": name, "builds": len(builds)}).Info("Recording existing builds")
+		}
+
+		for _, b := range builds {
+			if w.State.Seen(name, b.Build) {
+				continue
+			}
+			if baseline {
+				w.State.MarkSeen(name, b.Build, time.Now().UTC())
+				continue
+			}
+
+			log.WithFields(log.Fields{
+				"feed":    name,
+				"type":    b.Type,
+				"version": b.Version,
+				"build":   b.Build,
+				"devices": len(b.Devices()),
+			}).Info("New build")
+
+			ev := &Event{Time: time.Now().UTC(), Feed: name, Build: b}
+			if w.Handler != nil {
+				if err := w.Handler.Process(ev); err != nil {
+					log.WithError(err).WithField("build", b.Build).Error("Failed to process build (will retry)")
+					ev.Error = err.Error()
+				}
+			}
+			if len(ev.Error) > 0 {
+				w.State.MarkFailed(name, b.Build, ev.Error)
+			} else {
+				w.State.MarkSeen(name, b.Build, time.Now().UTC())
+			}
+			if err := w.emit(ev); err != nil {
+				return events, err
+			}
+			events = append(events, ev)
+
+			// save after every build so a restart doesn't re-run long pipelines
+			if err := w.State.Save(); err != nil {
+				return events, err
+			}
+		}
+
+		w.State.Polled(name, time.Now().UTC(), nil)
+	}
+
+	if err := w.State.Save(); err != nil {
+		return events, err
+	}
+
+	if len(failed) > 0 {
+		return events, fmt.Errorf("failed to poll feeds: %s", strings.Join(failed, ", "))
+	}
+
+	return events, nil
+}
+
+func (w *Watcher) emit(ev *Event) error {
+	if w.Events == nil {
+		return nil
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w.Events, string(data))
+	return err
+}
+
+// Run polls the feeds every Interval until the context is done
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Poll(); err != nil {
+			log.WithError(err).Error("Poll failed")
+		}
+		log.WithField("next", time.Now().UTC().Add(w.Interval).Format(time.RFC3339)).Debug("Waiting for next poll")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
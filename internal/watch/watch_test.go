@@ -0,0 +1,319 @@
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// feedServer serves an iTunes version plist of its builds
+type feedServer struct {
+	mu     sync.Mutex
+	builds []Build
+	fail   bool
+}
+
+func (s *feedServer) add(version, build string, devices ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := Build{Type: TypeIPSW, Version: version, Build: build}
+	for _, dev := range devices {
+		b.Files = append(b.Files, File{
+			Devices: []string{dev},
+			URL:     fmt.Sprintf("https://updates.cdn-apple.com/%s/%s_%s_%s_Restore.ipsw", build, dev, version, build),
+		})
+	}
+	s.builds = append(s.builds, b)
+}
+
+func (s *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	devices := make(map[string][]string)
+	var order []string
+	for _, b := range s.builds {
+		for _, f := range b.Files {
+			dev := f.Devices[0]
+			if _, ok := devices[dev]; !ok {
+				order = append(order, dev)
+			}
+			devices[dev] = append(devices[dev], fmt.Sprintf(`
+				<key>%s</key>
+				<dict>
+					<key>Restore</key>
+					<dict>
+						<key>BuildVersion</key><string>%s</string>
+						<key>FirmwareURL</key><string>%s</string>
+						<key>FirmwareSHA1</key><string>%040d</string>
+						<key>ProductVersion</key><string>%s</string>
+					</dict>
+				</dict>`, b.Build, b.Build, f.URL, 0, b.Version))
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>MobileDeviceSoftwareVersionsByVersion</key>
+	<dict>
+		<key>1</key>
+		<dict>
+			<key>MobileDeviceSoftwareVersions</key>
+			<dict>`)
+	for _, dev := range order {
+		fmt.Fprintf(&sb, "\n\t\t\t<key>%s</key>\n\t\t\t<dict>%s\n\t\t\t</dict>", dev, strings.Join(devices[dev], ""))
+	}
+	sb.WriteString(`
+			</dict>
+		</dict>
+	</dict>
+</dict>
+</plist>`)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(sb.String()))
+}
+
+// recorder is a Handler that records the builds it processes (failing the builds in fail)
+type recorder struct {
+	processed []string
+	fail      map[string]bool
+}
+
+func (r *recorder) Process(ev *Event) error {
+	r.processed = append(r.processed, ev.Build.Build)
+	if r.fail[ev.Build.Build] {
+		return fmt.Errorf("pipeline failed")
+	}
+	ev.Outputs = append(ev.Outputs, ev.Build.Build+"/kernelcache.release.iphone13")
+	return nil
+}
+
+// events parses the JSON events written one per line
+func events(t *testing.T, buf *bytes.Buffer) []Event {
+	t.Helper()
+	var evs []Event
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("bad event %q: %v", scanner.Text(), err)
+		}
+		evs = append(evs, ev)
+	}
+	return evs
+}
+
+func newTestWatcher(t *testing.T, srv *feedServer) (*Watcher, *recorder, *bytes.Buffer, func()) {
+	t.Helper()
+	ts := httptest.NewServer(srv)
+	state, err := LoadState("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{fail: make(map[string]bool)}
+	var buf bytes.Buffer
+	w := &Watcher{
+		Feeds:    []Feed{&ITunesFeed{URL: ts.URL}},
+		State:    state,
+		Interval: time.Hour,
+		Handler:  rec,
+		Events:   &buf,
+	}
+	return w, rec, &buf, ts.Close
+}
+
+func TestWatchBaseline(t *testing.T) {
+	srv := &feedServer{}
+	srv.add("14.6", "18F72", "iPhone13,2", "iPhone13,3")
+	srv.add("14.7", "18G69", "iPhone13,2")
+
+	w, rec, buf, done := newTestWatcher(t, srv)
+	defer done()
+
+	evs, err := w.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 0 || buf.Len() != 0 || len(rec.processed) != 0 {
+		t.Fatalf("first poll emitted %d events (%q) and processed %v", len(evs), buf.String(), rec.processed)
+	}
+	if !w.State.Known("itunes") {
+		t.Error("feed not known after a successful poll")
+	}
+	for _, build := range []string{"18F72", "18G69"} {
+		if !w.State.Seen("itunes", build) {
+			t.Errorf("existing build %s not recorded", build)
+		}
+	}
+}
+
+func TestWatchNewBuild(t *testing.T) {
+	srv := &feedServer{}
+	srv.add("14.7", "18G69", "iPhone13,2")
+
+	w, rec, buf, done := newTestWatcher(t, srv)
+	defer done()
+
+	if _, err := w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.add("14.7.1", "18G82", "iPhone13,2", "iPhone13,3")
+	if _, err := w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	evs := events(t, buf)
+	if len(evs) != 1 {
+		t.Fatalf("got %d events, want 1", len(evs))
+	}
+	ev := evs[0]
+	if ev.Feed != "itunes" || ev.Build.Build != "18G82" || ev.Build.Version != "14.7.1" || ev.Build.Type != TypeIPSW {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if devices := ev.Build.Devices(); strings.Join(devices, ",") != "iPhone13,2,iPhone13,3" {
+		t.Errorf("event devices = %v", devices)
+	}
+	if len(ev.Outputs) != 1 || len(ev.Error) > 0 {
+		t.Errorf("event outputs = %v, error = %q", ev.Outputs, ev.Error)
+	}
+	if strings.Join(rec.processed, ",") != "18G82" {
+		t.Errorf("processed %v, want [18G82]", rec.processed)
+	}
+
+	// nothing new
+	if evs, err := w.Poll(); err != nil || len(evs) != 0 {
+		t.Errorf("third poll returned %d events (err=%v)", len(evs), err)
+	}
+}
+
+func TestWatchRetryFailedBuild(t *testing.T) {
+	srv := &feedServer{}
+	srv.add("14.7", "18G69", "iPhone13,2")
+
+	w, rec, buf, done := newTestWatcher(t, srv)
+	defer done()
+
+	if _, err := w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.add("14.7.1", "18G82", "iPhone13,2")
+	rec.fail["18G82"] = true
+	if _, err := w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if evs := events(t, buf); len(evs) != 1 || len(evs[0].Error) == 0 {
+		t.Fatalf("got events %+v, want 1 failed event", evs)
+	}
+	if w.State.Seen("itunes", "18G82") {
+		t.Fatal("build that failed to process was marked as seen")
+	}
+	if _, ok := w.State.Failed("itunes", "18G82"); !ok {
+		t.Error("failure not recorded")
+	}
+
+	// the next poll retries it
+	rec.fail["18G82"] = false
+	if _, err := w.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if evs := events(t, buf); len(evs) != 1 || len(evs[0].Error) > 0 {
+		t.Fatalf("got events %+v, want 1 successful event", evs)
+	}
+	if strings.Join(rec.processed, ",") != "18G82,18G82" {
+		t.Errorf("processed %v", rec.processed)
+	}
+	if !w.State.Seen("itunes", "18G82") {
+		t.Error("build not seen after it was processed")
+	}
+	if _, ok := w.State.Failed("itunes", "18G82"); ok {
+		t.Error("failure not cleared after the build was processed")
+	}
+}
+
+func TestWatchFeedFailure(t *testing.T) {
+	srv := &feedServer{fail: true}
+	srv.add("14.7", "18G69", "iPhone13,2")
+
+	w, rec, buf, done := newTestWatcher(t, srv)
+	defer done()
+
+	if _, err := w.Poll(); err == nil {
+		t.Fatal("expected the poll of an unavailable feed to fail")
+	}
+	if w.State.Known("itunes") {
+		t.Fatal("failed poll marked the feed as known")
+	}
+	if fs := w.State.Feeds["itunes"]; fs == nil || len(fs.LastError) == 0 {
+		t.Error("poll error not recorded")
+	}
+
+	// the first successful poll is still the baseline
+	srv.mu.Lock()
+	srv.fail = false
+	srv.mu.Unlock()
+	evs, err := w.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 0 || buf.Len() != 0 || len(rec.processed) != 0 {
+		t.Errorf("poll after the failure emitted %d events and processed %v", len(evs), rec.processed)
+	}
+	if !w.State.Known("itunes") || len(w.State.Feeds["itunes"].LastError) > 0 {
+		t.Error("successful poll not recorded")
+	}
+}
+
+func TestStateSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "watch.json")
+	seen := time.Date(2021, 7, 26, 17, 0, 0, 0, time.UTC)
+
+	s, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Known("itunes") {
+		t.Fatal("new state knows a feed")
+	}
+	s.MarkSeen("itunes", "18G82", seen)
+	s.MarkFailed("ota", "19A5307g", "pipeline failed")
+	s.Polled("itunes", seen, nil)
+	s.SetKernel("kernelcache.release.iphone13", "/tmp/18G82/kernelcache.release.iphone13")
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Known("itunes") || s.Known("ota") {
+		t.Error("known feeds not restored")
+	}
+	if !s.Seen("itunes", "18G82") || !s.Feeds["itunes"].Seen["18G82"].Equal(seen) {
+		t.Error("seen build not restored")
+	}
+	if reason, ok := s.Failed("ota", "19A5307g"); !ok || reason != "pipeline failed" {
+		t.Errorf("failed build not restored: %q", reason)
+	}
+	if path, ok := s.Kernel("kernelcache.release.iphone13"); !ok || path != "/tmp/18G82/kernelcache.release.iphone13" {
+		t.Errorf("kernel not restored: %q", path)
+	}
+}
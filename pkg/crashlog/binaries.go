@@ -0,0 +1,242 @@
+package crashlog
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+// normalizeUUID returns the UUID as lowercase hex without dashes (the crashlog Binary Images format)
+func normalizeUUID(uuid string) string {
+	return strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+}
+
+type binaryRef struct {
+	path string
+	fat  bool
+}
+
+// BinaryIndex maps the UUIDs of a directory of Mach-Os and dSYMs to their files
+type BinaryIndex struct {
+	refs   map[string]binaryRef
+	opened map[string]*Binary
+}
+
+// Binary is a Mach-O (or dSYM) matching the UUID of a crashlog image
+type Binary struct {
+	Path     string
+	UUID     string
+	TextAddr uint64
+
+	m      *macho.File
+	syms   []uint64
+	names  map[uint64]string
+	dwarf  *dwarf.Data
+	closer interface{ Close() error }
+}
+
+// IndexBinaries walks dir (if set) and indexes every Mach-O (thin or universal) by its LC_UUID
+func IndexBinaries(dir string) (*BinaryIndex, error) {
+	idx := &BinaryIndex{
+		refs:   make(map[string]binaryRef),
+		opened: make(map[string]*Binary),
+	}
+
+	if len(dir) == 0 {
+		return idx, nil
+	}
+
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		idx.index(path)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to index binaries in %s: %v", dir, err)
+	}
+
+	log.Debugf("Indexed %d binaries in %s", len(idx.refs), dir)
+
+	return idx, nil
+}
+
+// index adds the UUID(s) of the Mach-O at path to the index
+func (i *BinaryIndex) index(path string) {
+	if fat, err := macho.OpenFat(path); err == nil {
+		for _, arch := range fat.Arches {
+			if uuid := arch.UUID(); uuid != nil {
+				i.add(uuid.String(), binaryRef{path: path, fat: true})
+			}
+		}
+		fat.Close()
+		return
+	}
+	m, err := macho.Open(path)
+	if err != nil {
+		return // not a Mach-O
+	}
+	if uuid := m.UUID(); uuid != nil {
+		i.add(uuid.String(), binaryRef{path: path})
+	}
+	m.Close()
+}
+
+// findDSYM looks for the dSYM with the given UUID with Spotlight (macOS only)
+func (i *BinaryIndex) findDSYM(uuid string) {
+	dsyms, err := utils.FindDSYMs(uuid)
+	if err != nil {
+		log.Debugf("failed to find dSYM for %s: %v", uuid, err)
+		return
+	}
+	for _, dsym := range dsyms {
+		files, err := filepath.Glob(filepath.Join(dsym, "Contents", "Resources", "DWARF", "*"))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			i.index(file)
+		}
+	}
+}
+
+func (i *BinaryIndex) add(uuid string, ref binaryRef) {
+	uuid = normalizeUUID(uuid)
+	if prev, ok := i.refs[uuid]; ok && strings.Contains(prev.path, ".dSYM") {
+		return // prefer the dSYM (it has the full symbol table)
+	}
+	i.refs[uuid] = ref
+}
+
+// Open returns the binary with the given UUID (or nil if there isn't one in the index)
+func (i *BinaryIndex) Open(uuid string) (*Binary, error) {
+	uuid = normalizeUUID(uuid)
+	if b, ok := i.opened[uuid]; ok {
+		return b, nil
+	}
+	ref, ok := i.refs[uuid]
+	if !ok && len(uuid) > 0 {
+		i.findDSYM(uuid)
+		ref, ok = i.refs[uuid]
+	}
+	if !ok {
+		i.opened[uuid] = nil // don't look for it again
+		return nil, nil
+	}
+
+	b := &Binary{Path: ref.path, UUID: uuid, names: make(map[uint64]string)}
+	if ref.fat {
+		fat, err := macho.OpenFat(ref.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, arch := range fat.Arches {
+			if u := arch.UUID(); u != nil && normalizeUUID(u.String()) == uuid {
+				b.m = arch.File
+				break
+			}
+		}
+		b.closer = fat
+	} else {
+		m, err := macho.Open(ref.path)
+		if err != nil {
+			return nil, err
+		}
+		b.m = m
+		b.closer = m
+	}
+	if b.m == nil {
+		b.closer.Close()
+		return nil, fmt.Errorf("failed to find %s in %s", uuid, ref.path)
+	}
+
+	if text := b.m.Segment("__TEXT"); text != nil {
+		b.TextAddr = text.Addr
+	}
+	if b.m.Symtab != nil {
+		for _, sym := range b.m.Symtab.Syms {
+			if sym.Type&types.N_STAB != 0 || sym.Type&types.N_TYPE != types.N_SECT || len(sym.Name) == 0 {
+				continue
+			}
+			if _, ok := b.names[sym.Value]; !ok {
+				b.names[sym.Value] = sym.Name
+				b.syms = append(b.syms, sym.Value)
+			}
+		}
+	}
+	sort.Slice(b.syms, func(i, j int) bool { return b.syms[i] < b.syms[j] })
+
+	i.opened[uuid] = b
+
+	return b, nil
+}
+
+// Close closes all the opened binaries
+func (i *BinaryIndex) Close() error {
+	var err error
+	for uuid, b := range i.opened {
+		if b == nil {
+			continue
+		}
+		if cerr := b.closer.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(i.opened, uuid)
+	}
+	return err
+}
+
+// Lookup returns the symbol containing the address at offset from the start of the image (and the
+// offset into that symbol)
+func (b *Binary) Lookup(offset uint64) (string, uint64, bool) {
+	addr := b.TextAddr + offset
+
+	i := sort.Search(len(b.syms), func(i int) bool { return b.syms[i] > addr })
+	if i == 0 {
+		return "", 0, false
+	}
+	sym := b.syms[i-1]
+
+	// don't attribute the address to the previous symbol if it is in a different (stripped) function
+	if fn, err := b.m.GetFunctionForVMAddr(addr); err == nil && sym < fn.StartAddr {
+		return "", 0, false
+	}
+
+	return b.names[sym], addr - sym, true
+}
+
+// SourceLines returns the DWARF source locations of the address at offset from the start of the image,
+// the innermost inlined function first (returns nil if the binary has no debug info). The functions are named
+// by their linkage (mangled) names if linkage is set, e.g. to demangle them, and by their DWARF names otherwise
+func (b *Binary) SourceLines(offset uint64, linkage bool) []SourceLine {
+	if b.dwarf == nil {
+		if b.m.Segment("__DWARF") == nil {
+			return nil
+		}
+		d, err := loadDWARF(b.m)
+		if err != nil {
+			log.Debugf("failed to load DWARF from %s: %v", b.Path, err)
+			return nil
+		}
+		b.dwarf = d
+	}
+
+	lines, err := sourceLines(b.dwarf, b.TextAddr+offset, linkage)
+	if err != nil {
+		log.Debugf("failed to lookup source line for %#x in %s: %v", b.TextAddr+offset, b.Path, err)
+		return nil
+	}
+
+	return lines
+}
@@ -2,6 +2,7 @@ package crashlog
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -15,14 +16,24 @@ import (
 // CrashLog is a crashlog object
 type CrashLog struct {
 	ReportVersion int
+	BugType       string
+	Incident      string
+	DateTime      string
 	HardwareModel string
+	OSName        string
 	OSVersion     string
 	OSBuild       string
 	Process       string
 	PID           int
+	ProcessPath   string
+	Identifier    string
+	Version       string
+	CodeType      string
+	ParentProcess string
 
 	ExceptionType      string
 	ExceptionSubtype   []string
+	ExceptionCodes     string
 	TerminationSignal  string
 	TerminationReason  string
 	TerminatingProcess string
@@ -33,6 +44,7 @@ type CrashLog struct {
 	CrashedThread int
 
 	lines  []string
+	ips    *ipsReport
 	closer io.Closer
 }
 
@@ -50,6 +62,11 @@ type state map[string]uint64
 
 // TODO: check that crashlog is arm64
 func (s state) String() string {
+	// a zero ESR means the crash report didn't include one (not an Unknown exception class)
+	var esr string
+	if s["esr"] != 0 {
+		esr = " " + ESR(s["esr"]).String()
+	}
 	return fmt.Sprintf(
 		"    x0: %#016x   x1: %#016x   x2: %#016x   x3: %#016x\n"+
 			"    x4: %#016x   x5: %#016x   x6: %#016x   x7: %#016x\n"+
@@ -60,17 +77,17 @@ func (s state) String() string {
 			"   x24: %#016x  x25: %#016x  x26: %#016x  x27: %#016x\n"+
 			"   x28: %#016x   fp: %#016x   lr: %#016x\n"+
 			"    sp: %#016x   pc: %#016x cpsr: %#08x\n"+
-			"   esr: %#08x\n",
+			"   far: %#016x  esr: %#08x%s\n",
 		s["x0"], s["x1"], s["x2"], s["x3"],
 		s["x4"], s["x5"], s["x6"], s["x7"],
 		s["x8"], s["x9"], s["x10"], s["x11"],
 		s["x12"], s["x13"], s["x14"], s["x15"],
-		s["16"], s["x17"], s["x18"], s["x19"],
+		s["x16"], s["x17"], s["x18"], s["x19"],
 		s["x20"], s["x21"], s["x22"], s["x23"],
 		s["x24"], s["x25"], s["x26"], s["x27"],
 		s["x28"], s["fp"], s["lr"],
 		s["sp"], s["pc"], s["cpsr"],
-		s["esr"])
+		s["far"], s["esr"], esr)
 }
 
 type thread struct {
@@ -89,6 +106,28 @@ type backtrace struct {
 	LibAddr  uint64
 	Offset   int
 	Symbol   string
+	// SymbolOffset is the offset of Address from the start of Symbol
+	SymbolOffset uint64
+	// Source is the source location of the frame (from a dSYM)
+	Source *SourceLine
+	// Inlined are the functions inlined at the frame (innermost first)
+	Inlined []SourceLine
+}
+
+// SymbolString returns the frame's symbol as 'symbol (File.swift:123)' if the source location is known
+// and as 'symbol + offset' otherwise
+func (b backtrace) SymbolString() string {
+	if b.Source != nil && len(b.Source.File) > 0 {
+		src := *b.Source
+		if len(b.Symbol) > 0 {
+			src.Function = b.Symbol
+		}
+		return src.String()
+	}
+	if len(b.Symbol) == 0 || b.SymbolOffset == 0 {
+		return b.Symbol
+	}
+	return fmt.Sprintf("%s + %d", b.Symbol, b.SymbolOffset)
 }
 
 // Open opens the named file using os.Open and prepares it for use as a crashlog
@@ -102,6 +141,7 @@ func Open(name string) (*CrashLog, error) {
 	}
 
 	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // .ips bodies can have very long lines
 	for scanner.Scan() {
 		crash.lines = append(crash.lines, scanner.Text())
 	}
@@ -109,6 +149,23 @@ func Open(name string) (*CrashLog, error) {
 		fmt.Fprintln(os.Stderr, "reading standard input:", err)
 	}
 
+	if isIPS(crash.lines) {
+		if err := crash.parseIPS(crash.lines[0], []byte(strings.Join(crash.lines[1:], "\n"))); err != nil {
+			f.Close()
+			return nil, err
+		}
+		crash.closer = f
+		return &crash, nil
+	}
+
+	if hasIPSHeader(crash.lines) { // legacy .ips reports are a JSON header line followed by a text crashlog
+		var hdr ipsHeader
+		if err := json.Unmarshal([]byte(crash.lines[0]), &hdr); err == nil {
+			crash.BugType = hdr.BugType
+		}
+		crash.lines = crash.lines[1:]
+	}
+
 	if err := crash.getReportVersion(); err != nil {
 		return nil, fmt.Errorf("failed to parse report version: %v", err)
 	}
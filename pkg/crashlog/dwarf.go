@@ -0,0 +1,214 @@
+package crashlog
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+)
+
+// SourceLine is the source location of a (possibly inlined) function
+type SourceLine struct {
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+func (s SourceLine) String() string {
+	if len(s.File) == 0 {
+		return s.Function
+	}
+	return fmt.Sprintf("%s (%s:%d)", s.Function, filepath.Base(s.File), s.Line)
+}
+
+// loadDWARF loads the DWARF debug info of a Mach-O (i.e. a dSYM) including the DWARF 5 sections
+func loadDWARF(m *macho.File) (*dwarf.Data, error) {
+	sections := make(map[string][]byte)
+
+	for _, sec := range m.Sections {
+		var name string
+		switch {
+		case strings.HasPrefix(sec.Name, "__debug_"):
+			name = strings.TrimPrefix(sec.Name, "__debug_")
+		case strings.HasPrefix(sec.Name, "__zdebug_"):
+			name = strings.TrimPrefix(sec.Name, "__zdebug_")
+		default:
+			continue
+		}
+		if name == "str_offs" { // section names are truncated to 16 chars
+			name = "str_offsets"
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", sec.Name, err)
+		}
+		if len(data) >= 12 && bytes.HasPrefix(data, []byte("ZLIB")) {
+			zr, err := zlib.NewReader(bytes.NewReader(data[12:]))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress %s: %v", sec.Name, err)
+			}
+			dec := make([]byte, binary.BigEndian.Uint64(data[4:12]))
+			if _, err := io.ReadFull(zr, dec); err != nil {
+				return nil, fmt.Errorf("failed to decompress %s: %v", sec.Name, err)
+			}
+			zr.Close()
+			data = dec
+		}
+		sections[name] = data
+	}
+
+	if len(sections["info"]) == 0 {
+		return nil, fmt.Errorf("no DWARF debug info")
+	}
+
+	d, err := dwarf.New(sections["abbrev"], nil, nil, sections["info"], sections["line"], nil, sections["ranges"], sections["str"])
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"addr", "line_str", "str_offsets", "rnglists"} {
+		if data, ok := sections[name]; ok {
+			if err := d.AddSection(".debug_"+name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return d, nil
+}
+
+func dwarfContains(d *dwarf.Data, e *dwarf.Entry, pc uint64) bool {
+	ranges, err := d.Ranges(e)
+	if err != nil {
+		return false
+	}
+	for _, r := range ranges {
+		if r[0] <= pc && pc < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// dwarfName returns the name of a subprogram or inlined subroutine following its abstract origin, the
+// linkage (mangled) name if linkage is set and the DW_AT_name (e.g. "foo" instead of "_ZN1A3fooEv") otherwise,
+// falling back to the other one if it is missing
+func dwarfName(d *dwarf.Data, e *dwarf.Entry, linkage bool) string {
+	var name, linkageName string
+	for depth := 0; e != nil && depth < 8; depth++ {
+		if n, ok := e.Val(dwarf.AttrLinkageName).(string); ok && len(linkageName) == 0 {
+			linkageName = n
+		}
+		if n, ok := e.Val(dwarf.AttrName).(string); ok && len(name) == 0 {
+			name = n
+		}
+		if linkage && len(linkageName) > 0 || !linkage && len(name) > 0 {
+			break
+		}
+		off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if off, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				break
+			}
+		}
+		r := d.Reader()
+		r.Seek(off)
+		if e, _ = r.Next(); e == nil {
+			break
+		}
+	}
+	if linkage && len(linkageName) > 0 || len(name) == 0 {
+		return linkageName
+	}
+	return name
+}
+
+// sourceLines returns the source locations of pc, the innermost inlined function first and the
+// function that contains them last (named by their linkage names if linkage is set, see dwarfName)
+func sourceLines(d *dwarf.Data, pc uint64, linkage bool) ([]SourceLine, error) {
+	r := d.Reader()
+	cu, err := r.SeekPC(pc)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the subprogram containing pc and the subroutines inlined into it (outermost first)
+	var chain []*dwarf.Entry
+	// scopes is the number of namespaces and classes entered looking for the subprogram
+	var scopes int
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			if len(chain) == 0 && scopes > 0 {
+				scopes-- // the end of a scope, keep looking in the enclosing one
+				continue
+			}
+			break // the children of the last match (or the CU) are done
+		}
+		switch e.Tag {
+		case dwarf.TagNamespace, dwarf.TagClassType, dwarf.TagStructType, dwarf.TagUnionType:
+			if e.Children && len(chain) == 0 {
+				scopes++
+				continue // C++ functions can be defined in these scopes
+			}
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine, dwarf.TagLexDwarfBlock:
+			if dwarfContains(d, e, pc) {
+				if e.Tag != dwarf.TagLexDwarfBlock {
+					chain = append(chain, e)
+				}
+				if e.Children {
+					continue // descend into it
+				}
+				break
+			}
+		}
+		if e.Children {
+			r.SkipChildren()
+		}
+	}
+
+	lr, err := d.LineReader(cu)
+	if err != nil || lr == nil {
+		return nil, fmt.Errorf("no line table for %#x", pc)
+	}
+	var le dwarf.LineEntry
+	if err := lr.SeekPC(pc, &le); err != nil {
+		return nil, err
+	}
+	files := lr.Files()
+
+	var file string
+	if le.File != nil {
+		file = le.File.Name
+	}
+	line := le.Line
+
+	if len(chain) == 0 {
+		return []SourceLine{{File: file, Line: line}}, nil
+	}
+
+	var lines []SourceLine
+	for i := len(chain) - 1; i >= 0; i-- {
+		lines = append(lines, SourceLine{Function: dwarfName(d, chain[i], linkage), File: file, Line: line})
+		// the caller's location is where this function was inlined
+		if cf, ok := chain[i].Val(dwarf.AttrCallFile).(int64); ok && cf >= 0 && int(cf) < len(files) && files[cf] != nil {
+			file = files[cf].Name
+		}
+		if cl, ok := chain[i].Val(dwarf.AttrCallLine).(int64); ok {
+			line = int(cl)
+		}
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,184 @@
+package crashlog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ESR is an arm64 Exception Syndrome Register value
+type ESR uint64
+
+// ESR exception classes
+const (
+	ExcClassUnknown         = 0x00
+	ExcClassWFx             = 0x01
+	ExcClassFP              = 0x07
+	ExcClassIllegalState    = 0x0e
+	ExcClassSVC64           = 0x15
+	ExcClassSysReg          = 0x18
+	ExcClassFPAC            = 0x1c
+	ExcClassInstrAbortLower = 0x20
+	ExcClassInstrAbort      = 0x21
+	ExcClassPCAlignment     = 0x22
+	ExcClassDataAbortLower  = 0x24
+	ExcClassDataAbort       = 0x25
+	ExcClassSPAlignment     = 0x26
+	ExcClassFPException     = 0x2c
+	ExcClassSError          = 0x2f
+	ExcClassBreakpointLower = 0x30
+	ExcClassBreakpoint      = 0x31
+	ExcClassSoftStepLower   = 0x32
+	ExcClassSoftStep        = 0x33
+	ExcClassWatchpointLower = 0x34
+	ExcClassWatchpoint      = 0x35
+	ExcClassBRK             = 0x3c
+)
+
+const (
+	esrISVBit                = 1 << 24
+	esrWnRBit                = 1 << 6
+	esrFaultStatusMask       = 0x3f
+	esrAccessSizeShift       = 22
+	esrExceptionClassShift   = 26
+	esrExceptionClassMask    = 0x3f
+	esrSyndromeMask          = 0x1ffffff
+	esrFaultStatusLevelMask  = 0x3
+	esrFaultStatusTypeMask   = 0x3c
+	esrFaultStatusTranslate  = 0x04
+	esrFaultStatusAccessFlag = 0x08
+	esrFaultStatusPermission = 0x0c
+)
+
+var excClassNames = map[uint64]string{
+	ExcClassUnknown:         "Unknown",
+	ExcClassWFx:             "WFI/WFE",
+	ExcClassFP:              "SIMD/FP Access",
+	ExcClassIllegalState:    "Illegal Execution State",
+	ExcClassSVC64:           "SVC",
+	ExcClassSysReg:          "MSR/MRS",
+	ExcClassFPAC:            "Pointer Authentication Failure",
+	ExcClassInstrAbortLower: "Instruction Abort",
+	ExcClassInstrAbort:      "Instruction Abort",
+	ExcClassPCAlignment:     "PC Alignment",
+	ExcClassDataAbortLower:  "Data Abort",
+	ExcClassDataAbort:       "Data Abort",
+	ExcClassSPAlignment:     "SP Alignment",
+	ExcClassFPException:     "Floating Point Exception",
+	ExcClassSError:          "SError",
+	ExcClassBreakpointLower: "Breakpoint",
+	ExcClassBreakpoint:      "Breakpoint",
+	ExcClassSoftStepLower:   "Software Step",
+	ExcClassSoftStep:        "Software Step",
+	ExcClassWatchpointLower: "Watchpoint",
+	ExcClassWatchpoint:      "Watchpoint",
+	ExcClassBRK:             "BRK",
+}
+
+// ExceptionClass returns the ESR's exception class (EC)
+func (e ESR) ExceptionClass() uint64 {
+	return (uint64(e) >> esrExceptionClassShift) & esrExceptionClassMask
+}
+
+// Syndrome returns the ESR's instruction specific syndrome (ISS)
+func (e ESR) Syndrome() uint64 {
+	return uint64(e) & esrSyndromeMask
+}
+
+// IsDataAbort returns true if the exception is a data abort
+func (e ESR) IsDataAbort() bool {
+	ec := e.ExceptionClass()
+	return ec == ExcClassDataAbortLower || ec == ExcClassDataAbort
+}
+
+// IsInstructionAbort returns true if the exception is an instruction abort (i.e. a bad pc)
+func (e ESR) IsInstructionAbort() bool {
+	ec := e.ExceptionClass()
+	return ec == ExcClassInstrAbortLower || ec == ExcClassInstrAbort
+}
+
+// IsPACFailure returns true if the exception is a pointer authentication failure (FEAT_FPAC)
+func (e ESR) IsPACFailure() bool {
+	return e.ExceptionClass() == ExcClassFPAC
+}
+
+// IsWrite returns true if a data abort was caused by a write
+func (e ESR) IsWrite() bool {
+	return e.IsDataAbort() && uint64(e)&esrWnRBit != 0
+}
+
+// AccessSize returns the size of the faulting access of a data abort (0 if the syndrome isn't valid)
+func (e ESR) AccessSize() int {
+	if !e.IsDataAbort() || uint64(e)&esrISVBit == 0 {
+		return 0
+	}
+	return 1 << ((uint64(e) >> esrAccessSizeShift) & 0x3)
+}
+
+// FaultStatus returns the data/instruction fault status code (DFSC/IFSC) description of an abort
+func (e ESR) FaultStatus() string {
+	if !e.IsDataAbort() && !e.IsInstructionAbort() {
+		return ""
+	}
+	fsc := uint64(e) & esrFaultStatusMask
+	switch fsc {
+	case 0x10:
+		return "Synchronous External Abort"
+	case 0x21:
+		return "Alignment fault"
+	case 0x30:
+		return "TLB Conflict Abort"
+	}
+	level := fsc & esrFaultStatusLevelMask
+	switch fsc & esrFaultStatusTypeMask {
+	case 0x00:
+		return fmt.Sprintf("Address Size fault (level %d)", level)
+	case esrFaultStatusTranslate:
+		return "Translation fault"
+	case esrFaultStatusAccessFlag:
+		return "Access Flag fault"
+	case esrFaultStatusPermission:
+		return "Permission fault"
+	}
+	return fmt.Sprintf("fault status %#x", fsc)
+}
+
+// IsTranslationFault returns true if the abort was caused by an unmapped address
+func (e ESR) IsTranslationFault() bool {
+	return (e.IsDataAbort() || e.IsInstructionAbort()) && uint64(e)&esrFaultStatusTypeMask == esrFaultStatusTranslate
+}
+
+// IsPermissionFault returns true if the abort was caused by a page's protections
+func (e ESR) IsPermissionFault() bool {
+	return (e.IsDataAbort() || e.IsInstructionAbort()) && uint64(e)&esrFaultStatusTypeMask == esrFaultStatusPermission
+}
+
+// String returns the ESR decoded like the crash reporter does, i.e. '(Data Abort) byte read Translation fault'
+func (e ESR) String() string {
+	name, ok := excClassNames[e.ExceptionClass()]
+	if !ok {
+		name = fmt.Sprintf("EC %#x", e.ExceptionClass())
+	}
+	var parts []string
+	parts = append(parts, fmt.Sprintf("(%s)", name))
+	if e.IsDataAbort() {
+		switch e.AccessSize() {
+		case 1:
+			parts = append(parts, "byte")
+		case 2:
+			parts = append(parts, "halfword")
+		case 4:
+			parts = append(parts, "word")
+		case 8:
+			parts = append(parts, "doubleword")
+		}
+		if e.IsWrite() {
+			parts = append(parts, "write")
+		} else {
+			parts = append(parts, "read")
+		}
+	}
+	if fs := e.FaultStatus(); len(fs) > 0 {
+		parts = append(parts, fs)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,380 @@
+package crashlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+// Rating is how likely a crash is to be exploitable (in the spirit of !exploitable and CrashWrangler)
+type Rating int
+
+const (
+	// Unknown means none of the heuristics could rate the crash
+	Unknown Rating = iota
+	// NotExploitable is a crash that is by design (i.e. a trap or resource limit)
+	NotExploitable
+	// ProbablyNotExploitable is a crash like a NULL dereference or stack exhaustion
+	ProbablyNotExploitable
+	// ProbablyExploitable is a crash with signs of memory corruption
+	ProbablyExploitable
+	// Exploitable is a crash where the attacker likely controls a code or write pointer
+	Exploitable
+)
+
+func (r Rating) String() string {
+	switch r {
+	case NotExploitable:
+		return "NOT_EXPLOITABLE"
+	case ProbablyNotExploitable:
+		return "PROBABLY_NOT_EXPLOITABLE"
+	case ProbablyExploitable:
+		return "PROBABLY_EXPLOITABLE"
+	case Exploitable:
+		return "EXPLOITABLE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// MarshalJSON returns the rating as its name
+func (r Rating) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+const (
+	// nearNullSize is the size of the range of addresses considered a NULL dereference
+	nearNullSize = 0x10000
+	// stackGuardSize is how far below sp a fault is considered a stack guard page hit
+	stackGuardSize = 0x10000
+	// nearRegisterSize is how far from a register's value a fault address is considered derived from it
+	nearRegisterSize = 0x1000
+	// recursionDepth is how many times the same frame must repeat to be considered runaway recursion
+	recursionDepth = 32
+	// userAddressMask strips the pointer authentication code from an arm64 userspace pointer
+	userAddressMask = 0x00007fffffffffff
+	// ptrauthBrkMask matches the 'brk #0xc470'-'brk #0xc473' traps emitted for failed auths (without FEAT_FPAC)
+	ptrauthBrkMask    = 0xfffc
+	ptrauthBrkComment = 0xc470
+)
+
+var (
+	faultAddrRE = regexp.MustCompile(`at (0x[[:xdigit:]]+)`)
+	// mallocErrorSymbols are functions libmalloc calls when it detects heap corruption
+	mallocErrorSymbols = []string{
+		"malloc_zone_error",
+		"malloc_report",
+		"malloc_error_break",
+		"malloc_printf",
+		"free_list_checksum_botch",
+		"nanov2_guard_corruption_detected",
+		"nanozone_error",
+		"szone_error",
+		"xzm_abort",
+		"BUG_IN_CLIENT_OF_LIBMALLOC",
+	}
+	// overflowCheckSymbols are functions the compiler's overflow checks call on detecting a smashed buffer
+	overflowCheckSymbols = []string{
+		"__stack_chk_fail",
+		"__chk_fail",
+	}
+)
+
+// Finding is a single exploitability heuristic that matched a crash
+type Finding struct {
+	Rating Rating `json:"rating"`
+	Reason string `json:"reason"`
+}
+
+// Exploitability is the result of the exploitability analysis of a crash log
+type Exploitability struct {
+	Process       string    `json:"process,omitempty"`
+	ExceptionType string    `json:"exception_type,omitempty"`
+	FaultAddress  uint64    `json:"fault_address,omitempty"`
+	ESR           string    `json:"esr,omitempty"`
+	Rating        Rating    `json:"rating"`
+	Findings      []Finding `json:"findings"`
+}
+
+func (e *Exploitability) add(r Rating, format string, args ...interface{}) {
+	e.Findings = append(e.Findings, Finding{Rating: r, Reason: fmt.Sprintf(format, args...)})
+	if r > e.Rating {
+		e.Rating = r
+	}
+}
+
+func (e *Exploitability) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%s)\n", e.Rating, e.ExceptionType)
+	if len(e.ESR) > 0 {
+		fmt.Fprintf(&sb, "    ESR:   %s\n", e.ESR)
+	}
+	if e.FaultAddress > 0 {
+		fmt.Fprintf(&sb, "    Fault: %#x\n", e.FaultAddress)
+	}
+	for _, f := range e.Findings {
+		fmt.Fprintf(&sb, "    - [%s] %s\n", f.Rating, f.Reason)
+	}
+	return sb.String()
+}
+
+// Exploitability rates how likely the crash is to be exploitable using the exception type/subtype,
+// the decoded ESR, the crashed thread's registers and its (symbolicated) backtrace
+func (c *CrashLog) Exploitability() *Exploitability {
+	e := &Exploitability{
+		Process:       c.Process,
+		ExceptionType: c.ExceptionType,
+	}
+
+	var regs state
+	var frames []backtrace
+	if c.CrashedThread >= 0 && c.CrashedThread < len(c.Threads) {
+		regs = c.Threads[c.CrashedThread].State
+		frames = c.Threads[c.CrashedThread].BackTrace
+	}
+
+	var esr ESR
+	if val, ok := regs["esr"]; ok && val != 0 {
+		esr = ESR(val)
+		e.ESR = fmt.Sprintf("%#08x %s", val, esr)
+	}
+
+	details := strings.Join(append([]string{c.ExceptionCodes, c.TerminationReason}, c.ExceptionSubtype...), "\n")
+	far, hasFar := c.faultAddress(regs)
+	if hasFar {
+		e.FaultAddress = far
+	}
+
+	// pointer authentication failures
+	if esr.IsPACFailure() {
+		e.add(Exploitable, "pointer authentication failure (ESR exception class FPAC): a signed code/data pointer was corrupted")
+	} else if esr.ExceptionClass() == ExcClassBRK && esr.Syndrome()&ptrauthBrkMask == ptrauthBrkComment {
+		e.add(Exploitable, "pointer authentication failure (brk #%#x trap after a failed auth): a signed code/data pointer was corrupted", esr.Syndrome()&0xffff)
+	} else if strings.Contains(details, "pointer authentication failure") {
+		e.add(Exploitable, "the crash reporter flagged a possible pointer authentication failure: a signed code/data pointer was corrupted")
+	}
+
+	// wild pc/lr
+	pc, hasPC := regs["pc"]
+	if !hasPC && len(frames) > 0 {
+		pc, hasPC = frames[0].Address, true
+	}
+	if hasPC {
+		switch {
+		case pc < nearNullSize:
+			e.add(ProbablyExploitable, "pc %#x is near NULL (call through a NULL or corrupted function pointer)", pc)
+		case pc>>47 != 0:
+			e.add(Exploitable, "pc %#x is not a canonical address (branch to a corrupted or unauthenticated code pointer)", pc)
+		case isPoisoned(pc):
+			e.add(Exploitable, "pc %#x is a poison/scribble pattern (branch through freed memory)", pc)
+		case !c.inImage(pc):
+			e.add(Exploitable, "pc %#x is not in any loaded image (wild jump; or JIT code)", pc)
+		case esr.IsInstructionAbort():
+			e.add(ProbablyExploitable, "instruction abort at pc %#x (%s)", pc, esr.FaultStatus())
+		}
+	}
+	if lr, ok := regs["lr"]; ok && lr != 0 {
+		// check the unstripped lr too as stripping the PAC bits breaks up a scribble pattern
+		stripped := lr & userAddressMask
+		switch {
+		case isPoisoned(lr):
+			e.add(Exploitable, "lr %#x is a poison/scribble pattern (return address read from freed memory)", lr)
+		case isPoisoned(stripped):
+			e.add(Exploitable, "lr %#x is a poison/scribble pattern (return address read from freed memory)", stripped)
+		case stripped >= nearNullSize && !c.inImage(stripped):
+			e.add(ProbablyExploitable, "lr %#x is not in any loaded image (corrupted return address or stack)", stripped)
+		}
+	}
+
+	// bad memory accesses
+	if hasFar && (esr.IsDataAbort() || strings.HasPrefix(c.ExceptionType, "EXC_BAD_ACCESS")) {
+		var src string
+		if reg, val, ok := nearRegister(regs, far); ok {
+			src = fmt.Sprintf(" (derived from %s = %#x)", reg, val)
+		}
+		access := "access"
+		if esr.IsDataAbort() {
+			access = "read"
+			if esr.IsWrite() {
+				access = "write"
+			}
+		}
+		sp := regs["sp"]
+		switch {
+		case sp > 0 && far < sp && sp-far <= stackGuardSize:
+			e.add(ProbablyNotExploitable, "%s of %#x just below sp %#x (stack overflow into the guard page)", access, far, sp)
+		case far < nearNullSize:
+			e.add(ProbablyNotExploitable, "%s of %#x is a NULL pointer dereference%s", access, far, src)
+		case isPoisoned(far):
+			e.add(Exploitable, "%s of %#x which is a poison/scribble pattern (use-after-free)%s", access, far, src)
+		case far>>47 != 0 && access == "write":
+			e.add(Exploitable, "write to non-canonical address %#x (corrupted or unauthenticated data pointer)%s", far, src)
+		case far>>47 != 0:
+			e.add(ProbablyExploitable, "%s of non-canonical address %#x (corrupted or unauthenticated data pointer)%s", access, far, src)
+		case esr.IsPermissionFault():
+			e.add(ProbablyExploitable, "%s of %#x violates the page protections%s", access, far, src)
+		case access == "write":
+			e.add(Exploitable, "write to invalid address %#x%s", far, src)
+		default:
+			e.add(Unknown, "%s of invalid address %#x%s", access, far, src)
+		}
+	}
+
+	// stack overflows
+	if strings.Contains(strings.ToLower(details), "stack overflow") || strings.Contains(details, "stack size exceeded") {
+		e.add(ProbablyNotExploitable, "the crash reporter flagged a stack overflow (runaway recursion)")
+	} else if depth, sym := recursion(frames); depth >= recursionDepth {
+		e.add(ProbablyNotExploitable, "%s repeats %d times in the crashed thread (runaway recursion)", sym, depth)
+	}
+
+	// heap corruption and smashed buffers
+	var sawMalloc, confirmed bool
+	for idx, bt := range frames {
+		if idx >= DefaultSignatureFrames*2 {
+			break
+		}
+		if bt.Image != nil && bt.Image.Name == "libsystem_malloc.dylib" {
+			sawMalloc = true
+		}
+		if sym := matchSymbol(bt.Symbol, mallocErrorSymbols); len(sym) > 0 {
+			e.add(Exploitable, "libmalloc detected heap corruption in frame %d (%s)", idx, bt.Symbol)
+			confirmed = true
+			break
+		}
+		if sym := matchSymbol(bt.Symbol, overflowCheckSymbols); len(sym) > 0 {
+			e.add(Exploitable, "a buffer overflow check failed in frame %d (%s)", idx, bt.Symbol)
+			confirmed = true
+			break
+		}
+	}
+	if sawMalloc && !confirmed && strings.Contains(c.ExceptionType, "SIGABRT") {
+		e.add(ProbablyExploitable, "abort from libsystem_malloc.dylib (heap corruption; symbolicate to confirm)")
+	}
+
+	// crashes that are by design
+	switch {
+	case strings.HasPrefix(c.ExceptionType, "EXC_BREAKPOINT"):
+		e.add(NotExploitable, "%s is a trap (i.e. a Swift runtime or __builtin_trap failure)", c.ExceptionType)
+	case strings.HasPrefix(c.ExceptionType, "EXC_CRASH") && strings.Contains(c.ExceptionType, "SIGABRT"):
+		e.add(ProbablyNotExploitable, "abort() (failed assertion or uncaught exception)")
+	case strings.HasPrefix(c.ExceptionType, "EXC_BAD_INSTRUCTION"):
+		e.add(ProbablyNotExploitable, "%s is an undefined instruction trap", c.ExceptionType)
+	case strings.HasPrefix(c.ExceptionType, "EXC_ARITHMETIC"):
+		e.add(NotExploitable, "%s is an arithmetic exception", c.ExceptionType)
+	case strings.HasPrefix(c.ExceptionType, "EXC_RESOURCE"):
+		e.add(NotExploitable, "%s is a resource limit", c.ExceptionType)
+	}
+
+	if len(e.Findings) == 0 {
+		e.add(Unknown, "no heuristics matched %s", c.ExceptionType)
+	}
+
+	return e
+}
+
+// faultAddress returns the faulting address from the far register or the exception subtype/codes
+func (c *CrashLog) faultAddress(regs state) (uint64, bool) {
+	if far, ok := regs["far"]; ok && far != 0 {
+		return far, true
+	}
+	for _, s := range append([]string{c.ExceptionCodes}, c.ExceptionSubtype...) {
+		if m := faultAddrRE.FindStringSubmatch(s); m != nil {
+			if addr, err := utils.ConvertStrToInt(m[1]); err == nil {
+				return addr, true
+			}
+		}
+	}
+	// EXC_BAD_ACCESS codes are 'kern_return_t, address'
+	if strings.HasPrefix(c.ExceptionType, "EXC_BAD_ACCESS") {
+		if codes := strings.Split(c.ExceptionCodes, ","); len(codes) == 2 {
+			if addr, err := utils.ConvertStrToInt(strings.TrimSpace(codes[1])); err == nil {
+				return addr, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// inImage returns true if addr is in one of the crashlog's images (or if there are no images to check)
+func (c *CrashLog) inImage(addr uint64) bool {
+	if len(c.Images) == 0 {
+		return true
+	}
+	addr &= userAddressMask
+	for _, img := range c.Images {
+		if img.Start <= addr && addr <= img.End {
+			return true
+		}
+	}
+	return false
+}
+
+// isPoisoned returns true if addr looks like a 0xbad…/0xdead… marker or a MallocScribble fill pattern
+func isPoisoned(addr uint64) bool {
+	hex := fmt.Sprintf("%x", addr)
+	if strings.HasPrefix(hex, "bad") || strings.HasPrefix(hex, "dead") {
+		return true
+	}
+	if len(hex) < 8 {
+		return false
+	}
+	// MallocScribble fills allocated memory with 0xaa and freed memory with 0x55
+	return strings.Trim(hex, "a") == "" || strings.Trim(hex, "5") == ""
+}
+
+// nearRegister returns the general purpose register whose value is closest to addr (within nearRegisterSize)
+func nearRegister(regs state, addr uint64) (string, uint64, bool) {
+	var reg string
+	var val uint64
+	best := uint64(nearRegisterSize + 1)
+	for i := 0; i <= 28; i++ {
+		name := fmt.Sprintf("x%d", i)
+		v, ok := regs[name]
+		if !ok || v < nearNullSize {
+			continue
+		}
+		var dist uint64
+		if v > addr {
+			dist = v - addr
+		} else {
+			dist = addr - v
+		}
+		if dist < best {
+			reg, val, best = name, v, dist
+		}
+	}
+	return reg, val, len(reg) > 0
+}
+
+// recursion returns the most repeated frame (by address) in a backtrace and how many times it repeats
+func recursion(frames []backtrace) (int, string) {
+	counts := make(map[uint64]int)
+	var max int
+	var sym string
+	for _, bt := range frames {
+		counts[bt.Address]++
+		if counts[bt.Address] > max {
+			max = counts[bt.Address]
+			sym = bt.Symbol
+			if len(sym) == 0 {
+				sym = fmt.Sprintf("%#x", bt.Address)
+			}
+		}
+	}
+	return max, sym
+}
+
+func matchSymbol(symbol string, symbols []string) string {
+	if len(symbol) == 0 {
+		return ""
+	}
+	for _, s := range symbols {
+		if strings.Contains(symbol, s) {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,274 @@
+package crashlog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestESR(t *testing.T) {
+	tests := []struct {
+		name       string
+		esr        ESR
+		class      uint64
+		str        string
+		write      bool
+		size       int
+		permission bool
+	}{
+		{"doubleword write translation fault", 0x93c00047, ExcClassDataAbortLower, "(Data Abort) doubleword write Translation fault", true, 8, false},
+		{"read permission fault", 0x9200000f, ExcClassDataAbortLower, "(Data Abort) read Permission fault", false, 0, true},
+		{"byte read access flag fault", 0x9600000b, ExcClassDataAbort, "(Data Abort) read Access Flag fault", false, 0, false},
+		{"word write with ISV", 0x93800046, ExcClassDataAbortLower, "(Data Abort) word write Translation fault", true, 4, false},
+		{"alignment fault", 0x92000021, ExcClassDataAbortLower, "(Data Abort) read Alignment fault", false, 0, false},
+		{"instruction abort", 0x82000005, ExcClassInstrAbortLower, "(Instruction Abort) Translation fault", false, 0, false},
+		{"pointer authentication failure", 0x72000002, ExcClassFPAC, "(Pointer Authentication Failure)", false, 0, false},
+		{"brk", 0xf200c471, ExcClassBRK, "(BRK)", false, 0, false},
+		{"unknown class", 0xfe000000, 0x3f, "(EC 0x3f)", false, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.esr.ExceptionClass(); got != tt.class {
+				t.Errorf("ExceptionClass() = %#x, want %#x", got, tt.class)
+			}
+			if got := tt.esr.String(); got != tt.str {
+				t.Errorf("String() = %q, want %q", got, tt.str)
+			}
+			if got := tt.esr.IsWrite(); got != tt.write {
+				t.Errorf("IsWrite() = %v, want %v", got, tt.write)
+			}
+			if got := tt.esr.AccessSize(); got != tt.size {
+				t.Errorf("AccessSize() = %d, want %d", got, tt.size)
+			}
+			if got := tt.esr.IsPermissionFault(); got != tt.permission {
+				t.Errorf("IsPermissionFault() = %v, want %v", got, tt.permission)
+			}
+		})
+	}
+
+	if esr := ESR(0xf200c471); esr.Syndrome() != 0xc471 {
+		t.Errorf("Syndrome() = %#x, want 0xc471", esr.Syndrome())
+	}
+	if !ESR(0x72000002).IsPACFailure() || ESR(0x92000047).IsPACFailure() {
+		t.Error("IsPACFailure() only matches the FPAC exception class")
+	}
+	if !ESR(0x82000005).IsTranslationFault() || ESR(0x9200000f).IsTranslationFault() {
+		t.Error("IsTranslationFault() only matches translation faults")
+	}
+}
+
+func TestIsPoisoned(t *testing.T) {
+	tests := []struct {
+		addr uint64
+		want bool
+	}{
+		{0xdeadbeef, true},
+		{0xbaddc0de, true},
+		{0xdeadbeefdeadbeef, true},
+		{0xaaaaaaaaaaaaaaaa, true},
+		{0x5555555555555555, true},
+		{0x55555555, true},
+		{0x5555, false},
+		{0xaaaa, false},
+		{0x100ba4000, false},
+		{0x1bad, false},
+		{0, false},
+	}
+	for _, tt := range tests {
+		if got := isPoisoned(tt.addr); got != tt.want {
+			t.Errorf("isPoisoned(%#x) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestFaultAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		crash  CrashLog
+		regs   state
+		want   uint64
+		wantOK bool
+	}{
+		{"far", CrashLog{ExceptionType: "EXC_BAD_ACCESS (SIGSEGV)"}, state{"far": 0x41414141}, 0x41414141, true},
+		{"subtype", CrashLog{ExceptionType: "EXC_BAD_ACCESS (SIGSEGV)", ExceptionSubtype: []string{"KERN_INVALID_ADDRESS at 0x0000000000000010"}}, state{}, 0x10, true},
+		{"codes", CrashLog{ExceptionType: "EXC_BAD_ACCESS (SIGBUS)", ExceptionCodes: "0x0000000000000001, 0x0000000000000020"}, nil, 0x20, true},
+		{"zero far", CrashLog{ExceptionType: "EXC_BAD_ACCESS (SIGSEGV)", ExceptionSubtype: []string{"KERN_PROTECTION_FAILURE at 0x0000000100ba4000"}}, state{"far": 0}, 0x100ba4000, true},
+		{"codes of another exception", CrashLog{ExceptionType: "EXC_CRASH (SIGABRT)", ExceptionCodes: "0x0000000000000000, 0x0000000000000000"}, nil, 0, false},
+		{"none", CrashLog{ExceptionType: "EXC_BAD_ACCESS (SIGSEGV)"}, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.crash.faultAddress(tt.regs)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("faultAddress() = %#x, %v; want %#x, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// testExploitCrash returns a crash log with a single crashed thread in an app image
+func testExploitCrash(excType string, regs state, frames ...backtrace) *CrashLog {
+	c := &CrashLog{
+		ExceptionType: excType,
+		Images: []image{
+			{Name: "Test", Start: 0x100ba0000, End: 0x100c3ffff},
+			{Name: "libsystem_malloc.dylib", Start: 0x1a0c00000, End: 0x1a0c3ffff},
+		},
+	}
+	base := state{"pc": 0x100ba4000, "lr": 0x100ba4100, "sp": 0x16f6a3f20}
+	for reg, val := range regs {
+		base[reg] = val
+	}
+	c.Threads = []thread{{State: base, BackTrace: frames}}
+	return c
+}
+
+func TestExploitability(t *testing.T) {
+	malloc := &image{Name: "libsystem_malloc.dylib", Start: 0x1a0c00000, End: 0x1a0c3ffff}
+	var recursive []backtrace
+	for i := 0; i < recursionDepth+8; i++ {
+		recursive = append(recursive, backtrace{FrameNum: i, Address: 0x100ba4010, Symbol: "walk"})
+	}
+
+	tests := []struct {
+		name   string
+		crash  *CrashLog
+		want   Rating
+		reason string
+	}{
+		{
+			"pac brk",
+			testExploitCrash("EXC_BREAKPOINT (SIGTRAP)", state{"esr": 0xf200c471}),
+			Exploitable, "pointer authentication failure",
+		},
+		{
+			"fpac",
+			testExploitCrash("EXC_BAD_ACCESS (SIGBUS)", state{"esr": 0x72000002}),
+			Exploitable, "ESR exception class FPAC",
+		},
+		{
+			"null dereference",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"esr": 0x92000006, "far": 0x10}),
+			ProbablyNotExploitable, "NULL pointer dereference",
+		},
+		{
+			"write to unmapped address",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"esr": 0x92000047, "far": 0x123456780, "x8": 0x123456700}),
+			Exploitable, "write to invalid address 0x123456780 (derived from x8 = 0x123456700)",
+		},
+		{
+			"write to read-only page",
+			testExploitCrash("EXC_BAD_ACCESS (SIGBUS)", state{"esr": 0x9200004f, "far": 0x100ba4000}),
+			ProbablyExploitable, "write of 0x100ba4000 violates the page protections",
+		},
+		{
+			"write to non-canonical address",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"esr": 0x92000047, "far": 0x4141414141414141}),
+			Exploitable, "write to non-canonical address",
+		},
+		{
+			"read of non-canonical address",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"esr": 0x92000007, "far": 0x4141414141414141}),
+			ProbablyExploitable, "read of non-canonical address",
+		},
+		{
+			"read of poisoned address",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"esr": 0x92000007, "far": 0xdeadbeef}),
+			Exploitable, "poison/scribble pattern (use-after-free)",
+		},
+		{
+			"stack guard",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"esr": 0x92000047, "far": 0x16f6a3e00}),
+			ProbablyNotExploitable, "stack overflow into the guard page",
+		},
+		{
+			"wild pc",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"pc": 0x41414140}),
+			Exploitable, "pc 0x41414140 is not in any loaded image",
+		},
+		{
+			"near null pc",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"pc": 0x8}),
+			ProbablyExploitable, "pc 0x8 is near NULL",
+		},
+		{
+			"poisoned lr",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"lr": 0xaaaaaaaaaaaaaaaa}),
+			Exploitable, "lr 0xaaaaaaaaaaaaaaaa is a poison/scribble pattern",
+		},
+		{
+			"signed poisoned lr",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"lr": 0x1b2f0000deadbeef}),
+			Exploitable, "lr 0xdeadbeef is a poison/scribble pattern",
+		},
+		{
+			"wild lr",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"lr": 0x3c2f000041414140}),
+			ProbablyExploitable, "lr 0x41414140 is not in any loaded image",
+		},
+		{
+			"malloc corruption",
+			testExploitCrash("EXC_CRASH (SIGABRT)", nil,
+				backtrace{Image: malloc, Symbol: "__pthread_kill"},
+				backtrace{Image: malloc, Symbol: "malloc_zone_error"}),
+			Exploitable, "libmalloc detected heap corruption in frame 1",
+		},
+		{
+			"unsymbolicated malloc abort",
+			testExploitCrash("EXC_CRASH (SIGABRT)", nil, backtrace{Image: malloc, Address: 0x1a0c01000}),
+			ProbablyExploitable, "abort from libsystem_malloc.dylib",
+		},
+		{
+			"stack check",
+			testExploitCrash("EXC_CRASH (SIGABRT)", nil, backtrace{Symbol: "__stack_chk_fail"}),
+			Exploitable, "buffer overflow check failed",
+		},
+		{
+			"abort",
+			testExploitCrash("EXC_CRASH (SIGABRT)", nil),
+			ProbablyNotExploitable, "abort()",
+		},
+		{
+			"recursion",
+			testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", nil, recursive...),
+			ProbablyNotExploitable, "walk repeats 40 times",
+		},
+		{
+			"resource limit",
+			testExploitCrash("EXC_RESOURCE (SIGKILL)", nil),
+			NotExploitable, "resource limit",
+		},
+		{
+			"nothing matched",
+			testExploitCrash("EXC_GUARD (SIGKILL)", nil),
+			Unknown, "no heuristics matched EXC_GUARD (SIGKILL)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.crash.Exploitability()
+			if e.Rating != tt.want {
+				t.Errorf("Rating = %s, want %s\n%s", e.Rating, tt.want, e)
+			}
+			found := false
+			for _, f := range e.Findings {
+				if strings.Contains(f.Reason, tt.reason) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("no finding contains %q\n%s", tt.reason, e)
+			}
+		})
+	}
+}
+
+func TestExploitabilityString(t *testing.T) {
+	e := testExploitCrash("EXC_BAD_ACCESS (SIGSEGV)", state{"esr": 0x92000006, "far": 0x10}).Exploitability()
+	want := "PROBABLY_NOT_EXPLOITABLE (EXC_BAD_ACCESS (SIGSEGV))\n" +
+		"    ESR:   0x92000006 (Data Abort) read Translation fault\n" +
+		"    Fault: 0x10\n" +
+		"    - [PROBABLY_NOT_EXPLOITABLE] read of 0x10 is a NULL pointer dereference\n"
+	if got := e.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,448 @@
+package crashlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ipsCrashBugType is the bug_type of a (userland) crash .ips report
+const ipsCrashBugType = "309"
+
+type ipsHeader struct {
+	AppName      string `json:"app_name,omitempty"`
+	Timestamp    string `json:"timestamp,omitempty"`
+	AppVersion   string `json:"app_version,omitempty"`
+	SliceUUID    string `json:"slice_uuid,omitempty"`
+	BuildVersion string `json:"build_version,omitempty"`
+	BundleID     string `json:"bundleID,omitempty"`
+	BugType      string `json:"bug_type,omitempty"`
+	OSVersion    string `json:"os_version,omitempty"`
+	IncidentID   string `json:"incident_id,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+type ipsRegister struct {
+	Value uint64 `json:"value"`
+}
+
+type ipsThreadState struct {
+	Flavor string        `json:"flavor,omitempty"`
+	X      []ipsRegister `json:"x,omitempty"`
+	FP     *ipsRegister  `json:"fp,omitempty"`
+	LR     *ipsRegister  `json:"lr,omitempty"`
+	SP     *ipsRegister  `json:"sp,omitempty"`
+	PC     *ipsRegister  `json:"pc,omitempty"`
+	CPSR   *ipsRegister  `json:"cpsr,omitempty"`
+	ESR    *ipsRegister  `json:"esr,omitempty"`
+	FAR    *ipsRegister  `json:"far,omitempty"`
+}
+
+type ipsFrame struct {
+	ImageIndex     int    `json:"imageIndex"`
+	ImageOffset    uint64 `json:"imageOffset"`
+	Symbol         string `json:"symbol,omitempty"`
+	SymbolLocation uint64 `json:"symbolLocation,omitempty"`
+	SourceFile     string `json:"sourceFile,omitempty"`
+	SourceLine     int    `json:"sourceLine,omitempty"`
+	Inline         bool   `json:"inline,omitempty"`
+}
+
+type ipsThread struct {
+	ID          uint64          `json:"id"`
+	Name        string          `json:"name,omitempty"`
+	Queue       string          `json:"queue,omitempty"`
+	Triggered   bool            `json:"triggered,omitempty"`
+	Frames      []ipsFrame      `json:"frames"`
+	ThreadState *ipsThreadState `json:"threadState,omitempty"`
+}
+
+type ipsImage struct {
+	Source string `json:"source,omitempty"`
+	Arch   string `json:"arch,omitempty"`
+	Base   uint64 `json:"base"`
+	Size   uint64 `json:"size"`
+	UUID   string `json:"uuid,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type ipsBody struct {
+	ModelCode string `json:"modelCode"`
+	OSVersion struct {
+		Train string `json:"train"`
+		Build string `json:"build"`
+	} `json:"osVersion"`
+	CaptureTime string `json:"captureTime"`
+	Incident    string `json:"incident"`
+	PID         int    `json:"pid"`
+	CPUType     string `json:"cpuType"`
+	ProcName    string `json:"procName"`
+	ProcPath    string `json:"procPath"`
+	BundleInfo  struct {
+		ID      string `json:"CFBundleIdentifier"`
+		Version string `json:"CFBundleShortVersionString"`
+		Build   string `json:"CFBundleVersion"`
+	} `json:"bundleInfo"`
+	ParentProc string `json:"parentProc"`
+	ParentPID  int    `json:"parentPid"`
+	Exception  struct {
+		Type    string `json:"type"`
+		Signal  string `json:"signal"`
+		Subtype string `json:"subtype"`
+		Codes   string `json:"codes"`
+	} `json:"exception"`
+	Termination struct {
+		Namespace string `json:"namespace"`
+		Code      uint64 `json:"code"`
+		Indicator string `json:"indicator"`
+		ByProc    string `json:"byProc"`
+		ByPID     int    `json:"byPid"`
+	} `json:"termination"`
+	FaultingThread int         `json:"faultingThread"`
+	Threads        []ipsThread `json:"threads"`
+	UsedImages     []ipsImage  `json:"usedImages"`
+}
+
+// ipsReport is the raw (two part) JSON of an .ips crash report kept around so it can be written back out
+type ipsReport struct {
+	header string
+	body   map[string]interface{}
+}
+
+// hasIPSHeader returns true if the crashlog lines start with an .ips JSON header line
+func hasIPSHeader(lines []string) bool {
+	return len(lines) > 1 && strings.HasPrefix(strings.TrimSpace(lines[0]), "{")
+}
+
+// isIPS returns true if the crashlog lines are a JSON .ips report (a JSON header line followed by a JSON body)
+// and not a legacy one (i.e. bug_type 109) where the header is followed by a text crashlog
+func isIPS(lines []string) bool {
+	if !hasIPSHeader(lines) {
+		return false
+	}
+	var hdr ipsHeader
+	if err := json.Unmarshal([]byte(lines[0]), &hdr); err == nil && hdr.BugType == ipsCrashBugType {
+		return true
+	}
+	for _, line := range lines[1:] {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			return strings.HasPrefix(line, "{")
+		}
+	}
+	return false
+}
+
+// parseIPS fills out the crashlog from the header and body of an .ips crash report
+func (c *CrashLog) parseIPS(header string, body []byte) error {
+	var hdr ipsHeader
+	if err := json.Unmarshal([]byte(header), &hdr); err != nil {
+		return fmt.Errorf("failed to parse .ips header: %v", err)
+	}
+	if hdr.BugType != ipsCrashBugType {
+		return fmt.Errorf("unsupported .ips bug_type %s (expected %s)", hdr.BugType, ipsCrashBugType)
+	}
+
+	var ips ipsBody
+	if err := json.Unmarshal(body, &ips); err != nil {
+		return fmt.Errorf("failed to parse .ips body: %v", err)
+	}
+
+	raw := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber() // preserve the 64-bit addresses when writing the report back out
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("failed to parse .ips body: %v", err)
+	}
+	c.ips = &ipsReport{header: strings.TrimSpace(header), body: raw}
+
+	c.BugType = hdr.BugType
+	c.Incident = ips.Incident
+	if len(c.Incident) == 0 {
+		c.Incident = hdr.IncidentID
+	}
+	c.DateTime = ips.CaptureTime
+	if len(c.DateTime) == 0 {
+		c.DateTime = hdr.Timestamp
+	}
+	c.HardwareModel = ips.ModelCode
+	// i.e. "iPhone OS 15.0"
+	if idx := strings.LastIndex(ips.OSVersion.Train, " "); idx > 0 {
+		c.OSName = ips.OSVersion.Train[:idx]
+		c.OSVersion = ips.OSVersion.Train[idx+1:]
+	} else {
+		c.OSVersion = ips.OSVersion.Train
+	}
+	c.OSBuild = ips.OSVersion.Build
+	c.Process = ips.ProcName
+	c.PID = ips.PID
+	c.ProcessPath = ips.ProcPath
+	c.Identifier = ips.BundleInfo.ID
+	if len(ips.BundleInfo.Version) > 0 {
+		c.Version = fmt.Sprintf("%s (%s)", ips.BundleInfo.Version, ips.BundleInfo.Build)
+	}
+	c.CodeType = ips.CPUType
+	if len(ips.ParentProc) > 0 {
+		c.ParentProcess = fmt.Sprintf("%s [%d]", ips.ParentProc, ips.ParentPID)
+	}
+
+	c.ExceptionType = ips.Exception.Type
+	if len(ips.Exception.Signal) > 0 {
+		c.ExceptionType += fmt.Sprintf(" (%s)", ips.Exception.Signal)
+	}
+	if len(ips.Exception.Subtype) > 0 {
+		c.ExceptionSubtype = append(c.ExceptionSubtype, ips.Exception.Subtype)
+	}
+	c.ExceptionCodes = ips.Exception.Codes
+	c.TerminationSignal = ips.Termination.Indicator
+	if len(ips.Termination.Namespace) > 0 {
+		c.TerminationReason = fmt.Sprintf("Namespace %s, Code %d", ips.Termination.Namespace, ips.Termination.Code)
+	}
+	if len(ips.Termination.ByProc) > 0 {
+		c.TerminatingProcess = fmt.Sprintf("%s [%d]", ips.Termination.ByProc, ips.Termination.ByPID)
+	}
+	c.CrashedThread = ips.FaultingThread
+
+	for _, img := range ips.UsedImages {
+		name := img.Name
+		if len(name) == 0 && len(img.Path) > 0 {
+			name = img.Path[strings.LastIndex(img.Path, "/")+1:]
+		}
+		end := img.Base
+		if img.Size > 0 {
+			end = img.Base + img.Size - 1
+		}
+		c.Images = append(c.Images, image{
+			Name:  name,
+			Start: img.Base,
+			End:   end,
+			Arch:  img.Arch,
+			UUID:  img.UUID,
+			Path:  img.Path,
+		})
+	}
+
+	for tidx, t := range ips.Threads {
+		th := thread{Number: tidx, Name: t.Name}
+		if len(t.Queue) > 0 {
+			th.Name = "Dispatch queue: " + t.Queue
+		}
+		if t.Triggered {
+			c.CrashedThread = tidx
+		}
+		var inlined []SourceLine
+		for fidx, frame := range t.Frames {
+			if frame.ImageIndex < 0 || frame.ImageIndex >= len(c.Images) {
+				return fmt.Errorf("thread %d frame %d has invalid image index %d", tidx, fidx, frame.ImageIndex)
+			}
+			if frame.Inline { // inlined frames precede the frame they were inlined into
+				inlined = append(inlined, SourceLine{Function: frame.Symbol, File: frame.SourceFile, Line: frame.SourceLine})
+				continue
+			}
+			img := &c.Images[frame.ImageIndex]
+			bt := backtrace{
+				FrameNum:     len(th.BackTrace),
+				Image:        img,
+				Address:      img.Start + frame.ImageOffset,
+				LibAddr:      img.Start,
+				Offset:       int(frame.ImageOffset),
+				Symbol:       frame.Symbol,
+				SymbolOffset: frame.SymbolLocation,
+				Inlined:      inlined,
+			}
+			if len(frame.SourceFile) > 0 {
+				bt.Source = &SourceLine{Function: frame.Symbol, File: frame.SourceFile, Line: frame.SourceLine}
+			}
+			th.BackTrace = append(th.BackTrace, bt)
+			inlined = nil
+		}
+		if ts := t.ThreadState; ts != nil {
+			th.State = make(state)
+			for i, x := range ts.X {
+				th.State[fmt.Sprintf("x%d", i)] = x.Value
+			}
+			for reg, val := range map[string]*ipsRegister{
+				"fp": ts.FP, "lr": ts.LR, "sp": ts.SP, "pc": ts.PC, "cpsr": ts.CPSR, "esr": ts.ESR, "far": ts.FAR,
+			} {
+				if val != nil {
+					th.State[reg] = val.Value
+				}
+			}
+		}
+		c.Threads = append(c.Threads, th)
+	}
+
+	if c.CrashedThread >= len(c.Threads) {
+		return fmt.Errorf("faulting thread %d not in report (%d threads)", c.CrashedThread, len(c.Threads))
+	}
+
+	return nil
+}
+
+// IsIPS returns true if the crashlog was parsed from an .ips report
+func (c *CrashLog) IsIPS() bool {
+	return c.ips != nil
+}
+
+// WriteIPS writes the crashlog back out as an .ips report with the frames' symbols filled in
+func (c *CrashLog) WriteIPS(w io.Writer) error {
+	if c.ips == nil {
+		return fmt.Errorf("crashlog was not parsed from an .ips report")
+	}
+
+	if threads, ok := c.ips.body["threads"].([]interface{}); ok {
+		for tidx, t := range threads {
+			if tidx >= len(c.Threads) {
+				break
+			}
+			th, ok := t.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			frames, ok := th["frames"].([]interface{})
+			if !ok {
+				continue
+			}
+			var out []interface{}
+			fidx := 0
+			for _, f := range frames {
+				frame, ok := f.(map[string]interface{})
+				if !ok {
+					out = append(out, f)
+					continue
+				}
+				if inline, _ := frame["inline"].(bool); inline {
+					continue // re-added from the backtrace below
+				}
+				if fidx >= len(c.Threads[tidx].BackTrace) {
+					out = append(out, frame)
+					continue
+				}
+				bt := c.Threads[tidx].BackTrace[fidx]
+				fidx++
+				for _, inl := range bt.Inlined {
+					inlined := make(map[string]interface{})
+					for k, v := range frame {
+						inlined[k] = v
+					}
+					inlined["symbol"] = inl.Function
+					inlined["symbolLocation"] = 0
+					inlined["inline"] = true
+					if len(inl.File) > 0 {
+						inlined["sourceFile"] = filepath.Base(inl.File)
+						inlined["sourceLine"] = inl.Line
+					}
+					out = append(out, inlined)
+				}
+				if len(bt.Symbol) > 0 {
+					frame["symbol"] = bt.Symbol
+					frame["symbolLocation"] = bt.SymbolOffset
+				}
+				if bt.Source != nil && len(bt.Source.File) > 0 {
+					frame["sourceFile"] = filepath.Base(bt.Source.File)
+					frame["sourceLine"] = bt.Source.Line
+				}
+				out = append(out, frame)
+			}
+			th["frames"] = out
+		}
+	}
+
+	if _, err := fmt.Fprintln(w, c.ips.header); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(c.ips.body)
+}
+
+// WriteText writes the crashlog out as a classic (report version 104) text crash report
+func (c *CrashLog) WriteText(w io.Writer) error {
+	var sb strings.Builder
+
+	field := func(name, value string) {
+		if len(value) > 0 {
+			fmt.Fprintf(&sb, "%-21s%s\n", name+":", value)
+		}
+	}
+
+	field("Incident Identifier", c.Incident)
+	field("Hardware Model", c.HardwareModel)
+	fmt.Fprintf(&sb, "%-21s%s [%d]\n", "Process:", c.Process, c.PID)
+	field("Path", c.ProcessPath)
+	field("Identifier", c.Identifier)
+	field("Version", c.Version)
+	field("Code Type", c.CodeType)
+	field("Parent Process", c.ParentProcess)
+	sb.WriteString("\n")
+	field("Date/Time", c.DateTime)
+	osName := c.OSName
+	if len(osName) == 0 {
+		osName = "iPhone OS"
+	}
+	fmt.Fprintf(&sb, "%-21s%s %s (%s)\n", "OS Version:", osName, c.OSVersion, c.OSBuild)
+	fmt.Fprintf(&sb, "%-21s%d\n\n", "Report Version:", 104)
+
+	fmt.Fprintf(&sb, "Exception Type:  %s\n", c.ExceptionType)
+	if len(c.ExceptionSubtype) > 0 {
+		fmt.Fprintf(&sb, "Exception Subtype: %s\n", strings.Join(c.ExceptionSubtype, "\n"))
+	}
+	if len(c.ExceptionCodes) > 0 {
+		fmt.Fprintf(&sb, "Exception Codes: %s\n", c.ExceptionCodes)
+	}
+	if len(c.TerminationSignal) > 0 {
+		fmt.Fprintf(&sb, "Termination Signal: %s\n", c.TerminationSignal)
+	}
+	if len(c.TerminationReason) > 0 {
+		fmt.Fprintf(&sb, "Termination Reason: %s\n", c.TerminationReason)
+	}
+	if len(c.TerminatingProcess) > 0 {
+		fmt.Fprintf(&sb, "Terminating Process: %s\n", c.TerminatingProcess)
+	}
+	fmt.Fprintf(&sb, "\nTriggered by Thread:  %d\n\n", c.CrashedThread)
+
+	for _, t := range c.Threads {
+		if len(t.Name) > 0 {
+			fmt.Fprintf(&sb, "Thread %d name:  %s\n", t.Number, t.Name)
+		}
+		if t.Number == c.CrashedThread {
+			fmt.Fprintf(&sb, "Thread %d Crashed:\n", t.Number)
+		} else {
+			fmt.Fprintf(&sb, "Thread %d:\n", t.Number)
+		}
+		for _, bt := range t.BackTrace {
+			for _, inl := range bt.Inlined {
+				fmt.Fprintf(&sb, "%-4d%-30s\t0x%016x %s [inlined]\n", bt.FrameNum, bt.Image.Name, bt.Address, inl)
+			}
+			location := fmt.Sprintf("%#x + %d", bt.LibAddr, bt.Offset)
+			if len(bt.Symbol) > 0 || bt.Source != nil {
+				location = bt.SymbolString()
+			}
+			fmt.Fprintf(&sb, "%-4d%-30s\t0x%016x %s\n", bt.FrameNum, bt.Image.Name, bt.Address, location)
+		}
+		sb.WriteString("\n")
+	}
+
+	if c.CrashedThread < len(c.Threads) && c.Threads[c.CrashedThread].State != nil {
+		fmt.Fprintf(&sb, "Thread %d crashed with ARM Thread State (64-bit):\n%s\n", c.CrashedThread, c.Threads[c.CrashedThread].State)
+	}
+
+	sb.WriteString("Binary Images:\n")
+	for _, img := range c.Images {
+		if len(img.Path) == 0 {
+			continue
+		}
+		uuid := strings.ToLower(strings.ReplaceAll(img.UUID, "-", ""))
+		fmt.Fprintf(&sb, "%#x - %#x %s %s  <%s> %s\n", img.Start, img.End, img.Name, img.Arch, uuid, img.Path)
+	}
+	sb.WriteString("\nEOF\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
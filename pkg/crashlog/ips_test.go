@@ -0,0 +1,179 @@
+package crashlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testLegacyIPS is a bug_type 109 report (a JSON header followed by a text crashlog)
+const testLegacyIPS = `{"app_name":"MobileSafari","timestamp":"2021-08-01 10:00:00.00 -0700","app_version":"14.1.2","slice_uuid":"01234567-89ab-cdef-0123-456789abcdef","bug_type":"109","os_version":"iPhone OS 14.7 (18G69)","incident_id":"11111111-2222-3333-4444-555555555555","name":"MobileSafari"}
+Incident Identifier: 11111111-2222-3333-4444-555555555555
+Hardware Model:      iPhone12,1
+Process:             MobileSafari [1234]
+Path:                /Applications/MobileSafari.app/MobileSafari
+Identifier:          com.apple.mobilesafari
+Version:             14.1.2 (8611.3.10.1.3)
+Code Type:           ARM-64 (Native)
+Parent Process:      launchd [1]
+
+Date/Time:           2021-08-01 10:00:00.0000 -0700
+OS Version:          iPhone OS 14.7 (18G69)
+Release Type:        User
+Report Version:      104
+
+Exception Type:  EXC_BAD_ACCESS (SIGSEGV)
+Exception Subtype: KERN_INVALID_ADDRESS at 0x0000000000000010
+Termination Signal: Segmentation fault: 11
+Termination Reason: Namespace SIGNAL, Code 0xb
+Terminating Process: exc handler [1234]
+Triggered by Thread:  0
+
+Thread 0 name:  Dispatch queue: com.apple.main-thread
+Thread 0 Crashed:
+0   MobileSafari 	0x0000000100ba4000 0x100ba0000 + 16384
+1   libdyld.dylib 	0x00000001a0c1d568 0x1a0c1c000 + 5480
+
+Thread 0 crashed with ARM Thread State (64-bit):
+    x0: 0x0000000000000000   x1: 0x0000000000000010
+    fp: 0x000000016f6a3f30   lr: 0x00000001a0c1d568
+    sp: 0x000000016f6a3f20   pc: 0x0000000100ba4000 cpsr: 0x60000000
+
+Binary Images:
+0x100ba0000 - 0x100c3ffff MobileSafari arm64  <0123456789abcdef0123456789abcdef> /Applications/MobileSafari.app/MobileSafari
+0x1a0c1c000 - 0x1a0c1ffff libdyld.dylib arm64e  <fedcba9876543210fedcba9876543210> /usr/lib/system/libdyld.dylib
+
+EOF
+`
+
+// testIPS is a bug_type 309 report (a JSON header followed by a JSON body)
+const testIPS = `{"app_name":"MobileSafari","timestamp":"2021-10-01 10:00:00.00 -0700","app_version":"15.0","bug_type":"309","os_version":"iPhone OS 15.0 (19A346)","incident_id":"66666666-7777-8888-9999-AAAAAAAAAAAA","name":"MobileSafari"}
+{
+  "modelCode" : "iPhone13,2",
+  "osVersion" : {"train" : "iPhone OS 15.0", "build" : "19A346"},
+  "captureTime" : "2021-10-01 10:00:00.0000 -0700",
+  "incident" : "66666666-7777-8888-9999-AAAAAAAAAAAA",
+  "pid" : 4321,
+  "cpuType" : "ARM-64",
+  "procName" : "MobileSafari",
+  "procPath" : "/Applications/MobileSafari.app/MobileSafari",
+  "bundleInfo" : {"CFBundleIdentifier" : "com.apple.mobilesafari", "CFBundleShortVersionString" : "15.0", "CFBundleVersion" : "8612.1.15"},
+  "exception" : {"type" : "EXC_BAD_ACCESS", "signal" : "SIGSEGV", "subtype" : "KERN_INVALID_ADDRESS at 0x0000000000000010"},
+  "faultingThread" : 1,
+  "threads" : [
+    {"id" : 100, "queue" : "com.apple.main-thread", "frames" : [{"imageIndex" : 1, "imageOffset" : 5480}]},
+    {"id" : 101, "triggered" : true, "frames" : [
+      {"imageIndex" : 0, "imageOffset" : 16000, "symbol" : "inlined", "sourceFile" : "a.c", "sourceLine" : 1, "inline" : true},
+      {"imageIndex" : 0, "imageOffset" : 16384, "symbol" : "main", "symbolLocation" : 12},
+      {"imageIndex" : 1, "imageOffset" : 5480, "symbol" : "start", "symbolLocation" : 4}
+    ],
+    "threadState" : {"flavor" : "ARM_THREAD_STATE64", "x" : [{"value" : 0}, {"value" : 16}], "pc" : {"value" : 4357505024}, "far" : {"value" : 16}}}
+  ],
+  "usedImages" : [
+    {"source" : "P", "arch" : "arm64", "base" : 4357488640, "size" : 655360, "uuid" : "01234567-89ab-cdef-0123-456789abcdef", "path" : "/Applications/MobileSafari.app/MobileSafari", "name" : "MobileSafari"},
+    {"source" : "P", "arch" : "arm64e", "base" : 6986776576, "size" : 16384, "uuid" : "fedcba98-7654-3210-fedc-ba9876543210", "path" : "/usr/lib/system/libdyld.dylib"}
+  ]
+}
+`
+
+func openTestCrashLog(t *testing.T, data string) *CrashLog {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "test.ips")
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	crash, err := Open(name)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { crash.Close() })
+	return crash
+}
+
+func TestOpenLegacyIPS(t *testing.T) {
+	crash := openTestCrashLog(t, testLegacyIPS)
+
+	if crash.IsIPS() {
+		t.Error("legacy .ips report parsed as a JSON .ips report")
+	}
+	if crash.BugType != "109" || crash.ReportVersion != 104 {
+		t.Errorf("bug_type = %s, report version = %d", crash.BugType, crash.ReportVersion)
+	}
+	if crash.Process != "MobileSafari" || crash.PID != 1234 || crash.HardwareModel != "iPhone12,1" {
+		t.Errorf("process = %s [%d] on %s", crash.Process, crash.PID, crash.HardwareModel)
+	}
+	if crash.OSVersion != "14.7" || crash.OSBuild != "18G69" {
+		t.Errorf("os = %s (%s)", crash.OSVersion, crash.OSBuild)
+	}
+	if len(crash.Images) != 2 {
+		t.Fatalf("got %d images, want 2", len(crash.Images))
+	}
+	if len(crash.Threads) != 1 || len(crash.Threads[0].BackTrace) != 2 {
+		t.Fatalf("threads = %v", crash.Threads)
+	}
+	if bt := crash.Threads[0].BackTrace[1]; bt.Address != 0x1a0c1d568 || bt.Offset != 5480 || bt.Image != &crash.Images[1] {
+		t.Errorf("frame 1 = %#x + %d in %v", bt.Address, bt.Offset, bt.Image)
+	}
+	if pc := crash.Threads[0].State["pc"]; pc != 0x100ba4000 {
+		t.Errorf("pc = %#x, want 0x100ba4000", pc)
+	}
+}
+
+func TestOpenIPS(t *testing.T) {
+	crash := openTestCrashLog(t, testIPS)
+
+	if !crash.IsIPS() {
+		t.Error("JSON .ips report not parsed as an .ips report")
+	}
+	if crash.BugType != "309" || crash.Incident != "66666666-7777-8888-9999-AAAAAAAAAAAA" {
+		t.Errorf("bug_type = %s, incident = %s", crash.BugType, crash.Incident)
+	}
+	if crash.OSName != "iPhone OS" || crash.OSVersion != "15.0" || crash.OSBuild != "19A346" {
+		t.Errorf("os = %s %s (%s)", crash.OSName, crash.OSVersion, crash.OSBuild)
+	}
+	if crash.Identifier != "com.apple.mobilesafari" || crash.Version != "15.0 (8612.1.15)" {
+		t.Errorf("bundle = %s %s", crash.Identifier, crash.Version)
+	}
+	if crash.ExceptionType != "EXC_BAD_ACCESS (SIGSEGV)" {
+		t.Errorf("exception type = %s", crash.ExceptionType)
+	}
+	if len(crash.Images) != 2 || crash.Images[1].Name != "libdyld.dylib" || crash.Images[1].End != 6986776576+16384-1 {
+		t.Fatalf("images = %v", crash.Images)
+	}
+	if crash.CrashedThread != 1 || len(crash.Threads) != 2 || crash.Threads[0].Name != "Dispatch queue: com.apple.main-thread" {
+		t.Fatalf("crashed thread %d of %v", crash.CrashedThread, crash.Threads)
+	}
+
+	bts := crash.Threads[1].BackTrace
+	if len(bts) != 2 {
+		t.Fatalf("got %d frames, want 2 (the inlined frame folds into the next)", len(bts))
+	}
+	if bts[0].Symbol != "main" || bts[0].SymbolOffset != 12 || bts[0].Address != 4357488640+16384 || len(bts[0].Inlined) != 1 {
+		t.Errorf("frame 0 = %v", bts[0])
+	}
+	if st := crash.Threads[1].State; st["x1"] != 16 || st["pc"] != 4357505024 || st["far"] != 16 {
+		t.Errorf("thread state = %v", st)
+	}
+}
+
+func TestIsIPS(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  bool
+	}{
+		{"309", []string{`{"bug_type":"309"}`, `{`}, true},
+		{"309 text body", []string{`{"bug_type":"309"}`, `Process: foo [1]`}, true},
+		{"json body", []string{`{"bug_type":"288"}`, ``, `{`}, true},
+		{"109", []string{`{"bug_type":"109"}`, `Incident Identifier: 1`}, false},
+		{"text", []string{`Incident Identifier: 1`, `{`}, false},
+		{"header only", []string{`{"bug_type":"109"}`}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIPS(tt.lines); got != tt.want {
+				t.Errorf("isIPS() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package crashlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// KernelSymbolicator resolves (unslid) kernelcache addresses
+type KernelSymbolicator interface {
+	Owner(addr uint64) string
+	Symbolicate(addr uint64) string
+}
+
+// KernelPanic is a parsed kernel panic log (panic-full-*.ips)
+type KernelPanic struct {
+	BugType   string `json:"bug_type,omitempty"`
+	OSVersion string `json:"os_version,omitempty"`
+	Build     string `json:"build,omitempty"`
+	Product   string `json:"product,omitempty"`
+	Kernel    string `json:"kernel,omitempty"`
+	Incident  string `json:"incident,omitempty"`
+	Date      string `json:"date,omitempty"`
+
+	PanicString string `json:"panic_string"`
+	OtherString string `json:"other_string,omitempty"`
+
+	PanicCPU    int    `json:"panic_cpu"`
+	PanicCaller uint64 `json:"panic_caller,omitempty"`
+	PanicTask   string `json:"panic_task,omitempty"`
+
+	KernelUUID          string `json:"kernel_uuid,omitempty"`
+	KernelCacheUUID     string `json:"kernelcache_uuid,omitempty"`
+	KernelSlide         uint64 `json:"kernel_slide"`
+	KernelTextBase      uint64 `json:"kernel_text_base,omitempty"`
+	KernelTextExecSlide uint64 `json:"kernel_text_exec_slide,omitempty"`
+	KernelTextExecBase  uint64 `json:"kernel_text_exec_base,omitempty"`
+
+	CPUs           []PanicCPU   `json:"cpus,omitempty"`
+	PanickedThread *PanicThread `json:"panicked_thread,omitempty"`
+	Kexts          []PanicKext  `json:"kexts,omitempty"`
+	LoadedKexts    []PanicKext  `json:"loaded_kexts,omitempty"`
+	Caller         *PanicFrame  `json:"caller,omitempty"`
+}
+
+// PanicCPU is the state of a CPU at the time of the panic
+type PanicCPU struct {
+	Num int        `json:"num"`
+	PC  PanicFrame `json:"pc"`
+	LR  PanicFrame `json:"lr"`
+	FP  uint64     `json:"fp"`
+}
+
+// PanicThread is the panicked thread and its backtrace
+type PanicThread struct {
+	Addr      uint64       `json:"addr"`
+	Backtrace uint64       `json:"backtrace,omitempty"`
+	TID       int          `json:"tid"`
+	Frames    []PanicFrame `json:"frames"`
+}
+
+// PanicFrame is a (slid) kernel address from the panic log
+type PanicFrame struct {
+	Address uint64 `json:"address"`
+	FP      uint64 `json:"fp,omitempty"`
+	Unslid  uint64 `json:"unslid,omitempty"`
+	Kext    string `json:"kext,omitempty"`
+	Symbol  string `json:"symbol,omitempty"`
+}
+
+func (f PanicFrame) String() string {
+	var out string
+	if f.Unslid != 0 {
+		out = fmt.Sprintf("%#016x (%#016x)", f.Address, f.Unslid)
+	} else {
+		out = fmt.Sprintf("%#016x", f.Address)
+	}
+	if len(f.Kext) > 0 {
+		out += " " + f.Kext
+	}
+	if len(f.Symbol) > 0 {
+		out += ": " + f.Symbol
+	}
+	return out
+}
+
+// PanicKext is a kext listed in the panic log
+type PanicKext struct {
+	ID      string `json:"id"`
+	Version string `json:"version,omitempty"`
+	UUID    string `json:"uuid,omitempty"`
+	Start   uint64 `json:"start,omitempty"`
+	End     uint64 `json:"end,omitempty"`
+}
+
+var (
+	panicCallerRE    = regexp.MustCompile(`panic\(cpu (\d+) caller (0x[[:xdigit:]]+)\)`)
+	panicHexFieldRE  = regexp.MustCompile(`^\s*(Kernel slide|Kernel text base|Kernel text exec slide|Kernel text exec base):\s+(0x[[:xdigit:]]+)`)
+	panicUUIDFieldRE = regexp.MustCompile(`^\s*(Kernel UUID|KernelCache UUID):\s+([[:xdigit:]-]+)`)
+	panicTaskRE      = regexp.MustCompile(`^Panicked task (0x[[:xdigit:]]+): (.*)$`)
+	panicThreadRE    = regexp.MustCompile(`^Panicked thread: (0x[[:xdigit:]]+), backtrace: (0x[[:xdigit:]]+), tid: (\d+)`)
+	panicFrameRE     = regexp.MustCompile(`^\s+lr: (0x[[:xdigit:]]+)\s+fp: (0x[[:xdigit:]]+)`)
+	panicCoreRE      = regexp.MustCompile(`CORE (\d+): PC=(0x[[:xdigit:]]+), LR=(0x[[:xdigit:]]+), FP=(0x[[:xdigit:]]+)`)
+	panicKextRE      = regexp.MustCompile(`^\s+(?:dependency: )?([\w.\-]+)\(([^)]*)\)(?:\[([[:xdigit:]-]+)\])?@(0x[[:xdigit:]]+)->(0x[[:xdigit:]]+)`)
+	panicLoadedRE    = regexp.MustCompile(`^([\w.\-]+)\t(\S+)`)
+)
+
+// OpenKernelPanic opens and parses a kernel panic log
+func OpenKernelPanic(name string) (*KernelPanic, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKernelPanic(data)
+}
+
+// ParseKernelPanic parses a kernel panic log which is either a JSON header line followed by
+// a JSON body containing the panicString or a plain text panic
+func ParseKernelPanic(data []byte) (*KernelPanic, error) {
+	p := &KernelPanic{PanicCPU: -1}
+
+	body := data
+	if idx := bytes.IndexByte(data, '\n'); idx > 0 && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var header struct {
+			BugType   string `json:"bug_type"`
+			OSVersion string `json:"os_version"`
+		}
+		if err := json.Unmarshal(data[:idx], &header); err == nil {
+			p.BugType = header.BugType
+			p.OSVersion = header.OSVersion
+			body = data[idx+1:]
+		}
+	}
+
+	var report struct {
+		Build       string `json:"build"`
+		Product     string `json:"product"`
+		Kernel      string `json:"kernel"`
+		Incident    string `json:"incident"`
+		Date        string `json:"date"`
+		PanicString string `json:"panicString"`
+		OtherString string `json:"otherString"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(body), &report); err == nil && len(report.PanicString) > 0 {
+		p.Build = report.Build
+		p.Product = report.Product
+		p.Kernel = report.Kernel
+		p.Incident = report.Incident
+		p.Date = report.Date
+		p.PanicString = report.PanicString
+		p.OtherString = report.OtherString
+	} else {
+		p.PanicString = string(body)
+	}
+
+	if !strings.Contains(p.PanicString, "panic(") && !strings.Contains(p.PanicString, "Panicked") {
+		return nil, fmt.Errorf("not a kernel panic log")
+	}
+
+	if err := p.parsePanicString(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func parseHex(s string) uint64 {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	return v
+}
+
+func (p *KernelPanic) parsePanicString() error {
+	if m := panicCallerRE.FindStringSubmatch(p.PanicString); m != nil {
+		p.PanicCPU, _ = strconv.Atoi(m[1])
+		p.PanicCaller = parseHex(m[2])
+	}
+
+	const (
+		sectionNone = iota
+		sectionThread
+		sectionKexts
+		sectionLoaded
+	)
+	section := sectionNone
+
+	scanner := bufio.NewScanner(strings.NewReader(p.PanicString + "\n" + p.OtherString))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if m := panicHexFieldRE.FindStringSubmatch(line); m != nil {
+			switch m[1] {
+			case "Kernel slide":
+				p.KernelSlide = parseHex(m[2])
+			case "Kernel text base":
+				p.KernelTextBase = parseHex(m[2])
+			case "Kernel text exec slide":
+				p.KernelTextExecSlide = parseHex(m[2])
+			case "Kernel text exec base":
+				p.KernelTextExecBase = parseHex(m[2])
+			}
+			continue
+		}
+		if m := panicUUIDFieldRE.FindStringSubmatch(line); m != nil {
+			if m[1] == "Kernel UUID" {
+				p.KernelUUID = m[2]
+			} else {
+				p.KernelCacheUUID = m[2]
+			}
+			continue
+		}
+		if m := panicCoreRE.FindAllStringSubmatch(line, -1); m != nil {
+			for _, core := range m {
+				num, _ := strconv.Atoi(core[1])
+				p.CPUs = append(p.CPUs, PanicCPU{
+					Num: num,
+					PC:  PanicFrame{Address: parseHex(core[2])},
+					LR:  PanicFrame{Address: parseHex(core[3])},
+					FP:  parseHex(core[4]),
+				})
+			}
+			continue
+		}
+		if m := panicTaskRE.FindStringSubmatch(line); m != nil {
+			p.PanicTask = m[2]
+			continue
+		}
+		if m := panicThreadRE.FindStringSubmatch(line); m != nil {
+			tid, _ := strconv.Atoi(m[3])
+			p.PanickedThread = &PanicThread{
+				Addr:      parseHex(m[1]),
+				Backtrace: parseHex(m[2]),
+				TID:       tid,
+			}
+			section = sectionThread
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "Kernel Extensions in backtrace:"):
+			section = sectionKexts
+			continue
+		case strings.HasPrefix(trimmed, "loaded kexts:"):
+			section = sectionLoaded
+			continue
+		}
+
+		switch section {
+		case sectionThread:
+			if m := panicFrameRE.FindStringSubmatch(line); m != nil {
+				p.PanickedThread.Frames = append(p.PanickedThread.Frames, PanicFrame{
+					Address: parseHex(m[1]),
+					FP:      parseHex(m[2]),
+				})
+			} else if len(trimmed) > 0 {
+				section = sectionNone
+			}
+		case sectionKexts:
+			if m := panicKextRE.FindStringSubmatch(line); m != nil {
+				if p.hasKext(m[1]) {
+					continue
+				}
+				p.Kexts = append(p.Kexts, PanicKext{
+					ID:      m[1],
+					Version: m[2],
+					UUID:    m[3],
+					Start:   parseHex(m[4]),
+					End:     parseHex(m[5]),
+				})
+			} else if len(trimmed) > 0 {
+				section = sectionNone
+			}
+		case sectionLoaded:
+			if m := panicLoadedRE.FindStringSubmatch(line); m != nil {
+				p.LoadedKexts = append(p.LoadedKexts, PanicKext{ID: m[1], Version: m[2]})
+			} else if len(trimmed) == 0 {
+				section = sectionNone
+			}
+		}
+	}
+
+	if p.PanicCaller != 0 {
+		p.Caller = &PanicFrame{Address: p.PanicCaller}
+	}
+
+	return scanner.Err()
+}
+
+func (p *KernelPanic) hasKext(id string) bool {
+	for _, k := range p.Kexts {
+		if k.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Slide returns the kernel slide (falling back to the text exec slide)
+func (p *KernelPanic) Slide() uint64 {
+	if p.KernelSlide != 0 {
+		return p.KernelSlide
+	}
+	return p.KernelTextExecSlide
+}
+
+// frames returns all of the panic's addresses
+func (p *KernelPanic) frames() []*PanicFrame {
+	var frames []*PanicFrame
+	if p.Caller != nil {
+		frames = append(frames, p.Caller)
+	}
+	for i := range p.CPUs {
+		frames = append(frames, &p.CPUs[i].PC, &p.CPUs[i].LR)
+	}
+	if p.PanickedThread != nil {
+		for i := range p.PanickedThread.Frames {
+			frames = append(frames, &p.PanickedThread.Frames[i])
+		}
+	}
+	return frames
+}
+
+// Symbolicate unslides every frame and maps it to its kext and symbol in the kernelcache (frames
+// outside of the kernelcache are mapped to the kexts listed in the panic log)
+func (p *KernelPanic) Symbolicate(s KernelSymbolicator) {
+	slide := p.Slide()
+	for _, f := range p.frames() {
+		if f.Address == 0 {
+			continue
+		}
+		f.Unslid = f.Address - slide
+		if owner := s.Owner(f.Unslid); len(owner) > 0 {
+			f.Kext = owner
+			f.Symbol = s.Symbolicate(f.Unslid)
+			continue
+		}
+		f.Unslid = 0
+		for _, k := range p.Kexts {
+			if f.Address >= k.Start && f.Address <= k.End {
+				f.Kext = k.ID
+				f.Symbol = fmt.Sprintf("%s + %#x", k.ID, f.Address-k.Start)
+				break
+			}
+		}
+	}
+}
+
+func (p *KernelPanic) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Product:             %s\n", p.Product)
+	fmt.Fprintf(&sb, "OS Version:          %s\n", p.OSVersion)
+	fmt.Fprintf(&sb, "Build:               %s\n", p.Build)
+	fmt.Fprintf(&sb, "Kernel:              %s\n", p.Kernel)
+	if len(p.KernelCacheUUID) > 0 {
+		fmt.Fprintf(&sb, "KernelCache UUID:    %s\n", p.KernelCacheUUID)
+	}
+	fmt.Fprintf(&sb, "Kernel Slide:        %#x\n", p.KernelSlide)
+	if p.KernelTextExecBase != 0 {
+		fmt.Fprintf(&sb, "Kernel Text Exec:    %#x\n", p.KernelTextExecBase)
+	}
+	if len(p.PanicTask) > 0 {
+		fmt.Fprintf(&sb, "Panicked Task:       %s\n", p.PanicTask)
+	}
+
+	panicLine := p.PanicString
+	if idx := strings.IndexByte(panicLine, '\n'); idx > 0 {
+		panicLine = panicLine[:idx]
+	}
+	fmt.Fprintf(&sb, "\nPanic: %s\n", panicLine)
+	if p.Caller != nil {
+		fmt.Fprintf(&sb, "Caller (CPU %d): %s\n", p.PanicCPU, p.Caller)
+	}
+
+	if len(p.CPUs) > 0 {
+		fmt.Fprintf(&sb, "\nCPUs:\n")
+		for _, cpu := range p.CPUs {
+			fmt.Fprintf(&sb, "  CORE %d:\n", cpu.Num)
+			fmt.Fprintf(&sb, "    pc: %s\n", cpu.PC)
+			fmt.Fprintf(&sb, "    lr: %s\n", cpu.LR)
+		}
+	}
+
+	if p.PanickedThread != nil {
+		fmt.Fprintf(&sb, "\nPanicked Thread %#x (tid %d):\n", p.PanickedThread.Addr, p.PanickedThread.TID)
+		for i, f := range p.PanickedThread.Frames {
+			fmt.Fprintf(&sb, "  %2d: %s\n", i, f)
+		}
+	}
+
+	if len(p.Kexts) > 0 {
+		fmt.Fprintf(&sb, "\nKernel Extensions in backtrace:\n")
+		for _, k := range p.Kexts {
+			fmt.Fprintf(&sb, "  %s (%s) %#x->%#x\n", k.ID, k.Version, k.Start, k.End)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,183 @@
+package crashlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testPanicString is the panicString of a kernel data abort (kernel slide 0x8d44000)
+const testPanicString = `panic(cpu 1 caller 0xfffffff0109be0a0): Kernel data abort. at pc 0xfffffff01094e3e4, lr 0xfffffff0109be0a0 (saved state: 0xffffffe8046b2f70)
+	  x0: 0x0000000000000000  x1:  0xffffffe19e7a4000  x2:  0x0000000000000010  x3:  0x0000000000000000
+Debugger message: panic
+Memory ID: 0x6
+OS release type: User
+OS version: 18G69
+Kernel version: Darwin Kernel Version 20.6.0: Mon Jun 21 21:23:35 PDT 2021; root:xnu-7195.140.42~10/RELEASE_ARM64_T8030
+KernelCache UUID: 7A3B1B1D-8F3E-4A0F-9C5E-1D2E3F4A5B6C
+Kernel UUID: 1C4B5D6E-7F80-3912-A3B4-C5D6E7F80912
+iBoot version: iBoot-6723.140.2
+secure boot?: YES
+Paniclog version: 13
+Kernel slide:      0x0000000008d44000
+Kernel text base:  0xfffffff00fd48000
+mach_absolute_time: 0x1b2c3d4e5f
+CORE 0: PC=0xfffffff0109c1234, LR=0xfffffff0109c1200, FP=0xffffffe8040f3ef0
+CORE 1 is the one that panicked. Check the full backtrace for details.
+Panicked task 0xffffffe19a6e0000: 1234 pages, 12 threads: pid 345: MobileSafari
+Panicked thread: 0xffffffe19e7a4000, backtrace: 0xffffffe8046b2680, tid: 5678
+		  lr: 0xfffffff0109be0a0  fp: 0xffffffe8046b2700
+		  lr: 0xfffffff01094e3e4  fp: 0xffffffe8046b2760
+		  lr: 0xfffffff0140d1234  fp: 0xffffffe8046b27c0
+		  lr: 0xfffffff0109c1200  fp: 0x0000000000000000
+      Kernel Extensions in backtrace:
+         com.apple.driver.AppleTest(1.0)[3E5F7A9B-1C2D-3E4F-5A6B-7C8D9E0F1A2B]@0xfffffff0140d0000->0xfffffff0140fffff
+            dependency: com.apple.iokit.IOTest(2.1)[4F6A8B0C-2D3E-4F5A-6B7C-8D9E0F1A2B3C]@0xfffffff014100000->0xfffffff014107fff
+         com.apple.driver.AppleOther(3)[5A7B9C1D-3E4F-5A6B-7C8D-9E0F1A2B3C4D]@0xfffffff014200000->0xfffffff014203fff
+            dependency: com.apple.iokit.IOTest(2.1)[4F6A8B0C-2D3E-4F5A-6B7C-8D9E0F1A2B3C]@0xfffffff014100000->0xfffffff014107fff
+
+last started kext at 1234567: com.apple.driver.AppleOther	3 (addr 0xfffffff014200000, size 16384)
+loaded kexts:
+com.apple.driver.AppleTest	1.0
+com.apple.iokit.IOTest	2.1
+com.apple.driver.AppleOther	3
+`
+
+// testKernel symbolicates the (unslid) kernelcache range 0xfffffff007004000-0xfffffff009000000
+type testKernel map[uint64]string
+
+func (k testKernel) Owner(addr uint64) string {
+	if addr >= 0xfffffff007004000 && addr < 0xfffffff009000000 {
+		return "com.apple.kernel"
+	}
+	return ""
+}
+
+func (k testKernel) Symbolicate(addr uint64) string {
+	return k[addr]
+}
+
+func TestParseKernelPanic(t *testing.T) {
+	header := `{"bug_type":"210","timestamp":"2021-08-01 10:00:00.00 -0700","os_version":"iPhone OS 14.7 (18G69)","incident_id":"11111111-2222-3333-4444-555555555555"}`
+	body, err := json.Marshal(map[string]string{
+		"build":       "iPhone OS 14.7 (18G69)",
+		"product":     "iPhone12,1",
+		"kernel":      "Darwin Kernel Version 20.6.0",
+		"incident":    "11111111-2222-3333-4444-555555555555",
+		"date":        "2021-08-01 10:00:00.00 -0700",
+		"panicString": testPanicString,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data string
+		ips  bool
+	}{
+		{"ips", header + "\n" + string(body), true},
+		{"text", testPanicString, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseKernelPanic([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseKernelPanic() error = %v", err)
+			}
+			if tt.ips && (p.BugType != "210" || p.Product != "iPhone12,1" || p.OSVersion != "iPhone OS 14.7 (18G69)") {
+				t.Errorf("bug_type = %s, product = %s, os = %s", p.BugType, p.Product, p.OSVersion)
+			}
+
+			if p.PanicCPU != 1 || p.PanicCaller != 0xfffffff0109be0a0 {
+				t.Errorf("panic cpu %d caller %#x", p.PanicCPU, p.PanicCaller)
+			}
+			if p.KernelSlide != 0x8d44000 || p.Slide() != 0x8d44000 || p.KernelTextBase != 0xfffffff00fd48000 {
+				t.Errorf("kernel slide = %#x, text base = %#x", p.KernelSlide, p.KernelTextBase)
+			}
+			if p.KernelUUID != "1C4B5D6E-7F80-3912-A3B4-C5D6E7F80912" || p.KernelCacheUUID != "7A3B1B1D-8F3E-4A0F-9C5E-1D2E3F4A5B6C" {
+				t.Errorf("kernel uuid = %s, kernelcache uuid = %s", p.KernelUUID, p.KernelCacheUUID)
+			}
+			if p.PanicTask != "1234 pages, 12 threads: pid 345: MobileSafari" {
+				t.Errorf("panicked task = %s", p.PanicTask)
+			}
+			if len(p.CPUs) != 1 || p.CPUs[0].PC.Address != 0xfffffff0109c1234 || p.CPUs[0].LR.Address != 0xfffffff0109c1200 {
+				t.Errorf("cpus = %+v", p.CPUs)
+			}
+
+			th := p.PanickedThread
+			if th == nil {
+				t.Fatal("no panicked thread")
+			}
+			if th.Addr != 0xffffffe19e7a4000 || th.Backtrace != 0xffffffe8046b2680 || th.TID != 5678 {
+				t.Errorf("panicked thread = %#x, backtrace %#x, tid %d", th.Addr, th.Backtrace, th.TID)
+			}
+			wantFrames := []PanicFrame{
+				{Address: 0xfffffff0109be0a0, FP: 0xffffffe8046b2700},
+				{Address: 0xfffffff01094e3e4, FP: 0xffffffe8046b2760},
+				{Address: 0xfffffff0140d1234, FP: 0xffffffe8046b27c0},
+				{Address: 0xfffffff0109c1200},
+			}
+			if !reflect.DeepEqual(th.Frames, wantFrames) {
+				t.Errorf("frames = %+v, want %+v", th.Frames, wantFrames)
+			}
+
+			// dependencies shared by kexts in the backtrace are only listed once
+			wantKexts := []PanicKext{
+				{ID: "com.apple.driver.AppleTest", Version: "1.0", UUID: "3E5F7A9B-1C2D-3E4F-5A6B-7C8D9E0F1A2B", Start: 0xfffffff0140d0000, End: 0xfffffff0140fffff},
+				{ID: "com.apple.iokit.IOTest", Version: "2.1", UUID: "4F6A8B0C-2D3E-4F5A-6B7C-8D9E0F1A2B3C", Start: 0xfffffff014100000, End: 0xfffffff014107fff},
+				{ID: "com.apple.driver.AppleOther", Version: "3", UUID: "5A7B9C1D-3E4F-5A6B-7C8D-9E0F1A2B3C4D", Start: 0xfffffff014200000, End: 0xfffffff014203fff},
+			}
+			if !reflect.DeepEqual(p.Kexts, wantKexts) {
+				t.Errorf("kexts = %+v, want %+v", p.Kexts, wantKexts)
+			}
+			if len(p.LoadedKexts) != 3 || p.LoadedKexts[1] != (PanicKext{ID: "com.apple.iokit.IOTest", Version: "2.1"}) {
+				t.Errorf("loaded kexts = %+v", p.LoadedKexts)
+			}
+		})
+	}
+
+	if _, err := ParseKernelPanic([]byte(testLegacyIPS)); err == nil {
+		t.Error("ParseKernelPanic() of a crashlog should fail")
+	}
+}
+
+func TestKernelPanicSlide(t *testing.T) {
+	p := &KernelPanic{KernelTextExecSlide: 0x4000}
+	if got := p.Slide(); got != 0x4000 {
+		t.Errorf("Slide() = %#x, want the text exec slide 0x4000", got)
+	}
+}
+
+func TestKernelPanicSymbolicate(t *testing.T) {
+	p, err := ParseKernelPanic([]byte(testPanicString))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Symbolicate(testKernel{
+		0xfffffff007c7a0a0: "_panic_with_thread_kernel_state + 180",
+		0xfffffff007c0a3e4: "_ipc_kmsg_send + 84",
+		0xfffffff007c7d200: "_thread_exception_return",
+	})
+
+	for _, tt := range []struct {
+		name  string
+		frame PanicFrame
+		want  PanicFrame
+	}{
+		{"caller", *p.Caller, PanicFrame{Address: 0xfffffff0109be0a0, Unslid: 0xfffffff007c7a0a0, Kext: "com.apple.kernel", Symbol: "_panic_with_thread_kernel_state + 180"}},
+		{"cpu 0 pc", p.CPUs[0].PC, PanicFrame{Address: 0xfffffff0109c1234, Unslid: 0xfffffff007c7d234, Kext: "com.apple.kernel"}},
+		{"frame 1", p.PanickedThread.Frames[1], PanicFrame{Address: 0xfffffff01094e3e4, FP: 0xffffffe8046b2760, Unslid: 0xfffffff007c0a3e4, Kext: "com.apple.kernel", Symbol: "_ipc_kmsg_send + 84"}},
+		// addresses outside of the kernelcache are mapped to the panic's kexts (and aren't unslid)
+		{"frame 2", p.PanickedThread.Frames[2], PanicFrame{Address: 0xfffffff0140d1234, FP: 0xffffffe8046b27c0, Kext: "com.apple.driver.AppleTest", Symbol: "com.apple.driver.AppleTest + 0x1234"}},
+		{"frame 3", p.PanickedThread.Frames[3], PanicFrame{Address: 0xfffffff0109c1200, Unslid: 0xfffffff007c7d200, Kext: "com.apple.kernel", Symbol: "_thread_exception_return"}},
+	} {
+		if !reflect.DeepEqual(tt.frame, tt.want) {
+			t.Errorf("%s = %+v, want %+v", tt.name, tt.frame, tt.want)
+		}
+	}
+
+	if got, want := fmt.Sprint(p.PanickedThread.Frames[1]), "0xfffffff01094e3e4 (0xfffffff007c0a3e4) com.apple.kernel: _ipc_kmsg_send + 84"; got != want {
+		t.Errorf("frame String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,608 @@
+package crashlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+// ipsStackshotBugType is the bug_type of a stackshot .ips report (i.e. hang reports)
+const ipsStackshotBugType = "288"
+
+// SharedCacheImage is the name given to the dyld_shared_cache image of stackshot frames
+const SharedCacheImage = "dyld_shared_cache"
+
+var (
+	spinHeaderRE  = regexp.MustCompile(`^([A-Za-z][\w /]*?):\s+(.*)$`)
+	spinProcessRE = regexp.MustCompile(`^Process:\s+(.+?)\s+\[(\d+)\]`)
+	spinThreadRE  = regexp.MustCompile(`^\s+Thread\s+(0x[[:xdigit:]]+)(.*?)\s+(\d+)\s+samples?\s+\(`)
+	spinQueueRE   = regexp.MustCompile(`DispatchQueue\s+"([^"]*)"`)
+	spinNameRE    = regexp.MustCompile(`Thread name\s+"([^"]*)"`)
+	spinFrameRE   = regexp.MustCompile(`^(\s*)(\*?)(\d+)\s+(.*?)\s*(?:\((\S.*?) \+ (\d+)\))?\s+\[(0x[[:xdigit:]]+)\]`)
+	spinImageRE   = regexp.MustCompile(`^\s*(0x[[:xdigit:]]+)\s+-\s+(0x[[:xdigit:]]+|\?\?\?)\s+(\S+).*?<([[:xdigit:]-]+)>\s+(\S.*?)\s*$`)
+	spinSymbolRE  = regexp.MustCompile(`^(.+?) \+ (\d+)$`)
+)
+
+// SampleFrame is a node in a spindump/stackshot call tree
+type SampleFrame struct {
+	// Count is the number of samples the frame was in
+	Count        int            `json:"count"`
+	Symbol       string         `json:"symbol,omitempty"`
+	SymbolOffset uint64         `json:"symbol_offset,omitempty"`
+	ImageName    string         `json:"image,omitempty"`
+	ImageOffset  uint64         `json:"image_offset"`
+	Address      uint64         `json:"address"`
+	Kernel       bool           `json:"kernel,omitempty"`
+	Image        *image         `json:"-"`
+	Children     []*SampleFrame `json:"children,omitempty"`
+}
+
+// Label returns the frame as 'symbol + offset' (or 'image + offset' if it isn't symbolicated)
+func (f *SampleFrame) Label() string {
+	switch {
+	case len(f.Symbol) > 0 && f.SymbolOffset > 0:
+		return fmt.Sprintf("%s + %d", f.Symbol, f.SymbolOffset)
+	case len(f.Symbol) > 0:
+		return f.Symbol
+	case len(f.ImageName) > 0:
+		return fmt.Sprintf("%s + %d", f.ImageName, f.ImageOffset)
+	default:
+		return fmt.Sprintf("%#x", f.Address)
+	}
+}
+
+func (f *SampleFrame) String() string {
+	var kernel string
+	if f.Kernel {
+		kernel = "*"
+	}
+	sym := f.Symbol
+	if len(sym) == 0 {
+		sym = "???"
+	} else if f.SymbolOffset > 0 {
+		sym = fmt.Sprintf("%s + %d", sym, f.SymbolOffset)
+	}
+	return fmt.Sprintf("%s%d  %s (%s + %d) [%#x]", kernel, f.Count, sym, f.ImageName, f.ImageOffset, f.Address)
+}
+
+// SampleThread is a sampled thread and its call tree
+type SampleThread struct {
+	ID      string         `json:"id"`
+	Name    string         `json:"name,omitempty"`
+	Queue   string         `json:"queue,omitempty"`
+	Samples int            `json:"samples"`
+	Roots   []*SampleFrame `json:"roots,omitempty"`
+}
+
+func (t *SampleThread) label() string {
+	label := "Thread " + t.ID
+	if len(t.Name) > 0 {
+		label += " " + t.Name
+	}
+	if len(t.Queue) > 0 {
+		label += " " + t.Queue
+	}
+	return label
+}
+
+// SampleProcess is a sampled process
+type SampleProcess struct {
+	Name       string          `json:"name"`
+	PID        int             `json:"pid"`
+	UUID       string          `json:"uuid,omitempty"`
+	Path       string          `json:"path,omitempty"`
+	Identifier string          `json:"identifier,omitempty"`
+	Version    string          `json:"version,omitempty"`
+	NumSamples int             `json:"samples,omitempty"`
+	Threads    []*SampleThread `json:"threads,omitempty"`
+	Images     []image         `json:"-"`
+}
+
+// Spindump is a parsed spindump (or the stackshot of an .ips hang report)
+type Spindump struct {
+	DateTime      string           `json:"date,omitempty"`
+	OSVersion     string           `json:"os_version,omitempty"`
+	Architecture  string           `json:"arch,omitempty"`
+	HardwareModel string           `json:"hardware_model,omitempty"`
+	ReportVersion string           `json:"report_version,omitempty"`
+	Duration      string           `json:"duration,omitempty"`
+	Steps         string           `json:"steps,omitempty"`
+	Processes     []*SampleProcess `json:"processes"`
+	// Images are the binary images shared by all the processes (if the spindump has a single list)
+	Images []image `json:"-"`
+}
+
+// OpenSpindump opens and parses a spindump text file or a stackshot .ips report
+func OpenSpindump(name string) (*Spindump, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpindump(data)
+}
+
+// ParseSpindump parses a spindump text file or a stackshot .ips report
+func ParseSpindump(data []byte) (*Spindump, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return parseStackshot(data)
+	}
+
+	s := &Spindump{}
+
+	var proc *SampleProcess
+	var thread *SampleThread
+	type level struct {
+		indent int
+		frame  *SampleFrame
+	}
+	var stack []level
+	inImages := false
+	procImages := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if len(strings.TrimSpace(line)) == 0 {
+			inImages = false
+			thread = nil
+			continue
+		}
+
+		if strings.TrimSpace(line) == "Binary Images:" {
+			inImages = true
+			// the per-process lists are indented, a single list shared by all processes isn't
+			procImages = strings.HasPrefix(line, " ") && proc != nil
+			thread = nil
+			continue
+		}
+
+		if inImages {
+			matches := spinImageRE.FindStringSubmatch(line)
+			if matches == nil {
+				continue
+			}
+			start, err := utils.ConvertStrToInt(matches[1])
+			if err != nil {
+				return nil, err
+			}
+			end := start
+			if matches[2] != "???" {
+				if end, err = utils.ConvertStrToInt(matches[2]); err != nil {
+					return nil, err
+				}
+			}
+			img := image{
+				Name:  matches[3],
+				Start: start,
+				End:   end,
+				UUID:  matches[4],
+				Path:  matches[5],
+			}
+			if procImages {
+				proc.Images = append(proc.Images, img)
+			} else {
+				s.Images = append(s.Images, img)
+			}
+			continue
+		}
+
+		if matches := spinProcessRE.FindStringSubmatch(line); matches != nil {
+			pid, err := strconv.Atoi(matches[2])
+			if err != nil {
+				return nil, err
+			}
+			proc = &SampleProcess{Name: matches[1], PID: pid}
+			s.Processes = append(s.Processes, proc)
+			thread = nil
+			continue
+		}
+
+		if matches := spinThreadRE.FindStringSubmatch(line); matches != nil && proc != nil {
+			samples, err := strconv.Atoi(matches[3])
+			if err != nil {
+				return nil, err
+			}
+			thread = &SampleThread{ID: matches[1], Samples: samples}
+			if m := spinQueueRE.FindStringSubmatch(matches[2]); m != nil {
+				thread.Queue = m[1]
+			}
+			if m := spinNameRE.FindStringSubmatch(matches[2]); m != nil {
+				thread.Name = m[1]
+			}
+			proc.Threads = append(proc.Threads, thread)
+			stack = nil
+			continue
+		}
+
+		if thread != nil {
+			matches := spinFrameRE.FindStringSubmatch(line)
+			if matches == nil {
+				continue
+			}
+			count, err := strconv.Atoi(matches[3])
+			if err != nil {
+				return nil, err
+			}
+			frame := &SampleFrame{
+				Count:     count,
+				Kernel:    matches[2] == "*",
+				ImageName: matches[5],
+			}
+			if sym := strings.TrimSpace(matches[4]); sym != "???" && len(sym) > 0 {
+				if m := spinSymbolRE.FindStringSubmatch(sym); m != nil {
+					frame.Symbol = m[1]
+					frame.SymbolOffset, _ = strconv.ParseUint(m[2], 10, 64)
+				} else {
+					frame.Symbol = sym
+				}
+			}
+			if len(matches[6]) > 0 {
+				frame.ImageOffset, _ = strconv.ParseUint(matches[6], 10, 64)
+			}
+			if frame.Address, err = utils.ConvertStrToInt(matches[7]); err != nil {
+				return nil, err
+			}
+
+			indent := len(matches[1]) + len(matches[2]) // kernel frames are marked with a '*' in the indentation
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				thread.Roots = append(thread.Roots, frame)
+			} else {
+				parent := stack[len(stack)-1].frame
+				parent.Children = append(parent.Children, frame)
+			}
+			stack = append(stack, level{indent: indent, frame: frame})
+			continue
+		}
+
+		if matches := spinHeaderRE.FindStringSubmatch(line); matches != nil {
+			key, val := matches[1], strings.TrimSpace(matches[2])
+			if proc != nil {
+				switch key {
+				case "UUID":
+					proc.UUID = val
+				case "Path":
+					proc.Path = val
+				case "Identifier":
+					proc.Identifier = val
+				case "Version":
+					proc.Version = val
+				case "Num samples":
+					proc.NumSamples, _ = strconv.Atoi(strings.Fields(val)[0])
+				}
+				continue
+			}
+			switch key {
+			case "Date/Time":
+				s.DateTime = val
+			case "OS Version":
+				s.OSVersion = val
+			case "Architecture":
+				s.Architecture = val
+			case "Hardware model", "Hardware Model":
+				s.HardwareModel = val
+			case "Report Version":
+				s.ReportVersion = val
+			case "Duration":
+				s.Duration = val
+			case "Steps":
+				s.Steps = val
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(s.Processes) == 0 {
+		return nil, fmt.Errorf("failed to find any processes in spindump")
+	}
+
+	s.linkImages()
+
+	return s, nil
+}
+
+// linkImages points the frames at their binary images (matched by address, falling back to the name)
+func (s *Spindump) linkImages() {
+	for _, p := range s.Processes {
+		images := p.Images
+		if len(images) == 0 {
+			images = s.Images
+		}
+		byName := make(map[string]*image)
+		for i := range images {
+			byName[images[i].Name] = &images[i]
+		}
+		for i := range images { // frames use the binary name (the images list can use the bundle ID)
+			if len(images[i].Path) > 0 {
+				byName[filepath.Base(images[i].Path)] = &images[i]
+			}
+		}
+		p.Walk(func(_ *SampleThread, f *SampleFrame) {
+			if f.Image != nil {
+				return
+			}
+			for i := range images {
+				if images[i].End > images[i].Start && f.Address >= images[i].Start && f.Address <= images[i].End {
+					f.Image = &images[i]
+					return
+				}
+			}
+			f.Image = byName[f.ImageName]
+		})
+	}
+}
+
+// Walk calls fn on every frame of every thread of the process
+func (p *SampleProcess) Walk(fn func(t *SampleThread, f *SampleFrame)) {
+	var walk func(t *SampleThread, frames []*SampleFrame)
+	walk = func(t *SampleThread, frames []*SampleFrame) {
+		for _, f := range frames {
+			fn(t, f)
+			walk(t, f.Children)
+		}
+	}
+	for _, t := range p.Threads {
+		walk(t, t.Roots)
+	}
+}
+
+type stackshotThread struct {
+	ID           uint64          `json:"id"`
+	Name         string          `json:"name"`
+	Queue        string          `json:"dispatch_queue_label"`
+	UserFrames   [][]json.Number `json:"userFrames"`
+	KernelFrames [][]json.Number `json:"kernelFrames"`
+}
+
+type stackshotProcess struct {
+	PID        int                        `json:"pid"`
+	ProcName   string                     `json:"procname"`
+	ThreadByID map[string]stackshotThread `json:"threadById"`
+}
+
+type stackshot struct {
+	OSVersion struct {
+		Train string `json:"train"`
+		Build string `json:"build"`
+	} `json:"osVersion"`
+	ModelCode    string                      `json:"modelCode"`
+	CaptureTime  string                      `json:"captureTime"`
+	ProcessByPID map[string]stackshotProcess `json:"processByPid"`
+	BinaryImages [][]interface{}             `json:"binaryImages"`
+}
+
+// parseStackshot parses the stackshot of an .ips report (a JSON header line followed by a JSON body)
+func parseStackshot(data []byte) (*Spindump, error) {
+	parts := bytes.SplitN(bytes.TrimSpace(data), []byte("\n"), 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("failed to parse .ips: missing body")
+	}
+
+	var hdr ipsHeader
+	if err := json.Unmarshal(parts[0], &hdr); err != nil {
+		return nil, fmt.Errorf("failed to parse .ips header: %v", err)
+	}
+
+	var ss stackshot
+	dec := json.NewDecoder(bytes.NewReader(parts[1]))
+	dec.UseNumber() // the image base addresses don't fit in a float64
+	if err := dec.Decode(&ss); err != nil {
+		return nil, fmt.Errorf("failed to parse .ips body: %v", err)
+	}
+	if len(ss.ProcessByPID) == 0 {
+		return nil, fmt.Errorf("unsupported .ips bug_type %s (expected a %s stackshot)", hdr.BugType, ipsStackshotBugType)
+	}
+
+	s := &Spindump{
+		DateTime:      ss.CaptureTime,
+		OSVersion:     strings.TrimSpace(fmt.Sprintf("%s (%s)", ss.OSVersion.Train, ss.OSVersion.Build)),
+		HardwareModel: ss.ModelCode,
+		ReportVersion: hdr.BugType,
+	}
+	if len(s.DateTime) == 0 {
+		s.DateTime = hdr.Timestamp
+	}
+
+	// binary images are [uuid, base, source] where source 'S' is the dyld_shared_cache and 'K' the kernel
+	for _, bi := range ss.BinaryImages {
+		var img image
+		if len(bi) > 0 {
+			img.UUID, _ = bi[0].(string)
+		}
+		if len(bi) > 1 {
+			if base, ok := bi[1].(json.Number); ok {
+				img.Start, _ = strconv.ParseUint(base.String(), 10, 64)
+				img.End = img.Start
+			}
+		}
+		img.Name = img.UUID
+		if len(bi) > 2 {
+			switch src, _ := bi[2].(string); src {
+			case "S":
+				img.Name = SharedCacheImage
+			case "K":
+				img.Name = "kernel"
+			}
+		}
+		s.Images = append(s.Images, img)
+	}
+
+	frame := func(f []json.Number, kernel bool) (*SampleFrame, error) {
+		if len(f) < 2 {
+			return nil, fmt.Errorf("invalid stackshot frame %v", f)
+		}
+		idx, err := f[0].Int64()
+		if err != nil {
+			return nil, err
+		}
+		off, err := strconv.ParseUint(f[1].String(), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sf := &SampleFrame{Count: 1, ImageOffset: off, Kernel: kernel}
+		if idx >= 0 && int(idx) < len(s.Images) {
+			sf.Image = &s.Images[idx]
+			sf.ImageName = sf.Image.Name
+			sf.Address = sf.Image.Start + off
+		}
+		return sf, nil
+	}
+
+	var pids []int
+	for _, p := range ss.ProcessByPID {
+		pids = append(pids, p.PID)
+	}
+	sort.Ints(pids)
+
+	for _, pid := range pids {
+		sp := ss.ProcessByPID[strconv.Itoa(pid)]
+		proc := &SampleProcess{Name: sp.ProcName, PID: sp.PID, NumSamples: 1}
+
+		var tids []uint64
+		for _, t := range sp.ThreadByID {
+			tids = append(tids, t.ID)
+		}
+		sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
+
+		for _, tid := range tids {
+			st := sp.ThreadByID[strconv.FormatUint(tid, 10)]
+			t := &SampleThread{ID: fmt.Sprintf("%#x", st.ID), Name: st.Name, Queue: st.Queue, Samples: 1}
+
+			// the frames are innermost first and the kernel frames are below the user frames
+			var chain []*SampleFrame
+			for i := len(st.UserFrames) - 1; i >= 0; i-- {
+				f, err := frame(st.UserFrames[i], false)
+				if err != nil {
+					return nil, err
+				}
+				chain = append(chain, f)
+			}
+			for i := len(st.KernelFrames) - 1; i >= 0; i-- {
+				f, err := frame(st.KernelFrames[i], true)
+				if err != nil {
+					return nil, err
+				}
+				chain = append(chain, f)
+			}
+			for i, f := range chain {
+				if i == 0 {
+					t.Roots = append(t.Roots, f)
+					continue
+				}
+				chain[i-1].Children = append(chain[i-1].Children, f)
+			}
+
+			proc.Threads = append(proc.Threads, t)
+		}
+
+		s.Processes = append(s.Processes, proc)
+	}
+
+	return s, nil
+}
+
+func (s *Spindump) String() string {
+	var sb strings.Builder
+
+	if len(s.DateTime) > 0 {
+		fmt.Fprintf(&sb, "Date/Time:      %s\n", s.DateTime)
+	}
+	if len(s.OSVersion) > 0 {
+		fmt.Fprintf(&sb, "OS Version:     %s\n", s.OSVersion)
+	}
+	if len(s.HardwareModel) > 0 {
+		fmt.Fprintf(&sb, "Hardware Model: %s\n", s.HardwareModel)
+	}
+	if len(s.Duration) > 0 {
+		fmt.Fprintf(&sb, "Duration:       %s\n", s.Duration)
+	}
+
+	var printFrames func(frames []*SampleFrame, depth int)
+	printFrames = func(frames []*SampleFrame, depth int) {
+		for _, f := range frames {
+			fmt.Fprintf(&sb, "%s%s\n", strings.Repeat("  ", depth+1), f)
+			printFrames(f.Children, depth+1)
+		}
+	}
+
+	for _, p := range s.Processes {
+		fmt.Fprintf(&sb, "\nProcess: %s [%d]", p.Name, p.PID)
+		if p.NumSamples > 0 {
+			fmt.Fprintf(&sb, " (%d samples)", p.NumSamples)
+		}
+		sb.WriteString("\n")
+		for _, t := range p.Threads {
+			fmt.Fprintf(&sb, "  %s  %d samples\n", t.label(), t.Samples)
+			printFrames(t.Roots, 0)
+		}
+	}
+
+	return sb.String()
+}
+
+// foldedName makes a frame name safe for the folded stack format
+// foldedLabel returns the frame's symbol without its offset (so samples in the same function merge) or
+// 'image + offset' if it isn't symbolicated
+func (f *SampleFrame) foldedLabel() string {
+	if len(f.Symbol) > 0 {
+		return f.Symbol
+	}
+	return f.Label()
+}
+
+func foldedName(name string) string {
+	return strings.ReplaceAll(name, ";", ":")
+}
+
+// WriteFolded writes the call trees as folded stacks ('proc;thread;frame;frame count' lines) as used by
+// flame graph tools (i.e. flamegraph.pl, speedscope or inferno)
+func (s *Spindump) WriteFolded(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	var fold func(prefix string, frames []*SampleFrame) error
+	fold = func(prefix string, frames []*SampleFrame) error {
+		for _, f := range frames {
+			path := prefix + ";" + foldedName(f.foldedLabel())
+			self := f.Count
+			for _, c := range f.Children {
+				self -= c.Count
+			}
+			if self > 0 {
+				if _, err := fmt.Fprintf(bw, "%s %d\n", path, self); err != nil {
+					return err
+				}
+			}
+			if err := fold(path, f.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, p := range s.Processes {
+		for _, t := range p.Threads {
+			prefix := foldedName(fmt.Sprintf("%s [%d]", p.Name, p.PID)) + ";" + foldedName(t.label())
+			if err := fold(prefix, t.Roots); err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,159 @@
+package crashlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testSpindump = `Date/Time:        2021-08-01 10:00:00.000 -0700
+OS Version:       iPhone OS 14.7 (Build 18G69)
+Architecture:     arm64
+Report Version:   32
+Duration:         1.00s
+Steps:            10
+
+Process:          SpringBoard [55]
+UUID:             AAAAAAAA-AAAA-AAAA-AAAA-AAAAAAAAAAAA
+Path:             /System/Library/CoreServices/SpringBoard.app/SpringBoard
+Identifier:       com.apple.springboard
+Version:          1.0 (50)
+Num samples:      10 (1-10)
+
+  Thread 0x1a2b    DispatchQueue "com.apple.main-thread"(1)    10 samples (1-10)    priority 47 (base 47)
+  10  start + 4 (libdyld.dylib + 5480) [0x1a0c1d568]
+    10  ??? (SpringBoard + 16384) [0x100ba4000]
+      6  -[UIApplication _run] + 100 (UIKitCore + 200) [0x1a30000c8]
+       *6  ??? (kernel + 256) [0xfffffff007004100]
+      3  -[UIApplication _run] + 120 (UIKitCore + 220) [0x1a30000dc]
+      1  ??? [0x1a3000500]
+
+  Thread 0x1a2c    Thread name "worker"    2 samples (1-2)    priority 31 (base 31)
+  2  start_wqthread + 8 (libsystem_pthread.dylib + 4096) [0x1a0d01000]
+
+  Binary Images:
+         0x100ba0000 -        0x100c3ffff  com.apple.springboard 1.0 (50) <AAAAAAAA-AAAA-AAAA-AAAA-AAAAAAAAAAAA> /System/Library/CoreServices/SpringBoard.app/SpringBoard
+         0x1a0c1c000 -        0x1a0c1ffff  libdyld.dylib (852.2) <BBBBBBBB-BBBB-BBBB-BBBB-BBBBBBBBBBBB> /usr/lib/system/libdyld.dylib
+         0x1a3000000 -        0x1a3ffffff  com.apple.UIKitCore 1.0 (4000) <CCCCCCCC-CCCC-CCCC-CCCC-CCCCCCCCCCCC> /System/Library/PrivateFrameworks/UIKitCore.framework/UIKitCore
+         0x1a0d00000 -                ???  libsystem_pthread.dylib (454.100.8) <DDDDDDDD-DDDD-DDDD-DDDD-DDDDDDDDDDDD> /usr/lib/system/libsystem_pthread.dylib
+`
+
+func TestParseSpindump(t *testing.T) {
+	s, err := ParseSpindump([]byte(testSpindump))
+	if err != nil {
+		t.Fatalf("ParseSpindump() error = %v", err)
+	}
+
+	if s.OSVersion != "iPhone OS 14.7 (Build 18G69)" || s.Architecture != "arm64" || s.Steps != "10" {
+		t.Errorf("header = %q, %q, %q", s.OSVersion, s.Architecture, s.Steps)
+	}
+	if len(s.Processes) != 1 {
+		t.Fatalf("got %d processes, want 1", len(s.Processes))
+	}
+	p := s.Processes[0]
+	if p.Name != "SpringBoard" || p.PID != 55 || p.Identifier != "com.apple.springboard" || p.NumSamples != 10 {
+		t.Errorf("process = %q [%d] %q %d", p.Name, p.PID, p.Identifier, p.NumSamples)
+	}
+	if len(p.Images) != 4 {
+		t.Fatalf("got %d process images, want 4", len(p.Images))
+	}
+	if len(p.Threads) != 2 {
+		t.Fatalf("got %d threads, want 2", len(p.Threads))
+	}
+	if th := p.Threads[0]; th.ID != "0x1a2b" || th.Queue != "com.apple.main-thread" || th.Samples != 10 {
+		t.Errorf("thread 0 = %q %q %d", th.ID, th.Queue, th.Samples)
+	}
+	if th := p.Threads[1]; th.Name != "worker" || th.Samples != 2 {
+		t.Errorf("thread 1 = %q %d", th.Name, th.Samples)
+	}
+
+	// start -> SpringBoard -> {_run -> kernel, _run, ???}
+	roots := p.Threads[0].Roots
+	if len(roots) != 1 || roots[0].Symbol != "start" || roots[0].SymbolOffset != 4 || roots[0].Count != 10 {
+		t.Fatalf("roots = %v", roots)
+	}
+	app := roots[0].Children
+	if len(app) != 1 || len(app[0].Symbol) != 0 || app[0].ImageName != "SpringBoard" || app[0].ImageOffset != 16384 {
+		t.Fatalf("app frames = %v", app)
+	}
+	calls := app[0].Children
+	if len(calls) != 3 {
+		t.Fatalf("got %d frames under SpringBoard, want 3", len(calls))
+	}
+	if calls[0].Symbol != "-[UIApplication _run]" || calls[0].SymbolOffset != 100 || calls[0].Address != 0x1a30000c8 {
+		t.Errorf("frame = %v", calls[0])
+	}
+	if len(calls[0].Children) != 1 || !calls[0].Children[0].Kernel || calls[0].Children[0].Count != 6 {
+		t.Errorf("kernel frames = %v", calls[0].Children)
+	}
+	if calls[1].Kernel || len(calls[1].Children) != 0 {
+		t.Errorf("frame = %v", calls[1])
+	}
+}
+
+func TestSpindumpLinkImages(t *testing.T) {
+	s, err := ParseSpindump([]byte(testSpindump))
+	if err != nil {
+		t.Fatalf("ParseSpindump() error = %v", err)
+	}
+	p := s.Processes[0]
+	calls := p.Threads[0].Roots[0].Children[0].Children
+
+	tests := []struct {
+		name  string
+		frame *SampleFrame
+		uuid  string
+	}{
+		{"dylib", p.Threads[0].Roots[0], "BBBBBBBB-BBBB-BBBB-BBBB-BBBBBBBBBBBB"},
+		{"bundle ID", p.Threads[0].Roots[0].Children[0], "AAAAAAAA-AAAA-AAAA-AAAA-AAAAAAAAAAAA"},
+		{"framework bundle ID", calls[0], "CCCCCCCC-CCCC-CCCC-CCCC-CCCCCCCCCCCC"},
+		{"no image name", calls[2], "CCCCCCCC-CCCC-CCCC-CCCC-CCCCCCCCCCCC"},
+		{"unknown end", p.Threads[1].Roots[0], "DDDDDDDD-DDDD-DDDD-DDDD-DDDDDDDDDDDD"},
+		{"kernel", calls[0].Children[0], ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.uuid) == 0 {
+				if tt.frame.Image != nil {
+					t.Errorf("frame %v linked to %s, want none", tt.frame, tt.frame.Image.Name)
+				}
+				return
+			}
+			if tt.frame.Image == nil {
+				t.Fatalf("frame %v isn't linked to an image", tt.frame)
+			}
+			if tt.frame.Image.UUID != tt.uuid {
+				t.Errorf("frame %v linked to %s, want %s", tt.frame, tt.frame.Image.UUID, tt.uuid)
+			}
+		})
+	}
+}
+
+func TestSpindumpWriteFolded(t *testing.T) {
+	s, err := ParseSpindump([]byte(testSpindump))
+	if err != nil {
+		t.Fatalf("ParseSpindump() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteFolded(&buf); err != nil {
+		t.Fatalf("WriteFolded() error = %v", err)
+	}
+
+	main := "SpringBoard [55];Thread 0x1a2b com.apple.main-thread;start;SpringBoard + 16384;"
+	want := []string{
+		main + "-[UIApplication _run];kernel + 256 6",
+		main + "-[UIApplication _run] 3",
+		main + "0x1a3000500 1",
+		"SpringBoard [55];Thread 0x1a2c worker;start_wqthread 2",
+	}
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("WriteFolded() =\n%s\nwant\n%s", buf.String(), strings.Join(want, "\n"))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package crashlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultSignatureFrames is the number of crashing thread frames used in a crash signature
+const DefaultSignatureFrames = 5
+
+// SignatureFrames returns the top n frames of the crashed thread as 'image`symbol' (or 'image+offset'
+// if the frame isn't symbolicated). The symbol offsets are left out so the frames are stable across builds
+func (c *CrashLog) SignatureFrames(n int) []string {
+	var frames []string
+	if c.CrashedThread < 0 || c.CrashedThread >= len(c.Threads) {
+		return frames
+	}
+	for _, bt := range c.Threads[c.CrashedThread].BackTrace {
+		if len(frames) == n {
+			break
+		}
+		var img string
+		if bt.Image != nil {
+			img = bt.Image.Name
+		}
+		if len(bt.Symbol) > 0 {
+			frames = append(frames, fmt.Sprintf("%s`%s", img, bt.Symbol))
+		} else {
+			frames = append(frames, fmt.Sprintf("%s+%#x", img, bt.Offset))
+		}
+	}
+	return frames
+}
+
+// Signature returns the crash signature (the exception type and the top n frames of the crashed thread)
+func (c *CrashLog) Signature(n int) string {
+	return strings.Join(append([]string{c.ExceptionType}, c.SignatureFrames(n)...), "\n")
+}
+
+// BucketID returns a short stable ID for a crash signature
+func BucketID(signature string) string {
+	sum := sha256.Sum256([]byte(signature))
+	return hex.EncodeToString(sum[:8])
+}
+
+// TriageReport is a crash log in a triage bucket
+type TriageReport struct {
+	Path      string `json:"path"`
+	Process   string `json:"process,omitempty"`
+	OSVersion string `json:"os_version,omitempty"`
+	Build     string `json:"build,omitempty"`
+	Device    string `json:"device,omitempty"`
+	Incident  string `json:"incident,omitempty"`
+	// Resolved is the number of the signature frames that are symbolicated
+	Resolved int `json:"-"`
+}
+
+// Bucket is a group of crash logs with the same signature
+type Bucket struct {
+	ID             string   `json:"id"`
+	Signature      string   `json:"signature"`
+	ExceptionType  string   `json:"exception_type"`
+	Frames         []string `json:"frames"`
+	Count          int      `json:"count"`
+	Processes      []string `json:"processes"`
+	Builds         []string `json:"builds"`
+	Devices        []string `json:"devices"`
+	Representative string   `json:"representative"`
+	// Exploitability is the highest exploitability rating of the bucket's reports
+	Exploitability Rating         `json:"exploitability"`
+	Reports        []TriageReport `json:"reports"`
+}
+
+// Triage buckets crash logs by their signature
+type Triage struct {
+	// Frames is the number of crashing thread frames in the signatures
+	Frames int
+
+	buckets map[string]*Bucket
+	// best is the number of symbolicated frames of each bucket's representative
+	best map[string]int
+}
+
+// NewTriage returns a Triage that signs crash logs with the top frames of the crashed thread
+func NewTriage(frames int) *Triage {
+	if frames <= 0 {
+		frames = DefaultSignatureFrames
+	}
+	return &Triage{
+		Frames:  frames,
+		buckets: make(map[string]*Bucket),
+		best:    make(map[string]int),
+	}
+}
+
+// Add adds a (symbolicated) crash log to its bucket and returns the bucket
+func (t *Triage) Add(path string, c *CrashLog) *Bucket {
+	sig := c.Signature(t.Frames)
+	id := BucketID(sig)
+
+	b, ok := t.buckets[id]
+	if !ok {
+		b = &Bucket{
+			ID:            id,
+			Signature:     sig,
+			ExceptionType: c.ExceptionType,
+			Frames:        c.SignatureFrames(t.Frames),
+		}
+		t.buckets[id] = b
+		t.best[id] = -1
+	}
+
+	report := TriageReport{
+		Path:      path,
+		Process:   c.Process,
+		OSVersion: c.OSVersion,
+		Build:     c.OSBuild,
+		Device:    c.HardwareModel,
+		Incident:  c.Incident,
+	}
+	for _, frame := range b.Frames {
+		if strings.Contains(frame, "`") {
+			report.Resolved++
+		}
+	}
+
+	if r := c.Exploitability().Rating; r > b.Exploitability {
+		b.Exploitability = r
+	}
+
+	b.Count++
+	b.Reports = append(b.Reports, report)
+	b.Processes = appendUnique(b.Processes, c.Process)
+	b.Builds = appendUnique(b.Builds, c.OSBuild)
+	b.Devices = appendUnique(b.Devices, c.HardwareModel)
+	// the most symbolicated (and then the first) report represents the bucket
+	if report.Resolved > t.best[id] {
+		t.best[id] = report.Resolved
+		b.Representative = path
+	}
+
+	return b
+}
+
+// Buckets returns the buckets (largest first)
+func (t *Triage) Buckets() []*Bucket {
+	var buckets []*Bucket
+	for _, b := range t.buckets {
+		sort.Strings(b.Builds)
+		sort.Strings(b.Devices)
+		sort.Strings(b.Processes)
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count == buckets[j].Count {
+			return buckets[i].ID < buckets[j].ID
+		}
+		return buckets[i].Count > buckets[j].Count
+	})
+	return buckets
+}
+
+func appendUnique(list []string, s string) []string {
+	if len(s) == 0 {
+		return list
+	}
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,10 @@
+// +build !darwin !cgo
+
+package crashlog
+
+import "fmt"
+
+// WriteSQLite writes the triage buckets and their reports to a SQLite database
+func WriteSQLite(dbFile string, buckets []*Bucket) error {
+	return fmt.Errorf("SQLite output is only supported on macOS (with cgo)")
+}
@@ -0,0 +1,90 @@
+// +build darwin,cgo
+
+package crashlog
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	// importing the sqlite dialects
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/pkg/errors"
+)
+
+type sqliteBucket struct {
+	ID             string `gorm:"primary_key"`
+	Signature      string
+	ExceptionType  string
+	Count          int
+	Processes      string
+	Builds         string
+	Devices        string
+	Representative string
+	Exploitability string
+}
+
+func (sqliteBucket) TableName() string {
+	return "buckets"
+}
+
+type sqliteReport struct {
+	ID        uint   `gorm:"primary_key"`
+	BucketID  string `gorm:"index"`
+	Path      string
+	Process   string
+	OSVersion string
+	Build     string
+	Device    string
+	Incident  string
+}
+
+func (sqliteReport) TableName() string {
+	return "reports"
+}
+
+// WriteSQLite writes the triage buckets and their reports to a SQLite database
+func WriteSQLite(dbFile string, buckets []*Bucket) error {
+	db, err := gorm.Open("sqlite3", dbFile)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open database: %s", dbFile)
+	}
+	defer db.Close()
+
+	if err := db.AutoMigrate(&sqliteBucket{}, &sqliteReport{}).Error; err != nil {
+		return errors.Wrap(err, "failed to create tables")
+	}
+
+	tx := db.Begin()
+	for _, b := range buckets {
+		if err := tx.Save(&sqliteBucket{
+			ID:             b.ID,
+			Signature:      b.Signature,
+			ExceptionType:  b.ExceptionType,
+			Count:          b.Count,
+			Processes:      strings.Join(b.Processes, ","),
+			Builds:         strings.Join(b.Builds, ","),
+			Devices:        strings.Join(b.Devices, ","),
+			Representative: b.Representative,
+			Exploitability: b.Exploitability.String(),
+		}).Error; err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "failed to write bucket %s", b.ID)
+		}
+		for _, r := range b.Reports {
+			if err := tx.Create(&sqliteReport{
+				BucketID:  b.ID,
+				Path:      r.Path,
+				Process:   r.Process,
+				OSVersion: r.OSVersion,
+				Build:     r.Build,
+				Device:    r.Device,
+				Incident:  r.Incident,
+			}).Error; err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "failed to write report %s", r.Path)
+			}
+		}
+	}
+
+	return tx.Commit().Error
+}
@@ -0,0 +1,105 @@
+package crashlog
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testTriageCrash returns a crash on a device and build whose crashed thread has the frames
+func testTriageCrash(build, device string, frames ...backtrace) *CrashLog {
+	app := &image{Name: "Test", Start: 0x100ba0000, End: 0x100c3ffff}
+	for i := range frames {
+		frames[i].FrameNum = i
+		if frames[i].Image == nil {
+			frames[i].Image = app
+		}
+	}
+	return &CrashLog{
+		Process:       "Test",
+		OSBuild:       build,
+		HardwareModel: device,
+		ExceptionType: "EXC_BAD_ACCESS (SIGSEGV)",
+		CrashedThread: 1,
+		Threads: []thread{
+			{Number: 0, BackTrace: []backtrace{{Image: app, Symbol: "main"}}},
+			{Number: 1, BackTrace: frames},
+		},
+	}
+}
+
+func TestTriageBuckets(t *testing.T) {
+	libobjc := &image{Name: "libobjc.A.dylib"}
+	top := func(offset uint64) []backtrace {
+		return []backtrace{
+			{Image: libobjc, Symbol: "objc_msgSend", SymbolOffset: 16, Offset: 0x5c10},
+			{Symbol: "-[Parser parse:]", SymbolOffset: offset, Offset: 0x4000 + int(offset)},
+			{Symbol: "main", SymbolOffset: 40, Offset: 0x3000},
+		}
+	}
+
+	tr := NewTriage(0)
+	if tr.Frames != DefaultSignatureFrames {
+		t.Errorf("NewTriage(0).Frames = %d, want %d", tr.Frames, DefaultSignatureFrames)
+	}
+
+	// the same top frames in different builds (at different offsets) are the same bucket
+	a := tr.Add("a.ips", testTriageCrash("18G69", "iPhone12,1", top(100)...))
+	b := tr.Add("b.ips", testTriageCrash("19A346", "iPhone13,2", top(124)...))
+	if a != b {
+		t.Fatalf("crashes with the same top frames are in buckets %s and %s", a.ID, b.ID)
+	}
+
+	// different frames are a different bucket
+	other := append(top(100)[:1], backtrace{Symbol: "-[Parser reset]", SymbolOffset: 8}, backtrace{Symbol: "main", SymbolOffset: 40})
+	c := tr.Add("c.ips", testTriageCrash("18G69", "iPhone12,1", other...))
+	if c == a {
+		t.Fatalf("crashes with different frames are in the same bucket %s", a.ID)
+	}
+	// as is a different exception type
+	abort := testTriageCrash("18G69", "iPhone12,1", top(100)...)
+	abort.ExceptionType = "EXC_CRASH (SIGABRT)"
+	if d := tr.Add("d.ips", abort); d == a || d == c {
+		t.Fatalf("crash with a different exception type is in bucket %s", d.ID)
+	}
+
+	// frames below the signature don't matter
+	deeper := append(top(100), backtrace{Symbol: "start", SymbolOffset: 4})
+	if e := NewTriage(3).Add("e.ips", testTriageCrash("18G69", "iPhone12,1", deeper...)); e.ID != a.ID {
+		t.Errorf("crash with the same top 3 frames is in bucket %s, want %s", e.ID, a.ID)
+	}
+
+	buckets := tr.Buckets()
+	if len(buckets) != 3 {
+		t.Fatalf("got %d buckets, want 3", len(buckets))
+	}
+	if buckets[0] != a || buckets[0].Count != 2 {
+		t.Errorf("largest bucket = %s with %d reports, want %s with 2", buckets[0].ID, buckets[0].Count, a.ID)
+	}
+	wantFrames := []string{"libobjc.A.dylib`objc_msgSend", "Test`-[Parser parse:]", "Test`main"}
+	if !reflect.DeepEqual(a.Frames, wantFrames) {
+		t.Errorf("bucket frames = %q, want %q", a.Frames, wantFrames)
+	}
+	if !reflect.DeepEqual(a.Builds, []string{"18G69", "19A346"}) || !reflect.DeepEqual(a.Devices, []string{"iPhone12,1", "iPhone13,2"}) {
+		t.Errorf("bucket builds = %q, devices = %q", a.Builds, a.Devices)
+	}
+	if a.ID != BucketID(a.Signature) || len(a.ID) != 16 {
+		t.Errorf("bucket ID %s isn't the short hash of its signature", a.ID)
+	}
+}
+
+func TestTriageUnsymbolicated(t *testing.T) {
+	tr := NewTriage(2)
+
+	// unsymbolicated frames sign by image offset so they only bucket with the same offsets
+	unsym := []backtrace{{Offset: 0x4064}, {Offset: 0x3028}}
+	b := tr.Add("unsymbolicated.ips", testTriageCrash("18G69", "iPhone12,1", unsym...))
+	if want := []string{"Test+0x4064", "Test+0x3028"}; !reflect.DeepEqual(b.Frames, want) {
+		t.Fatalf("unsymbolicated frames = %q, want %q", b.Frames, want)
+	}
+	if b.Representative != "unsymbolicated.ips" {
+		t.Errorf("representative = %s", b.Representative)
+	}
+	if again := tr.Add("again.ips", testTriageCrash("18G69", "iPhone12,1", unsym...)); again != b || again.Representative != "unsymbolicated.ips" {
+		t.Errorf("representative = %s, want the first report", again.Representative)
+	}
+}
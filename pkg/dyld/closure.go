@@ -0,0 +1,1124 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/blacktop/go-macho/pkg/trie"
+	"github.com/blacktop/go-macho/types"
+	"github.com/pkg/errors"
+)
+
+// This file decodes the dyld3 closures (dyld3/Closure.h) that are stored in
+// iOS 13/14 era dyld_shared_caches. Everything is encoded as TypedBytes:
+// a uint32 {type:8, payloadLength:24} followed by payloadLength bytes.
+
+// ErrNoClosures is the error for a shared cache that has no dyld3 closures
+var ErrNoClosures = errors.New("dyld shared cache does NOT contain dyld3 closures")
+
+// ImageNum is a dyld3 image number
+type ImageNum uint32
+
+// ClosureType is a dyld3 TypedBytes type
+type ClosureType uint8
+
+const (
+	// containers which have an overall length and TypedBytes inside their content
+	LaunchClosureType ClosureType = 1 // contains TypedBytes of closure attributes including imageArray
+	ImageArrayType    ClosureType = 2 // sizeof(ImageArray) + sizeof(uint32_t)*count + size of all images
+	ImageType         ClosureType = 3 // contains TypedBytes of image attributes
+	DlopenClosureType ClosureType = 4 // contains TypedBytes of closure attributes including imageArray
+
+	// attributes for Images
+	ImageFlagsType           ClosureType = 7  // sizeof(Image::Flags)
+	PathWithHashType         ClosureType = 8  // len = uint32_t + length path + 1, use multiple entries for aliases
+	FileInodeAndTimeType     ClosureType = 9  // sizeof(FileInfo)
+	CdHashType               ClosureType = 10 // 20, use multiple entries on watchOS for all hashes
+	UUIDType                 ClosureType = 11 // 16
+	MappingInfoType          ClosureType = 12 // sizeof(MappingInfo)
+	DiskSegmentType          ClosureType = 13 // sizeof(DiskSegment) * count
+	CacheSegmentType         ClosureType = 14 // sizeof(DyldCacheSegment) * count
+	DependentsType           ClosureType = 15 // sizeof(LinkedImage) * count
+	InitOffsetsType          ClosureType = 16 // sizeof(uint32_t) * count
+	DofOffsetsType           ClosureType = 17 // sizeof(uint32_t) * count
+	CodeSignLocType          ClosureType = 18 // sizeof(CodeSignatureLocation)
+	FairPlayLocType          ClosureType = 19 // sizeof(FairPlayRange)
+	RebaseFixupsType         ClosureType = 20 // sizeof(RebasePattern) * count
+	BindFixupsType           ClosureType = 21 // sizeof(BindPattern) * count
+	CachePatchInfoType       ClosureType = 22 // deprecated
+	TextFixupsType           ClosureType = 23 // sizeof(TextFixupPattern) * count
+	ImageOverrideType        ClosureType = 24 // sizeof(ImageNum)
+	InitBeforesType          ClosureType = 25 // sizeof(ImageNum) * count
+	InitsSectionType         ClosureType = 26 // sizeof(InitializerSectionRange)
+	ChainedFixupsTargetsType ClosureType = 27 // sizeof(ResolvedSymbolTarget) * count
+	TermOffsetsType          ClosureType = 28 // sizeof(uint32_t) * count
+	ChainedStartsOffsetType  ClosureType = 29 // sizeof(uint64_t)
+	ObjcFixupsType           ClosureType = 30 // sizeof(ResolvedSymbolTarget) + (sizeof(uint32_t) * 2) + (sizeof(ProtocolISAFixup) * count) + (sizeof(SelectorReferenceFixup) * count)
+
+	// attributes for Closures (launch or dlopen)
+	ClosureFlagsType          ClosureType = 32 // sizeof(Closure::Flags)
+	DyldCacheUUIDType         ClosureType = 33 // 16
+	MissingFilesType          ClosureType = 34
+	EnvVarType                ClosureType = 35 // "DYLD_BLAH=stuff"
+	TopImageType              ClosureType = 36 // sizeof(ImageNum)
+	LibDyldEntryType          ClosureType = 37 // sizeof(ResolvedSymbolTarget)
+	LibSystemNumType          ClosureType = 38 // sizeof(ImageNum)
+	MainEntryType             ClosureType = 40 // sizeof(ResolvedSymbolTarget)
+	StartEntryType            ClosureType = 41 // sizeof(ResolvedSymbolTarget) used by programs built with crt1.o
+	CacheOverridesType        ClosureType = 42 // sizeof(PatchEntry) * count used if process uses interposing or roots (cached dylib overrides)
+	InterposeTuplesType       ClosureType = 43 // sizeof(InterposingTuple) * count
+	ExistingFilesType         ClosureType = 44 // uint64_t + (SkippedFiles * count)
+	SelectorTableType         ClosureType = 45 // uint32_t + (sizeof(ObjCSelectorImage) * count) + hashTable size
+	ClassTableType            ClosureType = 46 // (3 * uint32_t) + (sizeof(ObjCClassImage) * count) + classHashTable size + protocolHashTable size
+	WarningType               ClosureType = 47 // len = uint32_t + length path + 1, use one entry per warning
+	DuplicateClassesTableType ClosureType = 48 // duplicateClassesHashTable
+	ProgVarsType              ClosureType = 49 // sizeof(uint32_t)
+)
+
+func (t ClosureType) String() string {
+	switch t {
+	case LaunchClosureType:
+		return "launchClosure"
+	case ImageArrayType:
+		return "imageArray"
+	case ImageType:
+		return "image"
+	case DlopenClosureType:
+		return "dlopenClosure"
+	case ImageFlagsType:
+		return "imageFlags"
+	case PathWithHashType:
+		return "pathWithHash"
+	case FileInodeAndTimeType:
+		return "fileInodeAndTime"
+	case CdHashType:
+		return "cdHash"
+	case UUIDType:
+		return "uuid"
+	case MappingInfoType:
+		return "mappingInfo"
+	case DiskSegmentType:
+		return "diskSegment"
+	case CacheSegmentType:
+		return "cacheSegment"
+	case DependentsType:
+		return "dependents"
+	case InitOffsetsType:
+		return "initOffsets"
+	case DofOffsetsType:
+		return "dofOffsets"
+	case CodeSignLocType:
+		return "codeSignLoc"
+	case FairPlayLocType:
+		return "fairPlayLoc"
+	case RebaseFixupsType:
+		return "rebaseFixups"
+	case BindFixupsType:
+		return "bindFixups"
+	case CachePatchInfoType:
+		return "cachePatchInfo"
+	case TextFixupsType:
+		return "textFixups"
+	case ImageOverrideType:
+		return "imageOverride"
+	case InitBeforesType:
+		return "initBefores"
+	case InitsSectionType:
+		return "initsSection"
+	case ChainedFixupsTargetsType:
+		return "chainedFixupsTargets"
+	case TermOffsetsType:
+		return "termOffsets"
+	case ChainedStartsOffsetType:
+		return "chainedStartsOffset"
+	case ObjcFixupsType:
+		return "objcFixups"
+	case ClosureFlagsType:
+		return "closureFlags"
+	case DyldCacheUUIDType:
+		return "dyldCacheUUID"
+	case MissingFilesType:
+		return "missingFiles"
+	case EnvVarType:
+		return "envVar"
+	case TopImageType:
+		return "topImage"
+	case LibDyldEntryType:
+		return "libDyldEntry"
+	case LibSystemNumType:
+		return "libSystemNum"
+	case MainEntryType:
+		return "mainEntry"
+	case StartEntryType:
+		return "startEntry"
+	case CacheOverridesType:
+		return "cacheOverrides"
+	case InterposeTuplesType:
+		return "interposeTuples"
+	case ExistingFilesType:
+		return "existingFiles"
+	case SelectorTableType:
+		return "selectorTable"
+	case ClassTableType:
+		return "classTable"
+	case WarningType:
+		return "warning"
+	case DuplicateClassesTableType:
+		return "duplicateClassesTable"
+	case ProgVarsType:
+		return "progVars"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(t))
+}
+
+// TypedBytes is a dyld3 closure TypedBytes entry
+type TypedBytes struct {
+	Type    ClosureType
+	Payload []byte
+}
+
+// parseTypedBytes parses a run of TypedBytes entries (the payload of a ContainerTypedBytes)
+func parseTypedBytes(data []byte) ([]TypedBytes, error) {
+	var tbs []TypedBytes
+	for len(data) >= 4 {
+		hdr := binary.LittleEndian.Uint32(data)
+		typ := ClosureType(hdr & 0xff)
+		plen := int(hdr >> 8)
+		if 4+plen > len(data) {
+			return nil, fmt.Errorf("%s TypedBytes payload length %#x overflows container", typ, plen)
+		}
+		tbs = append(tbs, TypedBytes{Type: typ, Payload: data[4 : 4+plen]})
+		data = data[4+plen:]
+	}
+	return tbs, nil
+}
+
+func readUint32s(data []byte) []uint32 {
+	vals := make([]uint32, len(data)/4)
+	for i := range vals {
+		vals[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return vals
+}
+
+func readUint64s(data []byte) []uint64 {
+	vals := make([]uint64, len(data)/8)
+	for i := range vals {
+		vals[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	return vals
+}
+
+func cstring(data []byte) string {
+	if idx := bytes.IndexByte(data, 0); idx >= 0 {
+		return string(data[:idx])
+	}
+	return string(data)
+}
+
+/**************************
+ * ResolvedSymbolTarget *
+ **************************/
+
+// ResolvedSymbolTargetKind is the kind of a closure ResolvedSymbolTarget
+type ResolvedSymbolTargetKind uint8
+
+const (
+	RebaseTarget      ResolvedSymbolTargetKind = 0
+	SharedCacheTarget ResolvedSymbolTargetKind = 1
+	ImageTarget       ResolvedSymbolTargetKind = 2
+	AbsoluteTarget    ResolvedSymbolTargetKind = 3
+)
+
+func (k ResolvedSymbolTargetKind) String() string {
+	switch k {
+	case RebaseTarget:
+		return "rebase"
+	case SharedCacheTarget:
+		return "sharedCache"
+	case ImageTarget:
+		return "image"
+	case AbsoluteTarget:
+		return "absolute"
+	}
+	return "unknown"
+}
+
+// ResolvedSymbolTarget is a closure bind/entry target
+type ResolvedSymbolTarget uint64
+
+// Kind returns the target kind
+func (t ResolvedSymbolTarget) Kind() ResolvedSymbolTargetKind {
+	return ResolvedSymbolTargetKind(t & 0x3)
+}
+
+// ImageNum returns the target image number (only valid for ImageTarget)
+func (t ResolvedSymbolTarget) ImageNum() ImageNum {
+	return ImageNum((t >> 2) & 0x3fffff)
+}
+
+// Offset returns the target offset into the cache or image
+func (t ResolvedSymbolTarget) Offset() uint64 {
+	if t.Kind() == ImageTarget {
+		return uint64(t>>24) & 0xffffffffff
+	}
+	return uint64(t >> 2)
+}
+
+// Value returns the (sign extended) value of an absolute target
+func (t ResolvedSymbolTarget) Value() uint64 {
+	v := uint64(t >> 2)
+	if v&(1<<61) != 0 {
+		v |= 0xc000000000000000
+	}
+	return v
+}
+
+func (t ResolvedSymbolTarget) String() string {
+	switch t.Kind() {
+	case RebaseTarget:
+		return "rebase"
+	case SharedCacheTarget:
+		return fmt.Sprintf("dyld_cache+%#x", t.Offset())
+	case ImageTarget:
+		return fmt.Sprintf("image(%d)+%#x", t.ImageNum(), t.Offset())
+	case AbsoluteTarget:
+		return fmt.Sprintf("absolute(%#x)", t.Value())
+	}
+	return fmt.Sprintf("unknown(%#x)", uint64(t))
+}
+
+/*********
+ * Image *
+ *********/
+
+// ClosureImageFlags are the dyld3 Image::Flags
+type ClosureImageFlags uint64
+
+func (f ClosureImageFlags) ImageNum() ImageNum        { return ImageNum(f & 0xffff) }
+func (f ClosureImageFlags) MaxLoadCount() uint32      { return uint32(f>>16) & 0xfff }
+func (f ClosureImageFlags) bit(n uint) bool           { return (f>>n)&1 == 1 }
+func (f ClosureImageFlags) IsInvalid() bool           { return f.bit(28) }
+func (f ClosureImageFlags) Has16KBpages() bool        { return f.bit(29) }
+func (f ClosureImageFlags) Is64() bool                { return f.bit(30) }
+func (f ClosureImageFlags) HasObjC() bool             { return f.bit(31) }
+func (f ClosureImageFlags) MayHavePlusLoads() bool    { return f.bit(32) }
+func (f ClosureImageFlags) IsEncrypted() bool         { return f.bit(33) }
+func (f ClosureImageFlags) HasWeakDefs() bool         { return f.bit(34) }
+func (f ClosureImageFlags) NeverUnload() bool         { return f.bit(35) }
+func (f ClosureImageFlags) CwdSameAsThis() bool       { return f.bit(36) }
+func (f ClosureImageFlags) IsPlatformBinary() bool    { return f.bit(37) }
+func (f ClosureImageFlags) IsBundle() bool            { return f.bit(38) }
+func (f ClosureImageFlags) IsDylib() bool             { return f.bit(39) }
+func (f ClosureImageFlags) IsExecutable() bool        { return f.bit(40) }
+func (f ClosureImageFlags) OverridableDylib() bool    { return f.bit(41) }
+func (f ClosureImageFlags) InDyldCache() bool         { return f.bit(42) }
+func (f ClosureImageFlags) HasTerminators() bool      { return f.bit(43) }
+func (f ClosureImageFlags) HasReadOnlyData() bool     { return f.bit(44) }
+func (f ClosureImageFlags) HasChainedFixups() bool    { return f.bit(45) }
+func (f ClosureImageFlags) HasPrecomputedObjC() bool  { return f.bit(46) }
+func (f ClosureImageFlags) FixupsNotEncoded() bool    { return f.bit(47) }
+func (f ClosureImageFlags) RebasesNotEncoded() bool   { return f.bit(48) }
+func (f ClosureImageFlags) HasOverrideImageNum() bool { return f.bit(49) }
+
+func (f ClosureImageFlags) String() string {
+	var flags []string
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{f.IsInvalid(), "invalid"},
+		{f.Has16KBpages(), "16KB-pages"},
+		{f.Is64(), "64-bit"},
+		{f.HasObjC(), "objc"},
+		{f.MayHavePlusLoads(), "+load"},
+		{f.IsEncrypted(), "encrypted"},
+		{f.HasWeakDefs(), "weak-defs"},
+		{f.NeverUnload(), "never-unload"},
+		{f.CwdSameAsThis(), "cwd-same"},
+		{f.IsPlatformBinary(), "platform-binary"},
+		{f.IsBundle(), "bundle"},
+		{f.IsDylib(), "dylib"},
+		{f.IsExecutable(), "executable"},
+		{f.OverridableDylib(), "overridable"},
+		{f.InDyldCache(), "in-dyld-cache"},
+		{f.HasTerminators(), "terminators"},
+		{f.HasReadOnlyData(), "read-only-data"},
+		{f.HasChainedFixups(), "chained-fixups"},
+		{f.HasPrecomputedObjC(), "precomputed-objc"},
+		{f.FixupsNotEncoded(), "fixups-not-encoded"},
+		{f.RebasesNotEncoded(), "rebases-not-encoded"},
+		{f.HasOverrideImageNum(), "override-image-num"},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	return strings.Join(flags, "|")
+}
+
+// DiskSegment is a closure Image::DiskSegment
+type DiskSegment uint64
+
+func (s DiskSegment) FilePageCount() uint32 { return uint32(s & 0x3fffffff) }
+func (s DiskSegment) VMPageCount() uint32   { return uint32(s>>30) & 0x3fffffff }
+func (s DiskSegment) Permissions() types.VmProtection {
+	return types.VmProtection((s >> 60) & 0x7)
+}
+func (s DiskSegment) PaddingNotSeg() bool { return (s>>63)&1 == 1 }
+
+// CacheSegment is a closure Image::DyldCacheSegment
+type CacheSegment uint64
+
+func (s CacheSegment) CacheOffset() uint32 { return uint32(s & 0xffffffff) }
+func (s CacheSegment) Size() uint32        { return uint32(s>>32) & 0xfffffff }
+func (s CacheSegment) Permissions() types.VmProtection {
+	return types.VmProtection((s >> 60) & 0xf)
+}
+
+// LinkKind is the kind of a closure dependent image
+type LinkKind uint8
+
+const (
+	LinkRegular  LinkKind = 0
+	LinkWeak     LinkKind = 1
+	LinkUpward   LinkKind = 2
+	LinkReExport LinkKind = 3
+)
+
+func (k LinkKind) String() string {
+	switch k {
+	case LinkRegular:
+		return "regular"
+	case LinkWeak:
+		return "weak"
+	case LinkUpward:
+		return "upward"
+	case LinkReExport:
+		return "re-export"
+	}
+	return "unknown"
+}
+
+// LinkedImage is a closure Image::LinkedImage
+type LinkedImage uint32
+
+func (l LinkedImage) ImageNum() ImageNum { return ImageNum(l & 0x3fffffff) }
+func (l LinkedImage) Kind() LinkKind     { return LinkKind(l >> 30) }
+
+// RebasePattern is a closure Image::RebasePattern
+type RebasePattern uint32
+
+func (p RebasePattern) RepeatCount() uint32 { return uint32(p & 0xfffff) }
+func (p RebasePattern) ContigCount() uint32 { return uint32(p>>20) & 0xff }
+func (p RebasePattern) SkipCount() uint32   { return uint32(p >> 28) }
+
+// BindPattern is a closure Image::BindPattern
+type BindPattern struct {
+	Target ResolvedSymbolTarget
+	Info   uint64 // startVmOffset:40, skipCount:8, repeatCount:16
+}
+
+func (p BindPattern) StartVMOffset() uint64 { return p.Info & 0xffffffffff }
+func (p BindPattern) SkipCount() uint64     { return (p.Info >> 40) & 0xff }
+func (p BindPattern) RepeatCount() uint64   { return p.Info >> 48 }
+
+// TextFixupPattern is a closure Image::TextFixupPattern
+type TextFixupPattern struct {
+	Target        ResolvedSymbolTarget
+	StartVMOffset uint32
+	RepeatCount   uint16
+	SkipCount     uint16
+}
+
+// InitializerSectionRange is a closure Image::InitializerSectionRange
+type InitializerSectionRange struct {
+	SectionOffset uint32
+	SectionSize   uint32
+}
+
+// CodeSignatureLocation is a closure Image::CodeSignatureLocation
+type CodeSignatureLocation struct {
+	FileOffset uint32
+	FileSize   uint32
+}
+
+// FairPlayRange is a closure Image::FairPlayRange
+type FairPlayRange struct {
+	RangeStart  uint32
+	RangeLength uint32
+}
+
+// ClosureFileInfo is a closure Image::FileInfo
+type ClosureFileInfo struct {
+	Inode   uint64
+	ModTime uint64
+}
+
+// ClosureMappingInfo is a closure Image::MappingInfo
+type ClosureMappingInfo struct {
+	TotalVMPages    uint32
+	SliceOffsetIn4K uint32
+}
+
+// ClosureImage is a dyld3 closure Image
+type ClosureImage struct {
+	Flags                ClosureImageFlags
+	Paths                []string
+	FileInfo             *ClosureFileInfo
+	CDHashes             []string
+	UUID                 types.UUID
+	MappingInfo          *ClosureMappingInfo
+	DiskSegments         []DiskSegment
+	CacheSegments        []CacheSegment
+	Dependents           []LinkedImage
+	InitOffsets          []uint32
+	TermOffsets          []uint32
+	DOFOffsets           []uint32
+	CodeSignature        *CodeSignatureLocation
+	FairPlay             *FairPlayRange
+	RebaseFixups         []RebasePattern
+	BindFixups           []BindPattern
+	TextFixups           []TextFixupPattern
+	OverrideImageNum     ImageNum
+	InitBefores          []ImageNum
+	InitsSection         *InitializerSectionRange
+	ChainedFixupsTargets []ResolvedSymbolTarget
+	ChainedStartsOffset  uint64
+	HasObjCFixups        bool
+}
+
+// Num returns the image's ImageNum
+func (i *ClosureImage) Num() ImageNum {
+	return i.Flags.ImageNum()
+}
+
+// Path returns the image's primary install path
+func (i *ClosureImage) Path() string {
+	if len(i.Paths) > 0 {
+		return i.Paths[0]
+	}
+	return ""
+}
+
+func parseClosureImage(data []byte) (*ClosureImage, error) {
+	attrs, err := parseTypedBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	img := &ClosureImage{}
+	for _, attr := range attrs {
+		p := attr.Payload
+		r := bytes.NewReader(p)
+		switch attr.Type {
+		case ImageFlagsType:
+			if len(p) >= 8 {
+				img.Flags = ClosureImageFlags(binary.LittleEndian.Uint64(p))
+			}
+		case PathWithHashType:
+			if len(p) > 4 {
+				img.Paths = append(img.Paths, cstring(p[4:]))
+			}
+		case FileInodeAndTimeType:
+			img.FileInfo = &ClosureFileInfo{}
+			binary.Read(r, binary.LittleEndian, img.FileInfo)
+		case CdHashType:
+			if len(p) >= 20 {
+				img.CDHashes = append(img.CDHashes, hex.EncodeToString(p[:20]))
+			}
+		case UUIDType:
+			copy(img.UUID[:], p)
+		case MappingInfoType:
+			img.MappingInfo = &ClosureMappingInfo{}
+			binary.Read(r, binary.LittleEndian, img.MappingInfo)
+		case DiskSegmentType:
+			for _, v := range readUint64s(p) {
+				img.DiskSegments = append(img.DiskSegments, DiskSegment(v))
+			}
+		case CacheSegmentType:
+			for _, v := range readUint64s(p) {
+				img.CacheSegments = append(img.CacheSegments, CacheSegment(v))
+			}
+		case DependentsType:
+			for _, v := range readUint32s(p) {
+				img.Dependents = append(img.Dependents, LinkedImage(v))
+			}
+		case InitOffsetsType:
+			img.InitOffsets = readUint32s(p)
+		case TermOffsetsType:
+			img.TermOffsets = readUint32s(p)
+		case DofOffsetsType:
+			img.DOFOffsets = readUint32s(p)
+		case CodeSignLocType:
+			img.CodeSignature = &CodeSignatureLocation{}
+			binary.Read(r, binary.LittleEndian, img.CodeSignature)
+		case FairPlayLocType:
+			img.FairPlay = &FairPlayRange{}
+			binary.Read(r, binary.LittleEndian, img.FairPlay)
+		case RebaseFixupsType:
+			for _, v := range readUint32s(p) {
+				img.RebaseFixups = append(img.RebaseFixups, RebasePattern(v))
+			}
+		case BindFixupsType:
+			img.BindFixups = make([]BindPattern, len(p)/binary.Size(BindPattern{}))
+			binary.Read(r, binary.LittleEndian, img.BindFixups)
+		case TextFixupsType:
+			img.TextFixups = make([]TextFixupPattern, len(p)/binary.Size(TextFixupPattern{}))
+			binary.Read(r, binary.LittleEndian, img.TextFixups)
+		case ImageOverrideType:
+			if len(p) >= 4 {
+				img.OverrideImageNum = ImageNum(binary.LittleEndian.Uint32(p))
+			}
+		case InitBeforesType:
+			for _, v := range readUint32s(p) {
+				img.InitBefores = append(img.InitBefores, ImageNum(v))
+			}
+		case InitsSectionType:
+			img.InitsSection = &InitializerSectionRange{}
+			binary.Read(r, binary.LittleEndian, img.InitsSection)
+		case ChainedFixupsTargetsType:
+			for _, v := range readUint64s(p) {
+				img.ChainedFixupsTargets = append(img.ChainedFixupsTargets, ResolvedSymbolTarget(v))
+			}
+		case ChainedStartsOffsetType:
+			if len(p) >= 8 {
+				img.ChainedStartsOffset = binary.LittleEndian.Uint64(p)
+			}
+		case ObjcFixupsType:
+			img.HasObjCFixups = true
+		}
+	}
+	return img, nil
+}
+
+// Rebases returns the image relative offsets of all the pointers to rebase
+func (i *ClosureImage) Rebases() []uint64 {
+	var offsets []uint64
+	var cur uint64
+	ptrSize := uint64(8)
+	if !i.Flags.Is64() {
+		ptrSize = 4
+	}
+	for _, pat := range i.RebaseFixups {
+		if pat.ContigCount() == 0 {
+			// a zero contigCount just skips ahead (in units of pointer size)
+			cur += uint64(pat.RepeatCount()) * ptrSize
+			continue
+		}
+		for r := uint32(0); r < pat.RepeatCount(); r++ {
+			for c := uint32(0); c < pat.ContigCount(); c++ {
+				offsets = append(offsets, cur)
+				cur += ptrSize
+			}
+			cur += uint64(pat.SkipCount()) * ptrSize
+		}
+	}
+	return offsets
+}
+
+// ClosureBind is a single bind location and the target it should point to
+type ClosureBind struct {
+	Offset uint64
+	Target ResolvedSymbolTarget
+}
+
+// Binds returns all of the image's bind locations
+func (i *ClosureImage) Binds() []ClosureBind {
+	var binds []ClosureBind
+	ptrSize := uint64(8)
+	if !i.Flags.Is64() {
+		ptrSize = 4
+	}
+	for _, pat := range i.BindFixups {
+		cur := pat.StartVMOffset()
+		for r := uint64(0); r < pat.RepeatCount(); r++ {
+			binds = append(binds, ClosureBind{Offset: cur, Target: pat.Target})
+			cur += (pat.SkipCount() + 1) * ptrSize
+		}
+	}
+	return binds
+}
+
+// String returns a summary of the image
+func (i *ClosureImage) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Image %d: %s\n", i.Num(), i.Path()))
+	if len(i.Paths) > 1 {
+		for _, alias := range i.Paths[1:] {
+			sb.WriteString(fmt.Sprintf("  alias:   %s\n", alias))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("  flags:   %s\n", i.Flags))
+	if i.UUID != (types.UUID{}) {
+		sb.WriteString(fmt.Sprintf("  uuid:    %s\n", i.UUID))
+	}
+	for _, cdh := range i.CDHashes {
+		sb.WriteString(fmt.Sprintf("  cdHash:  %s\n", cdh))
+	}
+	if i.FileInfo != nil {
+		sb.WriteString(fmt.Sprintf("  inode:   %#x, mtime: %#x\n", i.FileInfo.Inode, i.FileInfo.ModTime))
+	}
+	if i.CodeSignature != nil {
+		sb.WriteString(fmt.Sprintf("  codesig: offset=%#x, size=%#x\n", i.CodeSignature.FileOffset, i.CodeSignature.FileSize))
+	}
+	if i.FairPlay != nil {
+		sb.WriteString(fmt.Sprintf("  fairplay: start=%#x, length=%#x\n", i.FairPlay.RangeStart, i.FairPlay.RangeLength))
+	}
+	if len(i.DiskSegments) > 0 {
+		sb.WriteString("  disk segments:\n")
+		for _, seg := range i.DiskSegments {
+			sb.WriteString(fmt.Sprintf("    file_pages=%d vm_pages=%d prot=%s\n", seg.FilePageCount(), seg.VMPageCount(), seg.Permissions()))
+		}
+	}
+	if len(i.CacheSegments) > 0 {
+		sb.WriteString("  cache segments:\n")
+		for _, seg := range i.CacheSegments {
+			sb.WriteString(fmt.Sprintf("    cache_offset=%#x size=%#x prot=%s\n", seg.CacheOffset(), seg.Size(), seg.Permissions()))
+		}
+	}
+	if len(i.Dependents) > 0 {
+		sb.WriteString("  dependents:\n")
+		for _, dep := range i.Dependents {
+			sb.WriteString(fmt.Sprintf("    %d (%s)\n", dep.ImageNum(), dep.Kind()))
+		}
+	}
+	if len(i.InitOffsets) > 0 {
+		sb.WriteString("  initializers:\n")
+		for _, off := range i.InitOffsets {
+			sb.WriteString(fmt.Sprintf("    %#x\n", off))
+		}
+	}
+	if i.InitsSection != nil {
+		sb.WriteString(fmt.Sprintf("  inits section: offset=%#x, size=%#x\n", i.InitsSection.SectionOffset, i.InitsSection.SectionSize))
+	}
+	if len(i.TermOffsets) > 0 {
+		sb.WriteString("  terminators:\n")
+		for _, off := range i.TermOffsets {
+			sb.WriteString(fmt.Sprintf("    %#x\n", off))
+		}
+	}
+	if len(i.RebaseFixups) > 0 {
+		sb.WriteString(fmt.Sprintf("  rebases: %d\n", len(i.Rebases())))
+	}
+	if len(i.BindFixups) > 0 {
+		sb.WriteString(fmt.Sprintf("  binds:   %d\n", len(i.Binds())))
+	}
+	if len(i.ChainedFixupsTargets) > 0 {
+		sb.WriteString(fmt.Sprintf("  chained fixup targets: %d (starts @ %#x)\n", len(i.ChainedFixupsTargets), i.ChainedStartsOffset))
+	}
+	return sb.String()
+}
+
+/**************
+ * ImageArray *
+ **************/
+
+// ImageArray is a dyld3 closure ImageArray
+type ImageArray struct {
+	FirstImageNum ImageNum
+	HasRoots      bool
+	Images        []*ClosureImage
+}
+
+func parseImageArray(data []byte) (*ImageArray, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("image array too small")
+	}
+	ia := &ImageArray{
+		FirstImageNum: ImageNum(binary.LittleEndian.Uint32(data)),
+	}
+	countAndRoots := binary.LittleEndian.Uint32(data[4:])
+	count := int(countAndRoots & 0x7fffffff)
+	ia.HasRoots = countAndRoots>>31 == 1
+	if 8+count*4 > len(data) {
+		return nil, fmt.Errorf("image array offsets overflow (count=%d)", count)
+	}
+	offsets := readUint32s(data[8 : 8+count*4])
+	for idx, off := range offsets {
+		// image offsets are relative to the start of the ImageArray payload
+		if int(off)+4 > len(data) {
+			return nil, fmt.Errorf("image %d offset %#x overflows image array", idx, off)
+		}
+		hdr := binary.LittleEndian.Uint32(data[off:])
+		if typ := ClosureType(hdr & 0xff); typ != ImageType {
+			return nil, fmt.Errorf("image %d has unexpected type %s", idx, typ)
+		}
+		end := int(off) + 4 + int(hdr>>8)
+		if end > len(data) {
+			return nil, fmt.Errorf("image %d overflows image array", idx)
+		}
+		img, err := parseClosureImage(data[off+4 : end])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse image %d", idx)
+		}
+		ia.Images = append(ia.Images, img)
+	}
+	return ia, nil
+}
+
+// ImageForNum returns the image with the given ImageNum
+func (ia *ImageArray) ImageForNum(num ImageNum) *ClosureImage {
+	if ia == nil || num < ia.FirstImageNum {
+		return nil
+	}
+	if idx := int(num - ia.FirstImageNum); idx < len(ia.Images) {
+		return ia.Images[idx]
+	}
+	return nil
+}
+
+/***********
+ * Closure *
+ ***********/
+
+// ClosureFlags are the dyld3 LaunchClosure::Flags
+type ClosureFlags uint32
+
+func (f ClosureFlags) UsedAtPaths() bool          { return f&1 != 0 }
+func (f ClosureFlags) UsedFallbackPaths() bool    { return (f>>1)&1 != 0 }
+func (f ClosureFlags) InitImageCount() uint32     { return uint32(f>>2) & 0xffff }
+func (f ClosureFlags) HasInsertedLibraries() bool { return (f>>18)&1 != 0 }
+func (f ClosureFlags) HasProgVars() bool          { return (f>>19)&1 != 0 }
+func (f ClosureFlags) UsedInterposing() bool      { return (f>>20)&1 != 0 }
+
+// PatchEntry is a closure Closure::PatchEntry
+type PatchEntry struct {
+	OverriddenDylibInCache ImageNum
+	ExportCacheOffset      uint32
+	Replacement            ResolvedSymbolTarget
+}
+
+// InterposingTuple is a closure InterposingTuple
+type InterposingTuple struct {
+	StockImplementation ResolvedSymbolTarget
+	NewImplementation   ResolvedSymbolTarget
+}
+
+// ClosureWarning is a closure warning
+type ClosureWarning struct {
+	Kind    uint32
+	Message string
+}
+
+// Closure is a dyld3 launch or dlopen closure
+type Closure struct {
+	Type            ClosureType
+	Flags           ClosureFlags
+	DyldCacheUUID   types.UUID
+	TopImage        ImageNum
+	LibSystemNum    ImageNum
+	LibDyldEntry    *ResolvedSymbolTarget
+	MainEntry       *ResolvedSymbolTarget
+	StartEntry      *ResolvedSymbolTarget
+	ProgVarsOffset  uint32
+	MissingFiles    []string
+	EnvVars         []string
+	CacheOverrides  []PatchEntry
+	InterposeTuples []InterposingTuple
+	Warnings        []ClosureWarning
+	HasObjCTables   bool
+	Images          *ImageArray
+}
+
+func parseClosure(typ ClosureType, data []byte) (*Closure, error) {
+	attrs, err := parseTypedBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	c := &Closure{Type: typ}
+	target := func(p []byte) *ResolvedSymbolTarget {
+		if len(p) < 8 {
+			return nil
+		}
+		t := ResolvedSymbolTarget(binary.LittleEndian.Uint64(p))
+		return &t
+	}
+	for _, attr := range attrs {
+		p := attr.Payload
+		switch attr.Type {
+		case ImageArrayType:
+			if c.Images, err = parseImageArray(p); err != nil {
+				return nil, errors.Wrap(err, "failed to parse closure image array")
+			}
+		case ClosureFlagsType:
+			if len(p) >= 4 {
+				c.Flags = ClosureFlags(binary.LittleEndian.Uint32(p))
+			}
+		case DyldCacheUUIDType:
+			copy(c.DyldCacheUUID[:], p)
+		case TopImageType:
+			if len(p) >= 4 {
+				c.TopImage = ImageNum(binary.LittleEndian.Uint32(p))
+			}
+		case LibSystemNumType:
+			if len(p) >= 4 {
+				c.LibSystemNum = ImageNum(binary.LittleEndian.Uint32(p))
+			}
+		case LibDyldEntryType:
+			c.LibDyldEntry = target(p)
+		case MainEntryType:
+			c.MainEntry = target(p)
+		case StartEntryType:
+			c.StartEntry = target(p)
+		case ProgVarsType:
+			if len(p) >= 4 {
+				c.ProgVarsOffset = binary.LittleEndian.Uint32(p)
+			}
+		case MissingFilesType:
+			for _, path := range bytes.Split(p, []byte{0}) {
+				if len(path) > 0 {
+					c.MissingFiles = append(c.MissingFiles, string(path))
+				}
+			}
+		case EnvVarType:
+			c.EnvVars = append(c.EnvVars, cstring(p))
+		case CacheOverridesType:
+			c.CacheOverrides = make([]PatchEntry, len(p)/binary.Size(PatchEntry{}))
+			binary.Read(bytes.NewReader(p), binary.LittleEndian, c.CacheOverrides)
+		case InterposeTuplesType:
+			c.InterposeTuples = make([]InterposingTuple, len(p)/binary.Size(InterposingTuple{}))
+			binary.Read(bytes.NewReader(p), binary.LittleEndian, c.InterposeTuples)
+		case WarningType:
+			if len(p) >= 4 {
+				c.Warnings = append(c.Warnings, ClosureWarning{
+					Kind:    binary.LittleEndian.Uint32(p),
+					Message: cstring(p[4:]),
+				})
+			}
+		case SelectorTableType, ClassTableType, DuplicateClassesTableType:
+			c.HasObjCTables = true
+		}
+	}
+	return c, nil
+}
+
+// ParseClosure parses a TypedBytes encoded launch or dlopen closure
+func ParseClosure(data []byte) (*Closure, error) {
+	tbs, err := parseTypedBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(tbs) == 0 {
+		return nil, fmt.Errorf("empty closure")
+	}
+	if tbs[0].Type != LaunchClosureType && tbs[0].Type != DlopenClosureType {
+		return nil, fmt.Errorf("unexpected closure type %s", tbs[0].Type)
+	}
+	return parseClosure(tbs[0].Type, tbs[0].Payload)
+}
+
+// String returns a summary of the closure
+func (c *Closure) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s\n", c.Type))
+	if c.DyldCacheUUID != (types.UUID{}) {
+		sb.WriteString(fmt.Sprintf("  dyld cache uuid: %s\n", c.DyldCacheUUID))
+	}
+	if c.Type == LaunchClosureType {
+		sb.WriteString(fmt.Sprintf("  init image count: %d\n", c.Flags.InitImageCount()))
+		var flags []string
+		if c.Flags.UsedAtPaths() {
+			flags = append(flags, "used-@paths")
+		}
+		if c.Flags.UsedFallbackPaths() {
+			flags = append(flags, "used-fallback-paths")
+		}
+		if c.Flags.HasInsertedLibraries() {
+			flags = append(flags, "inserted-libraries")
+		}
+		if c.Flags.HasProgVars() {
+			flags = append(flags, "prog-vars")
+		}
+		if c.Flags.UsedInterposing() {
+			flags = append(flags, "interposing")
+		}
+		if len(flags) > 0 {
+			sb.WriteString(fmt.Sprintf("  flags: %s\n", strings.Join(flags, "|")))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("  top image: %d\n", c.TopImage))
+	if c.LibSystemNum > 0 {
+		sb.WriteString(fmt.Sprintf("  libSystem: %d\n", c.LibSystemNum))
+	}
+	if c.LibDyldEntry != nil {
+		sb.WriteString(fmt.Sprintf("  libdyld entry: %s\n", c.LibDyldEntry))
+	}
+	if c.MainEntry != nil {
+		sb.WriteString(fmt.Sprintf("  main entry: %s\n", c.MainEntry))
+	}
+	if c.StartEntry != nil {
+		sb.WriteString(fmt.Sprintf("  start entry: %s\n", c.StartEntry))
+	}
+	for _, env := range c.EnvVars {
+		sb.WriteString(fmt.Sprintf("  env: %s\n", env))
+	}
+	for _, missing := range c.MissingFiles {
+		sb.WriteString(fmt.Sprintf("  missing: %s\n", missing))
+	}
+	for _, patch := range c.CacheOverrides {
+		sb.WriteString(fmt.Sprintf("  override: image(%d)+%#x -> %s\n", patch.OverriddenDylibInCache, patch.ExportCacheOffset, patch.Replacement))
+	}
+	for _, tuple := range c.InterposeTuples {
+		sb.WriteString(fmt.Sprintf("  interpose: %s -> %s\n", tuple.StockImplementation, tuple.NewImplementation))
+	}
+	for _, warn := range c.Warnings {
+		sb.WriteString(fmt.Sprintf("  warning: %s\n", warn.Message))
+	}
+	if c.Images != nil {
+		sb.WriteString(fmt.Sprintf("  images: %d (first image num %d)\n", len(c.Images.Images), c.Images.FirstImageNum))
+	}
+	return sb.String()
+}
+
+/*********************
+ * dyld_shared_cache *
+ *********************/
+
+func (f *File) readTypedBytesAt(addr uint64) ([]byte, error) {
+	offset, err := f.GetOffset(addr)
+	if err != nil {
+		return nil, err
+	}
+	sr := io.NewSectionReader(f.r, 0, 1<<63-1)
+	hdr := make([]byte, 4)
+	if _, err := sr.ReadAt(hdr, int64(offset)); err != nil {
+		return nil, err
+	}
+	data := make([]byte, 4+int(binary.LittleEndian.Uint32(hdr)>>8))
+	if _, err := sr.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (f *File) parseImageArrayAt(addr uint64) (*ImageArray, error) {
+	data, err := f.readTypedBytesAt(addr)
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := parseTypedBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(tbs) == 0 || tbs[0].Type != ImageArrayType {
+		return nil, fmt.Errorf("no image array at %#x", addr)
+	}
+	return parseImageArray(tbs[0].Payload)
+}
+
+// GetDylibsImageArray returns the dyld3 ImageArray for the cached dylibs
+func (f *File) GetDylibsImageArray() (*ImageArray, error) {
+	addr := f.DylibsImageArrayAddr
+	if addr == 0 {
+		addr = f.DylibsImageArrayWithSubCachesAddr
+	}
+	if addr == 0 {
+		return nil, ErrNoClosures
+	}
+	return f.parseImageArrayAt(addr)
+}
+
+// GetOtherImageArray returns the dyld3 ImageArray for the dylibs and bundles with dlopen closures
+func (f *File) GetOtherImageArray() (*ImageArray, error) {
+	if f.OtherImageArrayAddr == 0 {
+		return nil, ErrNoClosures
+	}
+	return f.parseImageArrayAt(f.OtherImageArrayAddr)
+}
+
+// GetLaunchClosure returns the parsed dyld3 launch closure for a given executable path
+func (f *File) GetLaunchClosure(executablePath string) (*Closure, error) {
+	if f.ProgClosuresTrieAddr == 0 {
+		if f.ProgClosuresTrieWithSubCachesAddr == 0 {
+			return nil, ErrNoClosures
+		}
+		return f.getLaunchClosure(executablePath, f.ProgClosuresWithSubCachesAddr, f.ProgClosuresTrieWithSubCachesAddr, uint64(f.ProgClosuresTrieWithSubCachesSize))
+	}
+	return f.getLaunchClosure(executablePath, f.ProgClosuresAddr, f.ProgClosuresTrieAddr, f.ProgClosuresTrieSize)
+}
+
+func (f *File) getLaunchClosure(executablePath string, closuresAddr, trieAddr, trieSize uint64) (*Closure, error) {
+	offset, err := f.GetOffset(trieAddr)
+	if err != nil {
+		return nil, err
+	}
+	progClosuresTrie := make([]byte, trieSize)
+	if _, err := io.NewSectionReader(f.r, 0, 1<<63-1).ReadAt(progClosuresTrie, int64(offset)); err != nil {
+		return nil, err
+	}
+	imageNode, err := trie.WalkTrie(progClosuresTrie, executablePath)
+	if err != nil {
+		return nil, fmt.Errorf("no launch closure for %s: %v", executablePath, err)
+	}
+	closureOffset, _, err := trie.ReadUleb128FromBuffer(bytes.NewBuffer(progClosuresTrie[imageNode:]))
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.readTypedBytesAt(closuresAddr + closureOffset)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read launch closure for %s", executablePath)
+	}
+	return ParseClosure(data)
+}
+
+// GetDlopenImage returns the dyld3 dlopen closure image for a given path
+func (f *File) GetDlopenImage(path string) (*ClosureImage, error) {
+	imageNum, err := f.FindDlopenOtherImage(path)
+	if err != nil {
+		return nil, err
+	}
+	other, err := f.GetOtherImageArray()
+	if err != nil {
+		return nil, err
+	}
+	if img := other.ImageForNum(ImageNum(imageNum)); img != nil {
+		return img, nil
+	}
+	// dlopen-able cached dylibs map to their entry in the dylibs image array
+	dylibs, err := f.GetDylibsImageArray()
+	if err != nil {
+		return nil, err
+	}
+	if img := dylibs.ImageForNum(ImageNum(imageNum)); img != nil {
+		return img, nil
+	}
+	return nil, fmt.Errorf("image number %d for %s not found", imageNum, path)
+}
+
+// ClosureImagePath returns the path of a closure ImageNum, looking in
+// the closure's own image array and then the cache's image arrays
+func (f *File) ClosureImagePath(c *Closure, num ImageNum) string {
+	if c != nil {
+		if img := c.Images.ImageForNum(num); img != nil {
+			return img.Path()
+		}
+	}
+	// cached dylibs are numbered from 1 in cache order
+	if num > 0 && int(num) <= len(f.Images) {
+		return f.Images[num-1].Name
+	}
+	if other, err := f.GetOtherImageArray(); err == nil {
+		if img := other.ImageForNum(num); img != nil {
+			return img.Path()
+		}
+	}
+	return fmt.Sprintf("image(%d)", num)
+}
+
+// ClosureInitOrder returns the paths of the images in the order a launch
+// closure runs their initializers
+func (f *File) ClosureInitOrder(c *Closure) []string {
+	var order []string
+	top := c.Images.ImageForNum(c.TopImage)
+	if top == nil {
+		return nil
+	}
+	for _, num := range top.InitBefores {
+		order = append(order, f.ClosureImagePath(c, num))
+	}
+	return order
+}
@@ -0,0 +1,238 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/go-macho/types"
+)
+
+// typedBytes encodes a closure TypedBytes entry
+func typedBytes(typ ClosureType, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	out := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint32(out, uint32(typ)|uint32(len(data))<<8)
+	return append(out, data...)
+}
+
+func le(vals ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, v := range vals {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+func cstr(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// imageArray encodes an ImageArray payload holding the (ImageType) images
+func imageArray(first ImageNum, images ...[]byte) []byte {
+	data := le(uint32(first), uint32(len(images)))
+	off := uint32(8 + 4*len(images))
+	for _, img := range images {
+		data = append(data, le(off)...)
+		off += uint32(len(img))
+	}
+	return append(data, bytes.Join(images, nil)...)
+}
+
+const (
+	testImageFlags64   = 1 << 30
+	testImageFlagsExec = 1 << 40
+	testImageFlagsLib  = 1 << 39
+)
+
+var testUUID = types.UUID{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+
+// testLaunchClosure is a launch closure for /usr/bin/test (image 0x2000) which links an
+// image at /usr/lib/libtest.dylib (image 0x2001) and libSystem (cached image 5)
+func testLaunchClosure() []byte {
+	// image(0x2001)+0x3f00
+	mainEntry := uint64(ImageTarget) | 0x2001<<2 | 0x3f00<<24
+	exe := typedBytes(ImageType,
+		typedBytes(ImageFlagsType, le(uint64(0x2000|testImageFlags64|testImageFlagsExec))),
+		typedBytes(PathWithHashType, le(uint32(0x1234)), cstr("/usr/bin/test")),
+		typedBytes(PathWithHashType, le(uint32(0x5678)), cstr("/usr/bin/test-alias")),
+		typedBytes(UUIDType, testUUID[:]),
+		typedBytes(CdHashType, bytes.Repeat([]byte{0xaa}, 20)),
+		typedBytes(FileInodeAndTimeType, le(ClosureFileInfo{Inode: 0x1122, ModTime: 0x5f000000})),
+		// __TEXT: 4 file pages, 4 vm pages, r-x; __DATA: 1 file page, 2 vm pages, rw-
+		typedBytes(DiskSegmentType, le(uint64(4|4<<30|5<<60), uint64(1|2<<30|3<<60))),
+		typedBytes(DependentsType, le(uint32(5), uint32(0x2001|uint32(LinkWeak)<<30))),
+		typedBytes(InitBeforesType, le(uint32(5), uint32(0x2001), uint32(0x2000))),
+		typedBytes(InitOffsetsType, le(uint32(0x3f40), uint32(0x3f80))),
+		typedBytes(CodeSignLocType, le(CodeSignatureLocation{FileOffset: 0x8000, FileSize: 0x400})),
+		// 2x (2 contiguous pointers then skip 1), skip 3 pointers, 1 pointer
+		typedBytes(RebaseFixupsType, le(uint32(2|2<<20|1<<28), uint32(3), uint32(1|1<<20))),
+		// 3 pointers from 0x100 skipping 1 between each
+		typedBytes(BindFixupsType, le(BindPattern{Target: ResolvedSymbolTarget(uint64(SharedCacheTarget) | 0x1234<<2), Info: 0x100 | 1<<40 | 3<<48})),
+	)
+	lib := typedBytes(ImageType,
+		typedBytes(ImageFlagsType, le(uint64(0x2001|testImageFlags64|testImageFlagsLib))),
+		typedBytes(PathWithHashType, le(uint32(0x9abc)), cstr("/usr/lib/libtest.dylib")),
+	)
+	return typedBytes(LaunchClosureType,
+		typedBytes(ImageArrayType, imageArray(0x2000, exe, lib)),
+		// initImageCount 3, used-@paths, prog-vars
+		typedBytes(ClosureFlagsType, le(uint32(1|3<<2|1<<19))),
+		typedBytes(DyldCacheUUIDType, testUUID[:]),
+		typedBytes(TopImageType, le(uint32(0x2000))),
+		typedBytes(LibSystemNumType, le(uint32(5))),
+		typedBytes(MainEntryType, le(mainEntry)),
+		typedBytes(ProgVarsType, le(uint32(0x4000))),
+		typedBytes(EnvVarType, cstr("DYLD_INSERT_LIBRARIES=/tmp/x.dylib")),
+		typedBytes(MissingFilesType, cstr("/missing/a"), cstr("/missing/b")),
+		typedBytes(WarningType, le(uint32(0)), cstr("duplicate class")),
+	)
+}
+
+func TestParseClosure(t *testing.T) {
+	c, err := ParseClosure(testLaunchClosure())
+	if err != nil {
+		t.Fatalf("ParseClosure() error = %v", err)
+	}
+
+	if c.Type != LaunchClosureType || c.DyldCacheUUID != testUUID {
+		t.Errorf("closure type = %s, dyld cache uuid = %s", c.Type, c.DyldCacheUUID)
+	}
+	if !c.Flags.UsedAtPaths() || c.Flags.UsedFallbackPaths() || c.Flags.InitImageCount() != 3 || !c.Flags.HasProgVars() {
+		t.Errorf("closure flags = %#x", uint32(c.Flags))
+	}
+	if c.TopImage != 0x2000 || c.LibSystemNum != 5 || c.ProgVarsOffset != 0x4000 {
+		t.Errorf("top image = %#x, libSystem = %d, prog vars = %#x", c.TopImage, c.LibSystemNum, c.ProgVarsOffset)
+	}
+	if c.MainEntry == nil || c.MainEntry.Kind() != ImageTarget || c.MainEntry.ImageNum() != 0x2001 || c.MainEntry.Offset() != 0x3f00 {
+		t.Errorf("main entry = %v", c.MainEntry)
+	}
+	if c.LibDyldEntry != nil || c.StartEntry != nil {
+		t.Errorf("libdyld entry = %v, start entry = %v", c.LibDyldEntry, c.StartEntry)
+	}
+	if !reflect.DeepEqual(c.EnvVars, []string{"DYLD_INSERT_LIBRARIES=/tmp/x.dylib"}) {
+		t.Errorf("env vars = %q", c.EnvVars)
+	}
+	if !reflect.DeepEqual(c.MissingFiles, []string{"/missing/a", "/missing/b"}) {
+		t.Errorf("missing files = %q", c.MissingFiles)
+	}
+	if len(c.Warnings) != 1 || c.Warnings[0].Message != "duplicate class" {
+		t.Errorf("warnings = %+v", c.Warnings)
+	}
+
+	if c.Images == nil || c.Images.FirstImageNum != 0x2000 || len(c.Images.Images) != 2 {
+		t.Fatalf("image array = %+v", c.Images)
+	}
+	exe := c.Images.ImageForNum(0x2000)
+	if exe == nil || exe.Num() != 0x2000 || c.Images.ImageForNum(0x2001).Path() != "/usr/lib/libtest.dylib" {
+		t.Fatalf("ImageForNum() = %v", exe)
+	}
+	if img := c.Images.ImageForNum(0x2002); img != nil {
+		t.Errorf("ImageForNum(0x2002) = %s", img.Path())
+	}
+	if img := c.Images.ImageForNum(5); img != nil {
+		t.Errorf("ImageForNum(5) = %s", img.Path())
+	}
+
+	if !exe.Flags.Is64() || !exe.Flags.IsExecutable() || exe.Flags.IsDylib() || exe.Flags.String() != "64-bit|executable" {
+		t.Errorf("image flags = %s", exe.Flags)
+	}
+	if !reflect.DeepEqual(exe.Paths, []string{"/usr/bin/test", "/usr/bin/test-alias"}) || exe.Path() != "/usr/bin/test" {
+		t.Errorf("image paths = %q", exe.Paths)
+	}
+	if exe.UUID != testUUID || !reflect.DeepEqual(exe.CDHashes, []string{strings.Repeat("aa", 20)}) {
+		t.Errorf("image uuid = %s, cdhashes = %q", exe.UUID, exe.CDHashes)
+	}
+	if exe.FileInfo == nil || *exe.FileInfo != (ClosureFileInfo{Inode: 0x1122, ModTime: 0x5f000000}) {
+		t.Errorf("image file info = %+v", exe.FileInfo)
+	}
+	if exe.CodeSignature == nil || *exe.CodeSignature != (CodeSignatureLocation{FileOffset: 0x8000, FileSize: 0x400}) {
+		t.Errorf("image code signature = %+v", exe.CodeSignature)
+	}
+	if len(exe.DiskSegments) != 2 {
+		t.Fatalf("got %d disk segments, want 2", len(exe.DiskSegments))
+	}
+	if seg := exe.DiskSegments[1]; seg.FilePageCount() != 1 || seg.VMPageCount() != 2 || seg.Permissions() != 3 || seg.PaddingNotSeg() {
+		t.Errorf("disk segment 1 = file %d, vm %d, prot %s", seg.FilePageCount(), seg.VMPageCount(), seg.Permissions())
+	}
+	if len(exe.Dependents) != 2 || exe.Dependents[0].ImageNum() != 5 || exe.Dependents[0].Kind() != LinkRegular ||
+		exe.Dependents[1].ImageNum() != 0x2001 || exe.Dependents[1].Kind() != LinkWeak {
+		t.Errorf("dependents = %v", exe.Dependents)
+	}
+	if !reflect.DeepEqual(exe.InitOffsets, []uint32{0x3f40, 0x3f80}) {
+		t.Errorf("init offsets = %#x", exe.InitOffsets)
+	}
+	if want := []uint64{0, 8, 24, 32, 72}; !reflect.DeepEqual(exe.Rebases(), want) {
+		t.Errorf("Rebases() = %#x, want %#x", exe.Rebases(), want)
+	}
+	wantBinds := []ClosureBind{{Offset: 0x100}, {Offset: 0x110}, {Offset: 0x120}}
+	for i := range wantBinds {
+		wantBinds[i].Target = ResolvedSymbolTarget(uint64(SharedCacheTarget) | 0x1234<<2)
+	}
+	if !reflect.DeepEqual(exe.Binds(), wantBinds) {
+		t.Errorf("Binds() = %+v, want %+v", exe.Binds(), wantBinds)
+	}
+	if got := exe.Binds()[0].Target.String(); got != "dyld_cache+0x1234" {
+		t.Errorf("bind target = %s", got)
+	}
+
+	// closure images resolve from the closure and unknown images fall back to their number
+	f := &File{}
+	if got := f.ClosureImagePath(c, 0x2001); got != "/usr/lib/libtest.dylib" {
+		t.Errorf("ClosureImagePath(0x2001) = %s", got)
+	}
+	if want := []string{"image(5)", "/usr/lib/libtest.dylib", "/usr/bin/test"}; !reflect.DeepEqual(f.ClosureInitOrder(c), want) {
+		t.Errorf("ClosureInitOrder() = %q, want %q", f.ClosureInitOrder(c), want)
+	}
+}
+
+func TestResolvedSymbolTarget(t *testing.T) {
+	tests := []struct {
+		target ResolvedSymbolTarget
+		want   string
+	}{
+		{ResolvedSymbolTarget(RebaseTarget), "rebase"},
+		{ResolvedSymbolTarget(uint64(SharedCacheTarget) | 0x1a2b3c<<2), "dyld_cache+0x1a2b3c"},
+		{ResolvedSymbolTarget(uint64(ImageTarget) | 7<<2 | 0x4000<<24), "image(7)+0x4000"},
+		{ResolvedSymbolTarget(uint64(AbsoluteTarget) | 0x10<<2), "absolute(0x10)"},
+		// absolute values are sign extended from 62 bits
+		{ResolvedSymbolTarget(^uint64(0)), "absolute(0xffffffffffffffff)"},
+	}
+	for _, tt := range tests {
+		if got := tt.target.String(); got != tt.want {
+			t.Errorf("ResolvedSymbolTarget(%#x) = %s, want %s", uint64(tt.target), got, tt.want)
+		}
+	}
+}
+
+func TestParseClosureErrors(t *testing.T) {
+	valid := testLaunchClosure()
+	truncated := append([]byte{}, valid...)
+	binary.LittleEndian.PutUint32(truncated, uint32(LaunchClosureType)|uint32(len(valid))<<8)
+
+	badImage := typedBytes(LaunchClosureType, typedBytes(ImageArrayType, imageArray(1, typedBytes(ImageFlagsType, le(uint64(1))))))
+	badCount := typedBytes(LaunchClosureType, typedBytes(ImageArrayType, le(uint32(1), uint32(100))))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a closure", typedBytes(ImageArrayType, imageArray(1))},
+		{"payload overflows", truncated},
+		{"image array entry isn't an image", badImage},
+		{"image array count overflows", badCount},
+	}
+	for _, tt := range tests {
+		if c, err := ParseClosure(tt.data); err == nil {
+			t.Errorf("ParseClosure(%s) = %v, want an error", tt.name, c)
+		}
+	}
+
+	dlopen := typedBytes(DlopenClosureType, typedBytes(TopImageType, le(uint32(0x3000))))
+	if c, err := ParseClosure(dlopen); err != nil || c.Type != DlopenClosureType || c.TopImage != 0x3000 || c.Images != nil {
+		t.Errorf("ParseClosure(dlopen) = %+v, %v", c, err)
+	}
+}
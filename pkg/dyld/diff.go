@@ -0,0 +1,333 @@
+package dyld
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/pkg/errors"
+)
+
+// DiffConfig is the dyld_shared_cache diff config
+type DiffConfig struct {
+	Images    []string // only diff images whose path contains one of these strings
+	Exports   bool
+	ObjC      bool
+	Functions bool
+}
+
+// FunctionSizeChange is a function whose size (from LC_FUNCTION_STARTS) changed between caches
+type FunctionSizeChange struct {
+	Name    string `json:"name"`
+	OldSize uint64 `json:"old_size"`
+	NewSize uint64 `json:"new_size"`
+}
+
+// ImageDiff is the diff of an image that exists in both dyld_shared_caches
+type ImageDiff struct {
+	Name             string               `json:"name"`
+	OldVersion       string               `json:"old_version,omitempty"`
+	NewVersion       string               `json:"new_version,omitempty"`
+	OldUUID          string               `json:"old_uuid,omitempty"`
+	NewUUID          string               `json:"new_uuid,omitempty"`
+	ExportsAdded     []string             `json:"exports_added,omitempty"`
+	ExportsRemoved   []string             `json:"exports_removed,omitempty"`
+	ClassesAdded     []string             `json:"classes_added,omitempty"`
+	ClassesRemoved   []string             `json:"classes_removed,omitempty"`
+	SelectorsAdded   []string             `json:"selectors_added,omitempty"`
+	SelectorsRemoved []string             `json:"selectors_removed,omitempty"`
+	ProtocolsAdded   []string             `json:"protocols_added,omitempty"`
+	ProtocolsRemoved []string             `json:"protocols_removed,omitempty"`
+	FunctionsChanged []FunctionSizeChange `json:"functions_changed,omitempty"`
+}
+
+// VersionChanged returns true if the image's version changed
+func (d ImageDiff) VersionChanged() bool {
+	return d.OldVersion != d.NewVersion
+}
+
+// UUIDChanged returns true if the image's UUID changed
+func (d ImageDiff) UUIDChanged() bool {
+	return d.OldUUID != d.NewUUID
+}
+
+// IsEmpty returns true if nothing changed in the image
+func (d ImageDiff) IsEmpty() bool {
+	return !d.VersionChanged() && !d.UUIDChanged() &&
+		len(d.ExportsAdded) == 0 && len(d.ExportsRemoved) == 0 &&
+		len(d.ClassesAdded) == 0 && len(d.ClassesRemoved) == 0 &&
+		len(d.SelectorsAdded) == 0 && len(d.SelectorsRemoved) == 0 &&
+		len(d.ProtocolsAdded) == 0 && len(d.ProtocolsRemoved) == 0 &&
+		len(d.FunctionsChanged) == 0
+}
+
+// CacheDiff is the diff of two dyld_shared_caches
+type CacheDiff struct {
+	OldUUID       string      `json:"old_uuid"`
+	NewUUID       string      `json:"new_uuid"`
+	ImagesAdded   []string    `json:"images_added,omitempty"`
+	ImagesRemoved []string    `json:"images_removed,omitempty"`
+	Images        []ImageDiff `json:"images,omitempty"`
+}
+
+// imageSummary is the set of diffable info gathered for a single image
+type imageSummary struct {
+	Version   string
+	UUID      string
+	Exports   map[string]bool
+	Classes   map[string]bool
+	Selectors map[string]bool
+	Protocols map[string]bool
+	Functions map[string]uint64
+}
+
+func (conf *DiffConfig) match(name string) bool {
+	if len(conf.Images) == 0 {
+		return true
+	}
+	for _, filter := range conf.Images {
+		if strings.Contains(name, filter) || strings.EqualFold(filepath.Base(name), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff compares two dyld_shared_caches
+func Diff(old, new *File, conf *DiffConfig) (*CacheDiff, error) {
+	if conf == nil {
+		conf = &DiffConfig{Exports: true, ObjC: true, Functions: true}
+	}
+
+	diff := &CacheDiff{
+		OldUUID: old.UUID.String(),
+		NewUUID: new.UUID.String(),
+	}
+
+	oldImages := make(map[string]*CacheImage)
+	for _, img := range old.Images {
+		if conf.match(img.Name) {
+			oldImages[img.Name] = img
+		}
+	}
+	newImages := make(map[string]*CacheImage)
+	for _, img := range new.Images {
+		if conf.match(img.Name) {
+			newImages[img.Name] = img
+		}
+	}
+
+	var common []string
+	for name := range newImages {
+		if _, ok := oldImages[name]; ok {
+			common = append(common, name)
+		} else {
+			diff.ImagesAdded = append(diff.ImagesAdded, name)
+		}
+	}
+	for name := range oldImages {
+		if _, ok := newImages[name]; !ok {
+			diff.ImagesRemoved = append(diff.ImagesRemoved, name)
+		}
+	}
+	sort.Strings(diff.ImagesAdded)
+	sort.Strings(diff.ImagesRemoved)
+	sort.Strings(common)
+
+	for _, name := range common {
+		log.WithField("image", name).Debug("Diffing")
+
+		o, err := old.summarizeImage(oldImages[name], conf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s in old cache", name)
+		}
+		n, err := new.summarizeImage(newImages[name], conf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s in new cache", name)
+		}
+
+		idiff := ImageDiff{
+			Name:       name,
+			OldVersion: o.Version,
+			NewVersion: n.Version,
+			OldUUID:    o.UUID,
+			NewUUID:    n.UUID,
+		}
+		idiff.ExportsAdded, idiff.ExportsRemoved = utils.DiffSets(o.Exports, n.Exports)
+		idiff.ClassesAdded, idiff.ClassesRemoved = utils.DiffSets(o.Classes, n.Classes)
+		idiff.SelectorsAdded, idiff.SelectorsRemoved = utils.DiffSets(o.Selectors, n.Selectors)
+		idiff.ProtocolsAdded, idiff.ProtocolsRemoved = utils.DiffSets(o.Protocols, n.Protocols)
+
+		for fn, newSize := range n.Functions {
+			if oldSize, ok := o.Functions[fn]; ok && oldSize != newSize {
+				idiff.FunctionsChanged = append(idiff.FunctionsChanged, FunctionSizeChange{
+					Name:    fn,
+					OldSize: oldSize,
+					NewSize: newSize,
+				})
+			}
+		}
+		sort.Slice(idiff.FunctionsChanged, func(i, j int) bool {
+			return idiff.FunctionsChanged[i].Name < idiff.FunctionsChanged[j].Name
+		})
+
+		if !idiff.IsEmpty() {
+			diff.Images = append(diff.Images, idiff)
+		}
+	}
+
+	return diff, nil
+}
+
+func (f *File) summarizeImage(image *CacheImage, conf *DiffConfig) (*imageSummary, error) {
+	sum := &imageSummary{
+		Exports:   make(map[string]bool),
+		Classes:   make(map[string]bool),
+		Selectors: make(map[string]bool),
+		Protocols: make(map[string]bool),
+		Functions: make(map[string]uint64),
+	}
+
+	m, err := image.GetMacho()
+	if err != nil {
+		log.Debugf("failed to parse full MachO for %s: %v", image.Name, err)
+		m, err = image.GetPartialMacho()
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer m.Close()
+
+	if id := m.DylibID(); id != nil {
+		sum.Version = id.CurrentVersion
+	}
+	if uuid := m.UUID(); uuid != nil {
+		sum.UUID = uuid.String()
+	}
+
+	addr2sym := make(map[uint64]string)
+
+	if conf.Exports || conf.Functions {
+		syms, err := f.getExportTrieSymbols(image)
+		if err != nil && !errors.Is(err, ErrNoExportTrieInMachO) {
+			return nil, err
+		}
+		for _, sym := range syms {
+			if conf.Exports {
+				sum.Exports[sym.Name] = true
+			}
+			if !sym.Flags.ReExport() {
+				addr2sym[sym.Address] = sym.Name
+			}
+		}
+	}
+
+	if conf.ObjC && m.HasObjC() {
+		if classes, err := m.GetObjCClasses(); err == nil {
+			for _, class := range classes {
+				sum.Classes[class.Name] = true
+			}
+		} else {
+			log.Debugf("failed to parse objc classes for %s: %v", image.Name, err)
+		}
+		if protos, err := m.GetObjCProtocols(); err == nil {
+			for _, proto := range protos {
+				sum.Protocols[proto.Name] = true
+			}
+		} else {
+			log.Debugf("failed to parse objc protocols for %s: %v", image.Name, err)
+		}
+		if selRefs, err := m.GetObjCSelectorReferences(); err == nil {
+			for _, sel := range selRefs {
+				sum.Selectors[sel.Name] = true
+			}
+		} else {
+			log.Debugf("failed to parse objc selectors for %s: %v", image.Name, err)
+		}
+	}
+
+	if conf.Functions && m.FunctionStarts() != nil {
+		// local symbols name far more functions than the exports alone
+		if err := f.GetLocalSymbolsForImage(image); err == nil {
+			for _, sym := range image.LocalSymbols {
+				if _, ok := addr2sym[sym.Value]; !ok {
+					addr2sym[sym.Value] = sym.Name
+				}
+			}
+		} else if !errors.Is(err, ErrNoLocals) {
+			return nil, err
+		}
+		for _, fn := range m.GetFunctions() {
+			// unnamed functions can't be matched between caches
+			if name, ok := addr2sym[fn.StartAddr]; ok {
+				sum.Functions[name] = fn.EndAddr - fn.StartAddr
+			}
+		}
+	}
+
+	return sum, nil
+}
+
+// String returns the diff as a human readable report
+func (d *CacheDiff) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("OLD: %s\nNEW: %s\n\n", d.OldUUID, d.NewUUID))
+
+	if len(d.ImagesAdded) > 0 {
+		sb.WriteString("Images Added\n")
+		sb.WriteString("============\n")
+		for _, img := range d.ImagesAdded {
+			sb.WriteString(fmt.Sprintf("+ %s\n", img))
+		}
+		sb.WriteString("\n")
+	}
+	if len(d.ImagesRemoved) > 0 {
+		sb.WriteString("Images Removed\n")
+		sb.WriteString("==============\n")
+		for _, img := range d.ImagesRemoved {
+			sb.WriteString(fmt.Sprintf("- %s\n", img))
+		}
+		sb.WriteString("\n")
+	}
+
+	for _, img := range d.Images {
+		sb.WriteString(img.Name + "\n")
+		sb.WriteString(strings.Repeat("-", len(img.Name)) + "\n")
+		if img.VersionChanged() {
+			sb.WriteString(fmt.Sprintf("  version: %s -> %s\n", img.OldVersion, img.NewVersion))
+		}
+		if img.UUIDChanged() {
+			sb.WriteString(fmt.Sprintf("  uuid:    %s -> %s\n", img.OldUUID, img.NewUUID))
+		}
+		writeChanges(&sb, "exports", img.ExportsAdded, img.ExportsRemoved)
+		writeChanges(&sb, "objc classes", img.ClassesAdded, img.ClassesRemoved)
+		writeChanges(&sb, "objc selectors", img.SelectorsAdded, img.SelectorsRemoved)
+		writeChanges(&sb, "objc protocols", img.ProtocolsAdded, img.ProtocolsRemoved)
+		if len(img.FunctionsChanged) > 0 {
+			sb.WriteString("  functions:\n")
+			for _, fn := range img.FunctionsChanged {
+				sb.WriteString(fmt.Sprintf("    ~ %s (%#x -> %#x, %+d)\n", fn.Name, fn.OldSize, fn.NewSize, int64(fn.NewSize)-int64(fn.OldSize)))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func writeChanges(sb *strings.Builder, title string, added, removed []string) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	sb.WriteString(fmt.Sprintf("  %s:\n", title))
+	for _, a := range added {
+		sb.WriteString(fmt.Sprintf("    + %s\n", a))
+	}
+	for _, r := range removed {
+		sb.WriteString(fmt.Sprintf("    - %s\n", r))
+	}
+}
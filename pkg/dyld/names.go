@@ -0,0 +1,173 @@
+package dyld
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types/objc"
+	"github.com/blacktop/ipsw/internal/symscript"
+	"github.com/pkg/errors"
+)
+
+// GetImageSymbols returns all the names that can be recovered for an image
+// (functions, stubs, GOT entries, selrefs, CFStrings and ObjC methods)
+func (f *File) GetImageSymbols(image *CacheImage) ([]symscript.Symbol, error) {
+
+	if err := f.AnalyzeImage(image); err != nil {
+		return nil, errors.Wrapf(err, "failed to analyze %s", image.Name)
+	}
+
+	m, err := image.GetMacho()
+	if err != nil {
+		log.Debugf("failed to parse full MachO for %s: %v", image.Name, err)
+		m, err = image.GetPartialMacho()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed get image %s as MachO", image.Name)
+		}
+	}
+	defer m.Close()
+
+	if m.HasObjC() {
+		if err := f.CFStringsForImage(image.Name); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse objc cfstrings")
+		}
+		if err := f.SelectorsForImage(image.Name); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse objc selectors")
+		}
+	}
+
+	syms := make(map[uint64]symscript.Symbol)
+	add := func(addr uint64, name string, kind symscript.Kind, comment string) {
+		if len(name) == 0 {
+			return
+		}
+		if _, ok := syms[addr]; !ok {
+			syms[addr] = symscript.Symbol{Address: addr, Name: name, Kind: kind, Comment: comment}
+		}
+	}
+
+	// ObjC methods first so -[Class sel] wins over the bare selector names in AddressToSymbol
+	if m.HasObjC() {
+		f.addObjCMethods(m, image, add)
+	}
+
+	funcStarts := make(map[uint64]bool)
+	for _, fn := range m.GetFunctions() {
+		funcStarts[fn.StartAddr] = true
+		if name, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+			add(fn.StartAddr, name, symscript.Function, "")
+		}
+	}
+
+	for _, sym := range image.LocalSymbols {
+		if funcStarts[sym.Value] {
+			add(sym.Value, sym.Name, symscript.Function, "")
+		} else if sym.Value > 0 {
+			add(sym.Value, sym.Name, symscript.Data, "")
+		}
+	}
+
+	if exports, err := f.getExportTrieSymbols(image); err == nil {
+		for _, sym := range exports {
+			if sym.Flags.ReExport() || sym.Address == 0 {
+				continue
+			}
+			if funcStarts[sym.Address] {
+				add(sym.Address, sym.Name, symscript.Function, "")
+			} else {
+				add(sym.Address, sym.Name, symscript.Data, "")
+			}
+		}
+	} else if !errors.Is(err, ErrNoExportTrieInMachO) {
+		return nil, err
+	}
+
+	for stub := range image.Analysis.SymbolStubs {
+		add(stub, f.AddressToSymbol[stub], symscript.Stub, "")
+	}
+	for entry := range image.Analysis.GotPointers {
+		add(entry, f.AddressToSymbol[entry], symscript.Data, "")
+	}
+
+	if sec := m.Section("__DATA", "__objc_selrefs"); sec != nil {
+		for ptr := sec.Addr; ptr < sec.Addr+sec.Size; ptr += 8 {
+			add(ptr, f.AddressToSymbol[ptr], symscript.SelRef, "")
+		}
+	}
+
+	for _, cfstr := range image.ObjC.CFStrings {
+		add(cfstr.Address, cfstringName(cfstr.Name, cfstr.Address), symscript.CFString, cfstr.Name)
+	}
+
+	out := make([]symscript.Symbol, 0, len(syms))
+	for _, sym := range syms {
+		out = append(out, sym)
+	}
+
+	return out, nil
+}
+
+// addObjCMethods adds the image's class and category methods named -[Class sel] and +[Class sel]
+func (f *File) addObjCMethods(m *macho.File, image *CacheImage, add func(uint64, string, symscript.Kind, string)) {
+	addMethods := func(class string, methods []objc.Method, prefix string) {
+		for _, method := range methods {
+			if method.ImpVMAddr == 0 {
+				continue
+			}
+			add(method.ImpVMAddr, fmt.Sprintf("%s[%s %s]", prefix, class, method.Name), symscript.ObjCMethod, method.Types)
+		}
+	}
+
+	if classes, err := m.GetObjCClasses(); err == nil {
+		for _, class := range classes {
+			addMethods(class.Name, class.InstanceMethods, "-")
+			addMethods(class.Name, class.ClassMethods, "+")
+		}
+	} else {
+		log.Debugf("failed to parse objc classes for %s: %v", image.Name, err)
+	}
+
+	if cats, err := m.GetObjCCategories(); err == nil {
+		for _, cat := range cats {
+			// the category's class is usually in another image
+			var class string
+			if cat.ClsVMAddr > 0 && f.SlideInfo != nil {
+				if c, err := f.GetObjCClass(f.SlideInfo.SlidePointer(cat.ClsVMAddr)); err == nil {
+					class = c.Name
+				}
+			}
+			name := fmt.Sprintf("%s(%s)", class, cat.Name)
+			addMethods(name, cat.InstanceMethods, "-")
+			addMethods(name, cat.ClassMethods, "+")
+		}
+	} else {
+		log.Debugf("failed to parse objc categories for %s: %v", image.Name, err)
+	}
+}
+
+// cfstringName returns an IDA style name for a CFString (e.g. cfstr_HelloWorld)
+func cfstringName(s string, addr uint64) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			if upper && r >= 'a' && r <= 'z' {
+				r -= 'a' - 'A'
+			}
+			sb.WriteRune(r)
+			upper = false
+		default:
+			upper = true
+		}
+		if sb.Len() >= 32 {
+			break
+		}
+	}
+	if sb.Len() == 0 {
+		return fmt.Sprintf("cfstr_%x", addr)
+	}
+	return "cfstr_" + sb.String()
+}
@@ -0,0 +1,320 @@
+package dyld
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// SearchQuery is a dyld_shared_cache symbol search query
+type SearchQuery struct {
+	Pattern string   // regex (or glob if Glob is set) the symbol name must match
+	Glob    bool     // treat Pattern as a glob
+	Images  []string // only search images whose path contains one of these strings
+
+	// export flag filters (a symbol must match at least one of the set filters)
+	Weak        bool
+	ThreadLocal bool
+	Resolver    bool
+	Absolute    bool
+
+	FollowReExports bool // resolve re-exported symbols to their implementation
+
+	Exports bool // search the export tries
+	Locals  bool // search the local symbols
+	ObjC    bool // search the ObjC methods
+
+	StartAddr uint64 // only return symbols in the range [StartAddr, EndAddr)
+	EndAddr   uint64
+}
+
+// SearchResult is a symbol found by Search
+type SearchResult struct {
+	Name           string `json:"name"`
+	Address        uint64 `json:"address"`
+	Image          string `json:"image"`
+	Source         string `json:"source"`
+	Flags          string `json:"flags,omitempty"`
+	ReExport       string `json:"reexport,omitempty"`
+	ReExportedFrom string `json:"reexported_from,omitempty"`
+}
+
+func (r SearchResult) String() string {
+	var flags string
+	if len(r.Flags) > 0 {
+		flags = fmt.Sprintf(" [%s]", r.Flags)
+	}
+	if len(r.ReExportedFrom) > 0 {
+		return fmt.Sprintf("%#09x: %s%s (%s) %s (re-exported by %s)", r.Address, r.Name, flags, r.Source, r.Image, r.ReExportedFrom)
+	}
+	return fmt.Sprintf("%#09x: %s%s (%s) %s", r.Address, r.Name, flags, r.Source, r.Image)
+}
+
+// globToRegex converts a shell glob (with *, ? and [...] classes) into an anchored regular expression
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			// find the closing ] (a ] right after [ or [! is part of the class)
+			j := i + 1
+			if j < len(runes) && (runes[j] == '!' || runes[j] == '^') {
+				j++
+			}
+			if j < len(runes) && runes[j] == ']' {
+				j++
+			}
+			for j < len(runes) && runes[j] != ']' {
+				j++
+			}
+			if j >= len(runes) {
+				sb.WriteString(regexp.QuoteMeta(string(r))) // unterminated, match a literal [
+				continue
+			}
+			sb.WriteString("[")
+			k := i + 1
+			if runes[k] == '!' || runes[k] == '^' {
+				sb.WriteString("^")
+				k++
+			}
+			for first := k; k < j; k++ {
+				switch {
+				case runes[k] == '-' && k > first && k < j-1:
+					sb.WriteRune('-') // a range
+				case runes[k] == '-':
+					sb.WriteString(`\-`)
+				default:
+					sb.WriteString(regexp.QuoteMeta(string(runes[k])))
+				}
+			}
+			sb.WriteString("]")
+			i = j
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func (q *SearchQuery) hasFlagFilter() bool {
+	return q.Weak || q.ThreadLocal || q.Resolver || q.Absolute
+}
+
+func (q *SearchQuery) matchFlags(flags CacheExportFlag) bool {
+	if !q.hasFlagFilter() {
+		return true
+	}
+	return (q.Weak && flags&exportSymbolFlagsWeakDefinition != 0) ||
+		(q.ThreadLocal && flags.ThreadLocal()) ||
+		(q.Resolver && flags&exportSymbolFlagsStubAndResolver != 0) ||
+		(q.Absolute && flags.Absolute())
+}
+
+func (q *SearchQuery) hasRange() bool {
+	return q.EndAddr > 0
+}
+
+func (q *SearchQuery) inRange(addr uint64) bool {
+	return !q.hasRange() || (q.StartAddr <= addr && addr < q.EndAddr)
+}
+
+func (q *SearchQuery) matchImage(name string) bool {
+	if len(q.Images) == 0 {
+		return true
+	}
+	for _, img := range q.Images {
+		if strings.Contains(strings.ToLower(name), strings.ToLower(img)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search searches the dyld_shared_cache's exports, local symbols and ObjC methods
+func (f *File) Search(q *SearchQuery) ([]SearchResult, error) {
+	var re *regexp.Regexp
+	var err error
+
+	if len(q.Pattern) > 0 {
+		pattern := q.Pattern
+		if q.Glob {
+			pattern = globToRegex(pattern)
+		}
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, errors.Wrapf(err, "invalid search pattern %s", q.Pattern)
+		}
+	}
+	if q.hasRange() && q.StartAddr >= q.EndAddr {
+		return nil, fmt.Errorf("invalid address range %#x-%#x", q.StartAddr, q.EndAddr)
+	}
+	match := func(name string) bool {
+		return re == nil || re.MatchString(name)
+	}
+
+	var results []SearchResult
+
+	for _, image := range f.Images {
+		if !q.matchImage(image.Name) {
+			continue
+		}
+
+		m, err := image.GetPartialMacho()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed get image %s as MachO", image.Name)
+		}
+
+		if q.hasRange() {
+			overlaps := false
+			for _, seg := range m.Segments() {
+				if seg.Name == "__LINKEDIT" {
+					continue // shared by all the images in the cache
+				}
+				if seg.Addr < q.EndAddr && q.StartAddr < seg.Addr+seg.Memsz {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				m.Close()
+				continue
+			}
+		}
+
+		log.Debugf("searching %s", image.Name)
+
+		if q.Exports {
+			syms, err := f.getExportTrieSymbols(image)
+			if err != nil && !errors.Is(err, ErrNoExportTrieInMachO) {
+				m.Close()
+				return nil, err
+			}
+			for _, sym := range syms {
+				flags := CacheExportFlag(sym.Flags)
+				if !match(sym.Name) || !q.matchFlags(flags) {
+					continue
+				}
+				res := SearchResult{
+					Name:    sym.Name,
+					Address: sym.Address,
+					Image:   image.Name,
+					Source:  "export",
+					Flags:   flags.String(),
+				}
+				if flags&exportSymbolFlagsReexport != 0 {
+					if sym.Other > 0 && int(sym.Other) <= len(m.ImportedLibraries()) {
+						res.Image = m.ImportedLibraries()[sym.Other-1]
+						res.ReExportedFrom = image.Name
+					}
+					res.ReExport = sym.ReExport
+					if len(res.ReExport) == 0 {
+						res.ReExport = sym.Name
+					}
+					if q.FollowReExports && len(res.ReExportedFrom) > 0 {
+						if target, err := f.followReExport(res.Image, res.ReExport, 0); err == nil {
+							res.Address = target.Address
+							res.Image = target.Image
+						} else {
+							log.Debugf("failed to follow re-export %s: %v", sym.Name, err)
+						}
+					}
+				}
+				if q.inRange(res.Address) {
+					results = append(results, res)
+				}
+			}
+		}
+
+		// local symbols and ObjC methods don't have export flags
+		if q.hasFlagFilter() {
+			m.Close()
+			continue
+		}
+
+		if q.Locals {
+			if err := f.GetLocalSymbolsForImage(image); err != nil && !errors.Is(err, ErrNoLocals) {
+				m.Close()
+				return nil, err
+			}
+			for _, sym := range image.LocalSymbols {
+				if match(sym.Name) && q.inRange(sym.Value) {
+					results = append(results, SearchResult{
+						Name:    sym.Name,
+						Address: sym.Value,
+						Image:   image.Name,
+						Source:  "local",
+					})
+				}
+			}
+		}
+
+		if q.ObjC && m.HasObjC() {
+			if len(image.ObjC.Methods) == 0 {
+				if err := f.MethodsForImage(image.Name); err != nil {
+					m.Close()
+					return nil, errors.Wrapf(err, "failed to parse objc methods for %s", image.Name)
+				}
+			}
+			for _, method := range image.ObjC.Methods {
+				if match(method.Name) && q.inRange(method.ImpVMAddr) {
+					results = append(results, SearchResult{
+						Name:    method.Name,
+						Address: method.ImpVMAddr,
+						Image:   image.Name,
+						Source:  "objc",
+					})
+				}
+			}
+		}
+
+		m.Close()
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Address < results[j].Address
+	})
+
+	return results, nil
+}
+
+// followReExport resolves a re-exported symbol to the image that implements it
+func (f *File) followReExport(imageName, symbolName string, depth int) (*SearchResult, error) {
+	if depth > 10 {
+		return nil, fmt.Errorf("too many re-exports for %s", symbolName)
+	}
+	image := f.Image(imageName)
+	if image == nil {
+		return nil, fmt.Errorf("image %s not in cache", imageName)
+	}
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	sym, err := f.FindExportedSymbolInImage(image.Name, symbolName)
+	if err != nil {
+		return nil, err
+	}
+	if CacheExportFlag(sym.Flags)&exportSymbolFlagsReexport != 0 {
+		if sym.Other == 0 || int(sym.Other) > len(m.ImportedLibraries()) {
+			return nil, fmt.Errorf("invalid re-export library ordinal %d", sym.Other)
+		}
+		name := sym.ReExport
+		if len(name) == 0 {
+			name = sym.Name
+		}
+		return f.followReExport(m.ImportedLibraries()[sym.Other-1], name, depth+1)
+	}
+	return &SearchResult{Name: sym.Name, Address: sym.Address, Image: image.Name}, nil
+}
@@ -0,0 +1,41 @@
+package dyld
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	tests := []struct {
+		glob  string
+		name  string
+		match bool
+	}{
+		{"_objc_*", "_objc_msgSend", true},
+		{"_objc_*", "__objc_msgSend", false},
+		{"_str?cpy", "_strlcpy", true},
+		{"_str?cpy", "_strcpy", false},
+		{"_str[ln]cpy", "_strlcpy", true},
+		{"_str[ln]cpy", "_strxcpy", false},
+		{"_str[!ln]cpy", "_strxcpy", true},
+		{"_str[!ln]cpy", "_strlcpy", false},
+		{"_mem[a-c]*", "_memcpy", true},
+		{"_mem[a-c]*", "_memmove", false},
+		{"_a[-.]b", "_a-b", true},
+		{"_a[-.]b", "_a.b", true},
+		{"_a[-.]b", "_axb", false},
+		{"[]]x", "]x", true},
+		{"_open[", "_open[", true},
+		{"_open[", "_openx", false},
+	}
+	for _, tt := range tests {
+		re, err := regexp.Compile(globToRegex(tt.glob))
+		if err != nil {
+			t.Errorf("globToRegex(%q) = %q: %v", tt.glob, globToRegex(tt.glob), err)
+			continue
+		}
+		if got := re.MatchString(tt.name); got != tt.match {
+			t.Errorf("glob %q (%s) matching %q = %t, want %t", tt.glob, re, tt.name, got, tt.match)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"hash/adler32"
+
+	"github.com/blacktop/ipsw/pkg/lzfse"
+	"github.com/blacktop/lzss"
+	"github.com/pkg/errors"
+)
+
+const (
+	// LZSS ring buffer size, max match length and min match length - 1 (must match lzss.Decompress)
+	lzssN         = 4096
+	lzssF         = 18
+	lzssThreshold = 2
+	// lzssMaxDist keeps matches out of the part of the ring buffer still holding the initial fill
+	lzssMaxDist    = lzssN - lzssF
+	lzssHashBits   = 14
+	lzssChainDepth = 32
+)
+
+// lzssCompress compresses data into the LZSS format read by lzss.Decompress
+func lzssCompress(src []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(src) / 2)
+
+	head := make([]int32, 1<<lzssHashBits)
+	prev := make([]int32, lzssN)
+
+	hash := func(pos int) uint32 {
+		return ((uint32(src[pos])<<16 | uint32(src[pos+1])<<8 | uint32(src[pos+2])) * 2654435761) >> (32 - lzssHashBits)
+	}
+	insert := func(pos int) {
+		if pos+lzssThreshold+1 > len(src) {
+			return
+		}
+		h := hash(pos)
+		prev[pos%lzssN] = head[h]
+		head[h] = int32(pos + 1)
+	}
+	findMatch := func(pos int) (int, int) {
+		maxLen := len(src) - pos
+		if maxLen > lzssF {
+			maxLen = lzssF
+		}
+		if maxLen <= lzssThreshold {
+			return 0, 0
+		}
+		bestLen, bestDist := 0, 0
+		cand := int(head[hash(pos)]) - 1
+		for depth := 0; cand >= 0 && depth < lzssChainDepth && pos-cand <= lzssMaxDist; depth++ {
+			n := 0
+			for n < maxLen && src[cand+n] == src[pos+n] {
+				n++
+			}
+			if n > bestLen {
+				bestLen, bestDist = n, pos-cand
+				if n == maxLen {
+					break
+				}
+			}
+			next := int(prev[cand%lzssN]) - 1
+			if next >= cand { // overwritten by a newer position
+				break
+			}
+			cand = next
+		}
+		return bestLen, bestDist
+	}
+
+	for pos := 0; pos < len(src); {
+		flagsIdx := out.Len()
+		out.WriteByte(0)
+		var flags byte
+		for bit := uint(0); bit < 8 && pos < len(src); bit++ {
+			length, dist := findMatch(pos)
+			if length > lzssThreshold {
+				// matches are encoded as their position in the decoder's ring buffer
+				r := (lzssN - lzssF + pos - dist) & (lzssN - 1)
+				out.WriteByte(byte(r))
+				out.WriteByte(byte((r>>4)&0xf0) | byte(length-lzssThreshold-1))
+				for end := pos + length; pos < end; pos++ {
+					insert(pos)
+				}
+			} else {
+				flags |= 1 << bit
+				out.WriteByte(src[pos])
+				insert(pos)
+				pos++
+			}
+		}
+		out.Bytes()[flagsIdx] = flags
+	}
+
+	return out.Bytes()
+}
+
+// CompressLZSS compresses a kernelcache into a comp/lzss container
+func CompressLZSS(data []byte) ([]byte, error) {
+	comp := lzssCompress(data)
+
+	hdr := lzss.Header{
+		CompressionType:  0x636f6d70, // comp
+		Signature:        0x6c7a7373, // lzss
+		CheckSum:         adler32.Checksum(data),
+		UncompressedSize: uint32(len(data)),
+		CompressedSize:   uint32(len(comp)),
+	}
+
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.BigEndian, hdr); err != nil {
+		return nil, errors.Wrap(err, "failed to write lzss header")
+	}
+	buf.Write(comp)
+
+	return buf.Bytes(), nil
+}
+
+// CompressLZFSE compresses a kernelcache into a LZFSE stream
+func CompressLZFSE(data []byte) ([]byte, error) {
+	dat, err := lzfse.NewEncoder(data).EncodeBuffer()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lzfse compress kernelcache")
+	}
+	return dat, nil
+}
+
+// CreateImg4Data wraps a compressed kernelcache in an IM4P of type 'krnl'
+func CreateImg4Data(data []byte, version string) ([]byte, error) {
+	im4p := struct {
+		IM4P    string `asn1:"ia5"`
+		Name    string `asn1:"ia5"`
+		Version string `asn1:"ia5"`
+		Data    []byte
+	}{
+		IM4P:    "IM4P",
+		Name:    "krnl",
+		Version: version,
+		Data:    data,
+	}
+
+	dat, err := asn1.Marshal(im4p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ASN.1 marshal kernelcache IM4P")
+	}
+
+	return dat, nil
+}
@@ -0,0 +1,116 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// testKernel returns kernel-like data: a Mach-O header, repetitive code and strings and some random data
+func testKernel(size int) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{0xfeedfacf, 0x0100000c, 0xc0000002, 2})
+	rnd := rand.New(rand.NewSource(1))
+	for buf.Len() < size {
+		switch rnd.Intn(3) {
+		case 0:
+			buf.WriteString("@/BuildRoot/Library/Caches/com.apple.xbs/Sources/xnu/xnu-7195.141.2/osfmk/kern/zalloc.c:1234 ")
+		case 1:
+			for i := 0; i < 64; i++ {
+				binary.Write(&buf, binary.LittleEndian, []uint32{0xd503237f, 0xa9bf7bfd, 0x910003fd, 0x94000000 | uint32(rnd.Intn(1<<16))})
+			}
+		default:
+			chunk := make([]byte, rnd.Intn(512))
+			rnd.Read(chunk)
+			buf.Write(chunk)
+		}
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		compress func([]byte) ([]byte, error)
+		magic    string
+	}{
+		{"lzss", CompressLZSS, "comp"},
+		{"lzfse", CompressLZFSE, "bvx2"},
+	}
+	for _, tt := range tests {
+		for _, size := range []int{64, 4096, 300000} {
+			data := testKernel(size)
+			comp, err := tt.compress(data)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			im4p, err := CreateImg4Data(comp, "7195.141.2")
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			cc, err := ParseImg4Data(im4p)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if string(cc.Magic) != tt.magic {
+				t.Errorf("%s: magic = %q, want %q", tt.name, cc.Magic, tt.magic)
+			}
+			dec, err := DecompressData(cc)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !bytes.Equal(dec, data) {
+				t.Errorf("%s: %d bytes decompressed to %d bytes that don't match", tt.name, len(data), len(dec))
+			}
+			if size > 4096 && len(comp) >= len(data) {
+				t.Errorf("%s: %d bytes compressed to %d bytes", tt.name, len(data), len(comp))
+			}
+		}
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	data := testKernel(4096)
+	lzss, err := CompressLZSS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lzfse, err := CompressLZFSE(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im4p, err := CreateImg4Data(lzfse, "7195.141.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		compression string
+		im4p        bool
+	}{
+		{"raw", data, CompressionNone, false},
+		{"lzss", lzss, CompressionLZSS, false},
+		{"lzfse", lzfse, CompressionLZFSE, false},
+		{"im4p", im4p, CompressionLZFSE, true},
+	}
+	for _, tt := range tests {
+		dec, info, err := Unpack(tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(dec, data) {
+			t.Errorf("%s: unpacked %d bytes that don't match", tt.name, len(dec))
+		}
+		if info.Compression != tt.compression || info.Im4p != tt.im4p {
+			t.Errorf("%s: compression = %s, im4p = %t", tt.name, info.Compression, info.Im4p)
+		}
+	}
+
+	// only bvx2 LZFSE streams are supported
+	if _, _, err := Unpack(append([]byte("bvx1"), lzfse[4:]...)); err == nil {
+		t.Error("unpacked an unsupported LZFSE stream")
+	}
+}
@@ -2,78 +2,551 @@ package kernelcache
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
-	"testing/iotest"
 
+	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/utils"
 )
 
-// ParseMachO parses the kernelcache as a mach-o
-func ParseMachO(name string) error {
-	f, err := macho.Open(name)
-	if err != nil {
-		return err
+// UnknownSourceFile is the file assert/panic strings are grouped under when they don't embed their source path
+const UnknownSourceFile = "(unknown)"
+
+var (
+	assertPathRE    = regexp.MustCompile(`@(/?[\w.+-]+(?:/[\w.+-]+)*\.[A-Za-z+]+):\d+`)
+	assertFormatRE  = regexp.MustCompile(`@%s:%d`)
+	sourcesPrefixRE = regexp.MustCompile(`^.*?/Sources/([^/]+)/(?:[^/]+-[\d.]+/)?`)
+)
+
+// DiffConfig is the kernelcache diff config
+type DiffConfig struct {
+	Kexts    []string // only diff kexts whose bundle ID contains one of these strings
+	Symbols  bool
+	Strings  bool
+	Sysctls  bool
+	Syscalls bool
+	Sandbox  bool
+}
+
+// KextDiff is the diff of a kext that exists in both kernelcaches
+type KextDiff struct {
+	ID               string   `json:"id"`
+	OldVersion       string   `json:"old_version,omitempty"`
+	NewVersion       string   `json:"new_version,omitempty"`
+	SymbolsAdded     []string `json:"symbols_added,omitempty"`
+	SymbolsRemoved   []string `json:"symbols_removed,omitempty"`
+	OldFunctionCount int      `json:"old_function_count"`
+	NewFunctionCount int      `json:"new_function_count"`
+}
+
+// VersionChanged returns true if the kext's bundle version changed
+func (d KextDiff) VersionChanged() bool {
+	return d.OldVersion != d.NewVersion
+}
+
+// IsEmpty returns true if nothing changed in the kext
+func (d KextDiff) IsEmpty() bool {
+	return !d.VersionChanged() && len(d.SymbolsAdded) == 0 && len(d.SymbolsRemoved) == 0 &&
+		d.OldFunctionCount == d.NewFunctionCount
+}
+
+// StringsDiff is the change in the assert/panic strings of a source file
+type StringsDiff struct {
+	File    string   `json:"file"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Change is a changed entry in one of the kernel's tables (an empty Old/New means it was added/removed)
+type Change struct {
+	Number int    `json:"number,omitempty"`
+	Name   string `json:"name"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// KernelDiff is the diff of two kernelcaches
+type KernelDiff struct {
+	OldVersion        string        `json:"old_version,omitempty"`
+	NewVersion        string        `json:"new_version,omitempty"`
+	KextsAdded        []string      `json:"kexts_added,omitempty"`
+	KextsRemoved      []string      `json:"kexts_removed,omitempty"`
+	Kexts             []KextDiff    `json:"kexts,omitempty"`
+	Strings           []StringsDiff `json:"strings,omitempty"`
+	Sysctls           []Change      `json:"sysctls,omitempty"`
+	Syscalls          []Change      `json:"syscalls,omitempty"`
+	MachTraps         []Change      `json:"mach_traps,omitempty"`
+	SandboxOpsAdded   []string      `json:"sandbox_ops_added,omitempty"`
+	SandboxOpsRemoved []string      `json:"sandbox_ops_removed,omitempty"`
+}
+
+type kextSummary struct {
+	Version       string
+	Symbols       map[string]bool
+	FunctionCount int
+}
+
+type kernelSummary struct {
+	Kexts   map[string]*kextSummary
+	Strings map[string]map[string]bool // source file -> messages
+}
+
+func (conf *DiffConfig) match(id string) bool {
+	if len(conf.Kexts) == 0 {
+		return true
 	}
+	for _, filter := range conf.Kexts {
+		if strings.Contains(strings.ToLower(id), strings.ToLower(filter)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSourcePath strips the build machine specific prefix (and project version) from a source path
+func normalizeSourcePath(path string) string {
+	if loc := sourcesPrefixRE.FindStringSubmatchIndex(path); loc != nil {
+		return path[loc[2]:loc[3]] + "/" + path[loc[1]:]
+	}
+	return strings.TrimPrefix(path, "/BuildRoot/")
+}
 
-	fmt.Println(f.FileHeader)
+// parseAssertString returns the source file and message of an assert/panic string
+func parseAssertString(s string) (string, string, bool) {
+	if loc := assertPathRE.FindStringSubmatchIndex(s); loc != nil {
+		msg := strings.TrimSpace(s[:loc[0]] + s[loc[1]:])
+		return normalizeSourcePath(s[loc[2]:loc[3]]), msg, true
+	}
+	if assertFormatRE.MatchString(s) {
+		return UnknownSourceFile, strings.TrimSpace(s), true
+	}
+	return "", "", false
+}
+
+func summarizeKernel(m *macho.File, conf *DiffConfig) (*kernelSummary, error) {
+	sum := &kernelSummary{
+		Kexts:   make(map[string]*kextSummary),
+		Strings: make(map[string]map[string]bool),
+	}
 
-	err = os.Mkdir("diff", os.ModePerm)
+	kexts, err := GetKexts(m)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, sec := range f.Sections {
-		if strings.EqualFold(sec.Name, "__cstring") && strings.EqualFold(sec.Seg, "__TEXT") {
-			r := bufio.NewReader(sec.Open())
-			for {
-				s, err := r.ReadString('\x00')
-				if err == io.EOF {
-					break
-				}
+	for _, k := range kexts {
+		if !conf.match(k.ID) {
+			continue
+		}
+
+		ks := &kextSummary{Version: k.Version, Symbols: make(map[string]bool)}
+		sum.Kexts[k.ID] = ks
 
-				if err != nil && err != iotest.ErrTimeout {
-					panic("GetLines: " + err.Error())
+		if !conf.Symbols && !conf.Strings {
+			continue
+		}
+
+		km, err := openKextMachO(m, k)
+		if err != nil {
+			log.Debugf("failed to parse %s: %v", k.ID, err)
+			continue
+		}
+
+		if conf.Symbols {
+			if km.Symtab != nil {
+				for _, sym := range km.Symtab.Syms {
+					if len(sym.Name) > 0 {
+						ks.Symbols[sym.Name] = true
+					}
 				}
+			}
+			ks.FunctionCount = len(km.GetFunctions())
+		}
 
-				if strings.Contains(s, "@/BuildRoot/") {
-					var assertStr string
-					parts := strings.Split(strings.TrimSpace(s), "@/BuildRoot/")
-					if len(parts) > 1 {
-						assertStr = parts[0]
-						fileAndLineNum := parts[1]
-						parts = strings.Split(fileAndLineNum, ":")
-					} else {
-						fmt.Println("WHAT?? ", s)
+		if conf.Strings {
+			for _, sec := range km.Sections {
+				if !sec.Flags.IsCstringLiterals() {
+					continue
+				}
+				data, err := sec.Data()
+				if err != nil {
+					closeKextMachO(m, km)
+					return nil, fmt.Errorf("failed to read cstrings in %s %s.%s: %v", k.ID, sec.Seg, sec.Name, err)
+				}
+				for _, s := range bytes.Split(data, []byte{0}) {
+					file, msg, ok := parseAssertString(string(s))
+					if !ok {
+						continue
 					}
-					if len(parts) > 1 {
-						filePath := parts[0]
-						lineNum := parts[1]
-						fmt.Printf("%s on line %s ==> %s\n", filePath, lineNum, assertStr)
-
-						err = os.MkdirAll(filepath.Dir(filepath.Join("diff", filePath)), os.ModePerm)
-						if err != nil {
-							return err
-						}
-
-						f, err := os.Create(filepath.Join("diff", filePath))
-						if err != nil {
-							return err
-						}
-						f.Close()
-					} else {
-						fmt.Println("WHAT?? ", s)
+					if sum.Strings[file] == nil {
+						sum.Strings[file] = make(map[string]bool)
 					}
+					sum.Strings[file][msg] = true
 				}
 			}
 		}
+
+		closeKextMachO(m, km)
+	}
+
+	return sum, nil
+}
+
+func kernelVersion(m *macho.File) string {
+	kernel, err := getKernelMachO(m)
+	if err != nil {
+		return ""
+	}
+	if sv := kernel.SourceVersion(); sv != nil {
+		return sv.Version
+	}
+	return ""
+}
+
+// Diff compares two kernelcaches
+func Diff(old, new *macho.File, conf *DiffConfig) (*KernelDiff, error) {
+	if conf == nil {
+		conf = &DiffConfig{Symbols: true, Strings: true, Sysctls: true, Syscalls: true, Sandbox: true}
+	}
+
+	diff := &KernelDiff{
+		OldVersion: kernelVersion(old),
+		NewVersion: kernelVersion(new),
+	}
+
+	log.Debug("Summarizing old kernelcache")
+	o, err := summarizeKernel(old, conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse old kernelcache: %v", err)
+	}
+	log.Debug("Summarizing new kernelcache")
+	n, err := summarizeKernel(new, conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new kernelcache: %v", err)
+	}
+
+	var common []string
+	for id := range n.Kexts {
+		if _, ok := o.Kexts[id]; ok {
+			common = append(common, id)
+		} else {
+			diff.KextsAdded = append(diff.KextsAdded, id)
+		}
+	}
+	for id := range o.Kexts {
+		if _, ok := n.Kexts[id]; !ok {
+			diff.KextsRemoved = append(diff.KextsRemoved, id)
+		}
+	}
+	sort.Strings(diff.KextsAdded)
+	sort.Strings(diff.KextsRemoved)
+	sort.Strings(common)
+
+	for _, id := range common {
+		kdiff := KextDiff{
+			ID:               id,
+			OldVersion:       o.Kexts[id].Version,
+			NewVersion:       n.Kexts[id].Version,
+			OldFunctionCount: o.Kexts[id].FunctionCount,
+			NewFunctionCount: n.Kexts[id].FunctionCount,
+		}
+		kdiff.SymbolsAdded, kdiff.SymbolsRemoved = utils.DiffSets(o.Kexts[id].Symbols, n.Kexts[id].Symbols)
+		if !kdiff.IsEmpty() {
+			diff.Kexts = append(diff.Kexts, kdiff)
+		}
+	}
+
+	files := make(map[string]bool)
+	for file := range o.Strings {
+		files[file] = true
+	}
+	for file := range n.Strings {
+		files[file] = true
+	}
+	for _, file := range sortedKeys(files) {
+		added, removed := utils.DiffSets(o.Strings[file], n.Strings[file])
+		if len(added) > 0 || len(removed) > 0 {
+			diff.Strings = append(diff.Strings, StringsDiff{File: file, Added: added, Removed: removed})
+		}
+	}
+
+	if conf.Sysctls {
+		if diff.Sysctls, err = diffSysctls(old, new); err != nil {
+			log.Warnf("failed to diff sysctls: %v", err)
+		}
+	}
+
+	if conf.Syscalls {
+		if diff.Syscalls, err = diffSyscalls(old, new); err != nil {
+			log.Warnf("failed to diff syscalls: %v", err)
+		}
+		if diff.MachTraps, err = diffMachTraps(old, new); err != nil {
+			log.Warnf("failed to diff mach traps: %v", err)
+		}
+	}
+
+	if conf.Sandbox {
+		oldOps, err := getSandboxOptsSet(old)
+		if err != nil {
+			log.Warnf("failed to get old sandbox operations: %v", err)
+		}
+		newOps, err := getSandboxOptsSet(new)
+		if err != nil {
+			log.Warnf("failed to get new sandbox operations: %v", err)
+		}
+		diff.SandboxOpsAdded, diff.SandboxOpsRemoved = utils.DiffSets(oldOps, newOps)
+	}
+
+	return diff, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffChanges compares two tables of described entries keyed by name
+func diffChanges(old, new map[string]string, numbers map[string]int) []Change {
+	var changes []Change
+	names := make(map[string]bool)
+	for name := range old {
+		names[name] = true
+	}
+	for name := range new {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		if old[name] != new[name] {
+			changes = append(changes, Change{Number: numbers[name], Name: name, Old: old[name], New: new[name]})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Number < changes[j].Number
+	})
+	return changes
+}
+
+func diffSysctls(old, new *macho.File) ([]Change, error) {
+	describe := func(m *macho.File) (map[string]string, error) {
+		sysctls, err := GetSysctls(m)
+		if err != nil {
+			return nil, err
+		}
+		desc := make(map[string]string)
+		for _, s := range sysctls {
+			desc[s.Name] = strings.TrimSpace(fmt.Sprintf("%s %s %s", s.Type(), s.Access(), s.Format))
+		}
+		return desc, nil
+	}
+	o, err := describe(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := describe(new)
+	if err != nil {
+		return nil, err
+	}
+	return diffChanges(o, n, nil), nil
+}
+
+func syscallName(s Sysent) string {
+	if len(s.Name) > 0 {
+		return s.Name
+	}
+	return fmt.Sprintf("syscall_%d", s.Number)
+}
+
+func diffSyscalls(old, new *macho.File) ([]Change, error) {
+	numbers := make(map[string]int)
+	describe := func(m *macho.File) (map[string]string, error) {
+		syscalls, err := GetSyscallTable(m)
+		if err != nil {
+			return nil, err
+		}
+		desc := make(map[string]string)
+		for _, s := range syscalls {
+			if !s.Implemented {
+				continue
+			}
+			numbers[syscallName(s)] = s.Number
+			desc[syscallName(s)] = fmt.Sprintf("ret=%s nargs=%d arg_bytes=%d", s.ReturnTypeString(), s.NumArgs, s.ArgBytes)
+		}
+		return desc, nil
+	}
+	o, err := describe(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := describe(new)
+	if err != nil {
+		return nil, err
+	}
+	return diffChanges(o, n, numbers), nil
+}
+
+func diffMachTraps(old, new *macho.File) ([]Change, error) {
+	numbers := make(map[string]int)
+	describe := func(m *macho.File) (map[string]string, error) {
+		traps, err := GetMachTrapTable(m)
+		if err != nil {
+			return nil, err
+		}
+		desc := make(map[string]string)
+		for _, t := range traps {
+			if !t.Implemented {
+				continue
+			}
+			name := t.Name
+			if len(name) == 0 {
+				name = fmt.Sprintf("mach_trap_%d", t.Number)
+			}
+			numbers[name] = t.Number
+			desc[name] = fmt.Sprintf("%d: nargs=%d u32_words=%d returns_port=%t", t.Number, t.NumArgs, t.U32Words, t.ReturnsPort)
+		}
+		return desc, nil
+	}
+	o, err := describe(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := describe(new)
+	if err != nil {
+		return nil, err
+	}
+	return diffChanges(o, n, numbers), nil
+}
+
+func getSandboxOptsSet(m *macho.File) (map[string]bool, error) {
+	sbm := m
+	if m.FileTOC.FileHeader.Type == types.FileSet {
+		kexts, err := GetKexts(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range kexts {
+			if k.ID == "com.apple.security.sandbox" {
+				if sbm, err = OpenKext(m, k); err != nil {
+					return nil, err
+				}
+				defer closeKextMachO(m, sbm)
+				break
+			}
+		}
+	}
+	ops, err := GetSandboxOpts(sbm)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	for _, op := range ops {
+		set[op] = true
+	}
+	return set, nil
+}
+
+// String returns the diff as a human readable report
+func (d *KernelDiff) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("OLD: %s\nNEW: %s\n\n", d.OldVersion, d.NewVersion))
+
+	section := func(title string) {
+		sb.WriteString(title + "\n")
+		sb.WriteString(strings.Repeat("=", len(title)) + "\n")
+	}
+
+	if len(d.KextsAdded) > 0 {
+		section("Kexts Added")
+		for _, k := range d.KextsAdded {
+			sb.WriteString(fmt.Sprintf("+ %s\n", k))
+		}
+		sb.WriteString("\n")
+	}
+	if len(d.KextsRemoved) > 0 {
+		section("Kexts Removed")
+		for _, k := range d.KextsRemoved {
+			sb.WriteString(fmt.Sprintf("- %s\n", k))
+		}
+		sb.WriteString("\n")
+	}
+	if len(d.Kexts) > 0 {
+		section("Kexts Changed")
+		for _, k := range d.Kexts {
+			sb.WriteString(k.ID + "\n")
+			if k.VersionChanged() {
+				sb.WriteString(fmt.Sprintf("  version:   %s -> %s\n", k.OldVersion, k.NewVersion))
+			}
+			if k.OldFunctionCount != k.NewFunctionCount {
+				sb.WriteString(fmt.Sprintf("  functions: %d -> %d (%+d)\n", k.OldFunctionCount, k.NewFunctionCount, k.NewFunctionCount-k.OldFunctionCount))
+			}
+			for _, s := range k.SymbolsAdded {
+				sb.WriteString(fmt.Sprintf("  + %s\n", s))
+			}
+			for _, s := range k.SymbolsRemoved {
+				sb.WriteString(fmt.Sprintf("  - %s\n", s))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	if len(d.Strings) > 0 {
+		section("Assert/Panic Strings")
+		for _, s := range d.Strings {
+			sb.WriteString(s.File + "\n")
+			for _, a := range s.Added {
+				sb.WriteString(fmt.Sprintf("  + %s\n", a))
+			}
+			for _, r := range s.Removed {
+				sb.WriteString(fmt.Sprintf("  - %s\n", r))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	writeTable := func(title string, changes []Change) {
+		if len(changes) == 0 {
+			return
+		}
+		section(title)
+		for _, c := range changes {
+			switch {
+			case len(c.Old) == 0:
+				sb.WriteString(fmt.Sprintf("+ %s (%s)\n", c.Name, c.New))
+			case len(c.New) == 0:
+				sb.WriteString(fmt.Sprintf("- %s (%s)\n", c.Name, c.Old))
+			default:
+				sb.WriteString(fmt.Sprintf("~ %s (%s -> %s)\n", c.Name, c.Old, c.New))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	writeTable("Sysctls", d.Sysctls)
+	writeTable("Syscalls", d.Syscalls)
+	writeTable("Mach Traps", d.MachTraps)
+
+	if len(d.SandboxOpsAdded) > 0 || len(d.SandboxOpsRemoved) > 0 {
+		section("Sandbox Operations")
+		for _, op := range d.SandboxOpsAdded {
+			sb.WriteString(fmt.Sprintf("+ %s\n", op))
+		}
+		for _, op := range d.SandboxOpsRemoved {
+			sb.WriteString(fmt.Sprintf("- %s\n", op))
+		}
+		sb.WriteString("\n")
 	}
 
-	return nil
+	return sb.String()
 }
 
 func File2lines(filePath string) ([]string, error) {
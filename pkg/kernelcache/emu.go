@@ -0,0 +1,269 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+
+	"github.com/blacktop/go-arm64"
+	"github.com/blacktop/go-macho"
+)
+
+// emuMaxInstrs is the most instructions emulated per function
+const emuMaxInstrs = 0x4000
+
+// emuThis is the value given to a register holding a freshly allocated object
+const emuThis = 0xfeedfacecafe0000
+
+type emuReg struct {
+	val   uint64
+	known bool
+}
+
+// emuCall is a call made by an emulated function
+type emuCall struct {
+	pc     uint64
+	target uint64
+	args   [8]emuReg
+}
+
+// emuStore is a 64-bit store made by an emulated function
+type emuStore struct {
+	pc    uint64
+	base  emuReg
+	off   uint64
+	value emuReg
+}
+
+// emuEvent is either a call or a store (in the order they were emulated)
+type emuEvent struct {
+	call  *emuCall
+	store *emuStore
+}
+
+// emulator is a very small arm64 register tracker used to follow the constant values (addresses, sizes, etc)
+// that kernel code passes to calls and stores. It follows a single path through the function: conditional
+// branches are ignored, calls clobber the caller saved registers and it stops at the first return.
+type emulator struct {
+	m     *macho.File
+	regs  [32]emuReg
+	stubs map[uint64]uint64
+	// ret (optional) returns the value of x0 after a call
+	ret func(c *emuCall) emuReg
+}
+
+func newEmulator(m *macho.File) *emulator {
+	return &emulator{m: m, stubs: make(map[uint64]uint64)}
+}
+
+// isBranchReg returns true for br and its pointer authenticated forms (braa/brab/braaz/brabz)
+func isBranchReg(ins uint32) bool {
+	return ins&0xfefff800 == 0xd61f0000 || ins&0xfefff800 == 0xd61f0800
+}
+
+// isBranchLinkReg returns true for blr and its pointer authenticated forms (blraa/blrab/blraaz/blrabz)
+func isBranchLinkReg(ins uint32) bool {
+	return ins&0xfefff800 == 0xd63f0000 || ins&0xfefff800 == 0xd63f0800
+}
+
+func signExtend(v uint64, bits uint) uint64 {
+	shift := 64 - bits
+	return uint64(int64(v<<shift) >> shift)
+}
+
+func (e *emulator) reset() {
+	for i := range e.regs {
+		e.regs[i] = emuReg{}
+	}
+}
+
+func (e *emulator) get(r uint32) emuReg {
+	if r == 31 { // xzr (or sp which is never tracked)
+		return emuReg{}
+	}
+	return e.regs[r]
+}
+
+func (e *emulator) set(r uint32, v emuReg) {
+	if r != 31 {
+		e.regs[r] = v
+	}
+}
+
+func (e *emulator) readCode(addr uint64, count int) []uint32 {
+	off, err := e.m.GetOffset(addr)
+	if err != nil {
+		return nil
+	}
+	data := make([]byte, count*4)
+	n, _ := e.m.ReadAt(data, int64(off))
+	instrs := make([]uint32, n/4)
+	for i := range instrs {
+		instrs[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return instrs
+}
+
+func (e *emulator) readPtr(addr uint64) (uint64, bool) {
+	off, err := e.m.GetOffset(addr)
+	if err != nil {
+		return 0, false
+	}
+	var data [8]byte
+	if _, err := e.m.ReadAt(data[:], int64(off)); err != nil {
+		return 0, false
+	}
+	return resolvePtr(e.m, binary.LittleEndian.Uint64(data[:])), true
+}
+
+// resolveStub returns the final target of a call through a __stubs/__auth_stubs entry
+func (e *emulator) resolveStub(addr uint64) uint64 {
+	if target, ok := e.stubs[addr]; ok {
+		return target
+	}
+	saved := e.regs
+	e.reset()
+	target := addr
+	for pc, ins := range e.readCode(addr, 4) {
+		if isBranchReg(ins) {
+			if r := e.get((ins >> 5) & 31); r.known {
+				target = r.val
+			}
+			break
+		}
+		if !e.step(addr+uint64(pc)*4, ins, nil) {
+			break
+		}
+	}
+	e.regs = saved
+	e.stubs[addr] = target
+	return target
+}
+
+// run emulates the function at addr and returns the calls and stores it makes
+func (e *emulator) run(addr uint64) []emuEvent {
+	var events []emuEvent
+	instrs := e.readCode(addr, emuMaxInstrs)
+	for idx := 0; idx < len(instrs); idx++ {
+		pc := addr + uint64(idx)*4
+		ins := instrs[idx]
+		if ins&0xfc000000 == 0x14000000 { // b
+			target := pc + signExtend(uint64(ins&0x3ffffff)<<2, 28)
+			if target > pc && target < addr+uint64(len(instrs))*4 {
+				idx = int((target-addr)/4) - 1
+				continue
+			}
+			call := &emuCall{pc: pc, target: e.resolveStub(target)}
+			copy(call.args[:], e.regs[:8])
+			events = append(events, emuEvent{call: call})
+			break
+		}
+		if !e.step(pc, ins, &events) {
+			break
+		}
+	}
+	return events
+}
+
+// step emulates a single instruction and returns false if the function returns
+func (e *emulator) step(pc uint64, ins uint32, events *[]emuEvent) bool {
+	rd := ins & 31
+	rn := (ins >> 5) & 31
+
+	switch {
+	case ins == 0xd65f03c0 || ins == 0xd65f0bff || ins == 0xd65f0fff: // ret/retaa/retab
+		return false
+	case isBranchReg(ins):
+		return false
+	case ins&0x9f000000 == 0x90000000: // adrp
+		imm := signExtend((uint64((ins>>5)&0x7ffff)<<2|uint64((ins>>29)&3))<<12, 33)
+		e.set(rd, emuReg{val: (pc &^ 0xfff) + imm, known: true})
+	case ins&0x9f000000 == 0x10000000: // adr
+		imm := signExtend(uint64((ins>>5)&0x7ffff)<<2|uint64((ins>>29)&3), 21)
+		e.set(rd, emuReg{val: pc + imm, known: true})
+	case ins&0xff000000 == 0x91000000 || ins&0xff000000 == 0xd1000000: // add/sub (immediate)
+		imm := uint64((ins >> 10) & 0xfff)
+		if ins&(1<<22) != 0 {
+			imm <<= 12
+		}
+		src := e.regs[rn] // register 31 is sp here
+		if rn == 31 || !src.known {
+			e.set(rd, emuReg{})
+		} else if ins&0xff000000 == 0x91000000 {
+			e.set(rd, emuReg{val: src.val + imm, known: true})
+		} else {
+			e.set(rd, emuReg{val: src.val - imm, known: true})
+		}
+	case ins&0x7f800000 == 0x52800000: // movz
+		shift := ((ins >> 21) & 3) * 16
+		e.set(rd, emuReg{val: uint64((ins>>5)&0xffff) << shift, known: true})
+	case ins&0x7f800000 == 0x12800000: // movn
+		shift := ((ins >> 21) & 3) * 16
+		val := ^(uint64((ins>>5)&0xffff) << shift)
+		if ins&(1<<31) == 0 {
+			val &= 0xffffffff
+		}
+		e.set(rd, emuReg{val: val, known: true})
+	case ins&0x7f800000 == 0x72800000: // movk
+		shift := ((ins >> 21) & 3) * 16
+		if r := e.get(rd); r.known {
+			e.set(rd, emuReg{val: r.val&^(0xffff<<shift) | uint64((ins>>5)&0xffff)<<shift, known: true})
+		}
+	case ins&0xff8003e0 == 0xb20003e0: // mov (orr xd, xzr, #bitmask)
+		e.set(rd, emuReg{val: arm64.DecodeBitMasks((ins>>22)&1, (ins>>10)&0x3f, (ins>>16)&0x3f, 64), known: true})
+	case ins&0x7fe0ffe0 == 0x2a0003e0: // mov (orr rd, zr, rm)
+		e.set(rd, e.get((ins>>16)&31))
+	case ins&0xffc00000 == 0xf9400000: // ldr x (unsigned offset)
+		if base := e.get(rn); base.known && rn != 31 {
+			if val, ok := e.readPtr(base.val + uint64((ins>>10)&0xfff)*8); ok {
+				e.set(rd, emuReg{val: val, known: true})
+				break
+			}
+		}
+		e.set(rd, emuReg{})
+	case ins&0xff000000 == 0x58000000: // ldr x (literal)
+		if val, ok := e.readPtr(pc + signExtend(uint64((ins>>5)&0x7ffff)<<2, 21)); ok {
+			e.set(rd, emuReg{val: val, known: true})
+		} else {
+			e.set(rd, emuReg{})
+		}
+	case ins&0xffc00000 == 0xf9000000: // str x (unsigned offset)
+		if events != nil && rn != 31 {
+			*events = append(*events, emuEvent{store: &emuStore{
+				pc:    pc,
+				base:  e.get(rn),
+				off:   uint64((ins>>10)&0xfff) * 8,
+				value: e.get(rd),
+			}})
+		}
+	case ins&0xfc000000 == 0x94000000, isBranchLinkReg(ins): // bl, blr
+		call := &emuCall{pc: pc}
+		if ins&0xfc000000 == 0x94000000 {
+			call.target = e.resolveStub(pc + signExtend(uint64(ins&0x3ffffff)<<2, 28))
+		} else if r := e.get(rn); r.known {
+			call.target = r.val
+		}
+		copy(call.args[:], e.regs[:8])
+		if events != nil {
+			*events = append(*events, emuEvent{call: call})
+		}
+		for r := 0; r < 19; r++ { // caller saved registers are clobbered
+			e.regs[r] = emuReg{}
+		}
+		e.regs[30] = emuReg{}
+		if e.ret != nil {
+			e.regs[0] = e.ret(call)
+		}
+	case ins&0xffff0000 == 0xdac10000 && (ins>>10)&0x3f <= 0x11: // pac*/aut*/xpac*
+		// pointer authentication doesn't change the (stripped) value
+	case (ins>>25)&0x5 == 0x4: // other loads/stores
+		if ins&(1<<22) != 0 { // loads clobber their destination(s)
+			e.set(rd, emuReg{})
+			if ins&0x3a000000 == 0x28000000 { // ldp
+				e.set((ins>>10)&31, emuReg{})
+			}
+		}
+	case (ins>>26)&0x7 == 0x4 || (ins>>25)&0x7 == 0x5: // other data processing instructions
+		e.set(rd, emuReg{})
+	}
+
+	return true
+}
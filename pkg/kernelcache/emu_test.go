@@ -0,0 +1,103 @@
+package kernelcache
+
+import "testing"
+
+// arm64 branch (register) encodings
+func encBr(rn uint32) uint32            { return 0xd61f0000 | rn<<5 }
+func encBraa(rn, rm uint32) uint32      { return 0xd71f0800 | rn<<5 | rm }
+func encBraaz(rn uint32) uint32         { return 0xd61f081f | rn<<5 }
+func encBlr(rn uint32) uint32           { return 0xd63f0000 | rn<<5 }
+func encBlraa(rn, rm uint32) uint32     { return 0xd73f0800 | rn<<5 | rm }
+func encBlrab(rn, rm uint32) uint32     { return 0xd73f0c00 | rn<<5 | rm }
+func encBlraaz(rn uint32) uint32        { return 0xd63f081f | rn<<5 }
+func encMovz(rd, imm uint32) uint32     { return 0xd2800000 | imm<<5 | rd }
+func encMovk(rd, imm, hw uint32) uint32 { return 0xf2800000 | hw<<21 | imm<<5 | rd }
+
+func TestBranchRegDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		ins  uint32
+		br   bool
+		blr  bool
+	}{
+		{"br x16", encBr(16), true, false},
+		{"braa x16, x17", encBraa(16, 17), true, false},
+		{"braaz x16", encBraaz(16), true, false},
+		{"blr x8", encBlr(8), false, true},
+		{"blraa x8, x17", encBlraa(8, 17), false, true},
+		{"blrab x8, x17", encBlrab(8, 17), false, true},
+		{"blraaz x8", encBlraaz(8), false, true},
+		{"ret", 0xd65f03c0, false, false},
+		{"retaa", 0xd65f0bff, false, false},
+		{"movz x8, #1", encMovz(8, 1), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBranchReg(tt.ins); got != tt.br {
+				t.Errorf("isBranchReg(%#08x) = %t, want %t", tt.ins, got, tt.br)
+			}
+			if got := isBranchLinkReg(tt.ins); got != tt.blr {
+				t.Errorf("isBranchLinkReg(%#08x) = %t, want %t", tt.ins, got, tt.blr)
+			}
+		})
+	}
+}
+
+func TestEmulatorBranchReg(t *testing.T) {
+	const target = 0xfffffff007b01234
+
+	tests := []struct {
+		name string
+		ins  uint32
+		call bool
+	}{
+		{"br", encBr(8), false},
+		{"braa", encBraa(8, 17), false},
+		{"blr", encBlr(8), true},
+		{"blraa", encBlraa(8, 17), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEmulator(nil)
+			var events []emuEvent
+			for i, ins := range []uint32{
+				encMovz(8, 0x1234),
+				encMovk(8, 0x07b0, 1),
+				encMovk(8, 0xfff0, 2),
+				encMovk(8, 0xffff, 3),
+				encMovz(0, 0x42),
+			} {
+				if !e.step(uint64(i)*4, ins, &events) {
+					t.Fatalf("step %d stopped", i)
+				}
+			}
+
+			cont := e.step(0x14, tt.ins, &events)
+			if tt.call {
+				if !cont {
+					t.Fatal("call stopped the emulation")
+				}
+				if len(events) != 1 || events[0].call == nil {
+					t.Fatalf("got %d events, want a call", len(events))
+				}
+				call := events[0].call
+				if call.target != target {
+					t.Errorf("call target = %#x, want %#x", call.target, uint64(target))
+				}
+				if !call.args[0].known || call.args[0].val != 0x42 {
+					t.Errorf("call x0 = %+v, want 0x42", call.args[0])
+				}
+				if e.regs[0].known {
+					t.Error("x0 not clobbered by the call")
+				}
+			} else {
+				if cont {
+					t.Fatal("branch didn't stop the emulation")
+				}
+				if len(events) != 0 {
+					t.Fatalf("got %d events, want none", len(events))
+				}
+			}
+		})
+	}
+}
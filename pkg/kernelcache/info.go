@@ -0,0 +1,290 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/pkg/errors"
+)
+
+// Kernelcache compression types
+const (
+	CompressionNone  = "none"
+	CompressionLZSS  = "lzss"
+	CompressionLZFSE = "lzfse"
+)
+
+var versionRE = regexp.MustCompile(`^Darwin Kernel Version (\d+\.\d+(?:\.\d+)?): ([^;]+); root:(xnu[\w-]*?-[\d.]+(?:~\d+)?)/(\w+)`)
+
+// Version is the parsed kernel version string
+type Version struct {
+	Raw    string `json:"raw"`
+	Darwin string `json:"darwin"`
+	Date   string `json:"date"`
+	XNU    string `json:"xnu"`
+	Type   string `json:"type"`
+	Arch   string `json:"arch"`
+	CPU    string `json:"cpu,omitempty"`
+}
+
+// KextInfo is a kext (or the kernel) in a kernelcache
+type KextInfo struct {
+	ID      string `json:"id"`
+	Version string `json:"version,omitempty"`
+	UUID    string `json:"uuid,omitempty"`
+	Addr    uint64 `json:"addr"`
+}
+
+// SegmentInfo is a top level kernelcache segment
+type SegmentInfo struct {
+	Name     string `json:"name"`
+	Addr     uint64 `json:"addr"`
+	Size     uint64 `json:"size"`
+	Offset   uint64 `json:"offset"`
+	FileSize uint64 `json:"file_size"`
+	Prot     string `json:"prot"`
+}
+
+// Info is a summary of what a kernelcache is
+type Info struct {
+	Compression string `json:"compression"`
+	Im4p        bool   `json:"im4p"`
+
+	Version  *Version `json:"version,omitempty"`
+	UUID     string   `json:"uuid,omitempty"`
+	Platform string   `json:"platform,omitempty"`
+	MinOS    string   `json:"min_os,omitempty"`
+	SDK      string   `json:"sdk,omitempty"`
+	Fileset  bool     `json:"fileset"`
+
+	BaseAddr     uint64        `json:"base_addr"`
+	TextExecAddr uint64        `json:"text_exec_addr,omitempty"`
+	Segments     []SegmentInfo `json:"segments"`
+
+	Kexts   []KextInfo `json:"kexts"`
+	Devices []string   `json:"devices,omitempty"`
+}
+
+// Unpack returns the Mach-O data of a raw, LZSS/LZFSE compressed or IM4P wrapped kernelcache
+// along with how it was packaged (only the Compression and Im4p fields of the Info are set)
+func Unpack(data []byte) ([]byte, *Info, error) {
+	info := &Info{Compression: CompressionNone}
+
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("kernelcache is too small")
+	}
+
+	switch binary.LittleEndian.Uint32(data) {
+	case uint32(types.Magic64), uint32(types.Magic32):
+		return data, info, nil
+	}
+	if binary.BigEndian.Uint32(data) == uint32(types.MagicFat) {
+		fat, err := macho.NewFatFile(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to parse fat mach-o")
+		}
+		defer fat.Close()
+		return data[fat.Arches[0].Offset:], info, nil
+	}
+
+	cc := &CompressedCache{Magic: data[:4], Size: len(data), Data: data}
+	if !bytes.Equal(cc.Magic, []byte("comp")) && !bytes.Equal(cc.Magic, []byte("bvx2")) {
+		var err error
+		cc, err = ParseImg4Data(data)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "kernelcache is not a Mach-O, LZSS/LZFSE stream or IM4P")
+		}
+		info.Im4p = true
+	}
+
+	switch {
+	case bytes.Equal(cc.Magic, []byte("bvx2")):
+		info.Compression = CompressionLZFSE
+	case bytes.Equal(cc.Magic, []byte("comp")):
+		info.Compression = CompressionLZSS
+	}
+
+	dec, err := DecompressData(cc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dec, info, nil
+}
+
+// GetVersion returns the kernel's version string (i.e. 'Darwin Kernel Version 21.0.0: ...; root:xnu-8019.12.5~1/RELEASE_ARM64_T8110')
+func GetVersion(m *macho.File) (*Version, error) {
+	kernel, err := getKernelMachO(m)
+	if err != nil {
+		return nil, err
+	}
+
+	needle := []byte("Darwin Kernel Version ")
+
+	var sections []*macho.Section
+	for _, sec := range kernel.Sections {
+		if sec.Name == "__const" || sec.Name == "__cstring" {
+			sections = append(sections, sec)
+		}
+	}
+	sections = append(sections, kernel.Sections...) // fallback to searching everything
+
+	for _, sec := range sections {
+		if sec.Size == 0 || sec.Offset == 0 {
+			continue
+		}
+		data := make([]byte, sec.Size)
+		if _, err := m.ReadAt(data, int64(sec.Offset)); err != nil {
+			continue
+		}
+		idx := bytes.Index(data, needle)
+		if idx < 0 {
+			continue
+		}
+		raw := data[idx:]
+		if end := bytes.IndexByte(raw, 0); end > 0 {
+			raw = raw[:end]
+		}
+		return parseVersion(string(raw))
+	}
+
+	return nil, fmt.Errorf("failed to find kernel version string")
+}
+
+func parseVersion(raw string) (*Version, error) {
+	v := &Version{Raw: raw}
+
+	matches := versionRE.FindStringSubmatch(raw)
+	if matches == nil {
+		return v, fmt.Errorf("failed to parse kernel version string: %s", raw)
+	}
+
+	v.Darwin = matches[1]
+	v.Date = strings.TrimSpace(matches[2])
+	v.XNU = matches[3]
+
+	// i.e. RELEASE_ARM64_T8110 or RELEASE_X86_64
+	config := strings.Replace(matches[4], "X86_64", "X86-64", 1)
+	parts := strings.SplitN(config, "_", 3)
+	v.Type = parts[0]
+	if len(parts) > 1 {
+		v.Arch = strings.Replace(parts[1], "X86-64", "X86_64", 1)
+	}
+	if len(parts) > 2 {
+		v.CPU = parts[2]
+	}
+
+	return v, nil
+}
+
+// GetInfo returns the version, build, layout and kext information of a kernelcache
+func GetInfo(m *macho.File) (*Info, error) {
+	info := &Info{
+		Compression: CompressionNone,
+		Fileset:     m.FileTOC.FileHeader.Type == types.FileSet,
+		BaseAddr:    m.GetBaseAddress(),
+	}
+
+	kernel, err := getKernelMachO(m)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Version, err = GetVersion(m)
+	if err != nil {
+		log.Debugf("failed to get kernel version: %v", err)
+	}
+
+	if uuid := kernel.UUID(); uuid != nil {
+		info.UUID = uuid.String()
+	}
+
+	bv := kernel.BuildVersion()
+	if bv == nil {
+		bv = m.BuildVersion()
+	}
+	if bv != nil {
+		info.Platform = bv.Platform
+		info.MinOS = bv.Minos
+		info.SDK = bv.Sdk
+	}
+
+	for _, seg := range m.Segments() {
+		info.Segments = append(info.Segments, SegmentInfo{
+			Name:     seg.Name,
+			Addr:     seg.Addr,
+			Size:     seg.Memsz,
+			Offset:   seg.Offset,
+			FileSize: seg.Filesz,
+			Prot:     fmt.Sprintf("%s/%s", seg.Prot, seg.Maxprot),
+		})
+	}
+	if text := kernel.Segment("__TEXT_EXEC"); text != nil {
+		info.TextExecAddr = text.Addr
+	}
+
+	kexts, err := GetKexts(m)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range kexts {
+		ki := KextInfo{ID: k.ID, Version: k.Version, Addr: k.Addr}
+		if km, err := openKextMachO(m, k); err == nil {
+			if uuid := km.UUID(); uuid != nil {
+				ki.UUID = uuid.String()
+			}
+			closeKextMachO(m, km)
+		} else {
+			log.Debugf("failed to parse %s: %v", k.ID, err)
+		}
+		info.Kexts = append(info.Kexts, ki)
+	}
+
+	return info, nil
+}
+
+func (i *Info) String() string {
+	var sb strings.Builder
+
+	if i.Version != nil {
+		fmt.Fprintf(&sb, "Version:     %s\n", i.Version.Raw)
+		fmt.Fprintf(&sb, "Darwin:      %s\n", i.Version.Darwin)
+		fmt.Fprintf(&sb, "XNU:         %s\n", i.Version.XNU)
+		fmt.Fprintf(&sb, "Config:      %s %s %s\n", i.Version.Type, i.Version.Arch, i.Version.CPU)
+	}
+	fmt.Fprintf(&sb, "UUID:        %s\n", i.UUID)
+	if len(i.Platform) > 0 {
+		fmt.Fprintf(&sb, "Platform:    %s (min OS %s, SDK %s)\n", i.Platform, i.MinOS, i.SDK)
+	}
+	compression := i.Compression
+	if i.Im4p {
+		compression += " (IM4P)"
+	}
+	fmt.Fprintf(&sb, "Compression: %s\n", compression)
+	fmt.Fprintf(&sb, "Fileset:     %t\n", i.Fileset)
+	if len(i.Devices) > 0 {
+		fmt.Fprintf(&sb, "Devices:     %s\n", strings.Join(i.Devices, ", "))
+	}
+
+	fmt.Fprintf(&sb, "\nLayout (base %#x", i.BaseAddr)
+	if i.TextExecAddr != 0 {
+		fmt.Fprintf(&sb, ", text exec %#x", i.TextExecAddr)
+	}
+	fmt.Fprintf(&sb, "):\n")
+	for _, seg := range i.Segments {
+		fmt.Fprintf(&sb, "  %-20s %#016x-%#016x off=%#09x size=%#09x %s\n", seg.Name, seg.Addr, seg.Addr+seg.Size, seg.Offset, seg.Size, seg.Prot)
+	}
+
+	fmt.Fprintf(&sb, "\nKexts (%d):\n", len(i.Kexts))
+	for _, k := range i.Kexts {
+		fmt.Fprintf(&sb, "  %#016x %s %s (%s)\n", k.Addr, k.UUID, k.ID, k.Version)
+	}
+
+	return sb.String()
+}
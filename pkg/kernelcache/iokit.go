@@ -0,0 +1,467 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/internal/symscript"
+)
+
+const (
+	maxVtableEntries = 1024
+	maxClassSize     = 0x100000
+)
+
+// IOKitMethod is a virtual method in an IOKit class's vtable
+type IOKitMethod struct {
+	Index     int    `json:"index"`
+	Addr      uint64 `json:"addr"`
+	Name      string `json:"name"`
+	Inherited bool   `json:"inherited,omitempty"`
+}
+
+// Demangled returns the demangled name of the method
+func (m IOKitMethod) Demangled() string {
+	return demangle.Do(m.Name, false, false)
+}
+
+// IOKitClass is a C++ class registered with OSMetaClass
+type IOKitClass struct {
+	Name       string        `json:"name"`
+	Super      string        `json:"super,omitempty"`
+	Size       uint32        `json:"size"`
+	MetaClass  uint64        `json:"metaclass"`
+	MetaVtable uint64        `json:"metaclass_vtable,omitempty"`
+	Vtable     uint64        `json:"vtable,omitempty"`
+	Kext       string        `json:"kext"`
+	Methods    []IOKitMethod `json:"methods,omitempty"`
+
+	superMeta uint64
+}
+
+func (c IOKitClass) String() string {
+	return fmt.Sprintf("%-48s size=%#-6x meta=%#x vtable=%#x (%s)", c.Name, c.Size, c.MetaClass, c.Vtable, c.Kext)
+}
+
+// getSymbolMap returns the address to name map of the kernel and kext symbols
+func getSymbolMap(m *macho.File, kexts []Kext) map[uint64]string {
+	syms := make(map[uint64]string)
+	add := func(f *macho.File) {
+		if f.Symtab == nil {
+			return
+		}
+		for _, sym := range f.Symtab.Syms {
+			if sym.Type&types.N_STAB == 0 && sym.Type&types.N_TYPE == types.N_SECT && len(sym.Name) > 0 {
+				if _, ok := syms[sym.Value]; !ok {
+					syms[sym.Value] = sym.Name
+				}
+			}
+		}
+	}
+	if m.FileTOC.FileHeader.Type != types.FileSet {
+		add(m)
+	}
+	for _, k := range kexts {
+		if m.FileTOC.FileHeader.Type != types.FileSet && k.ID == KernelID {
+			continue
+		}
+		km, err := OpenKext(m, k)
+		if err != nil {
+			log.Debugf("failed to parse %s: %v", k.ID, err)
+			continue
+		}
+		add(km)
+		closeKextMachO(m, km)
+	}
+	return syms
+}
+
+// getInitFuncs returns the addresses of a kext's static initializers
+func getInitFuncs(m, km *macho.File, base uint64) []uint64 {
+	var funcs []uint64
+	for _, sec := range km.Sections {
+		switch sec.Name {
+		case "__mod_init_func":
+			data, err := sec.Data()
+			if err != nil {
+				continue
+			}
+			ptrs := make([]uint64, len(data)/8)
+			binary.Read(bytes.NewReader(data), binary.LittleEndian, &ptrs)
+			for _, ptr := range ptrs {
+				if ptr != 0 {
+					funcs = append(funcs, resolvePtr(m, ptr))
+				}
+			}
+		case "__init_offsets":
+			data, err := sec.Data()
+			if err != nil {
+				continue
+			}
+			offs := make([]uint32, len(data)/4)
+			binary.Read(bytes.NewReader(data), binary.LittleEndian, &offs)
+			for _, off := range offs {
+				funcs = append(funcs, base+uint64(off))
+			}
+		}
+	}
+	return funcs
+}
+
+func isClassName(s string) bool {
+	if len(s) == 0 || len(s) > 256 {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || r == ':' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+type initFunc struct {
+	kext   string
+	addr   uint64
+	events []emuEvent
+}
+
+// findMetaClassCtors returns the OSMetaClass constructor(s) either by symbol or as the most common call
+// target in the static initializers that looks like OSMetaClass(name, superclass_meta, size)
+func findMetaClassCtors(m *macho.File, syms map[uint64]string, inits []initFunc) map[uint64]bool {
+	ctors := make(map[uint64]bool)
+	for addr, name := range syms {
+		if strings.HasPrefix(name, "__ZN11OSMetaClassC") && strings.Contains(name, "EPKcPKS_j") {
+			ctors[addr] = true
+		}
+	}
+	if len(ctors) > 0 {
+		return ctors
+	}
+
+	counts := make(map[uint64]int)
+	for _, fn := range inits {
+		for _, ev := range fn.events {
+			c := ev.call
+			if c == nil || c.target == 0 || !c.args[0].known || !c.args[1].known || !c.args[3].known || c.args[3].val > maxClassSize {
+				continue
+			}
+			if name, err := m.GetCString(c.args[1].val); err != nil || !isClassName(name) {
+				continue
+			}
+			counts[c.target]++
+		}
+	}
+	max := 0
+	for _, n := range counts {
+		if n > max {
+			max = n
+		}
+	}
+	for target, n := range counts {
+		// the zone variants of the constructor are less common
+		if n >= 4 && n*4 >= max {
+			ctors[target] = true
+		}
+	}
+	return ctors
+}
+
+// readVtable returns the function pointers of the vtable at addr (the address point is 16 bytes in)
+func readVtable(m *macho.File, addr uint64) []uint64 {
+	off, err := m.GetOffset(addr + 16)
+	if err != nil {
+		return nil
+	}
+	data := make([]byte, maxVtableEntries*8)
+	n, _ := m.ReadAt(data, int64(off))
+	var funcs []uint64
+	for i := 0; i+8 <= n; i += 8 {
+		ptr := binary.LittleEndian.Uint64(data[i:])
+		if ptr == 0 {
+			break
+		}
+		fn := resolvePtr(m, ptr)
+		if _, err := m.GetOffset(fn); err != nil {
+			break
+		}
+		funcs = append(funcs, fn)
+	}
+	return funcs
+}
+
+// findAllocSlot returns the metaclass vtable slot of alloc(), the slot that most metaclasses override
+func findAllocSlot(m *macho.File, classes []*IOKitClass) int {
+	distinct := make(map[int]map[uint64]bool)
+	for _, c := range classes {
+		for i, fn := range readVtable(m, c.MetaVtable) {
+			if distinct[i] == nil {
+				distinct[i] = make(map[uint64]bool)
+			}
+			distinct[i][fn] = true
+		}
+	}
+	// ties go to the later slot as alloc() is declared after the (also per class) destructors
+	slot, max := -1, 1
+	for i, fns := range distinct {
+		if len(fns) > max || len(fns) == max && i > slot {
+			slot, max = i, len(fns)
+		}
+	}
+	return slot
+}
+
+// findVtable emulates a metaclass's alloc() to find the vtable it stores into the new object
+// (the last one stored is the most derived class's as the constructors run from the root class down)
+func findVtable(e *emulator, fn uint64, depth int) uint64 {
+	saved := e.ret
+	allocated := depth > 0
+	e.ret = func(c *emuCall) emuReg {
+		if c.args[0].known && c.args[0].val == emuThis { // constructors return this
+			return emuReg{val: emuThis, known: true}
+		}
+		if !allocated { // the first call is operator new
+			allocated = true
+			return emuReg{val: emuThis, known: true}
+		}
+		return emuReg{}
+	}
+	events := e.run(fn)
+	e.ret = saved
+
+	var vtable uint64
+	for _, ev := range events {
+		if s := ev.store; s != nil && s.base.known && s.base.val == emuThis && s.off == 0 && s.value.known {
+			vtable = s.value.val - 16
+		}
+		if c := ev.call; c != nil && depth < 2 && c.target != 0 && c.args[0].known && c.args[0].val == emuThis {
+			e.reset()
+			e.regs[0] = emuReg{val: emuThis, known: true}
+			if vt := findVtable(e, c.target, depth+1); vt != 0 {
+				vtable = vt
+			}
+		}
+	}
+	return vtable
+}
+
+// mangledMethod renames a method's mangled name (i.e. __ZN8OSObject4freeEv) to another class
+func mangledMethod(name, class string) string {
+	for _, prefix := range []string{"__ZNK", "__ZN"} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := name[len(prefix):]
+		i, n := 0, 0
+		for ; i < len(rest) && rest[i] >= '0' && rest[i] <= '9'; i++ {
+			n = n*10 + int(rest[i]-'0')
+		}
+		if i == 0 || i+n > len(rest) {
+			return ""
+		}
+		return fmt.Sprintf("%s%d%s%s", prefix, len(class), class, rest[i+n:])
+	}
+	return ""
+}
+
+func vmethodName(class string, idx int) string {
+	method := fmt.Sprintf("vmethod_%d", idx)
+	return fmt.Sprintf("__ZN%d%s%d%sEv", len(class), class, len(method), method)
+}
+
+// GetIOKitClasses recovers the IOKit (OSMetaClass) class hierarchy of the kernel and its kexts
+func GetIOKitClasses(m *macho.File) ([]*IOKitClass, error) {
+	kexts, err := GetKexts(m)
+	if err != nil {
+		return nil, err
+	}
+
+	syms := getSymbolMap(m, kexts)
+	e := newEmulator(m)
+
+	var inits []initFunc
+	for _, k := range kexts {
+		km, err := openKextMachO(m, k)
+		if err != nil {
+			log.Debugf("failed to parse %s: %v", k.ID, err)
+			continue
+		}
+		for _, fn := range getInitFuncs(m, km, k.Addr) {
+			e.reset()
+			inits = append(inits, initFunc{kext: k.ID, addr: fn, events: e.run(fn)})
+		}
+		closeKextMachO(m, km)
+	}
+
+	ctors := findMetaClassCtors(m, syms, inits)
+	if len(ctors) == 0 {
+		return nil, fmt.Errorf("failed to find OSMetaClass constructor")
+	}
+
+	// emulate the initializers again now that we know the constructors return this
+	e.ret = func(c *emuCall) emuReg {
+		if ctors[c.target] {
+			return c.args[0]
+		}
+		return emuReg{}
+	}
+	for i := range inits {
+		e.reset()
+		inits[i].events = e.run(inits[i].addr)
+	}
+	e.ret = nil
+
+	var classes []*IOKitClass
+	byMeta := make(map[uint64]*IOKitClass)
+
+	for _, fn := range inits {
+		var last *IOKitClass
+		for _, ev := range fn.events {
+			if c := ev.call; c != nil && ctors[c.target] {
+				last = nil
+				if !c.args[0].known || !c.args[1].known {
+					continue
+				}
+				if _, dup := byMeta[c.args[0].val]; dup {
+					continue
+				}
+				name, err := m.GetCString(c.args[1].val)
+				if err != nil || !isClassName(name) {
+					continue
+				}
+				class := &IOKitClass{
+					Name:      name,
+					MetaClass: c.args[0].val,
+					Kext:      fn.kext,
+				}
+				if c.args[2].known {
+					class.superMeta = c.args[2].val
+				}
+				if c.args[3].known {
+					class.Size = uint32(c.args[3].val)
+				}
+				classes = append(classes, class)
+				byMeta[class.MetaClass] = class
+				last = class
+			} else if s := ev.store; s != nil && last != nil && last.MetaVtable == 0 {
+				// the metaclass's vtable is stored right after the constructor returns
+				if s.base.known && s.base.val == last.MetaClass && s.off == 0 && s.value.known {
+					last.MetaVtable = s.value.val - 16
+				}
+			}
+		}
+	}
+
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("failed to find any OSMetaClass instances")
+	}
+
+	vtables := make(map[string]uint64)
+	for addr, name := range syms {
+		if strings.HasPrefix(name, "__ZTV") {
+			vtables[name] = addr
+		}
+	}
+	allocSlot := findAllocSlot(m, classes)
+
+	for _, c := range classes {
+		if super, ok := byMeta[c.superMeta]; ok && c.superMeta != 0 {
+			c.Super = super.Name
+		}
+		if vt, ok := vtables[fmt.Sprintf("__ZTV%d%s", len(c.Name), c.Name)]; ok {
+			c.Vtable = vt
+			continue
+		}
+		if c.MetaVtable == 0 || allocSlot < 0 {
+			continue
+		}
+		if metaFuncs := readVtable(m, c.MetaVtable); allocSlot < len(metaFuncs) {
+			e.reset()
+			e.regs[0] = emuReg{val: c.MetaClass, known: true}
+			c.Vtable = findVtable(e, metaFuncs[allocSlot], 0)
+		}
+	}
+
+	// name the virtual methods from the root classes down
+	named := make(map[*IOKitClass]bool)
+	var nameMethods func(c *IOKitClass, depth int)
+	nameMethods = func(c *IOKitClass, depth int) {
+		if named[c] || depth > 64 {
+			return
+		}
+		named[c] = true
+		var super *IOKitClass
+		if s, ok := byMeta[c.superMeta]; ok && c.superMeta != 0 && s != c {
+			super = s
+			nameMethods(super, depth+1)
+		}
+		if c.Vtable == 0 {
+			return
+		}
+		for i, fn := range readVtable(m, c.Vtable) {
+			method := IOKitMethod{Index: i, Addr: fn}
+			if super != nil && i < len(super.Methods) {
+				sm := super.Methods[i]
+				if sm.Addr == fn {
+					method.Name = sm.Name
+					method.Inherited = true
+				} else if name, ok := syms[fn]; ok {
+					method.Name = name
+				} else {
+					method.Name = mangledMethod(sm.Name, c.Name)
+				}
+			} else if name, ok := syms[fn]; ok {
+				method.Name = name
+			}
+			if len(method.Name) == 0 {
+				method.Name = vmethodName(c.Name, i)
+			}
+			c.Methods = append(c.Methods, method)
+		}
+	}
+	for _, c := range classes {
+		nameMethods(c, 0)
+	}
+
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+
+	return classes, nil
+}
+
+// IOKitSymbols returns the symbols recovered from the IOKit classes for use in a disassembler script
+func IOKitSymbols(classes []*IOKitClass) []symscript.Symbol {
+	var syms []symscript.Symbol
+	seen := make(map[uint64]bool)
+	add := func(addr uint64, name string, kind symscript.Kind, comment string) {
+		if addr == 0 || seen[addr] {
+			return
+		}
+		seen[addr] = true
+		syms = append(syms, symscript.Symbol{Address: addr, Name: name, Kind: kind, Comment: comment})
+	}
+	for _, c := range classes {
+		n := fmt.Sprintf("%d%s", len(c.Name), c.Name)
+		add(c.MetaClass, "__ZN"+n+"10gMetaClassE", symscript.Data, c.Name+"::gMetaClass")
+		if c.MetaVtable != 0 {
+			add(c.MetaVtable, "__ZTVN"+n+"9MetaClassE", symscript.Data, "vtable for "+c.Name+"::MetaClass")
+		}
+		if c.Vtable != 0 {
+			add(c.Vtable, "__ZTV"+n, symscript.Data, "vtable for "+c.Name)
+		}
+		for _, m := range c.Methods {
+			if !m.Inherited {
+				add(m.Addr, m.Name, symscript.Function, m.Demangled())
+			}
+		}
+	}
+	return syms
+}
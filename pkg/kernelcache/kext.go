@@ -9,6 +9,7 @@ import (
 
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/types"
 	"github.com/blacktop/go-plist"
 )
 
@@ -181,6 +182,130 @@ func findCStringVMaddr(m *macho.File, cstr string) (uint64, error) {
 	return 0, fmt.Errorf("string not found in MachO")
 }
 
+func getPrelinkInfo(m *macho.File) (*PrelinkInfo, error) {
+	if infoSec := m.Section("__PRELINK_INFO", "__info"); infoSec != nil {
+
+		data, err := infoSec.Data()
+		if err != nil {
+			return nil, err
+		}
+
+		var prelink PrelinkInfo
+		decoder := plist.NewDecoder(bytes.NewReader(bytes.Trim([]byte(data), "\x00")))
+		err = decoder.Decode(&prelink)
+		if err != nil {
+			return nil, err
+		}
+
+		return &prelink, nil
+	}
+	return nil, fmt.Errorf("section __PRELINK_INFO.__info not found")
+}
+
+// resolvePtr converts a (tagged or chained fixup) pointer in the kernelcache into a vmaddr
+func resolvePtr(m *macho.File, ptr uint64) uint64 {
+	if ptr == 0 {
+		return 0
+	}
+	if _, err := m.GetOffset(ptr | tagPtrMask); err == nil {
+		return ptr | tagPtrMask
+	}
+	return fixupchains.DyldChainedPtr64KernelCacheRebase{Pointer: ptr}.Target() + m.GetBaseAddress()
+}
+
+// Kext is a kernel extension (or the kernel itself) in a kernelcache
+type Kext struct {
+	ID      string `json:"id"`
+	Version string `json:"version,omitempty"`
+	Addr    uint64 `json:"addr"`
+	Offset  uint64 `json:"offset"`
+}
+
+// KernelID is the bundle ID used for the kernel itself
+const KernelID = "com.apple.kernel"
+
+// GetKexts returns the kernel and kexts in a MH_FILESET or legacy prelinked kernelcache
+func GetKexts(m *macho.File) ([]Kext, error) {
+	var kexts []Kext
+
+	versions := make(map[string]string)
+	prelink, err := getPrelinkInfo(m)
+	if err == nil {
+		for _, bundle := range prelink.PrelinkInfoDictionary {
+			versions[bundle.ID] = bundle.Version
+		}
+	}
+
+	if m.FileTOC.FileHeader.Type == types.FileSet {
+		for _, fs := range m.FileSets() {
+			kexts = append(kexts, Kext{
+				ID:      fs.EntryID,
+				Version: versions[fs.EntryID],
+				Addr:    fs.Addr,
+				Offset:  fs.Offset,
+			})
+		}
+		return kexts, nil
+	}
+
+	kernel := Kext{ID: KernelID, Addr: m.GetBaseAddress()}
+	if sv := m.SourceVersion(); sv != nil {
+		kernel.Version = sv.Version
+	}
+	kexts = append(kexts, kernel)
+
+	if prelink == nil { // bare kernel
+		return kexts, nil
+	}
+
+	kextStartAdddrs, err := getKextStartVMAddrs(m)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bundle := range prelink.PrelinkInfoDictionary {
+		if bundle.OSKernelResource || int(bundle.ModuleIndex) >= len(kextStartAdddrs) {
+			continue
+		}
+		addr := kextStartAdddrs[bundle.ModuleIndex] | tagPtrMask
+		off, err := m.GetOffset(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get offset of %s: %v", bundle.ID, err)
+		}
+		kexts = append(kexts, Kext{
+			ID:      bundle.ID,
+			Version: bundle.Version,
+			Addr:    addr,
+			Offset:  off,
+		})
+	}
+
+	return kexts, nil
+}
+
+// getKernelMachO returns the kernel's MachO (the kernelcache itself if it isn't a MH_FILESET)
+func getKernelMachO(m *macho.File) (*macho.File, error) {
+	if m.FileTOC.FileHeader.Type == types.FileSet {
+		return m.GetFileSetFileByName(KernelID)
+	}
+	return m, nil
+}
+
+// OpenKext parses the MachO of a kext in the kernelcache
+func OpenKext(m *macho.File, k Kext) (*macho.File, error) {
+	return macho.NewFile(io.NewSectionReader(m, int64(k.Offset), 1<<63-1), macho.FileConfig{
+		Offset:    int64(k.Offset),
+		SrcReader: io.NewSectionReader(m, 0, 1<<63-1),
+		VMAddrConverter: types.VMAddrConverter{
+			Converter: func(addr uint64) uint64 {
+				return resolvePtr(m, addr)
+			},
+			VMAddr2Offet: m.GetOffset,
+			Offet2VMAddr: m.GetVMAddress,
+		},
+	})
+}
+
 // KextList lists all the kernel extensions in the kernelcache
 func KextList(kernel string) error {
 
@@ -195,27 +320,22 @@ func KextList(kernel string) error {
 		return err
 	}
 
-	if infoSec := m.Section("__PRELINK_INFO", "__info"); infoSec != nil {
-
-		data, err := infoSec.Data()
-		if err != nil {
-			return err
-		}
+	// MH_FILESET kernelcaches don't have a __PRELINK_INFO (and have never listed anything here)
+	if m.Section("__PRELINK_INFO", "__info") == nil {
+		return nil
+	}
 
-		var prelink PrelinkInfo
-		decoder := plist.NewDecoder(bytes.NewReader(bytes.Trim([]byte(data), "\x00")))
-		err = decoder.Decode(&prelink)
-		if err != nil {
-			return err
-		}
+	prelink, err := getPrelinkInfo(m)
+	if err != nil {
+		return err
+	}
 
-		fmt.Println("FOUND:", len(prelink.PrelinkInfoDictionary))
-		for _, bundle := range prelink.PrelinkInfoDictionary {
-			if !bundle.OSKernelResource {
-				fmt.Printf("%#x: %s (%s)\n", kextStartAdddrs[bundle.ModuleIndex]|tagPtrMask, bundle.ID, bundle.Version)
-			} else {
-				fmt.Printf("%#x: %s (%s)\n", 0, bundle.ID, bundle.Version)
-			}
+	fmt.Println("FOUND:", len(prelink.PrelinkInfoDictionary))
+	for _, bundle := range prelink.PrelinkInfoDictionary {
+		if !bundle.OSKernelResource {
+			fmt.Printf("%#x: %s (%s)\n", kextStartAdddrs[bundle.ModuleIndex]|tagPtrMask, bundle.ID, bundle.Version)
+		} else {
+			fmt.Printf("%#x: %s (%s)\n", 0, bundle.ID, bundle.Version)
 		}
 	}
 
@@ -0,0 +1,269 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+const (
+	kextPageSize     = 0x4000
+	maxKextSegSize   = 1 << 28
+	fileHeader64Size = 32
+	segment64Size    = 72
+	section64Size    = 80
+	nlist64Size      = 16
+)
+
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
+
+// linkedit data load commands whose data is carried over into the extracted kext
+var kextLinkEditDataCmds = map[types.LoadCmd]bool{
+	types.LC_FUNCTION_STARTS:          true,
+	types.LC_DATA_IN_CODE:             true,
+	types.LC_SEGMENT_SPLIT_INFO:       true,
+	types.LC_DYLIB_CODE_SIGN_DRS:      true,
+	types.LC_LINKER_OPTIMIZATION_HINT: true,
+	types.LC_DYLD_EXPORTS_TRIE:        true,
+	types.LC_DYLD_CHAINED_FIXUPS:      true,
+}
+
+// ExtractKext carves a kext out of the kernelcache into a standalone MachO
+//
+// The kext's segments are copied out of the kernelcache and laid out page aligned, its load commands are
+// rewritten to match and a new __LINKEDIT is built from the kext's symbols and whatever linkedit data
+// (function starts, data in code, etc) can still be read from the kernelcache. The code signature and
+// dyld info are dropped as they no longer apply and pointers are left as they are in the kernelcache.
+func ExtractKext(m *macho.File, k Kext) ([]byte, error) {
+	km, err := OpenKext(m, k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", k.ID, err)
+	}
+	defer closeKextMachO(m, km)
+
+	hdrData := make([]byte, fileHeader64Size)
+	if _, err := m.ReadAt(hdrData, int64(k.Offset)); err != nil {
+		return nil, fmt.Errorf("failed to read %s header: %v", k.ID, err)
+	}
+	var hdr types.FileHeader
+	if err := binary.Read(bytes.NewReader(hdrData), binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Magic != types.Magic64 {
+		return nil, fmt.Errorf("%s has unsupported magic %s", k.ID, hdr.Magic)
+	}
+	cmds := make([]byte, hdr.SizeCommands)
+	if _, err := m.ReadAt(cmds, int64(k.Offset)+fileHeader64Size); err != nil {
+		return nil, fmt.Errorf("failed to read %s load commands: %v", k.ID, err)
+	}
+
+	// lay out the segments
+	type segLayout struct {
+		data   []byte
+		newOff uint64
+	}
+	layout := make(map[string]*segLayout)
+	cur := alignUp(fileHeader64Size+uint64(hdr.SizeCommands), kextPageSize)
+	for _, seg := range km.Segments() {
+		if seg.Name == "__LINKEDIT" || seg.Filesz == 0 {
+			continue
+		}
+		if seg.Filesz > maxKextSegSize {
+			return nil, fmt.Errorf("%s segment %s is too large (%#x)", k.ID, seg.Name, seg.Filesz)
+		}
+		sl := &segLayout{data: make([]byte, seg.Filesz)}
+		if _, err := m.ReadAt(sl.data, int64(seg.Offset)); err != nil {
+			return nil, fmt.Errorf("failed to read %s segment %s: %v", k.ID, seg.Name, err)
+		}
+		if seg.Addr == k.Addr { // the segment containing the header
+			sl.newOff = 0
+			if end := alignUp(seg.Filesz, kextPageSize); end > cur {
+				cur = end
+			}
+		} else {
+			sl.newOff = cur
+			cur = alignUp(cur+seg.Filesz, kextPageSize)
+		}
+		layout[seg.Name] = sl
+	}
+
+	// build the new __LINKEDIT
+	var linkedit bytes.Buffer
+	linkeditOff := cur
+	newDataOffs := make(map[int]uint32) // load command offset -> new linkedit data offset
+
+	for pos := 0; pos+8 <= len(cmds); {
+		cmd := types.LoadCmd(binary.LittleEndian.Uint32(cmds[pos:]))
+		size := int(binary.LittleEndian.Uint32(cmds[pos+4:]))
+		if size < 8 || pos+size > len(cmds) {
+			return nil, fmt.Errorf("%s has a malformed load command at %#x", k.ID, pos)
+		}
+		if kextLinkEditDataCmds[cmd] {
+			dataOff := binary.LittleEndian.Uint32(cmds[pos+8:])
+			dataSize := binary.LittleEndian.Uint32(cmds[pos+12:])
+			data := make([]byte, dataSize)
+			if _, err := m.ReadAt(data, int64(dataOff)); dataSize > 0 && err == nil {
+				for linkedit.Len()%8 != 0 {
+					linkedit.WriteByte(0)
+				}
+				newDataOffs[pos] = uint32(linkeditOff) + uint32(linkedit.Len())
+				linkedit.Write(data)
+			} else if dataSize > 0 {
+				log.Debugf("failed to read %s %s data: %v", k.ID, cmd, err)
+			}
+		}
+		pos += size
+	}
+
+	// symbols sorted into locals, external definitions and undefined for LC_DYSYMTAB
+	var locals, extdefs, undefs []macho.Symbol
+	if km.Symtab != nil {
+		for _, sym := range km.Symtab.Syms {
+			switch {
+			case sym.Type&types.N_STAB == 0 && sym.Type&types.N_TYPE == types.N_UNDF:
+				undefs = append(undefs, sym)
+			case sym.Type&types.N_EXT != 0 && sym.Type&types.N_STAB == 0:
+				extdefs = append(extdefs, sym)
+			default:
+				locals = append(locals, sym)
+			}
+		}
+	}
+	syms := append(append(append([]macho.Symbol{}, locals...), extdefs...), undefs...)
+	for linkedit.Len()%8 != 0 {
+		linkedit.WriteByte(0)
+	}
+	symOff := uint32(linkeditOff) + uint32(linkedit.Len())
+	var strtab bytes.Buffer
+	strtab.WriteString(" \x00")
+	for _, sym := range syms {
+		n := types.Nlist64{
+			Nlist: types.Nlist{Type: sym.Type, Sect: sym.Sect, Desc: sym.Desc},
+			Value: sym.Value,
+		}
+		n.Name = 1 // empty string
+		if len(sym.Name) > 0 {
+			n.Name = uint32(strtab.Len())
+			strtab.WriteString(sym.Name + "\x00")
+		}
+		buf := make([]byte, nlist64Size)
+		n.Put64(buf, binary.LittleEndian)
+		linkedit.Write(buf)
+	}
+	for strtab.Len()%8 != 0 {
+		strtab.WriteByte(0)
+	}
+	strOff := uint32(linkeditOff) + uint32(linkedit.Len())
+	linkedit.Write(strtab.Bytes())
+
+	// patch the load commands
+	var newCmds []byte
+	for pos := 0; pos+8 <= len(cmds); {
+		cmd := types.LoadCmd(binary.LittleEndian.Uint32(cmds[pos:]))
+		size := int(binary.LittleEndian.Uint32(cmds[pos+4:]))
+
+		switch {
+		case cmd == types.LC_SEGMENT_64:
+			var seg types.Segment64
+			if err := binary.Read(bytes.NewReader(cmds[pos:]), binary.LittleEndian, &seg); err != nil {
+				return nil, err
+			}
+			name := strings.Trim(string(seg.Name[:]), "\x00")
+			var newOff uint64
+			switch {
+			case name == "__LINKEDIT":
+				seg.Offset = linkeditOff
+				seg.Filesz = uint64(linkedit.Len())
+				if seg.Memsz < seg.Filesz {
+					seg.Memsz = alignUp(seg.Filesz, kextPageSize)
+				}
+			case layout[name] != nil:
+				newOff = layout[name].newOff
+				seg.Offset = newOff
+			default:
+				seg.Offset = 0
+				seg.Filesz = 0
+			}
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.LittleEndian, seg)
+			copy(cmds[pos:], buf.Bytes())
+
+			for i := 0; i < int(seg.Nsect); i++ {
+				spos := pos + segment64Size + i*section64Size
+				if spos+section64Size > len(cmds) {
+					break
+				}
+				var sec types.Section64
+				if err := binary.Read(bytes.NewReader(cmds[spos:]), binary.LittleEndian, &sec); err != nil {
+					return nil, err
+				}
+				if sec.Offset != 0 && layout[name] != nil {
+					sec.Offset = uint32(newOff + (sec.Addr - seg.Addr))
+				} else {
+					sec.Offset = 0
+				}
+				sec.Reloff = 0
+				sec.Nreloc = 0
+				buf.Reset()
+				binary.Write(&buf, binary.LittleEndian, sec)
+				copy(cmds[spos:], buf.Bytes())
+			}
+		case cmd == types.LC_SYMTAB:
+			binary.LittleEndian.PutUint32(cmds[pos+8:], symOff)
+			binary.LittleEndian.PutUint32(cmds[pos+12:], uint32(len(syms)))
+			binary.LittleEndian.PutUint32(cmds[pos+16:], strOff)
+			binary.LittleEndian.PutUint32(cmds[pos+20:], uint32(strtab.Len()))
+		case cmd == types.LC_DYSYMTAB:
+			dysymtab := types.DysymtabCmd{
+				LoadCmd:    cmd,
+				Len:        uint32(size),
+				Ilocalsym:  0,
+				Nlocalsym:  uint32(len(locals)),
+				Iextdefsym: uint32(len(locals)),
+				Nextdefsym: uint32(len(extdefs)),
+				Iundefsym:  uint32(len(locals) + len(extdefs)),
+				Nundefsym:  uint32(len(undefs)),
+			}
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.LittleEndian, dysymtab)
+			copy(cmds[pos:], buf.Bytes())
+		case kextLinkEditDataCmds[cmd]:
+			if off, ok := newDataOffs[pos]; ok {
+				binary.LittleEndian.PutUint32(cmds[pos+8:], off)
+			} else {
+				binary.LittleEndian.PutUint32(cmds[pos+8:], 0)
+				binary.LittleEndian.PutUint32(cmds[pos+12:], 0)
+			}
+		case cmd == types.LC_CODE_SIGNATURE: // dropped
+			hdr.NCommands--
+			pos += size
+			continue
+		case cmd == types.LC_DYLD_INFO || cmd == types.LC_DYLD_INFO_ONLY:
+			for i := pos + 8; i < pos+size; i++ {
+				cmds[i] = 0
+			}
+		}
+
+		newCmds = append(newCmds, cmds[pos:pos+size]...)
+		pos += size
+	}
+	hdr.SizeCommands = uint32(len(newCmds))
+	hdr.Put(hdrData, binary.LittleEndian)
+
+	out := make([]byte, linkeditOff+uint64(linkedit.Len()))
+	for _, sl := range layout {
+		copy(out[sl.newOff:], sl.data)
+	}
+	copy(out, hdrData)
+	copy(out[fileHeader64Size:], newCmds)
+	copy(out[linkeditOff:], linkedit.Bytes())
+
+	return out, nil
+}
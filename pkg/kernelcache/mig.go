@@ -0,0 +1,262 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+)
+
+const (
+	migSubsystemHeaderSize = 32
+	migMaxRoutines         = 1024
+	migMaxMsgSize          = 0x100000
+	migMaxDescriptors      = 64
+
+	// mig_kern_routine_descriptor (xnu-7195+) and the user space routine_descriptor strides
+	migKernRoutineSize = 24
+	migRoutineSize     = 40
+
+	// the first xnu version (iOS 14) whose subsystems are mig_kern_subsystems
+	migKernSubsystemXNU = 7195
+)
+
+// known kernel MIG subsystems by their first message ID
+var migSubsystemNames = map[int32]string{
+	200:    "mach_host",
+	400:    "host_priv",
+	600:    "host_security",
+	1000:   "clock",
+	1200:   "clock_priv",
+	2000:   "memory_object_control",
+	2800:   "iokit",
+	3000:   "processor",
+	3200:   "mach_port",
+	3400:   "task",
+	3600:   "thread_act",
+	3800:   "vm_map",
+	4000:   "processor_set",
+	4800:   "mach_vm",
+	4900:   "memory_entry",
+	5400:   "mach_voucher",
+	6200:   "UNDReply",
+	8000:   "task_restartable",
+	51471:  "arcade_register",
+	617000: "lock_set",
+	716200: "mach_eventlink",
+}
+
+type migSubsystem64 struct {
+	Server   uint64
+	Start    int32
+	End      int32
+	MaxSize  uint32
+	_        uint32
+	Reserved uint64
+}
+
+// migRoutine64 is a MIG routine descriptor read with either layout:
+//
+//	routine_descriptor:          impl_routine, stub_routine, argc, descr_count, arg_descr, max_reply_msg
+//	mig_kern_routine_descriptor: kstub_routine, argc, descr_count, reply_descr_count, max_reply_msg
+type migRoutine64 struct {
+	ImplRoutine     uint64
+	StubRoutine     uint64
+	ArgC            uint32
+	DescrCount      uint32
+	ReplyDescrCount uint32
+	MaxReplyMsg     uint32
+}
+
+func readMigRoutine(data []byte, off, stride int) migRoutine64 {
+	if stride == migKernRoutineSize {
+		return migRoutine64{
+			StubRoutine:     binary.LittleEndian.Uint64(data[off:]),
+			ArgC:            binary.LittleEndian.Uint32(data[off+8:]),
+			DescrCount:      binary.LittleEndian.Uint32(data[off+12:]),
+			ReplyDescrCount: binary.LittleEndian.Uint32(data[off+16:]),
+			MaxReplyMsg:     binary.LittleEndian.Uint32(data[off+20:]),
+		}
+	}
+	return migRoutine64{
+		ImplRoutine: binary.LittleEndian.Uint64(data[off:]),
+		StubRoutine: binary.LittleEndian.Uint64(data[off+8:]),
+		ArgC:        binary.LittleEndian.Uint32(data[off+16:]),
+		DescrCount:  binary.LittleEndian.Uint32(data[off+20:]),
+		MaxReplyMsg: binary.LittleEndian.Uint32(data[off+32:]),
+	}
+}
+
+// MigRoutine is a routine of a MIG subsystem
+type MigRoutine struct {
+	Number      int32  `json:"number"`
+	Stub        uint64 `json:"stub"`
+	Impl        uint64 `json:"impl,omitempty"`
+	ArgC        uint32 `json:"argc"`
+	MaxReplyMsg uint32 `json:"max_reply_msg"`
+}
+
+// MigSubsystem is a MIG subsystem served by the kernel
+type MigSubsystem struct {
+	Name     string       `json:"name,omitempty"`
+	Addr     uint64       `json:"addr"`
+	Server   uint64       `json:"server"`
+	Start    int32        `json:"start"`
+	End      int32        `json:"end"`
+	MaxSize  uint32       `json:"max_size"`
+	Routines []MigRoutine `json:"routines"`
+}
+
+func (s MigSubsystem) String() string {
+	var sb strings.Builder
+	name := s.Name
+	if len(name) == 0 {
+		name = "(unknown)"
+	}
+	fmt.Fprintf(&sb, "%#x: %-24s start=%-6d end=%-6d server=%#x routines=%d\n", s.Addr, name, s.Start, s.End, s.Server, len(s.Routines))
+	for _, r := range s.Routines {
+		fmt.Fprintf(&sb, "    %6d: stub=%#x argc=%d\n", r.Number, r.Stub, r.ArgC)
+	}
+	return sb.String()
+}
+
+// isKernelPtr returns true if the (tagged or chained fixup) pointer points into the kernelcache
+func isKernelPtr(m *macho.File, ptr uint64) bool {
+	if ptr == 0 {
+		return false
+	}
+	_, err := m.GetOffset(resolvePtr(m, ptr))
+	return err == nil
+}
+
+// migRoutineStrides returns the routine descriptor strides to try, the kernel's own layout first
+func migRoutineStrides(m *macho.File) []int {
+	if v, err := GetVersion(m); err == nil {
+		// i.e. xnu-7195.141.2~1
+		ver := v.XNU[strings.LastIndex(v.XNU, "-")+1:]
+		if idx := strings.IndexByte(ver, '.'); idx > 0 {
+			ver = ver[:idx]
+		}
+		if major, err := strconv.Atoi(ver); err == nil && major < migKernSubsystemXNU {
+			return []int{migRoutineSize, migKernRoutineSize}
+		}
+	}
+	return []int{migKernRoutineSize, migRoutineSize}
+}
+
+// readMigRoutines reads and validates the count routine descriptors at off
+func readMigRoutines(data []byte, off, count, stride int, maxSize uint32, isPtr func(uint64) bool) ([]migRoutine64, bool) {
+	if off+count*stride > len(data) {
+		return nil, false
+	}
+	routines := make([]migRoutine64, count)
+	implemented := 0
+	for i := range routines {
+		r := readMigRoutine(data, off+i*stride, stride)
+		if r.StubRoutine == 0 {
+			if r.ImplRoutine != 0 || r.ArgC != 0 {
+				return nil, false
+			}
+			continue
+		}
+		if !isPtr(r.StubRoutine) || (r.ImplRoutine != 0 && !isPtr(r.ImplRoutine)) || r.ArgC > 64 ||
+			r.DescrCount > migMaxDescriptors || r.ReplyDescrCount > migMaxDescriptors || r.MaxReplyMsg > maxSize {
+			return nil, false
+		}
+		routines[i] = r
+		implemented++
+	}
+	if implemented == 0 {
+		return nil, false
+	}
+	return routines, true
+}
+
+// findMigSubsystems scans data (at addr) for mig_subsystem structs with the routine descriptor strides in
+// order of preference (the pointers are returned as they are in data)
+func findMigSubsystems(data []byte, addr uint64, strides []int, isPtr func(uint64) bool) []MigSubsystem {
+	var subsystems []MigSubsystem
+
+	for off := 0; off+migSubsystemHeaderSize <= len(data); off += 8 {
+		var hdr migSubsystem64
+		binary.Read(bytes.NewReader(data[off:off+migSubsystemHeaderSize]), binary.LittleEndian, &hdr)
+
+		if hdr.Reserved != 0 || hdr.Start <= 0 || hdr.End <= hdr.Start || hdr.End-hdr.Start > migMaxRoutines ||
+			hdr.MaxSize == 0 || hdr.MaxSize > migMaxMsgSize || !isPtr(hdr.Server) {
+			continue
+		}
+
+		count := int(hdr.End - hdr.Start)
+		var routines []migRoutine64
+		var stride int
+		for _, stride = range strides {
+			var ok bool
+			if routines, ok = readMigRoutines(data, off+migSubsystemHeaderSize, count, stride, hdr.MaxSize, isPtr); ok {
+				break
+			}
+		}
+		if routines == nil {
+			continue
+		}
+
+		sub := MigSubsystem{
+			Name:    migSubsystemNames[hdr.Start],
+			Addr:    addr + uint64(off),
+			Server:  hdr.Server,
+			Start:   hdr.Start,
+			End:     hdr.End,
+			MaxSize: hdr.MaxSize,
+		}
+		for i, r := range routines {
+			if r.StubRoutine == 0 {
+				continue
+			}
+			sub.Routines = append(sub.Routines, MigRoutine{
+				Number:      hdr.Start + int32(i),
+				Stub:        r.StubRoutine,
+				Impl:        r.ImplRoutine,
+				ArgC:        r.ArgC,
+				MaxReplyMsg: r.MaxReplyMsg,
+			})
+		}
+		subsystems = append(subsystems, sub)
+
+		off += migSubsystemHeaderSize + count*stride - 8 // skip over the routines
+	}
+
+	return subsystems
+}
+
+// GetMigSubsystems recovers the kernel's MIG subsystems by scanning its const data for mig_subsystem structs
+// (mig_kern_subsystem structs on xnu-7195+ kernels)
+func GetMigSubsystems(m *macho.File) ([]MigSubsystem, error) {
+	addr, data, err := getKernelConstData(m)
+	if err != nil {
+		return nil, err
+	}
+
+	subsystems := findMigSubsystems(data, addr, migRoutineStrides(m), func(ptr uint64) bool {
+		return isKernelPtr(m, ptr)
+	})
+	if len(subsystems) == 0 {
+		return nil, fmt.Errorf("failed to find any MIG subsystems")
+	}
+
+	for i := range subsystems {
+		subsystems[i].Server = resolvePtr(m, subsystems[i].Server)
+		for j := range subsystems[i].Routines {
+			subsystems[i].Routines[j].Stub = resolvePtr(m, subsystems[i].Routines[j].Stub)
+			subsystems[i].Routines[j].Impl = resolvePtr(m, subsystems[i].Routines[j].Impl)
+		}
+	}
+
+	sort.Slice(subsystems, func(i, j int) bool {
+		return subsystems[i].Start < subsystems[j].Start
+	})
+
+	return subsystems, nil
+}
@@ -0,0 +1,99 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+const (
+	testMigServer = 0xfffffff007c01000
+	testMigStub   = 0xfffffff007c02000
+)
+
+func testKernelPtr(ptr uint64) bool {
+	return ptr>>32 == 0xfffffff0
+}
+
+// migSubsystem builds a synthetic mach_port mig_subsystem (routines 3200-3205, 3203 unimplemented) with the
+// routine descriptor stride, preceded by pad bytes of other const data
+func migSubsystem(pad, stride int) []byte {
+	const start, end, maxSize = 3200, 3206, 0x2c
+
+	data := make([]byte, pad+migSubsystemHeaderSize+stride*(end-start)+64)
+	for i := 0; i < pad; i += 8 {
+		binary.LittleEndian.PutUint64(data[i:], 0x4141414141414141)
+	}
+	off := pad
+	binary.LittleEndian.PutUint64(data[off:], testMigServer)
+	binary.LittleEndian.PutUint32(data[off+8:], start)
+	binary.LittleEndian.PutUint32(data[off+12:], end)
+	binary.LittleEndian.PutUint32(data[off+16:], maxSize)
+
+	for i := 0; i < end-start; i++ {
+		r := off + migSubsystemHeaderSize + stride*i
+		if i == 3 {
+			continue
+		}
+		stub, argc, reply := testMigStub+0x100*uint64(i), uint32(i+1), uint32(0x24+i)
+		if stride == migKernRoutineSize {
+			binary.LittleEndian.PutUint64(data[r:], stub)
+			binary.LittleEndian.PutUint32(data[r+8:], argc)
+			binary.LittleEndian.PutUint32(data[r+12:], 0) // descr_count
+			binary.LittleEndian.PutUint32(data[r+16:], 1) // reply_descr_count
+			binary.LittleEndian.PutUint32(data[r+20:], reply)
+		} else {
+			binary.LittleEndian.PutUint64(data[r+8:], stub) // no impl_routine in the kernel
+			binary.LittleEndian.PutUint32(data[r+16:], argc)
+			binary.LittleEndian.PutUint32(data[r+32:], reply)
+		}
+	}
+	return data
+}
+
+func TestFindMigSubsystems(t *testing.T) {
+	tests := []struct {
+		name    string
+		pad     int
+		stride  int
+		strides []int
+	}{
+		{"mig_kern_subsystem", 0x40, migKernRoutineSize, []int{migKernRoutineSize, migRoutineSize}},
+		{"mig_kern_subsystem on an older kernel", 0x40, migKernRoutineSize, []int{migRoutineSize, migKernRoutineSize}},
+		{"mig_subsystem", 0x18, migRoutineSize, []int{migRoutineSize, migKernRoutineSize}},
+		{"mig_subsystem on a newer kernel", 0x18, migRoutineSize, []int{migKernRoutineSize, migRoutineSize}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs := findMigSubsystems(migSubsystem(tt.pad, tt.stride), 0xfffffff007a00000, tt.strides, testKernelPtr)
+			if len(subs) != 1 {
+				t.Fatalf("found %d subsystems, want 1: %+v", len(subs), subs)
+			}
+			sub := subs[0]
+			if sub.Name != "mach_port" || sub.Addr != 0xfffffff007a00000+uint64(tt.pad) || sub.Server != testMigServer ||
+				sub.Start != 3200 || sub.End != 3206 || sub.MaxSize != 0x2c {
+				t.Fatalf("subsystem = %+v", sub)
+			}
+			if len(sub.Routines) != 5 {
+				t.Fatalf("got %d routines, want 5", len(sub.Routines))
+			}
+			for _, r := range sub.Routines {
+				i := int(r.Number - 3200)
+				if i == 3 {
+					t.Errorf("unimplemented routine %d returned", r.Number)
+				}
+				if r.Stub != testMigStub+0x100*uint64(i) || r.Impl != 0 || r.ArgC != uint32(i+1) || r.MaxReplyMsg != uint32(0x24+i) {
+					t.Errorf("routine %d = %+v", r.Number, r)
+				}
+			}
+		})
+	}
+}
+
+func TestFindMigSubsystemsNotFound(t *testing.T) {
+	data := migSubsystem(0, migKernRoutineSize)
+	// a reply bigger than the subsystem's max size
+	binary.LittleEndian.PutUint32(data[migSubsystemHeaderSize+20:], 0x1000)
+	if subs := findMigSubsystems(data, 0, []int{migKernRoutineSize, migRoutineSize}, testKernelPtr); len(subs) != 0 {
+		t.Fatalf("found %+v", subs)
+	}
+}
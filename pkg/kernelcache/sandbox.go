@@ -15,10 +15,16 @@ import (
 )
 
 type Sandbox struct {
+	Header   SandboxProfileCollection
 	Globals  map[uint16]string
+	Messages []string
 	Regexes  map[uint16][]byte
 	OpNodes  map[uint16]uint64
 	Profiles []SandboxProfile
+
+	data         []byte
+	baseAddr     uint32
+	regexOffsets []uint16
 }
 
 type SandboxProfileCollection struct {
@@ -287,11 +293,24 @@ func GetSandboxCollections(m *macho.File, r *bytes.Reader) ([]byte, error) {
 	return getSandboxData(m, r, "\"failed to initialize collection\"")
 }
 
+// ParseSandboxCollection parses the sandbox profile collection data
 func ParseSandboxCollection(data []byte, opsList []string) (*Sandbox, error) {
+	return parseSandbox(data, opsList, true)
+}
+
+// ParseSandboxProfile parses the platform sandbox profile data
+//
+// NOTE: the platform profile shares the collection's header and tables, but has a single
+// operation table with no name or version entry in front of it.
+func ParseSandboxProfile(data []byte, opsList []string) (*Sandbox, error) {
+	return parseSandbox(data, opsList, false)
+}
+
+func parseSandbox(data []byte, opsList []string, isCollection bool) (*Sandbox, error) {
 	var collection SandboxProfileCollection
 
 	// init Sandbox
-	sb := &Sandbox{}
+	sb := &Sandbox{data: data}
 	sb.Globals = make(map[uint16]string)
 	sb.OpNodes = make(map[uint16]uint64)
 	sb.Regexes = make(map[uint16][]byte)
@@ -301,9 +320,10 @@ func ParseSandboxCollection(data []byte, opsList []string) (*Sandbox, error) {
 	if err := binary.Read(r, binary.LittleEndian, &collection); err != nil {
 		return nil, fmt.Errorf("failed to read sandbox profile collection structure: %v", err)
 	}
+	sb.Header = collection
 
-	regexOffsets := make([]uint16, collection.RegexItemCount)
-	if err := binary.Read(r, binary.LittleEndian, &regexOffsets); err != nil {
+	sb.regexOffsets = make([]uint16, collection.RegexItemCount)
+	if err := binary.Read(r, binary.LittleEndian, &sb.regexOffsets); err != nil {
 		return nil, fmt.Errorf("failed to read sandbox profile regex offets: %v", err)
 	}
 
@@ -317,14 +337,19 @@ func ParseSandboxCollection(data []byte, opsList []string) (*Sandbox, error) {
 		return nil, fmt.Errorf("failed to read sandbox profile message offets: %v", err)
 	}
 
+	profileCount := uint32(collection.ProfileCount)
 	profileSize := uint32(collection.OpCount+uint8(binary.Size(uint16(0)))) * 2
+	if !isCollection {
+		profileCount = 1
+		profileSize = uint32(collection.OpCount) * 2
+	}
 	log.Debugf("[+] profile size: %d", profileSize)
 
 	globalVarStart := 2*uint32(collection.RegexItemCount) + 12
 	globalVarEnd := globalVarStart + 2*uint32(collection.GlobalVarCount)
 	log.Debugf("[+] global var start: %#x, end: %#x", globalVarStart, globalVarEnd)
 
-	opNodeStartTmp := globalVarEnd + 2*uint32(collection.MsgItemCount) + profileSize*uint32(collection.ProfileCount)
+	opNodeStartTmp := globalVarEnd + 2*uint32(collection.MsgItemCount) + profileSize*profileCount
 	log.Debugf("[+] temp op node start: %#x", opNodeStartTmp)
 
 	// delta op node start
@@ -339,11 +364,11 @@ func ParseSandboxCollection(data []byte, opsList []string) (*Sandbox, error) {
 	log.Debugf("[+] op node start: %#x", opNodeStart)
 
 	// start address of regex, global, messsages
-	baseAddr := opNodeStart + uint32(collection.OpNodeSize)*8
-	log.Debugf("[+] start address of regex, global, messsages: %#x", baseAddr)
+	sb.baseAddr = opNodeStart + uint32(collection.OpNodeSize)*8
+	log.Debugf("[+] start address of regex, global, messsages: %#x", sb.baseAddr)
 
 	var profileDatas [][]byte
-	for i := uint16(0); i < collection.ProfileCount; i++ {
+	for i := uint32(0); i < profileCount; i++ {
 		profile := make([]byte, profileSize)
 		if err := binary.Read(r, binary.LittleEndian, &profile); err != nil {
 			return nil, fmt.Errorf("failed to read sandbox profiles: %v", err)
@@ -352,124 +377,83 @@ func ParseSandboxCollection(data []byte, opsList []string) (*Sandbox, error) {
 	}
 
 	for idx, prof := range profileDatas {
-		sp := SandboxProfile{}
+		sp := SandboxProfile{Name: "platform"}
 
 		pr := bytes.NewReader(prof)
 
 		var nameOffset uint16
-		if err := binary.Read(pr, binary.LittleEndian, &nameOffset); err != nil {
-			return nil, fmt.Errorf("failed to read profile name offset for index %d: %v", idx, err)
-		}
-
-		if err := binary.Read(pr, binary.LittleEndian, &sp.Version); err != nil {
-			return nil, fmt.Errorf("failed to read profile version for index %d: %v", idx, err)
+		if isCollection {
+			if err := binary.Read(pr, binary.LittleEndian, &nameOffset); err != nil {
+				return nil, fmt.Errorf("failed to read profile name offset for index %d: %v", idx, err)
+			}
+			if err := binary.Read(pr, binary.LittleEndian, &sp.Version); err != nil {
+				return nil, fmt.Errorf("failed to read profile version for index %d: %v", idx, err)
+			}
 		}
 
 		for i := 0; i < int(collection.OpCount); i++ {
-			so := SandboxOperation{Name: opsList[i]}
+			so := SandboxOperation{Name: fmt.Sprintf("op-%d", i)}
+			if i < len(opsList) {
+				so.Name = opsList[i]
+			}
 			if err := binary.Read(pr, binary.LittleEndian, &so.Index); err != nil {
-				return nil, fmt.Errorf("failed to read sandbox operation index for %s: %v", opsList[i], err)
+				return nil, fmt.Errorf("failed to read sandbox operation index for %s: %v", so.Name, err)
 			}
-			// TODO: lookup operation value
 			sp.Operations = append(sp.Operations, so)
 		}
 
-		r.Seek(int64(baseAddr+8*uint32(nameOffset)), io.SeekStart)
-		var nameLength uint16
-		if err := binary.Read(r, binary.LittleEndian, &nameLength); err != nil {
-			return nil, fmt.Errorf("failed to read profile name length for index %d: %v", idx, err)
-		}
-
-		str := make([]byte, nameLength)
-		_, err := r.Read(str)
-		if err != nil {
-			return nil, err
+		if isCollection {
+			name, err := sb.readString(nameOffset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read profile name for index %d: %v", idx, err)
+			}
+			sp.Name = name
 		}
 
-		sp.Name = strings.Trim(string(str[:]), "\x00")
-
 		sb.Profiles = append(sb.Profiles, sp)
 	}
 
 	profileDatas = nil
 
-	// fmt.Printf("\nOperation Nodes\n")
-	// fmt.Println("===============")
+	// op nodes are 8 byte records referenced by their index
 	r.Seek(int64(opNodeStart), io.SeekStart)
-	opNodeCount := (baseAddr - opNodeStart) / 8
-	opNodeOffsets := make([]uint16, opNodeCount)
-	if err := binary.Read(r, binary.LittleEndian, &opNodeOffsets); err != nil {
-		return nil, fmt.Errorf("failed to read sandbox op node offets: %v", err)
-	}
-	// TODO: refactor to only use sb.OpNodes
-	opNodes := make([]uint64, opNodeCount)
-	for _, opoff := range opNodeOffsets {
+	for i := uint16(0); i < collection.OpNodeSize; i++ {
 		var opNodeValue uint64
-		r.Seek(int64(opoff), io.SeekStart)
 		if err := binary.Read(r, binary.LittleEndian, &opNodeValue); err != nil {
-			return nil, fmt.Errorf("failed to read sandbox op node offets: %v", err)
+			return nil, fmt.Errorf("failed to read sandbox op node %d: %v", i, err)
 		}
-		opNodes = append(opNodes, opNodeValue)
-		sb.OpNodes[opoff] = opNodeValue
+		sb.OpNodes[i] = opNodeValue
 	}
 
 	for i, prof := range sb.Profiles {
 		for j, o := range prof.Operations {
-			sb.Profiles[i].Operations[j].Value = opNodes[o.Index]
+			sb.Profiles[i].Operations[j].Value = sb.OpNodes[o.Index]
 		}
 	}
 
-	// fmt.Println("Messages")
-	// fmt.Println("========")
-	// for _, moff := range msgOffsets {
-	// 	r.Seek(int64(baseAddr+uint32(moff)), io.SeekStart)
-
-	// 	length, err := r.ReadByte()
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-
-	// 	str := make([]byte, length)
-	// 	_, err = r.Read(str)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-
-	// 	fmt.Println(string(str[:]))
-	// }
-
-	for _, goff := range globalOffsets {
-		r.Seek(int64(baseAddr+8*uint32(goff)), io.SeekStart)
-
-		var globalLength uint16
-		if err := binary.Read(r, binary.LittleEndian, &globalLength); err != nil {
-			return nil, fmt.Errorf("failed to read global variable length: %v", err)
-		}
-
-		str := make([]byte, globalLength)
-		_, err := r.Read(str)
+	for _, moff := range msgOffsets {
+		msg, err := sb.readString(moff)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to read message string: %v", err)
 		}
-
-		sb.Globals[goff] = strings.Trim(string(str[:]), "\x00")
+		sb.Messages = append(sb.Messages, msg)
 	}
 
-	for idx, roff := range regexOffsets {
-
-		r.Seek(int64(baseAddr+8*uint32(roff)), io.SeekStart)
-
-		var itemLength uint16
-		if err := binary.Read(r, binary.LittleEndian, &itemLength); err != nil {
-			return nil, fmt.Errorf("failed to read regex table offset: %v", err)
+	for _, goff := range globalOffsets {
+		global, err := sb.readString(goff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read global variable: %v", err)
 		}
+		sb.Globals[goff] = global
+	}
 
-		data := make([]byte, itemLength)
-		if _, err := r.Read(data); err != nil {
-			return nil, err
+	for idx, roff := range sb.regexOffsets {
+		data, err := sb.readItem(roff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read regex table item %d: %v", idx, err)
 		}
 
-		log.Debugf("[+] idx: %03d, offset: %#x, location: %#x, length: %#x\n\n%s", idx, baseAddr+8*uint32(roff), 8*roff, itemLength, hex.Dump(data))
+		log.Debugf("[+] idx: %03d, offset: %#x, location: %#x, length: %#x\n\n%s", idx, sb.baseAddr+8*uint32(roff), 8*roff, len(data), hex.Dump(data))
 
 		sb.Regexes[roff] = data
 	}
@@ -477,6 +461,27 @@ func ParseSandboxCollection(data []byte, opsList []string) (*Sandbox, error) {
 	return sb, nil
 }
 
+// readItem reads a length prefixed item from the area following the op nodes
+func (sb *Sandbox) readItem(off uint16) ([]byte, error) {
+	start := int(sb.baseAddr) + 8*int(off)
+	if start+2 > len(sb.data) {
+		return nil, fmt.Errorf("item offset %#x is out of bounds", start)
+	}
+	length := int(binary.LittleEndian.Uint16(sb.data[start:]))
+	if start+2+length > len(sb.data) {
+		return nil, fmt.Errorf("item at offset %#x with length %#x is out of bounds", start, length)
+	}
+	return sb.data[start+2 : start+2+length], nil
+}
+
+func (sb *Sandbox) readString(off uint16) (string, error) {
+	data, err := sb.readItem(off)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(string(data), "\x00"), nil
+}
+
 func getTag(ptr uint64) uint64 {
 	return ptr >> 48
 }
@@ -0,0 +1,248 @@
+package kernelcache
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+// SandboxOperationDiff is the change in an operation's rules
+type SandboxOperationDiff struct {
+	Operation    string   `json:"operation"`
+	RulesAdded   []string `json:"rules_added,omitempty"`
+	RulesRemoved []string `json:"rules_removed,omitempty"`
+	// Undecodable is why the operation's rules couldn't be compared (they failed to decompile in either kernelcache)
+	Undecodable string `json:"undecodable,omitempty"`
+}
+
+// SandboxProfileDiff is the diff of a profile that exists in both kernelcaches
+type SandboxProfileDiff struct {
+	Name       string                 `json:"name"`
+	Operations []SandboxOperationDiff `json:"operations"`
+}
+
+// SandboxDiff is the diff of the sandbox profiles of two kernelcaches
+type SandboxDiff struct {
+	OperationsAdded   []string             `json:"operations_added,omitempty"`
+	OperationsRemoved []string             `json:"operations_removed,omitempty"`
+	ProfilesAdded     []string             `json:"profiles_added,omitempty"`
+	ProfilesRemoved   []string             `json:"profiles_removed,omitempty"`
+	Profiles          []SandboxProfileDiff `json:"profiles,omitempty"`
+}
+
+// GetSandboxes parses the platform profile and the profile collection of a kernelcache
+func GetSandboxes(m *macho.File, r *bytes.Reader) ([]*Sandbox, error) {
+	var sbs []*Sandbox
+
+	opsList, err := GetSandboxOpts(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sandbox operations: %v", err)
+	}
+
+	if data, err := GetSandboxProfiles(m, r); err != nil {
+		log.Warnf("failed to find platform profile: %v", err)
+	} else if platform, err := ParseSandboxProfile(data, opsList); err != nil {
+		log.Warnf("failed to parse platform profile: %v", err)
+	} else {
+		sbs = append(sbs, platform)
+	}
+
+	data, err := GetSandboxCollections(m, r)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := ParseSandboxCollection(data, opsList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile collection: %v", err)
+	}
+
+	return append(sbs, collection), nil
+}
+
+// ruleSet flattens a profile's rules into a set of "action filter" entries per operation
+// and returns why the operations that failed to decompile (or were truncated) can't be compared
+func (sb *Sandbox) ruleSet(sp SandboxProfile) (map[string]map[string]bool, map[string]string, error) {
+	rules, err := sb.Rules(sp)
+	if err != nil {
+		return nil, nil, err
+	}
+	set := make(map[string]map[string]bool)
+	undecodable := make(map[string]string)
+	for _, r := range rules {
+		if len(r.Error) > 0 {
+			undecodable[r.Operation] = r.Error
+			continue
+		}
+		if r.Truncated {
+			undecodable[r.Operation] = errTooManyPaths.Error()
+		}
+		if set[r.Operation] == nil {
+			set[r.Operation] = make(map[string]bool)
+		}
+		if len(r.Filters) == 0 {
+			set[r.Operation][r.Action] = true
+		}
+		for _, f := range r.Filters {
+			set[r.Operation][r.Action+" "+f] = true
+		}
+	}
+	return set, undecodable, nil
+}
+
+type sbProfileRef struct {
+	sb *Sandbox
+	sp SandboxProfile
+}
+
+func sandboxProfiles(sbs []*Sandbox) (map[string]sbProfileRef, map[string]bool) {
+	profiles := make(map[string]sbProfileRef)
+	ops := make(map[string]bool)
+	for _, sb := range sbs {
+		for _, sp := range sb.Profiles {
+			profiles[sp.Name] = sbProfileRef{sb: sb, sp: sp}
+			for _, op := range sp.Operations {
+				ops[op.Name] = true
+			}
+		}
+	}
+	return profiles, ops
+}
+
+// DiffSandboxes compares the decompiled sandbox profiles of two kernelcaches
+func DiffSandboxes(old, new []*Sandbox) (*SandboxDiff, error) {
+	diff := &SandboxDiff{}
+
+	oldProfiles, oldOps := sandboxProfiles(old)
+	newProfiles, newOps := sandboxProfiles(new)
+
+	diff.OperationsAdded, diff.OperationsRemoved = utils.DiffSets(oldOps, newOps)
+
+	var common []string
+	for name := range newProfiles {
+		if _, ok := oldProfiles[name]; ok {
+			common = append(common, name)
+		} else {
+			diff.ProfilesAdded = append(diff.ProfilesAdded, name)
+		}
+	}
+	for name := range oldProfiles {
+		if _, ok := newProfiles[name]; !ok {
+			diff.ProfilesRemoved = append(diff.ProfilesRemoved, name)
+		}
+	}
+	sort.Strings(diff.ProfilesAdded)
+	sort.Strings(diff.ProfilesRemoved)
+	sort.Strings(common)
+
+	for _, name := range common {
+		o, n := oldProfiles[name], newProfiles[name]
+		oldRules, oldUndecodable, err := o.sb.ruleSet(o.sp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompile old %s profile: %v", name, err)
+		}
+		newRules, newUndecodable, err := n.sb.ruleSet(n.sp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompile new %s profile: %v", name, err)
+		}
+
+		ops := make(map[string]bool)
+		for _, m := range []map[string]map[string]bool{oldRules, newRules} {
+			for op := range m {
+				ops[op] = true
+			}
+		}
+		for _, m := range []map[string]string{oldUndecodable, newUndecodable} {
+			for op := range m {
+				ops[op] = true
+			}
+		}
+		var opNames []string
+		for op := range ops {
+			opNames = append(opNames, op)
+		}
+		sort.Strings(opNames)
+
+		pdiff := SandboxProfileDiff{Name: name}
+		for _, op := range opNames {
+			// an operation that only one side can decompile would show up as all its rules added/removed
+			var reasons []string
+			if reason, ok := oldUndecodable[op]; ok {
+				reasons = append(reasons, "old: "+reason)
+			}
+			if reason, ok := newUndecodable[op]; ok {
+				reasons = append(reasons, "new: "+reason)
+			}
+			if len(reasons) > 0 {
+				pdiff.Operations = append(pdiff.Operations, SandboxOperationDiff{
+					Operation:   op,
+					Undecodable: strings.Join(reasons, "; "),
+				})
+				continue
+			}
+			added, removed := utils.DiffSets(oldRules[op], newRules[op])
+			if len(added) > 0 || len(removed) > 0 {
+				pdiff.Operations = append(pdiff.Operations, SandboxOperationDiff{
+					Operation:    op,
+					RulesAdded:   added,
+					RulesRemoved: removed,
+				})
+			}
+		}
+		if len(pdiff.Operations) > 0 {
+			diff.Profiles = append(diff.Profiles, pdiff)
+		}
+	}
+
+	return diff, nil
+}
+
+// String returns the diff as a human readable report
+func (d *SandboxDiff) String() string {
+	var sb strings.Builder
+
+	section := func(title, prefix string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		sb.WriteString(title + "\n")
+		sb.WriteString(strings.Repeat("=", len(title)) + "\n")
+		for _, item := range items {
+			sb.WriteString(fmt.Sprintf("%s %s\n", prefix, item))
+		}
+		sb.WriteString("\n")
+	}
+	section("Operations Added", "+", d.OperationsAdded)
+	section("Operations Removed", "-", d.OperationsRemoved)
+	section("Profiles Added", "+", d.ProfilesAdded)
+	section("Profiles Removed", "-", d.ProfilesRemoved)
+
+	for _, p := range d.Profiles {
+		sb.WriteString(p.Name + "\n")
+		sb.WriteString(strings.Repeat("-", len(p.Name)) + "\n")
+		for _, op := range p.Operations {
+			if len(op.Undecodable) > 0 {
+				sb.WriteString(fmt.Sprintf("  %s: undecodable (%s)\n", op.Operation, op.Undecodable))
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("  %s:\n", op.Operation))
+			for _, r := range op.RulesAdded {
+				sb.WriteString(fmt.Sprintf("    + %s\n", r))
+			}
+			for _, r := range op.RulesRemoved {
+				sb.WriteString(fmt.Sprintf("    - %s\n", r))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	if sb.Len() == 0 {
+		return "No sandbox profile changes\n"
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,294 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AppleMatch (version 3) NFA opcodes
+const (
+	reOpChar      = 0x02 // match the following byte
+	reOpDot       = 0x09 // match any character
+	reOpFork      = 0x0a // split execution to the next instruction and the following uint16 target
+	reOpEnd       = 0x15 // accept
+	reOpLineStart = 0x19 // ^
+	reOpLineEnd   = 0x29 // $
+	reOpJump      = 0x2f // jump to the following uint16 target
+	reOpClassMask = 0x0f
+	reOpClass     = 0x0b // character class, high nibble is the number of ranges that follow
+)
+
+const appleMatchVersion = 3
+
+// reKind is used to decide when a sub-expression needs parenthesizing
+type reKind int
+
+const (
+	reEmpty reKind = iota
+	reAtom
+	reConcat
+	reAlt
+)
+
+type reExpr struct {
+	s    string
+	kind reKind
+	tail string // the last atom of a concatenation (s ends with it)
+}
+
+func (e reExpr) group() string {
+	if e.kind == reConcat || e.kind == reAlt {
+		return "(" + e.s + ")"
+	}
+	return e.s
+}
+
+func reCat(a, b reExpr) reExpr {
+	if a.kind == reEmpty {
+		return b
+	}
+	if b.kind == reEmpty {
+		return a
+	}
+	// xx* and x*x are x+ (as is yxx* when x is the last atom of a concatenation)
+	if b.kind == reAtom && b.s == a.group()+"*" {
+		return reExpr{s: a.group() + "+", kind: reAtom}
+	}
+	if b.kind == reAtom && a.kind == reConcat && b.s == a.tail+"*" {
+		return reExpr{s: a.s + "+", kind: reConcat, tail: a.tail + "+"}
+	}
+	if a.kind == reAtom && a.s == b.group()+"*" {
+		return reExpr{s: b.group() + "+", kind: reAtom}
+	}
+	as, bs := a.s, b.s
+	if a.kind == reAlt {
+		as = a.group()
+	}
+	if b.kind == reAlt {
+		bs = b.group()
+	}
+	tail := bs
+	if b.kind == reConcat {
+		tail = b.tail
+	}
+	return reExpr{s: as + bs, kind: reConcat, tail: tail}
+}
+
+func reOr(a, b reExpr) reExpr {
+	if a.s == b.s && a.kind == b.kind {
+		return a
+	}
+	if a.kind == reEmpty {
+		return reOpt(b)
+	}
+	if b.kind == reEmpty {
+		return reOpt(a)
+	}
+	return reExpr{s: a.s + "|" + b.s, kind: reAlt}
+}
+
+func reOpt(e reExpr) reExpr {
+	if e.kind == reEmpty || strings.HasSuffix(e.s, "*") && e.kind == reAtom {
+		return e
+	}
+	return reExpr{s: e.group() + "?", kind: reAtom}
+}
+
+func reStar(e reExpr) reExpr {
+	if e.kind == reEmpty {
+		return e
+	}
+	s := e.group()
+	// (x)?* and (x)+* are just (x)*
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "?"), "+")
+	return reExpr{s: s + "*", kind: reAtom}
+}
+
+func reLiteral(c byte) string {
+	switch {
+	case strings.IndexByte(`\.+*?()|[]{}^$`, c) >= 0:
+		return `\` + string(c)
+	case c < 0x20 || c >= 0x7f:
+		return fmt.Sprintf(`\x%02x`, c)
+	}
+	return string(c)
+}
+
+func reClassLiteral(c byte) string {
+	switch {
+	case strings.IndexByte(`\]^-`, c) >= 0:
+		return `\` + string(c)
+	case c < 0x20 || c >= 0x7f:
+		return fmt.Sprintf(`\x%02x`, c)
+	}
+	return string(c)
+}
+
+// ParseAppleMatchRegex decompiles an AppleMatch regex NFA back into a regular expression
+func ParseAppleMatchRegex(data []byte) (string, error) {
+	if len(data) < 6 {
+		return "", fmt.Errorf("regex data too small (%d bytes)", len(data))
+	}
+	if version := binary.BigEndian.Uint32(data[:4]); version != appleMatchVersion {
+		return "", fmt.Errorf("unsupported AppleMatch regex version %d", version)
+	}
+	code := data[6:]
+	if length := int(binary.LittleEndian.Uint16(data[4:6])); length < len(code) {
+		code = code[:length]
+	}
+
+	// build the NFA, states are instruction offsets and -1/-2 are the start/accept states
+	const start, accept = -1, -2
+	edges := make(map[int]map[int]reExpr)
+	addEdge := func(from, to int, e reExpr) {
+		if edges[from] == nil {
+			edges[from] = make(map[int]reExpr)
+		}
+		if prev, ok := edges[from][to]; ok {
+			e = reOr(prev, e)
+		}
+		edges[from][to] = e
+	}
+	readTarget := func(pc int) (int, error) {
+		if pc+3 > len(code) {
+			return 0, fmt.Errorf("truncated instruction at %#x", pc)
+		}
+		return int(binary.LittleEndian.Uint16(code[pc+1:])), nil
+	}
+
+	states := []int{0}
+	addEdge(start, 0, reExpr{})
+	for pc := 0; pc < len(code); {
+		op := code[pc]
+		if pc != 0 {
+			states = append(states, pc)
+		}
+		switch {
+		case op == reOpChar:
+			if pc+2 > len(code) {
+				return "", fmt.Errorf("truncated instruction at %#x", pc)
+			}
+			addEdge(pc, pc+2, reExpr{s: reLiteral(code[pc+1]), kind: reAtom})
+			pc += 2
+		case op == reOpDot:
+			addEdge(pc, pc+1, reExpr{s: ".", kind: reAtom})
+			pc++
+		case op == reOpLineStart:
+			addEdge(pc, pc+1, reExpr{s: "^", kind: reAtom})
+			pc++
+		case op == reOpLineEnd:
+			addEdge(pc, pc+1, reExpr{s: "$", kind: reAtom})
+			pc++
+		case op == reOpEnd:
+			addEdge(pc, accept, reExpr{})
+			pc++
+		case op == reOpJump:
+			target, err := readTarget(pc)
+			if err != nil {
+				return "", err
+			}
+			addEdge(pc, target, reExpr{})
+			pc += 3
+		case op == reOpFork:
+			target, err := readTarget(pc)
+			if err != nil {
+				return "", err
+			}
+			addEdge(pc, pc+3, reExpr{})
+			addEdge(pc, target, reExpr{})
+			pc += 3
+		case op&reOpClassMask == reOpClass:
+			count := int(op >> 4)
+			if pc+1+2*count > len(code) {
+				return "", fmt.Errorf("truncated character class at %#x", pc)
+			}
+			var class strings.Builder
+			class.WriteString("[")
+			for i := 0; i < count; i++ {
+				lo, hi := code[pc+1+2*i], code[pc+2+2*i]
+				// a reversed first range marks a negated class
+				if i == 0 && lo > hi {
+					class.WriteString("^")
+					lo, hi = hi, lo
+				}
+				class.WriteString(reClassLiteral(lo))
+				if hi != lo {
+					class.WriteString("-" + reClassLiteral(hi))
+				}
+			}
+			class.WriteString("]")
+			addEdge(pc, pc+1+2*count, reExpr{s: class.String(), kind: reAtom})
+			pc += 1 + 2*count
+		default:
+			return "", fmt.Errorf("unknown AppleMatch opcode %#x at %#x", op, pc)
+		}
+	}
+
+	// state elimination, collapsing simple chains first so loops are found before the forks
+	// around them are expanded (ties are broken by instruction order)
+	remaining := make(map[int]bool)
+	for _, s := range states {
+		remaining[s] = true
+	}
+	for len(remaining) > 0 {
+		s, best := 0, -1
+		for _, cand := range states {
+			if !remaining[cand] {
+				continue
+			}
+			in := 0
+			for _, outs := range edges {
+				if _, ok := outs[cand]; ok {
+					in++
+				}
+			}
+			if cost := in * len(edges[cand]); best < 0 || cost < best {
+				s, best = cand, cost
+			}
+		}
+		delete(remaining, s)
+
+		loop := reExpr{}
+		if l, ok := edges[s][s]; ok {
+			loop = reStar(l)
+			delete(edges[s], s)
+		}
+		for _, from := range sortedStates(edges) {
+			in, ok := edges[from][s]
+			if !ok || from == s {
+				continue
+			}
+			delete(edges[from], s)
+			for _, to := range sortedTargets(edges[s]) {
+				addEdge(from, to, reCat(reCat(in, loop), edges[s][to]))
+			}
+		}
+		delete(edges, s)
+	}
+
+	re, ok := edges[start][accept]
+	if !ok {
+		return "", fmt.Errorf("regex has no accepting path")
+	}
+	return re.s, nil
+}
+
+func sortedStates(m map[int]map[int]reExpr) []int {
+	var keys []int
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func sortedTargets(m map[int]reExpr) []int {
+	var keys []int
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,408 @@
+package kernelcache
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+const (
+	sbNodeFilter   = 0
+	sbNodeTerminal = 1
+
+	sbTerminalDeny = 1 << 0 // terminal node action flag (allow if unset)
+
+	sbFilterRegex = 0x80 // filter argument is an index into the regex table
+
+	maxSandboxPaths = 4096 // give up enumerating an operation's filter graph after this many paths
+)
+
+type sbArgType int
+
+const (
+	sbArgString sbArgType = iota
+	sbArgInteger
+	sbArgBoolean
+	sbArgVnodeType
+)
+
+type sbFilterInfo struct {
+	Name string
+	Arg  sbArgType
+}
+
+// sbFilters are the known filter IDs
+//
+// NOTE: these change between sandbox kext versions, unknown IDs are rendered as (filter-<id> <arg>)
+var sbFilters = map[uint8]sbFilterInfo{
+	0x01: {"literal", sbArgString},
+	0x02: {"mount-relative-path", sbArgString},
+	0x03: {"xattr", sbArgString},
+	0x04: {"file-mode", sbArgInteger},
+	0x05: {"ipc-posix-name", sbArgString},
+	0x06: {"global-name", sbArgString},
+	0x07: {"local-name", sbArgString},
+	0x08: {"local", sbArgString},
+	0x09: {"remote", sbArgString},
+	0x0a: {"control-name", sbArgString},
+	0x0b: {"socket-domain", sbArgInteger},
+	0x0c: {"socket-type", sbArgInteger},
+	0x0d: {"socket-protocol", sbArgInteger},
+	0x0e: {"target", sbArgInteger},
+	0x0f: {"fsctl-command", sbArgInteger},
+	0x10: {"ioctl-command", sbArgInteger},
+	0x11: {"iokit-user-client-class", sbArgString},
+	0x12: {"iokit-property", sbArgString},
+	0x13: {"iokit-connection", sbArgString},
+	0x14: {"device-major", sbArgInteger},
+	0x15: {"device-minor", sbArgInteger},
+	0x16: {"device-conforms-to", sbArgString},
+	0x17: {"extension", sbArgString},
+	0x18: {"extension-class", sbArgString},
+	0x19: {"appleevent-destination", sbArgString},
+	0x1a: {"debug-mode", sbArgBoolean},
+	0x1b: {"right-name", sbArgString},
+	0x1c: {"preference-domain", sbArgString},
+	0x1d: {"vnode-type", sbArgVnodeType},
+	0x1e: {"require-entitlement", sbArgString},
+	0x1f: {"entitlement-value", sbArgString},
+	0x20: {"kext-bundle-id", sbArgString},
+	0x21: {"info-type", sbArgString},
+	0x22: {"notification-name", sbArgString},
+	0x23: {"notification-payload", sbArgString},
+	0x24: {"semaphore-owner", sbArgInteger},
+	0x25: {"sysctl-name", sbArgString},
+	0x26: {"process-name", sbArgString},
+	0x27: {"rootless-boot-device-filter", sbArgBoolean},
+	0x28: {"rootless-file-filter", sbArgBoolean},
+	0x29: {"rootless-disk-filter", sbArgBoolean},
+	0x2a: {"rootless-proc-filter", sbArgBoolean},
+	0x2b: {"privilege-id", sbArgInteger},
+	0x2c: {"process-attribute", sbArgInteger},
+	0x2d: {"uid", sbArgInteger},
+	0x2e: {"nvram-variable", sbArgString},
+	0x2f: {"csr", sbArgInteger},
+	0x30: {"host-special-port", sbArgInteger},
+	0x31: {"filesystem-name", sbArgString},
+	0x32: {"boot-arg", sbArgString},
+	0x33: {"xpc-service-name", sbArgString},
+	0x34: {"signing-identifier", sbArgString},
+	0x35: {"signal-number", sbArgInteger},
+	0x36: {"target-signing-identifier", sbArgString},
+	0x37: {"reference", sbArgString},
+	0x38: {"certificate-type", sbArgString},
+	0x39: {"iokit-registry-entry-class", sbArgString},
+}
+
+var sbVnodeTypes = map[uint16]string{
+	1: "REGULAR-FILE",
+	2: "DIRECTORY",
+	3: "BLOCK-DEVICE",
+	4: "CHARACTER-DEVICE",
+	5: "SYMLINK",
+	6: "SOCKET",
+	7: "FIFO",
+}
+
+// SandboxNode is a decoded op node
+type SandboxNode struct {
+	Terminal bool
+	// terminal nodes
+	Deny  bool
+	Flags uint16
+	// filter nodes
+	Filter   uint8
+	Argument uint16
+	Match    uint16
+	Unmatch  uint16
+}
+
+// DecodeSandboxNode decodes a raw 8 byte op node
+func DecodeSandboxNode(raw uint64) (SandboxNode, error) {
+	switch uint8(raw) {
+	case sbNodeTerminal:
+		flags := uint16(raw >> 16)
+		return SandboxNode{
+			Terminal: true,
+			Deny:     flags&sbTerminalDeny != 0,
+			Flags:    flags &^ sbTerminalDeny,
+		}, nil
+	case sbNodeFilter:
+		return SandboxNode{
+			Filter:   uint8(raw >> 8),
+			Argument: uint16(raw >> 16),
+			Match:    uint16(raw >> 32),
+			Unmatch:  uint16(raw >> 48),
+		}, nil
+	}
+	return SandboxNode{}, fmt.Errorf("unknown op node type %#x (%#016x)", uint8(raw), raw)
+}
+
+// Action returns the SBPL action of a terminal node
+func (n SandboxNode) Action() string {
+	if n.Deny {
+		return "deny"
+	}
+	return "allow"
+}
+
+// SandboxRule is a decompiled SBPL rule, the filters are OR'd together and an empty list means
+// the rule is unconditional
+type SandboxRule struct {
+	Action    string   `json:"action,omitempty"`
+	Operation string   `json:"operation"`
+	Filters   []string `json:"filters,omitempty"`
+	// Truncated is set when the operation's filter graph has too many paths to enumerate
+	// (the filters are only the ones found before giving up)
+	Truncated bool `json:"truncated,omitempty"`
+	// Error is set when the operation's filter graph can't be decompiled (the rule has no action)
+	Error string `json:"error,omitempty"`
+}
+
+func (r SandboxRule) String() string {
+	if len(r.Error) > 0 {
+		return fmt.Sprintf(";; (%s) failed to decompile: %s", r.Operation, r.Error)
+	}
+	var rule string
+	switch len(r.Filters) {
+	case 0:
+		rule = fmt.Sprintf("(%s %s)", r.Action, r.Operation)
+	case 1:
+		rule = fmt.Sprintf("(%s %s %s)", r.Action, r.Operation, r.Filters[0])
+	default:
+		rule = fmt.Sprintf("(%s %s\n    %s)", r.Action, r.Operation, strings.Join(r.Filters, "\n    "))
+	}
+	if r.Truncated {
+		rule += fmt.Sprintf(" ;; TRUNCATED (more than %d paths)", maxSandboxPaths)
+	}
+	return rule
+}
+
+// Regex returns the decompiled regex at the regex table index
+func (sb *Sandbox) Regex(idx uint16) (string, error) {
+	if int(idx) >= len(sb.regexOffsets) {
+		return "", fmt.Errorf("regex index %d out of range (%d regexes)", idx, len(sb.regexOffsets))
+	}
+	return ParseAppleMatchRegex(sb.Regexes[sb.regexOffsets[idx]])
+}
+
+func (sb *Sandbox) filterString(n SandboxNode) string {
+	info, ok := sbFilters[n.Filter&^sbFilterRegex]
+	if !ok {
+		info = sbFilterInfo{Name: fmt.Sprintf("filter-%#x", n.Filter&^sbFilterRegex)}
+	}
+
+	var arg string
+	if n.Filter&sbFilterRegex != 0 {
+		re, err := sb.Regex(n.Argument)
+		if err != nil {
+			log.Debugf("failed to decompile regex %d: %v", n.Argument, err)
+			arg = fmt.Sprintf("(regex-index %d)", n.Argument)
+		} else {
+			arg = fmt.Sprintf("(regex #\"%s\")", re)
+		}
+		// path regexes are written without the literal filter
+		if n.Filter&^sbFilterRegex == 0x01 {
+			return arg
+		}
+		return fmt.Sprintf("(%s %s)", info.Name, arg)
+	}
+
+	switch info.Arg {
+	case sbArgString:
+		str, err := sb.readString(n.Argument)
+		if err != nil {
+			log.Debugf("failed to read %s filter argument %#x: %v", info.Name, n.Argument, err)
+			arg = fmt.Sprintf("%#x", n.Argument)
+		} else {
+			arg = strconv.Quote(str)
+		}
+	case sbArgBoolean:
+		arg = "#f"
+		if n.Argument != 0 {
+			arg = "#t"
+		}
+	case sbArgVnodeType:
+		if vt, ok := sbVnodeTypes[n.Argument]; ok {
+			arg = vt
+		} else {
+			arg = strconv.Itoa(int(n.Argument))
+		}
+	default:
+		arg = strconv.Itoa(int(n.Argument))
+	}
+
+	return fmt.Sprintf("(%s %s)", info.Name, arg)
+}
+
+type sbPath struct {
+	Filters []string
+	Result  SandboxNode
+}
+
+var errTooManyPaths = fmt.Errorf("too many paths (>%d)", maxSandboxPaths)
+
+// paths enumerates every route from an op node to a terminal node (the first maxSandboxPaths
+// are kept in out when it returns errTooManyPaths)
+func (sb *Sandbox) paths(idx uint16, filters []string, depth int, out *[]sbPath) error {
+	if len(*out) >= maxSandboxPaths {
+		return errTooManyPaths
+	}
+	if depth > int(sb.Header.OpNodeSize) {
+		return fmt.Errorf("op node graph loop at node %d", idx)
+	}
+	raw, ok := sb.OpNodes[idx]
+	if !ok {
+		return fmt.Errorf("op node %d out of range (%d nodes)", idx, len(sb.OpNodes))
+	}
+	n, err := DecodeSandboxNode(raw)
+	if err != nil {
+		return err
+	}
+	if n.Terminal {
+		*out = append(*out, sbPath{Filters: append([]string{}, filters...), Result: n})
+		return nil
+	}
+	f := sb.filterString(n)
+	if err := sb.paths(n.Match, append(filters, f), depth+1, out); err != nil {
+		return err
+	}
+	return sb.paths(n.Unmatch, append(filters, "(require-not "+f+")"), depth+1, out)
+}
+
+// Rules decompiles a profile's op node graphs into SBPL rules
+//
+// Operations that share the default operation's node are omitted and only the paths through an
+// operation's filters that reach a different decision than the default are kept. The filters of
+// each rule (and of each require-all) are sorted, so the output does not depend on node order.
+// An operation with too many paths gets Truncated rules and one that can't be decompiled gets a
+// rule with its Error (so no operation is silently left out).
+func (sb *Sandbox) Rules(sp SandboxProfile) ([]SandboxRule, error) {
+	var rules []SandboxRule
+
+	if len(sp.Operations) == 0 {
+		return nil, nil
+	}
+
+	def := sp.Operations[0]
+	var defPaths []sbPath
+	err := sb.paths(def.Index, nil, 0, &defPaths)
+	if err != nil && err != errTooManyPaths {
+		return nil, fmt.Errorf("failed to decompile %s: %v", def.Name, err)
+	}
+	defAction := "deny"
+	if len(defPaths) == 1 && len(defPaths[0].Filters) == 0 {
+		defAction = defPaths[0].Result.Action()
+		rules = append(rules, SandboxRule{Action: defAction, Operation: def.Name})
+	} else {
+		rules = append(rules, opRules(def.Name, defPaths, "", err)...)
+	}
+
+	for _, op := range sp.Operations[1:] {
+		if op.Index == def.Index {
+			continue
+		}
+		var paths []sbPath
+		err := sb.paths(op.Index, nil, 0, &paths)
+		if err != nil && err != errTooManyPaths {
+			log.Debugf("failed to decompile %s in %s: %v", op.Name, sp.Name, err)
+			rules = append(rules, SandboxRule{Operation: op.Name, Error: err.Error()})
+			continue
+		}
+		rules = append(rules, opRules(op.Name, paths, defAction, err)...)
+	}
+
+	return rules, nil
+}
+
+// opRules returns an operation's rules, marking them as truncated if enumerating its paths stopped early
+func opRules(operation string, paths []sbPath, skip string, err error) []SandboxRule {
+	rules := pathsToRules(operation, paths, skip)
+	if err != errTooManyPaths {
+		return rules
+	}
+	if len(rules) == 0 { // none of the paths found differ from the default
+		return []SandboxRule{{Operation: operation, Truncated: true, Error: err.Error()}}
+	}
+	for i := range rules {
+		rules[i].Truncated = true
+	}
+	return rules
+}
+
+// pathsToRules groups the paths that don't end in the skip action into one rule per action
+func pathsToRules(operation string, paths []sbPath, skip string) []SandboxRule {
+	var rules []SandboxRule
+	for _, action := range []string{"allow", "deny"} {
+		if action == skip {
+			continue
+		}
+		rule := SandboxRule{Action: action, Operation: operation}
+		seen := make(map[string]bool)
+		unconditional := false
+		for _, p := range paths {
+			if p.Result.Action() != action {
+				continue
+			}
+			if len(p.Filters) == 0 {
+				unconditional = true
+				break
+			}
+			f := p.Filters[0]
+			if len(p.Filters) > 1 {
+				conj := append([]string{}, p.Filters...)
+				sort.Strings(conj)
+				f = "(require-all " + strings.Join(conj, " ") + ")"
+			}
+			if !seen[f] {
+				seen[f] = true
+				rule.Filters = append(rule.Filters, f)
+			}
+		}
+		if unconditional {
+			rule.Filters = nil
+		} else if len(rule.Filters) == 0 {
+			continue
+		}
+		sort.Strings(rule.Filters)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// SBPL returns the profile as SBPL source
+func (sb *Sandbox) SBPL(sp SandboxProfile) (string, error) {
+	rules, err := sb.Rules(sp)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	out.WriteString("(version 1)\n")
+	out.WriteString(fmt.Sprintf(";; profile: %s (version %d)\n", sp.Name, sp.Version))
+	if len(sb.Globals) > 0 {
+		var offs []int
+		for off := range sb.Globals {
+			offs = append(offs, int(off))
+		}
+		sort.Ints(offs)
+		out.WriteString(";; globals:\n")
+		for _, off := range offs {
+			out.WriteString(fmt.Sprintf(";;   %s\n", sb.Globals[uint16(off)]))
+		}
+	}
+	if len(sb.Messages) > 0 {
+		out.WriteString(";; messages:\n")
+		for _, msg := range sb.Messages {
+			out.WriteString(fmt.Sprintf(";;   %s\n", msg))
+		}
+	}
+	for _, r := range rules {
+		out.WriteString(r.String() + "\n")
+	}
+
+	return out.String(), nil
+}
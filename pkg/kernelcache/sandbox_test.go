@@ -0,0 +1,294 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"regexp"
+	"testing"
+)
+
+// appleMatch encodes an AppleMatch (version 3) regex program
+func appleMatch(code ...byte) []byte {
+	data := make([]byte, 6, 6+len(code))
+	binary.BigEndian.PutUint32(data, appleMatchVersion)
+	binary.LittleEndian.PutUint16(data[4:], uint16(len(code)))
+	return append(data, code...)
+}
+
+func TestParseAppleMatchRegex(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		want  string
+		match []string
+		miss  []string
+	}{
+		{
+			name:  "literal",
+			data:  appleMatch(reOpChar, 'a', reOpChar, 'b', reOpChar, 'c', reOpEnd),
+			want:  "abc",
+			match: []string{"abc"},
+		},
+		{
+			name:  "anchored",
+			data:  appleMatch(reOpLineStart, reOpChar, '/', reOpChar, 't', reOpChar, 'm', reOpChar, 'p', reOpChar, '/', reOpEnd),
+			want:  "^/tmp/",
+			match: []string{"/tmp/x"},
+			miss:  []string{"/private/tmp/x"},
+		},
+		{
+			name:  "escaped",
+			data:  appleMatch(reOpChar, '.', reOpChar, 'a', reOpLineEnd, reOpEnd),
+			want:  `\.a$`,
+			match: []string{"x.a"},
+			miss:  []string{"xxa", ".ab"},
+		},
+		{
+			// 0: a; 2: fork 5/9; 5: .; 6: jmp 2; 9: b
+			name:  "star",
+			data:  appleMatch(reOpChar, 'a', reOpFork, 9, 0, reOpDot, reOpJump, 2, 0, reOpChar, 'b', reOpEnd),
+			want:  "a.*b",
+			match: []string{"ab", "axyzb"},
+		},
+		{
+			// 0: a; 2: fork 5/0
+			name:  "plus",
+			data:  appleMatch(reOpChar, 'a', reOpFork, 0, 0, reOpEnd),
+			want:  "a+",
+			match: []string{"aaa"},
+		},
+		{
+			// 0: ^; 1: /; 3: v; 5: .; 6: fork 9/5; 9: $
+			name:  "plus after a prefix",
+			data:  appleMatch(reOpLineStart, reOpChar, '/', reOpChar, 'v', reOpDot, reOpFork, 5, 0, reOpLineEnd, reOpEnd),
+			want:  "^/v.+$",
+			match: []string{"/var"},
+			miss:  []string{"/v"},
+		},
+		{
+			// 0: fork 3/12; 3: foo; 9: jmp 18; 12: bar
+			name:  "alternation",
+			data:  appleMatch(reOpFork, 12, 0, reOpChar, 'f', reOpChar, 'o', reOpChar, 'o', reOpJump, 18, 0, reOpChar, 'b', reOpChar, 'a', reOpChar, 'r', reOpEnd),
+			want:  "foo|bar",
+			match: []string{"foo", "bar"},
+			miss:  []string{"baz"},
+		},
+		{
+			// 0: a; 2: fork 5/7; 5: b; 7: c
+			name:  "optional",
+			data:  appleMatch(reOpChar, 'a', reOpFork, 7, 0, reOpChar, 'b', reOpChar, 'c', reOpEnd),
+			want:  "ab?c",
+			match: []string{"ac", "abc"},
+		},
+		{
+			name:  "class",
+			data:  appleMatch(2<<4|reOpClass, 'a', 'z', '0', '9', reOpEnd),
+			want:  "[a-z0-9]",
+			match: []string{"q", "7"},
+			miss:  []string{"Q"},
+		},
+		{
+			name:  "negated class",
+			data:  appleMatch(1<<4|reOpClass, 'z', 'a', reOpEnd),
+			want:  "[^a-z]",
+			match: []string{"Q"},
+			miss:  []string{"q"},
+		},
+		{
+			name: "class escapes",
+			data: appleMatch(2<<4|reOpClass, '-', '-', ']', ']', reOpEnd),
+			want: `[\-\]]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAppleMatchRegex(tt.data)
+			if err != nil {
+				t.Fatalf("ParseAppleMatchRegex() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseAppleMatchRegex() = %q, want %q", got, tt.want)
+			}
+			re, err := regexp.Compile(got)
+			if err != nil {
+				t.Fatalf("decompiled regex doesn't compile: %v", err)
+			}
+			for _, s := range tt.match {
+				if !re.MatchString(s) {
+					t.Errorf("%s doesn't match %q", got, s)
+				}
+			}
+			for _, s := range tt.miss {
+				if re.MatchString(s) {
+					t.Errorf("%s matches %q", got, s)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAppleMatchRegexErrors(t *testing.T) {
+	version2 := appleMatch(reOpChar, 'a', reOpEnd)
+	binary.BigEndian.PutUint32(version2, 2)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too small", []byte{0, 0, 0, 3}},
+		{"unsupported version", version2},
+		{"unknown opcode", appleMatch(0x01, reOpEnd)},
+		{"truncated char", appleMatch(reOpChar)},
+		{"truncated jump", appleMatch(reOpJump, 0)},
+		{"truncated class", appleMatch(2<<4|reOpClass, 'a', 'z')},
+		{"no accept", appleMatch(reOpChar, 'a')},
+	}
+	for _, tt := range tests {
+		if re, err := ParseAppleMatchRegex(tt.data); err == nil {
+			t.Errorf("ParseAppleMatchRegex(%s) = %q, want an error", tt.name, re)
+		}
+	}
+}
+
+// sandboxItemSlot is the size of each string/regex/message item in a test profile, so the
+// string items are filter arguments 0, 4, 8...
+const sandboxItemSlot = 32
+
+// sandboxProfile builds platform profile data with the op nodes, one regex, one message and
+// the strings the op nodes' filters refer to
+func sandboxProfile(ops []uint16, nodes []uint64, regex []byte, message string, strs ...string) []byte {
+	const header = 12
+	var area []byte
+	addItem := func(data []byte) uint16 {
+		off := uint16(len(area) / 8)
+		item := make([]byte, sandboxItemSlot)
+		binary.LittleEndian.PutUint16(item, uint16(len(data)))
+		copy(item[2:], data)
+		area = append(area, item...)
+		return off
+	}
+	for _, s := range strs {
+		addItem(append([]byte(s), 0))
+	}
+	regexOff := addItem(regex)
+	msgOff := addItem(append([]byte(message), 0))
+
+	data := make([]byte, header)
+	binary.LittleEndian.PutUint16(data[0:], 0)                  // version
+	binary.LittleEndian.PutUint16(data[2:], uint16(len(nodes))) // op node count
+	data[4] = uint8(len(ops))
+	data[5] = 0                                 // globals
+	binary.LittleEndian.PutUint16(data[6:], 1)  // profiles
+	binary.LittleEndian.PutUint16(data[8:], 1)  // regexes
+	binary.LittleEndian.PutUint16(data[10:], 1) // messages
+	data = appendUint16s(data, regexOff, msgOff)
+	data = appendUint16s(data, ops...)
+	// the op nodes are 8 byte aligned
+	data = append(data, make([]byte, (8-len(data)%8)%8)...)
+	for _, n := range nodes {
+		data = append(data, make([]byte, 8)...)
+		binary.LittleEndian.PutUint64(data[len(data)-8:], n)
+	}
+	return append(data, area...)
+}
+
+func appendUint16s(data []byte, vals ...uint16) []byte {
+	for _, v := range vals {
+		data = append(data, 0, 0)
+		binary.LittleEndian.PutUint16(data[len(data)-2:], v)
+	}
+	return data
+}
+
+func terminalNode(deny bool) uint64 {
+	if deny {
+		return sbNodeTerminal | sbTerminalDeny<<16
+	}
+	return sbNodeTerminal
+}
+
+func filterNode(filter uint8, arg, match, unmatch uint16) uint64 {
+	return sbNodeFilter | uint64(filter)<<8 | uint64(arg)<<16 | uint64(match)<<32 | uint64(unmatch)<<48
+}
+
+func TestSandboxSBPL(t *testing.T) {
+	const (
+		deny = iota
+		allow
+		readLiteral
+		readRegex
+		lookup
+		write
+	)
+	nodes := []uint64{
+		deny:        terminalNode(true),
+		allow:       terminalNode(false),
+		readLiteral: filterNode(0x01, 0, allow, readRegex),            // (literal "/etc/hosts")
+		readRegex:   filterNode(0x01|sbFilterRegex, 0, allow, deny),   // (regex #"^/tmp/")
+		lookup:      filterNode(0x06, sandboxItemSlot/8, allow, deny), // (global-name "com.apple.test")
+		write:       filterNode(0x1d, 2, deny, allow),                 // (vnode-type DIRECTORY)
+	}
+	// ^/tmp/
+	regex := appleMatch(reOpLineStart, reOpChar, '/', reOpChar, 't', reOpChar, 'm', reOpChar, 'p', reOpChar, '/', reOpEnd)
+	ops := []uint16{deny, readLiteral, deny, lookup, write, deny}
+	data := sandboxProfile(ops, nodes, regex, "denied by platform", "/etc/hosts", "com.apple.test")
+
+	sb, err := ParseSandboxProfile(data, []string{"default", "file-read*", "file-write-data", "mach-lookup", "file-write-create"})
+	if err != nil {
+		t.Fatalf("ParseSandboxProfile() error = %v", err)
+	}
+	if len(sb.Profiles) != 1 || len(sb.Profiles[0].Operations) != len(ops) {
+		t.Fatalf("profiles = %v", sb.Profiles)
+	}
+
+	got, err := sb.SBPL(sb.Profiles[0])
+	if err != nil {
+		t.Fatalf("SBPL() error = %v", err)
+	}
+	// operations on the default node are omitted and op-5 isn't in the operation names
+	want := `(version 1)
+;; profile: platform (version 0)
+;; messages:
+;;   denied by platform
+(deny default)
+(allow file-read*
+    (literal "/etc/hosts")
+    (require-all (regex #"^/tmp/") (require-not (literal "/etc/hosts"))))
+(allow mach-lookup (global-name "com.apple.test"))
+(allow file-write-create (require-not (vnode-type DIRECTORY)))
+`
+	if got != want {
+		t.Errorf("SBPL() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSandboxRulesErrors(t *testing.T) {
+	nodes := []uint64{
+		terminalNode(true),
+		filterNode(0x01, 0, 1, 0), // loops back to itself
+		0xff,                      // unknown node type
+		filterNode(0x01, 0, 0, 9), // unmatch is out of range
+	}
+	regex := appleMatch(reOpChar, 'a', reOpEnd)
+	data := sandboxProfile([]uint16{0, 1, 2, 3}, nodes, regex, "", "/a")
+
+	sb, err := ParseSandboxProfile(data, []string{"default", "loop", "bad-node", "out-of-range"})
+	if err != nil {
+		t.Fatalf("ParseSandboxProfile() error = %v", err)
+	}
+	rules, err := sb.Rules(sb.Profiles[0])
+	if err != nil {
+		t.Fatalf("Rules() error = %v", err)
+	}
+	if len(rules) != 4 || rules[0].String() != "(deny default)" {
+		t.Fatalf("Rules() = %v", rules)
+	}
+	// operations that can't be decompiled are kept as commented out rules
+	for _, r := range rules[1:] {
+		if len(r.Error) == 0 || len(r.Action) > 0 {
+			t.Errorf("%s rule = %+v, want an error", r.Operation, r)
+		}
+	}
+	if got, want := rules[2].String(), ";; (bad-node) failed to decompile: unknown op node type 0xff (0x00000000000000ff)"; got != want {
+		t.Errorf("bad-node rule = %q, want %q", got, want)
+	}
+}
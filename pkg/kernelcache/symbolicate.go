@@ -0,0 +1,394 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/go-plist"
+)
+
+const (
+	minSignatureInstrs = 4
+	maxSignatureInstrs = 256
+
+	indirectSymbolLocal = 0x80000000 // INDIRECT_SYMBOL_LOCAL
+	indirectSymbolAbs   = 0x40000000 // INDIRECT_SYMBOL_ABS
+)
+
+// SymbolSet is the list of kernel symbols exported by a pseudo-kext (i.e. com.apple.kpi.libkern)
+type SymbolSet struct {
+	ID                string            `plist:"CFBundleIdentifier,omitempty"`
+	CompatibleVersion string            `plist:"OSBundleCompatibleVersion,omitempty"`
+	Version           string            `plist:"CFBundleVersion,omitempty"`
+	Symbols           []SymbolSetSymbol `plist:"Symbols,omitempty"`
+}
+
+// SymbolSetSymbol is a symbol (or symbol prefix) exported by a SymbolSet
+type SymbolSetSymbol struct {
+	Name   string `plist:"SymbolName,omitempty"`
+	Prefix string `plist:"SymbolPrefix,omitempty"`
+}
+
+// ErrNoSymbolSets is returned by GetSymbolSets when the kernel has no __LINKINFO.__symbolsets
+var ErrNoSymbolSets = fmt.Errorf("kernelcache does NOT contain __LINKINFO.__symbolsets")
+
+// GetSymbolSets parses the kernel's __LINKINFO.__symbolsets plist
+func GetSymbolSets(m *macho.File) ([]SymbolSet, error) {
+	kernel, err := getKernelMachO(m)
+	if err != nil {
+		return nil, err
+	}
+
+	sec := kernel.Section("__LINKINFO", "__symbolsets")
+	if sec == nil {
+		return nil, ErrNoSymbolSets
+	}
+
+	data := make([]byte, sec.Size)
+	if _, err := m.ReadAt(data, int64(sec.Offset)); err != nil {
+		return nil, err
+	}
+
+	var sets struct {
+		SymbolSets []SymbolSet `plist:"SymbolsSets,omitempty"`
+	}
+	if err := plist.NewDecoder(bytes.NewReader(data)).Decode(&sets); err != nil {
+		return nil, fmt.Errorf("failed to parse __symbolsets bplist data: %v", err)
+	}
+
+	return sets.SymbolSets, nil
+}
+
+type addrRange struct {
+	start uint64
+	end   uint64
+	owner string
+}
+
+// Symbolicator maps the addresses of a kernelcache to symbol names and kexts
+type Symbolicator struct {
+	Symbols map[uint64]string
+	// Stats are the number of symbols found from each source
+	Stats map[string]int
+
+	addrs  []uint64
+	ranges []addrRange
+}
+
+// NewSymbolicator builds the kernelcache's symbol map from the kernel and kext symbol tables and
+// exports, adds the symbolset symbols the kexts import (at the addresses in their GOTs) and optionally
+// carries over the names from a matching (symbolicated) kernel from a Kernel Debug Kit by function
+// start and byte signature
+func NewSymbolicator(m *macho.File, kdk *macho.File) (*Symbolicator, error) {
+	kexts, err := GetKexts(m)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Symbolicator{
+		Symbols: getSymbolMap(m, kexts),
+		Stats:   make(map[string]int),
+	}
+	s.Stats["symtab"] = len(s.Symbols)
+
+	isFileset := m.FileTOC.FileHeader.Type == types.FileSet
+
+	// the kernel symbols imported by the kexts
+	imports := make(map[string]uint64)
+
+	for _, k := range kexts {
+		km, err := openKextMachO(m, k)
+		if err != nil {
+			log.Debugf("failed to parse %s: %v", k.ID, err)
+			continue
+		}
+		for _, seg := range km.Segments() {
+			if seg.Memsz == 0 || seg.Name == "__LINKEDIT" {
+				continue
+			}
+			if !isFileset && k.ID == KernelID && (strings.HasPrefix(seg.Name, "__PLK") || strings.HasPrefix(seg.Name, "__PRELINK")) {
+				continue // the kexts of a legacy kernelcache
+			}
+			s.ranges = append(s.ranges, addrRange{start: seg.Addr, end: seg.Addr + seg.Memsz, owner: k.ID})
+		}
+		if exports, err := km.DyldExports(); err == nil {
+			for _, exp := range exports {
+				if _, ok := s.Symbols[exp.Address]; !ok && exp.Address != 0 {
+					s.Symbols[exp.Address] = exp.Name
+					s.Stats["exports"]++
+				}
+			}
+		}
+		for name, addr := range getImportAddrs(m, km) {
+			imports[name] = addr
+		}
+		closeKextMachO(m, km)
+	}
+
+	if sets, err := GetSymbolSets(m); err == nil {
+		names := make(map[string]bool)
+		for _, name := range s.Symbols {
+			names[name] = true
+		}
+		for _, set := range sets {
+			for _, sym := range set.Symbols {
+				if len(sym.Name) == 0 {
+					continue
+				}
+				if names[sym.Name] {
+					s.Stats["symbolsets"]++
+					continue
+				}
+				addr, ok := imports[sym.Name]
+				if !ok {
+					s.Stats["symbolsets (missing)"]++
+					continue
+				}
+				if _, named := s.Symbols[addr]; !named {
+					s.Symbols[addr] = sym.Name
+				}
+				names[sym.Name] = true
+				s.Stats["symbolsets (imports)"]++
+			}
+		}
+	} else {
+		log.Debugf("failed to get symbolsets: %v", err)
+	}
+
+	if kdk != nil {
+		kernel, err := getKernelMachO(m)
+		if err != nil {
+			return nil, err
+		}
+		matched, err := matchKDKSymbols(m, kernel, kdk, s.Symbols)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match KDK symbols: %v", err)
+		}
+		s.Stats["kdk"] = matched
+	}
+
+	for addr := range s.Symbols {
+		s.addrs = append(s.addrs, addr)
+	}
+	sort.Slice(s.addrs, func(i, j int) bool { return s.addrs[i] < s.addrs[j] })
+	sort.Slice(s.ranges, func(i, j int) bool { return s.ranges[i].start < s.ranges[j].start })
+
+	return s, nil
+}
+
+// getImportAddrs returns the addresses of the symbols a kext imports from its (already bound) GOT entries
+func getImportAddrs(m, km *macho.File) map[string]uint64 {
+	imports := make(map[string]uint64)
+	if km.Symtab == nil || km.Dysymtab == nil {
+		return imports
+	}
+	for _, sec := range km.Sections {
+		if !sec.Flags.IsNonLazySymbolPointers() {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		for i := 0; i+8 <= len(data); i += 8 {
+			idx := int(sec.Reserved1) + i/8
+			if idx >= len(km.Dysymtab.IndirectSyms) {
+				break
+			}
+			symIdx := km.Dysymtab.IndirectSyms[idx]
+			if symIdx&(indirectSymbolLocal|indirectSymbolAbs) != 0 || int(symIdx) >= len(km.Symtab.Syms) {
+				continue
+			}
+			name := km.Symtab.Syms[symIdx].Name
+			if addr := resolvePtr(m, binary.LittleEndian.Uint64(data[i:])); addr != 0 && len(name) > 0 {
+				imports[name] = addr
+			}
+		}
+	}
+	return imports
+}
+
+// Owner returns the bundle ID of the kext (or kernel) containing addr
+func (s *Symbolicator) Owner(addr uint64) string {
+	var owner string
+	for _, r := range s.ranges {
+		if r.start > addr {
+			break
+		}
+		if addr < r.end {
+			owner = r.owner // the last (innermost) range wins
+		}
+	}
+	return owner
+}
+
+// Lookup returns the closest symbol at or before addr in the same kext and the offset of addr from it
+func (s *Symbolicator) Lookup(addr uint64) (string, uint64, bool) {
+	i := sort.Search(len(s.addrs), func(i int) bool { return s.addrs[i] > addr })
+	if i == 0 {
+		return "", 0, false
+	}
+	sym := s.addrs[i-1]
+	if s.Owner(sym) != s.Owner(addr) {
+		return "", 0, false
+	}
+	return s.Symbols[sym], addr - sym, true
+}
+
+// Symbolicate returns addr as 'symbol + offset'
+func (s *Symbolicator) Symbolicate(addr uint64) string {
+	name, off, ok := s.Lookup(addr)
+	if !ok {
+		return ""
+	}
+	if off == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s + %d", name, off)
+}
+
+// functionSignature returns the function's instructions with the address dependent bits
+// (page addresses, branch targets and literal offsets) masked out
+func functionSignature(data []byte) string {
+	count := len(data) / 4
+	if count < minSignatureInstrs {
+		return ""
+	}
+	if count > maxSignatureInstrs {
+		count = maxSignatureInstrs
+	}
+	sig := make([]byte, count*4)
+	for i := 0; i < count; i++ {
+		ins := binary.LittleEndian.Uint32(data[i*4:])
+		switch {
+		case ins&0x1f000000 == 0x10000000: // adr/adrp
+			ins &= 0x9f00001f
+		case ins&0x7c000000 == 0x14000000: // b/bl
+			ins &= 0xfc000000
+		case ins&0x3b000000 == 0x18000000: // ldr (literal)
+			ins &= 0xff00001f
+		case ins&0xff800000 == 0x91000000: // add x (immediate) used with adrp
+			ins &= 0xffc003ff
+		case ins&0xffc00000 == 0xf9400000: // ldr x (unsigned offset) used with adrp
+			ins &= 0xffc003ff
+		}
+		binary.LittleEndian.PutUint32(sig[i*4:], ins)
+	}
+	return string(sig)
+}
+
+type sigFunc struct {
+	types.Function
+	sig string
+}
+
+func readFunctionSignatures(m *macho.File, funcs []types.Function) []sigFunc {
+	var out []sigFunc
+	for _, fn := range funcs {
+		sf := sigFunc{Function: fn}
+		size := fn.EndAddr - fn.StartAddr
+		if size > maxSignatureInstrs*4 {
+			size = maxSignatureInstrs * 4
+		}
+		if off, err := m.GetOffset(fn.StartAddr); err == nil && size > 0 {
+			data := make([]byte, size)
+			if _, err := m.ReadAt(data, int64(off)); err == nil {
+				sf.sig = functionSignature(data)
+			}
+		}
+		out = append(out, sf)
+	}
+	return out
+}
+
+// matchKDKSymbols names the kernel's functions by matching them to the functions of a KDK kernel.
+// Functions with a unique byte signature in both kernels are matched first and then the matches are
+// extended to the neighbouring functions with the same size (as the function order is the same)
+func matchKDKSymbols(m, kernel, kdk *macho.File, syms map[uint64]string) (int, error) {
+	kdkSyms := make(map[uint64]string)
+	if kdk.Symtab == nil {
+		return 0, fmt.Errorf("KDK kernel has no symbols")
+	}
+	for _, sym := range kdk.Symtab.Syms {
+		if sym.Type&types.N_STAB == 0 && sym.Type&types.N_TYPE == types.N_SECT && len(sym.Name) > 0 {
+			kdkSyms[sym.Value] = sym.Name
+		}
+	}
+
+	kdkFuncs := kdk.GetFunctions()
+	relFuncs := kernel.GetFunctions()
+	if len(kdkFuncs) == 0 || len(relFuncs) == 0 {
+		return 0, fmt.Errorf("both kernels must have LC_FUNCTION_STARTS")
+	}
+
+	matches := make(map[int]int) // kdk function index -> release function index
+
+	if ku, ru := kdk.UUID(), kernel.UUID(); ku != nil && ru != nil && ku.String() == ru.String() && len(kdkFuncs) == len(relFuncs) {
+		for i := range kdkFuncs {
+			matches[i] = i
+		}
+	} else {
+		kdkSigs := readFunctionSignatures(kdk, kdkFuncs)
+		relSigs := readFunctionSignatures(m, relFuncs)
+
+		kdkBySig := make(map[string][]int)
+		for i, fn := range kdkSigs {
+			if len(fn.sig) > 0 {
+				kdkBySig[fn.sig] = append(kdkBySig[fn.sig], i)
+			}
+		}
+		relBySig := make(map[string][]int)
+		for i, fn := range relSigs {
+			if len(fn.sig) > 0 {
+				relBySig[fn.sig] = append(relBySig[fn.sig], i)
+			}
+		}
+		for sig, ki := range kdkBySig {
+			if ri := relBySig[sig]; len(ki) == 1 && len(ri) == 1 {
+				matches[ki[0]] = ri[0]
+			}
+		}
+
+		// extend the matches to their neighbours
+		matched := make(map[int]bool)
+		var anchors []int
+		for ki, ri := range matches {
+			matched[ri] = true
+			anchors = append(anchors, ki)
+		}
+		sort.Ints(anchors)
+		size := func(fn types.Function) uint64 { return fn.EndAddr - fn.StartAddr }
+		for _, ki := range anchors {
+			ri := matches[ki]
+			for _, dir := range []int{-1, 1} {
+				for k, r := ki+dir, ri+dir; k >= 0 && r >= 0 && k < len(kdkFuncs) && r < len(relFuncs); k, r = k+dir, r+dir {
+					if _, ok := matches[k]; ok || matched[r] || size(kdkFuncs[k]) != size(relFuncs[r]) {
+						break
+					}
+					matches[k] = r
+					matched[r] = true
+				}
+			}
+		}
+	}
+
+	count := 0
+	for ki, ri := range matches {
+		name, ok := kdkSyms[kdkFuncs[ki].StartAddr]
+		if !ok {
+			continue
+		}
+		if _, ok := syms[relFuncs[ri].StartAddr]; !ok {
+			syms[relFuncs[ri].StartAddr] = name
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,277 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/blacktop/go-macho"
+)
+
+const machTrapTableCount = 128
+
+// sysent return types
+var sysentReturnTypes = []string{"none", "int", "uint", "off_t", "addr_t", "size_t", "ssize_t", "uint64_t"}
+
+// Sysent is a BSD syscall table entry
+type Sysent struct {
+	Number      int    `json:"number"`
+	Name        string `json:"name,omitempty"`
+	Call        uint64 `json:"call"`
+	ReturnType  int32  `json:"return_type"`
+	NumArgs     int16  `json:"num_args"`
+	ArgBytes    uint16 `json:"arg_bytes"`
+	Implemented bool   `json:"implemented"`
+}
+
+// ReturnTypeString returns the name of the syscall's return type
+func (s Sysent) ReturnTypeString() string {
+	if int(s.ReturnType) < len(sysentReturnTypes) {
+		return sysentReturnTypes[s.ReturnType]
+	}
+	return fmt.Sprintf("%d", s.ReturnType)
+}
+
+func (s Sysent) String() string {
+	return fmt.Sprintf("%3d: %-32s call=%#x ret=%-8s nargs=%d arg_bytes=%d", s.Number, s.Name, s.Call, s.ReturnTypeString(), s.NumArgs, s.ArgBytes)
+}
+
+// MachTrap is a mach_trap_table entry
+type MachTrap struct {
+	Number      int    `json:"number"`
+	Name        string `json:"name,omitempty"`
+	NumArgs     uint8  `json:"num_args"`
+	U32Words    uint8  `json:"u32_words"`
+	ReturnsPort bool   `json:"returns_port"`
+	Function    uint64 `json:"function"`
+	Munge       uint64 `json:"munge,omitempty"`
+	Implemented bool   `json:"implemented"`
+}
+
+func (t MachTrap) String() string {
+	return fmt.Sprintf("%3d: %-48s func=%#x nargs=%d", t.Number, t.Name, t.Function, t.NumArgs)
+}
+
+func getKernelConstData(m *macho.File) (uint64, []byte, error) {
+	kernel, err := getKernelMachO(m)
+	if err != nil {
+		return 0, nil, err
+	}
+	sec := kernel.Section("__DATA_CONST", "__const")
+	if sec == nil {
+		sec = kernel.Section("__CONST", "__constdata")
+	}
+	if sec == nil {
+		return 0, nil, fmt.Errorf("kernel __DATA_CONST.__const section not found")
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return 0, nil, err
+	}
+	return sec.Addr, data, nil
+}
+
+type sysent64 struct {
+	Call       uint64
+	ReturnType int32
+	NumArgs    int16
+	ArgBytes   uint16
+}
+
+// known (return type, nargs, arg bytes) of syscalls 1-4: exit, fork, read and write
+var sysentSignature = []sysent64{
+	{ReturnType: 0, NumArgs: 1, ArgBytes: 4},
+	{ReturnType: 1, NumArgs: 0, ArgBytes: 0},
+	{ReturnType: 6, NumArgs: 3, ArgBytes: 12},
+	{ReturnType: 6, NumArgs: 3, ArgBytes: 12},
+}
+
+func validSysent(s sysent64) bool {
+	return s.Call != 0 && s.ReturnType >= 0 && int(s.ReturnType) < len(sysentReturnTypes) &&
+		s.NumArgs >= 0 && s.NumArgs <= 16 && int(s.ArgBytes) <= 8*int(s.NumArgs)
+}
+
+// GetSyscallTable recovers the BSD syscall table (sysent) from the kernel's const data
+func GetSyscallTable(m *macho.File) ([]Sysent, error) {
+	_, data, err := getKernelConstData(m)
+	if err != nil {
+		return nil, err
+	}
+
+	const stride = 16 // arm64 sysent has no 32-bit munger
+
+	read := func(off int) sysent64 {
+		var s sysent64
+		binary.Read(bytes.NewReader(data[off:off+stride]), binary.LittleEndian, &s)
+		return s
+	}
+
+	start := -1
+	for off := 0; off+stride*(len(sysentSignature)+1) <= len(data); off += 8 {
+		// syscall 0 is nosys
+		if s := read(off); !validSysent(s) || s.ReturnType != 1 || s.NumArgs != 0 {
+			continue
+		}
+		match := true
+		for i, sig := range sysentSignature {
+			s := read(off + stride*(i+1))
+			if s.Call == 0 || s.ReturnType != sig.ReturnType || s.NumArgs != sig.NumArgs || s.ArgBytes != sig.ArgBytes {
+				match = false
+				break
+			}
+		}
+		if match {
+			start = off
+			break
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("failed to find sysent table")
+	}
+
+	var syscalls []Sysent
+	nosys := resolvePtr(m, read(start).Call)
+	for off, num := start, 0; off+stride <= len(data); off, num = off+stride, num+1 {
+		s := read(off)
+		if !validSysent(s) {
+			break
+		}
+		call := resolvePtr(m, s.Call)
+		syscalls = append(syscalls, Sysent{
+			Number:      num,
+			Name:        bsdSyscallNames[num],
+			Call:        call,
+			ReturnType:  s.ReturnType,
+			NumArgs:     s.NumArgs,
+			ArgBytes:    s.ArgBytes,
+			Implemented: num == 0 || call != nosys,
+		})
+	}
+
+	return syscalls, nil
+}
+
+// machTrap64 is an arm64 mach_trap_t (Munge is only there with CONFIG_REQUIRES_U32_MUNGING)
+type machTrap64 struct {
+	ArgCount    uint8
+	U32Words    uint8
+	ReturnsPort uint8
+	_           [5]uint8
+	Function    uint64
+	Munge       uint64
+}
+
+// mach_trap_t strides without and with the 32-bit munger
+var machTrapStrides = []int{16, 24}
+
+func readMachTrap(data []byte, off, stride int) machTrap64 {
+	t := machTrap64{
+		ArgCount:    data[off],
+		U32Words:    data[off+1],
+		ReturnsPort: data[off+2],
+		Function:    binary.LittleEndian.Uint64(data[off+8:]),
+	}
+	if stride > 16 {
+		t.Munge = binary.LittleEndian.Uint64(data[off+16:])
+	}
+	return t
+}
+
+// findMachTrapTable returns the offset and stride of the mach_trap_table in data.
+// Traps 0-9 are all kern_invalid (with no args) and trap 10 is _kernelrpc_mach_vm_allocate_trap (with 4 args)
+func findMachTrapTable(data []byte) (int, int, error) {
+	for _, stride := range machTrapStrides {
+		for off := 0; off+stride*machTrapTableCount <= len(data); off += 8 {
+			first := readMachTrap(data, off, stride)
+			if first.Function == 0 || first.ArgCount != 0 || first.U32Words != 0 {
+				continue
+			}
+			match := true
+			for i := 1; i < 10; i++ {
+				if t := readMachTrap(data, off+stride*i, stride); t.Function != first.Function || t.ArgCount != 0 || t.U32Words != 0 {
+					match = false
+					break
+				}
+			}
+			if !match {
+				continue
+			}
+			if t := readMachTrap(data, off+stride*10, stride); t.Function != 0 && t.Function != first.Function && t.ArgCount == 4 {
+				return off, stride, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("failed to find mach_trap_table")
+}
+
+// GetMachTrapTable recovers the mach_trap_table from the kernel's const data
+func GetMachTrapTable(m *macho.File) ([]MachTrap, error) {
+	_, data, err := getKernelConstData(m)
+	if err != nil {
+		return nil, err
+	}
+
+	start, stride, err := findMachTrapTable(data)
+	if err != nil {
+		return nil, err
+	}
+
+	names := getMachTrapNames(m, data)
+
+	var traps []MachTrap
+	kernInvalid := resolvePtr(m, readMachTrap(data, start, stride).Function)
+	for i := 0; i < machTrapTableCount; i++ {
+		t := readMachTrap(data, start+stride*i, stride)
+		trap := MachTrap{
+			Number:      i,
+			NumArgs:     t.ArgCount,
+			U32Words:    t.U32Words,
+			ReturnsPort: t.ReturnsPort != 0,
+			Function:    resolvePtr(m, t.Function),
+		}
+		if t.Munge != 0 {
+			trap.Munge = resolvePtr(m, t.Munge)
+		}
+		trap.Implemented = trap.Function != kernInvalid
+		if i < len(names) {
+			trap.Name = names[i]
+		}
+		traps = append(traps, trap)
+	}
+
+	return traps, nil
+}
+
+// getMachTrapNames reads the mach_syscall_name_table by finding the pointer to trap 10's name
+func getMachTrapNames(m *macho.File, data []byte) []string {
+	kernel, err := getKernelMachO(m)
+	if err != nil {
+		return nil
+	}
+	anchor, err := findCStringVMaddr(kernel, "_kernelrpc_mach_vm_allocate_trap")
+	if err != nil {
+		return nil
+	}
+
+	ptrs := make([]uint64, len(data)/8)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &ptrs)
+
+	for idx, ptr := range ptrs {
+		if idx < 10 || idx-10+machTrapTableCount > len(ptrs) || resolvePtr(m, ptr) != anchor {
+			continue
+		}
+		var names []string
+		for _, p := range ptrs[idx-10 : idx-10+machTrapTableCount] {
+			name, err := m.GetCString(resolvePtr(m, p))
+			if err != nil {
+				name = ""
+			}
+			names = append(names, name)
+		}
+		if names[0] == "kern_invalid" {
+			return names
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+const (
+	testKernInvalid = 0xfffffff007b01000
+	testVMAllocate  = 0xfffffff007b02000
+)
+
+// machTrapTable builds a synthetic arm64 mach_trap_table preceded by pad bytes of other const data
+func machTrapTable(pad, stride int) []byte {
+	data := make([]byte, pad+stride*machTrapTableCount+64)
+	for i := 0; i < pad; i += 8 {
+		binary.LittleEndian.PutUint64(data[i:], 0x4141414141414141)
+	}
+	for i := 0; i < machTrapTableCount; i++ {
+		off := pad + stride*i
+		fn, args, words := uint64(testKernInvalid), byte(0), byte(0)
+		if i == 10 {
+			fn, args, words = testVMAllocate, 4, 5
+		} else if i > 10 {
+			fn, args, words = testVMAllocate+uint64(i)*0x100, 2, 2
+		}
+		data[off] = args
+		data[off+1] = words
+		binary.LittleEndian.PutUint64(data[off+8:], fn)
+		if stride > 16 && args > 0 {
+			binary.LittleEndian.PutUint64(data[off+16:], 0xfffffff007c00000) // munge_wwlw
+		}
+	}
+	return data
+}
+
+func TestFindMachTrapTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		pad    int
+		stride int
+	}{
+		{"arm64", 0, 16},
+		{"arm64 with leading data", 0x48, 16},
+		{"u32 munging", 0x30, 24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := machTrapTable(tt.pad, tt.stride)
+			off, stride, err := findMachTrapTable(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if off != tt.pad || stride != tt.stride {
+				t.Fatalf("found table at %#x (stride %d), want %#x (stride %d)", off, stride, tt.pad, tt.stride)
+			}
+			trap := readMachTrap(data, off+stride*10, stride)
+			if trap.Function != testVMAllocate || trap.ArgCount != 4 || trap.U32Words != 5 {
+				t.Fatalf("trap 10 = %+v", trap)
+			}
+			if trap := readMachTrap(data, off, stride); trap.Function != testKernInvalid || trap.Munge != 0 {
+				t.Fatalf("trap 0 = %+v", trap)
+			}
+		})
+	}
+}
+
+func TestFindMachTrapTableNotFound(t *testing.T) {
+	data := machTrapTable(0, 16)
+	// break the kern_invalid run
+	binary.LittleEndian.PutUint64(data[16*5+8:], testVMAllocate)
+	if _, _, err := findMachTrapTable(data); err == nil {
+		t.Fatal("expected no mach_trap_table to be found")
+	}
+}
@@ -0,0 +1,185 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+// sysctl oid kinds
+const (
+	ctlTypeMask   = 0xf
+	ctlTypeNode   = 1
+	ctlTypeInt    = 2
+	ctlTypeString = 3
+	ctlTypeQuad   = 4
+	ctlTypeOpaque = 5
+	ctlFlagRD     = 0x80000000
+	ctlFlagWR     = 0x40000000
+)
+
+type sysctlOID struct {
+	Parent  uint64
+	Link    uint64
+	Number  int32
+	Kind    uint32
+	Arg1    uint64
+	Arg2    int32
+	_       uint32
+	Name    uint64
+	Handler uint64
+	Fmt     uint64
+	Descr   uint64
+	Version int32
+	Refcnt  int32
+}
+
+// Sysctl is a sysctl registered in the kernelcache's __sysctl_set sections
+type Sysctl struct {
+	Name        string `json:"name"`
+	Number      int32  `json:"number"`
+	Kind        uint32 `json:"kind"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	Kext        string `json:"kext"`
+}
+
+// Type returns the sysctl's CTLTYPE
+func (s Sysctl) Type() string {
+	switch s.Kind & ctlTypeMask {
+	case ctlTypeNode:
+		return "node"
+	case ctlTypeInt:
+		return "int"
+	case ctlTypeString:
+		return "string"
+	case ctlTypeQuad:
+		return "quad"
+	case ctlTypeOpaque:
+		return "opaque"
+	}
+	return fmt.Sprintf("type(%d)", s.Kind&ctlTypeMask)
+}
+
+// Access returns the sysctl's read/write access
+func (s Sysctl) Access() string {
+	var access string
+	if s.Kind&ctlFlagRD != 0 {
+		access += "r"
+	}
+	if s.Kind&ctlFlagWR != 0 {
+		access += "w"
+	}
+	return access
+}
+
+func (s Sysctl) String() string {
+	return fmt.Sprintf("%-48s %-6s %-2s %s", s.Name, s.Type(), s.Access(), s.Description)
+}
+
+// openKextMachO returns the MachO of a kext (the kernelcache itself for the kernel of a legacy kernelcache)
+func openKextMachO(m *macho.File, k Kext) (*macho.File, error) {
+	if m.FileTOC.FileHeader.Type != types.FileSet && k.ID == KernelID {
+		return m, nil
+	}
+	return OpenKext(m, k)
+}
+
+// closeKextMachO closes a MachO returned by openKextMachO (unless it is the kernelcache itself)
+func closeKextMachO(m, km *macho.File) {
+	if km != m {
+		km.Close()
+	}
+}
+
+// GetSysctls returns all the sysctls registered by the kernel and its kexts
+func GetSysctls(m *macho.File) ([]Sysctl, error) {
+	kexts, err := GetKexts(m)
+	if err != nil {
+		return nil, err
+	}
+
+	type oid struct {
+		sysctlOID
+		name string
+		kext string
+	}
+	var oids []oid
+	children := make(map[uint64]int) // child list vmaddr -> node oid index
+
+	for _, k := range kexts {
+		km, err := openKextMachO(m, k)
+		if err != nil {
+			log.Debugf("failed to parse %s: %v", k.ID, err)
+			continue
+		}
+		for _, sec := range km.Sections {
+			if sec.Name != "__sysctl_set" {
+				continue
+			}
+			data, err := sec.Data()
+			if err != nil {
+				closeKextMachO(m, km)
+				return nil, fmt.Errorf("failed to read %s %s.%s: %v", k.ID, sec.Seg, sec.Name, err)
+			}
+			ptrs := make([]uint64, len(data)/8)
+			binary.Read(bytes.NewReader(data), binary.LittleEndian, &ptrs)
+			for _, ptr := range ptrs {
+				off, err := m.GetOffset(resolvePtr(m, ptr))
+				if err != nil {
+					continue
+				}
+				var o oid
+				buf := make([]byte, binary.Size(o.sysctlOID))
+				if _, err := m.ReadAt(buf, int64(off)); err != nil {
+					continue
+				}
+				if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &o.sysctlOID); err != nil {
+					continue
+				}
+				o.name, _ = m.GetCString(resolvePtr(m, o.Name))
+				o.kext = k.ID
+				if o.Kind&ctlTypeMask == ctlTypeNode && o.Arg1 != 0 {
+					children[resolvePtr(m, o.Arg1)] = len(oids)
+				}
+				oids = append(oids, o)
+			}
+		}
+		closeKextMachO(m, km)
+	}
+
+	var sysctls []Sysctl
+	for _, o := range oids {
+		parts := []string{o.name}
+		parent := resolvePtr(m, o.Parent)
+		for depth := 0; depth < 16; depth++ {
+			idx, ok := children[parent]
+			if !ok {
+				break
+			}
+			parts = append([]string{oids[idx].name}, parts...)
+			parent = resolvePtr(m, oids[idx].Parent)
+		}
+		s := Sysctl{
+			Name:   strings.Join(parts, "."),
+			Number: o.Number,
+			Kind:   o.Kind,
+			Kext:   o.kext,
+		}
+		s.Format, _ = m.GetCString(resolvePtr(m, o.Fmt))
+		s.Description, _ = m.GetCString(resolvePtr(m, o.Descr))
+		sysctls = append(sysctls, s)
+	}
+
+	sort.Slice(sysctls, func(i, j int) bool {
+		return sysctls[i].Name < sysctls[j].Name
+	})
+
+	return sysctls, nil
+}
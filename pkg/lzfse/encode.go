@@ -0,0 +1,511 @@
+package lzfse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	// Largest L, M and D values that can be encoded
+	LZFSE_ENCODE_MAX_L_VALUE = 315
+	LZFSE_ENCODE_MAX_M_VALUE = 2359
+	LZFSE_ENCODE_MAX_D_VALUE = 262139
+
+	lzfseEncodeMinMatch   = 4
+	lzfseEncodeChainDepth = 16
+	// history window (must be larger than LZFSE_ENCODE_MAX_D_VALUE)
+	lzfseEncodeWindowBits = 18
+	lzfseEncodeWindowMask = (1 << lzfseEncodeWindowBits) - 1
+)
+
+// fseEncoderEntry entry for one symbol in the encoder table (64b).
+type fseEncoderEntry struct {
+	s0     int16 // First state requiring a K-bit shift
+	k      int16 // States S >= S0 are shifted K bits. States S < S0 are shifted K-1 bits
+	delta0 int16 // Relative increment used to compute next state if S >= S0
+	delta1 int16 // Relative increment used to compute next state if S < S0
+}
+
+// fseOutStream object representing an output stream.
+type fseOutStream struct {
+	Accum      uint64      // Output bits
+	AccumNbits fseBitCount // Number of valid bits in ACCUM, other bits are 0
+}
+
+// fseOutPush - push n bits to the fse stream object.
+func fseOutPush(s *fseOutStream, n fseBitCount, b uint64) {
+	s.Accum |= b << s.AccumNbits
+	s.AccumNbits += n
+}
+
+// fseOutFlush - write the full bytes of the accumulator to the buffer.
+func fseOutFlush(s *fseOutStream, buf *bytes.Buffer) {
+	nbits := s.AccumNbits & -8 // number of bits written, multiple of 8
+	for i := fseBitCount(0); i < nbits; i += 8 {
+		buf.WriteByte(byte(s.Accum >> i))
+	}
+	s.Accum >>= nbits
+	s.AccumNbits -= nbits
+}
+
+// fseOutFinish - write the remaining bits of the accumulator to the buffer (ACCUM_NBITS is left in [-7, 0]).
+func fseOutFinish(s *fseOutStream, buf *bytes.Buffer) {
+	nbits := (s.AccumNbits + 7) & -8 // number of bits written, multiple of 8
+	for i := fseBitCount(0); i < nbits; i += 8 {
+		buf.WriteByte(byte(s.Accum >> i))
+	}
+	s.Accum = 0
+	s.AccumNbits -= nbits
+}
+
+// fseInitEncoderTable initialize encoder table T[NSYMBOLS]. NSTATES = sum FREQ[i] is the number of states (a power of 2).
+func fseInitEncoderTable(nstates int, freq []uint16, t []fseEncoderEntry) {
+	offset := 0 // current offset
+	nClz := bits.LeadingZeros32(uint32(nstates))
+	for i, fr := range freq {
+		f := int(fr)
+		if f == 0 {
+			continue // skip this symbol, no occurrences
+		}
+		k := bits.LeadingZeros32(uint32(f)) - nClz // shift needed to ensure N <= (F<<K) < 2*N
+		t[i].s0 = int16((f << k) - nstates)
+		t[i].k = int16(k)
+		t[i].delta0 = int16(offset - f + (nstates >> k))
+		if k > 0 {
+			t[i].delta1 = int16(offset - f + (nstates >> (k - 1)))
+		}
+		offset += f
+	}
+}
+
+// fseEncode - encode SYMBOL using the encoder table, and update *pstate, out.
+func fseEncode(pstate *fseState, t []fseEncoderEntry, out *fseOutStream, symbol int) {
+	s := int(*pstate)
+	e := t[symbol]
+
+	// Number of bits to write
+	nbits := fseBitCount(e.k - 1)
+	delta := int(e.delta1)
+	if s >= int(e.s0) {
+		nbits = fseBitCount(e.k)
+		delta = int(e.delta0)
+	}
+
+	// Write lower NBITS of state
+	fseOutPush(out, nbits, fseMaskLsb64(uint64(s), nbits))
+
+	// Update state with remaining bits and delta
+	*pstate = fseState(delta + (s >> uint(nbits)))
+}
+
+// fseAdjustFreqs removes OVERRUN states from the normalized frequencies (keeping every used symbol)
+func fseAdjustFreqs(freq []uint16, overrun int) {
+	for shift := uint(3); overrun != 0; shift-- {
+		for sym := range freq {
+			if freq[sym] > 1 {
+				n := int(freq[sym]-1) >> shift
+				if n > overrun {
+					n = overrun
+				}
+				freq[sym] -= uint16(n)
+				overrun -= n
+				if overrun == 0 {
+					break
+				}
+			}
+		}
+	}
+}
+
+// fseNormalizeFreq normalize a table T[NSYMBOLS] of occurrences to FREQ[NSYMBOLS] so that sum FREQ[i] = NSTATES.
+func fseNormalizeFreq(nstates int, t []uint32, freq []uint16) {
+	var sCount uint32
+	var highprecStep uint32
+	remaining := nstates // must be signed; this may become < 0
+	maxFreq := 0
+	maxFreqSym := 0
+	shift := uint(bits.LeadingZeros32(uint32(nstates)) - 1)
+
+	// Compute the total number of symbol occurrences
+	for _, c := range t {
+		sCount += c
+	}
+
+	if sCount != 0 {
+		highprecStep = (1 << 31) / sCount
+	}
+
+	for i, c := range t {
+		// Rescale the occurrence count to get the normalized frequency.
+		// Round up if the fractional part is >= 0.5; otherwise round down.
+		f := int((((c * highprecStep) >> shift) + 1) >> 1)
+
+		// If a symbol was used, it must be given a nonzero normalized frequency.
+		if f == 0 && c != 0 {
+			f = 1
+		}
+
+		freq[i] = uint16(f)
+		remaining -= f
+
+		// Remember the maximum frequency and which symbol had it.
+		if f > maxFreq {
+			maxFreq = f
+			maxFreqSym = i
+		}
+	}
+
+	// If there remain states to be assigned, then just assign them to the most frequent symbol.
+	// Alternatively, if we assigned more states than were actually available, then either remove
+	// states from the most frequent symbol (for minor overruns) or use the slow adjustment
+	// algorithm (for the rare cases of a major overrun).
+	if -remaining < (maxFreq >> 2) {
+		freq[maxFreqSym] = uint16(int(freq[maxFreqSym]) + remaining)
+	} else {
+		fseAdjustFreqs(freq, -remaining)
+	}
+}
+
+// encodeV1FreqValue encode an entry value in the (fixed Huffman) freq table encoding.
+// Return bits, and nbits, the number of bits to write (starting with LSB).
+func encodeV1FreqValue(value int) (uint32, int) {
+	switch value {
+	case 0:
+		return 0, 2 //    0.0
+	case 1:
+		return 2, 2 //    1.0
+	case 2:
+		return 1, 3 //   0.01
+	case 3:
+		return 5, 3 //   1.01
+	case 4:
+		return 3, 5 // 00.011
+	case 5:
+		return 11, 5 // 01.011
+	case 6:
+		return 19, 5 // 10.011
+	case 7:
+		return 27, 5 // 11.011
+	}
+	if value < 24 {
+		return 7 + (uint32(value-8) << 4), 8 // xxxx.0111
+	}
+	// 24..1047
+	return (uint32(value-24) << 4) + 15, 14 // xxxxxxxxxx.1111
+}
+
+// valueSymbol returns the symbol whose base value range contains value
+func valueSymbol(value int32, base []int32) int {
+	for sym := len(base) - 1; sym > 0; sym-- {
+		if base[sym] <= value {
+			return sym
+		}
+	}
+	return 0
+}
+
+type lmdTriplet struct {
+	L int32 // literal length
+	M int32 // match length
+	D int32 // match distance
+}
+
+// Encoder lzfse_encoder_state object
+type Encoder struct {
+	src []byte
+	dst bytes.Buffer
+
+	// match search history
+	head []int32
+	prev []int32
+
+	// pending block
+	literals []byte
+	lmds     []lmdTriplet
+	nRaw     uint32
+}
+
+// NewEncoder creates a new lzfse encoder
+func NewEncoder(data []byte) *Encoder {
+	var dst bytes.Buffer
+	dst.Grow(len(data) / 2)
+	return &Encoder{
+		src:  data,
+		dst:  dst,
+		head: make([]int32, LZFSE_ENCODE_HASH_VALUES),
+		prev: make([]int32, lzfseEncodeWindowMask+1),
+	}
+}
+
+// EncodeBuffer compresses a buffer using LZFSE.
+func (e *Encoder) EncodeBuffer() ([]byte, error) {
+	src := e.src
+
+	pos := 0
+	litStart := 0
+	for pos+lzfseEncodeMinMatch <= len(src) {
+		m, d := e.findMatch(pos)
+		if m < lzfseEncodeMinMatch {
+			e.insert(pos)
+			pos++
+			continue
+		}
+		e.pushMatch(src[litStart:pos], m, d)
+		for end := pos + m; pos < end; pos++ {
+			e.insert(pos)
+		}
+		litStart = pos
+	}
+	if litStart < len(src) {
+		e.pushMatch(src[litStart:], 0, 0)
+	}
+	e.encodeBlock()
+
+	binary.Write(&e.dst, binary.LittleEndian, LZFSE_ENDOFSTREAM_BLOCK_MAGIC)
+
+	return e.dst.Bytes(), nil
+}
+
+func (e *Encoder) hash(pos int) uint32 {
+	return (binary.LittleEndian.Uint32(e.src[pos:]) * 2654435761) >> (32 - LZFSE_ENCODE_HASH_BITS)
+}
+
+func (e *Encoder) insert(pos int) {
+	if pos+4 > len(e.src) {
+		return
+	}
+	h := e.hash(pos)
+	e.prev[pos&lzfseEncodeWindowMask] = e.head[h]
+	e.head[h] = int32(pos + 1)
+}
+
+// findMatch returns the longest match (length and distance) for the bytes at pos in the history
+func (e *Encoder) findMatch(pos int) (int, int) {
+	src := e.src
+	maxLen := len(src) - pos
+	if maxLen > LZFSE_ENCODE_MAX_M_VALUE {
+		maxLen = LZFSE_ENCODE_MAX_M_VALUE
+	}
+
+	bestLen, bestDist := 0, 0
+	cand := int(e.head[e.hash(pos)]) - 1
+	for depth := 0; cand >= 0 && depth < lzfseEncodeChainDepth; depth++ {
+		dist := pos - cand
+		if dist > LZFSE_ENCODE_MAX_D_VALUE {
+			break
+		}
+		if src[cand+bestLen] == src[pos+bestLen] {
+			n := 0
+			for n < maxLen && src[cand+n] == src[pos+n] {
+				n++
+			}
+			if n > bestLen {
+				bestLen, bestDist = n, dist
+				if n >= LZFSE_ENCODE_GOOD_MATCH || n == maxLen {
+					break
+				}
+			}
+		}
+		next := int(e.prev[cand&lzfseEncodeWindowMask]) - 1
+		if next >= cand { // overwritten by a newer position
+			break
+		}
+		cand = next
+	}
+
+	return bestLen, bestDist
+}
+
+// pushMatch adds the literals followed by a match of length M at distance D to the pending block
+// (splitting them if they don't fit in the L and M values)
+func (e *Encoder) pushMatch(literals []byte, M, D int) {
+	for len(literals) > LZFSE_ENCODE_MAX_L_VALUE {
+		e.pushLMD(literals[:LZFSE_ENCODE_MAX_L_VALUE], 0, 1)
+		literals = literals[LZFSE_ENCODE_MAX_L_VALUE:]
+	}
+	for M > LZFSE_ENCODE_MAX_M_VALUE {
+		e.pushLMD(literals, LZFSE_ENCODE_MAX_M_VALUE, D)
+		literals = nil
+		M -= LZFSE_ENCODE_MAX_M_VALUE
+	}
+	if M == 0 {
+		D = 1 // D must always be valid
+	}
+	e.pushLMD(literals, M, D)
+}
+
+func (e *Encoder) pushLMD(literals []byte, M, D int) {
+	if len(e.lmds) == LZFSE_MATCHES_PER_BLOCK || len(e.literals)+len(literals) > LZFSE_LITERALS_PER_BLOCK-4 {
+		e.encodeBlock()
+	}
+	e.literals = append(e.literals, literals...)
+	e.lmds = append(e.lmds, lmdTriplet{L: int32(len(literals)), M: int32(M), D: int32(D)})
+	e.nRaw += uint32(len(literals) + M)
+}
+
+// encodeBlock encodes the pending literals and L,M,D triplets as a LZFSE_COMPRESSEDV2_BLOCK_MAGIC block
+func (e *Encoder) encodeBlock() {
+	if len(e.lmds) == 0 {
+		return
+	}
+
+	// Pad literals to a multiple of 4 (the padding values are never used)
+	literals := e.literals
+	for len(literals)%4 != 0 {
+		literals = append(literals, literals[len(literals)-1])
+	}
+
+	var header compressedBlockHeaderV1
+	header.Magic = LZFSE_COMPRESSEDV1_BLOCK_MAGIC
+	header.NRawBytes = e.nRaw
+	header.NLiterals = uint32(len(literals))
+	header.NMatches = uint32(len(e.lmds))
+
+	// Compute the symbol frequencies
+	var lCounts [LZFSE_ENCODE_L_SYMBOLS]uint32
+	var mCounts [LZFSE_ENCODE_M_SYMBOLS]uint32
+	var dCounts [LZFSE_ENCODE_D_SYMBOLS]uint32
+	var literalCounts [LZFSE_ENCODE_LITERAL_SYMBOLS]uint32
+
+	lSyms := make([]int, len(e.lmds))
+	mSyms := make([]int, len(e.lmds))
+	dSyms := make([]int, len(e.lmds))
+	for i, t := range e.lmds {
+		lSyms[i] = valueSymbol(t.L, lBaseValue[:])
+		mSyms[i] = valueSymbol(t.M, mBaseValue[:])
+		dSyms[i] = valueSymbol(t.D, dBaseValue[:])
+		lCounts[lSyms[i]]++
+		mCounts[mSyms[i]]++
+		dCounts[dSyms[i]]++
+	}
+	for _, lit := range literals {
+		literalCounts[lit]++
+	}
+
+	fseNormalizeFreq(LZFSE_ENCODE_L_STATES, lCounts[:], header.LFreq[:])
+	fseNormalizeFreq(LZFSE_ENCODE_M_STATES, mCounts[:], header.MFreq[:])
+	fseNormalizeFreq(LZFSE_ENCODE_D_STATES, dCounts[:], header.DFreq[:])
+	fseNormalizeFreq(LZFSE_ENCODE_LITERAL_STATES, literalCounts[:], header.LiteralFreq[:])
+
+	var lEncoder [LZFSE_ENCODE_L_SYMBOLS]fseEncoderEntry
+	var mEncoder [LZFSE_ENCODE_M_SYMBOLS]fseEncoderEntry
+	var dEncoder [LZFSE_ENCODE_D_SYMBOLS]fseEncoderEntry
+	var literalEncoder [LZFSE_ENCODE_LITERAL_SYMBOLS]fseEncoderEntry
+	fseInitEncoderTable(LZFSE_ENCODE_L_STATES, header.LFreq[:], lEncoder[:])
+	fseInitEncoderTable(LZFSE_ENCODE_M_STATES, header.MFreq[:], mEncoder[:])
+	fseInitEncoderTable(LZFSE_ENCODE_D_STATES, header.DFreq[:], dEncoder[:])
+	fseInitEncoderTable(LZFSE_ENCODE_LITERAL_STATES, header.LiteralFreq[:], literalEncoder[:])
+
+	// Encode literals
+	var literalPayload bytes.Buffer
+	{
+		var out fseOutStream
+		var state0, state1, state2, state3 fseState
+
+		// We encode starting from the last literal so we can decode starting from the first
+		for i := len(literals); i > 0; {
+			i -= 4
+			fseEncode(&state3, literalEncoder[:], &out, int(literals[i+3])) // 10b
+			fseEncode(&state2, literalEncoder[:], &out, int(literals[i+2])) // 10b
+			fseEncode(&state1, literalEncoder[:], &out, int(literals[i+1])) // 10b
+			fseEncode(&state0, literalEncoder[:], &out, int(literals[i+0])) // 10b
+			fseOutFlush(&out, &literalPayload)
+		}
+		fseOutFinish(&out, &literalPayload)
+
+		header.LiteralBits = out.AccumNbits // [-7, 0]
+		header.NLiteralPayloadBytes = uint32(literalPayload.Len())
+		header.LiteralState = [4]uint16{uint16(state0), uint16(state1), uint16(state2), uint16(state3)}
+	}
+
+	// Encode L,M,D
+	var lmdPayload bytes.Buffer
+	{
+		var out fseOutStream
+		var lState, mState, dState fseState
+
+		// Add 8 padding bytes to the L,M,D payload
+		lmdPayload.Write(make([]byte, 8))
+
+		// We encode starting from the last match so we can decode starting from the first
+		for i := len(e.lmds) - 1; i >= 0; i-- {
+			t := e.lmds[i]
+			// D requires 23b max
+			fseOutPush(&out, fseBitCount(dExtraBits[dSyms[i]]), uint64(t.D-dBaseValue[dSyms[i]]))
+			fseEncode(&dState, dEncoder[:], &out, dSyms[i])
+			// M requires 17b max
+			fseOutPush(&out, fseBitCount(mExtraBits[mSyms[i]]), uint64(t.M-mBaseValue[mSyms[i]]))
+			fseEncode(&mState, mEncoder[:], &out, mSyms[i])
+			// L requires 14b max
+			fseOutPush(&out, fseBitCount(lExtraBits[lSyms[i]]), uint64(t.L-lBaseValue[lSyms[i]]))
+			fseEncode(&lState, lEncoder[:], &out, lSyms[i])
+			fseOutFlush(&out, &lmdPayload)
+		}
+		fseOutFinish(&out, &lmdPayload)
+
+		header.LmdBits = out.AccumNbits // [-7, 0]
+		header.NLmdPayloadBytes = uint32(lmdPayload.Len())
+		header.LState = uint16(lState)
+		header.MState = uint16(mState)
+		header.DState = uint16(dState)
+	}
+
+	header.NPayloadBytes = header.NLiteralPayloadBytes + header.NLmdPayloadBytes
+
+	e.dst.Write(encodeV2Header(header))
+	e.dst.Write(literalPayload.Bytes())
+	e.dst.Write(lmdPayload.Bytes())
+
+	e.literals = e.literals[:0]
+	e.lmds = e.lmds[:0]
+	e.nRaw = 0
+}
+
+// encodeV2Header encode all fields of a compressedBlockHeaderV1 as a (truncated) compressedBlockHeaderV2.
+func encodeV2Header(in compressedBlockHeaderV1) []byte {
+	v0 := uint64(in.NLiterals) |
+		uint64(in.NLiteralPayloadBytes)<<20 |
+		uint64(in.NMatches)<<40 |
+		uint64(7+in.LiteralBits)<<60
+	v1 := uint64(in.LiteralState[0]) |
+		uint64(in.LiteralState[1])<<10 |
+		uint64(in.LiteralState[2])<<20 |
+		uint64(in.LiteralState[3])<<30 |
+		uint64(in.NLmdPayloadBytes)<<40 |
+		uint64(7+in.LmdBits)<<60
+	v2 := uint64(in.LState)<<32 |
+		uint64(in.MState)<<42 |
+		uint64(in.DState)<<52
+
+	// Encode the freq tables
+	var freqs []byte
+	var accum uint32
+	var accumNbits int
+	for _, table := range [][]uint16{in.LFreq[:], in.MFreq[:], in.DFreq[:], in.LiteralFreq[:]} {
+		for _, f := range table {
+			b, nbits := encodeV1FreqValue(int(f))
+			accum |= b << accumNbits
+			accumNbits += nbits
+			for accumNbits >= 8 {
+				freqs = append(freqs, byte(accum))
+				accum >>= 8
+				accumNbits -= 8
+			}
+		}
+	}
+	if accumNbits > 0 {
+		freqs = append(freqs, byte(accum))
+	}
+
+	headerSize := uint64(4 + 4 + 3*8 + len(freqs))
+	v2 |= headerSize
+
+	out := new(bytes.Buffer)
+	binary.Write(out, binary.LittleEndian, LZFSE_COMPRESSEDV2_BLOCK_MAGIC)
+	binary.Write(out, binary.LittleEndian, in.NRawBytes)
+	binary.Write(out, binary.LittleEndian, [3]uint64{v0, v1, v2})
+	out.Write(freqs)
+
+	return out.Bytes()
+}
@@ -396,6 +396,11 @@ func getFolder(zr *zip.Reader) (string, error) {
 
 // RemoteExtract extracts and decompresses remote OTA payload files
 func RemoteExtract(zr *zip.Reader, extractPattern string) error {
+	return RemoteExtractTo(zr, extractPattern, "")
+}
+
+// RemoteExtractTo extracts and decompresses remote OTA payload files into destPath
+func RemoteExtractTo(zr *zip.Reader, extractPattern, destPath string) error {
 
 	var validPayload = regexp.MustCompile(`payload.0\d+$`)
 
@@ -403,6 +408,7 @@ func RemoteExtract(zr *zip.Reader, extractPattern string) error {
 	if err != nil {
 		return err
 	}
+	folder = filepath.Join(destPath, folder)
 
 	sortFileBySize(zr.File)
 